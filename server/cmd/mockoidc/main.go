@@ -0,0 +1,45 @@
+// Command mockoidc runs a local OpenID Connect provider that signs everyone in as one identity,
+// so social login can be tried without real provider credentials. Point the server at it with
+//
+//	GOOGLE_ISSUER=http://localhost:9090 GOOGLE_CLIENT_ID=kaiyo GOOGLE_CLIENT_SECRET=secret
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9090", "address to listen on")
+	clientID := flag.String("client-id", "kaiyo", "client id the server uses")
+	clientSecret := flag.String("client-secret", "secret", "client secret the server uses")
+	subject := flag.String("sub", "100000000000000000001", "subject of the signed in identity")
+	email := flag.String("email", "traveller@example.com", "email of the signed in identity")
+	verified := flag.Bool("email-verified", true, "whether the email is reported as verified")
+	flag.Parse()
+
+	provider, err := oidctest.New("http://"+*addr, *clientID, *clientSecret)
+	if err != nil {
+		slog.Error("Could not create provider", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	provider.SetIdentity(oidctest.Identity{
+		Subject:       *subject,
+		Email:         *email,
+		EmailVerified: *verified,
+		GivenName:     "Test",
+		FamilyName:    "Traveller",
+	})
+
+	slog.Info("Mock OpenID Connect provider listening on http://"+*addr, slog.String("email", *email))
+
+	if err := http.ListenAndServe(*addr, provider); err != nil {
+		slog.Error("Mock provider stopped", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+}
@@ -15,7 +15,16 @@ import (
 	"github.com/nakul-krishnakumar/kaiyo-ai/internal/database"
 	"github.com/nakul-krishnakumar/kaiyo-ai/internal/http/auth"
 	"github.com/nakul-krishnakumar/kaiyo-ai/internal/http/chat"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/http/itineraries"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/http/jobs"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/http/me"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/http/public"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/http/templates"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/http/trips"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/mail"
 	mw "github.com/nakul-krishnakumar/kaiyo-ai/internal/middlewares"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/queue"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/realtime"
 	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
 )
 
@@ -25,9 +34,6 @@ func main() {
 	authConfig := auth.MustLoad()
 	dbConfig := database.MustLoad()
 
-	// middlewares
-	authenticate := mw.Auth(authConfig)
-
 	// database connection
 	db, err := database.New(dbConfig)
 	if err != nil {
@@ -49,14 +55,42 @@ func main() {
 	// If connected to db, initialise repositories with the database pool
 	repo := repositories.NewRepositories(db.Pool)
 
+	// session checks are shared by logout and the auth middleware so logging out takes effect at once
+	sessions := auth.NewSessionCache(repo.Session)
+
+	// middlewares
+	authenticate := mw.Auth(authConfig, sessions)
+	requireVerified := mw.RequireVerified(authConfig.UnverifiedRestrictions)
+
+	// transactional email, logged instead of sent unless MAIL_DRIVER is set
+	mailer := mail.MustLoad()
+
+	// passkeys are added under /me and used to log in under /auth
+	passkeys := auth.NewPasskeys(authConfig, repo)
+
 	// http mux constructor
 	mainMux := http.NewServeMux()
 
+	// background jobs, handlers are registered by the controllers that own them
+	jobQueue := queue.New(repo.Job)
+
+	// live updates for members viewing a trip, shared with other replicas through Postgres
+	hub := realtime.New(db.Pool)
+
+	// chat controller is shared so itinerary edits can be noted in the chat history
+	chatCtrl := chat.NewController(repo, jobQueue, hub)
+
 	apiMux := http.NewServeMux()
-	apiMux.Handle("/chats/", http.StripPrefix("/chats", chat.New())) // /api/v1/chats
+	apiMux.Handle("/chats/", http.StripPrefix("/chats", chat.New(chatCtrl)))                                   // /api/v1/chats
+	apiMux.Handle("/itineraries/", http.StripPrefix("/itineraries", itineraries.New(repo, chatCtrl, hub)))     // /api/v1/itineraries
+	apiMux.Handle("/jobs/", http.StripPrefix("/jobs", jobs.New(repo)))                                         // /api/v1/jobs
+	apiMux.Handle("/trips/", http.StripPrefix("/trips", trips.New(repo, chatCtrl, mailer, authConfig.AppURL))) // /api/v1/trips
+	apiMux.Handle("/templates/", http.StripPrefix("/templates", templates.New(repo, chatCtrl)))                // /api/v1/templates
+	apiMux.Handle("/me/", http.StripPrefix("/me", me.New(repo, sessions, mailer, passkeys)))                   // /api/v1/me
 
-	mainMux.Handle("/api/v1/", authenticate(http.StripPrefix("/api/v1", apiMux)))   // /api/v1/
-	mainMux.Handle("/auth/", http.StripPrefix("/auth", auth.New(authConfig, repo))) // /auth
+	mainMux.Handle("/api/v1/", authenticate(http.StripPrefix("/api/v1", requireVerified(apiMux))))              // /api/v1/
+	mainMux.Handle("/auth/", http.StripPrefix("/auth", auth.New(authConfig, repo, sessions, mailer, passkeys))) // /auth
+	mainMux.Handle("/public/", http.StripPrefix("/public", public.New(repo)))                                   // /public, no authentication
 
 	// default endpoint - {$} makes it very specific
 	mainMux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
@@ -77,6 +111,12 @@ func main() {
 		Handler: mw.CORS(mainMux),
 	}
 
+	// open event streams would otherwise hold up Shutdown until it times out
+	server.RegisterOnShutdown(hub.Stop)
+
+	jobQueue.Start()
+	hub.Start()
+
 	slog.Info("Server listening on http://" + addr)
 
 	//* graceful shutdown
@@ -105,5 +145,10 @@ func main() {
 		slog.Error("Error shutting down the server,", slog.String("error", err.Error()))
 	}
 
+	// running jobs get the rest of the shutdown window, unfinished ones are picked up after restart
+	if err := jobQueue.Stop(ctx); err != nil {
+		slog.Error("Jobs still running at shutdown", slog.String("error", err.Error()))
+	}
+
 	slog.Info("Server shutdown successfully")
 }
@@ -0,0 +1,46 @@
+// Package access enforces trip roles, every chat, itinerary and job belongs to the trip of its chat
+package access
+
+import (
+	"context"
+	"errors"
+
+	mw "github.com/nakul-krishnakumar/kaiyo-ai/internal/middlewares"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+var ErrForbidden = errors.New("you do not have access to this trip")
+
+// Require checks the requesting user has at least the given role in the chat's trip and returns their role
+func Require(ctx context.Context, trips repositories.TripRepository, chatID string, role string) (string, error) {
+	userID, ok := mw.UserIDFromContext(ctx)
+	if !ok {
+		return "", ErrForbidden
+	}
+
+	got, err := trips.GetRole(ctx, chatID, userID)
+	if errors.Is(err, models.ErrNotFound) {
+		return "", ErrForbidden
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if !models.RoleAllows(got, role) {
+		return got, ErrForbidden
+	}
+
+	return got, nil
+}
+
+// Join is Require for the first message of a chat, a chat nobody owns yet becomes the requesting user's trip
+func Join(ctx context.Context, trips repositories.TripRepository, chatID string, role string) (string, error) {
+	if userID, ok := mw.UserIDFromContext(ctx); ok {
+		if _, err := trips.Claim(ctx, chatID, userID); err != nil {
+			return "", err
+		}
+	}
+
+	return Require(ctx, trips, chatID, role)
+}
@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE itineraries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    chat_id VARCHAR(64) NOT NULL UNIQUE,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    current_version INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Every saved itinerary is kept as an immutable version
+CREATE TABLE itinerary_versions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    itinerary_id UUID NOT NULL REFERENCES itineraries(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    data JSONB NOT NULL,
+    source VARCHAR(20) NOT NULL,
+    message TEXT, -- the chat message that produced this version
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    CONSTRAINT itinerary_versions_unique UNIQUE (itinerary_id, version),
+    CONSTRAINT itinerary_versions_source CHECK (source IN ('assistant', 'restore'))
+);
+
+CREATE INDEX idx_itineraries_user_id ON itineraries(user_id);
+CREATE INDEX idx_itinerary_versions_itinerary_id ON itinerary_versions(itinerary_id, version DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS itinerary_versions;
+DROP TABLE IF EXISTS itineraries;
+-- +goose StatementEnd
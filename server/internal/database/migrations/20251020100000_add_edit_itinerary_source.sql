@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Direct edits save versions of their own
+ALTER TABLE itinerary_versions
+    DROP CONSTRAINT itinerary_versions_source,
+    ADD CONSTRAINT itinerary_versions_source CHECK (source IN ('assistant', 'restore', 'edit'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE itinerary_versions
+    DROP CONSTRAINT itinerary_versions_source,
+    ADD CONSTRAINT itinerary_versions_source CHECK (source IN ('assistant', 'restore'));
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Background jobs, claimed by workers with FOR UPDATE SKIP LOCKED
+CREATE TABLE jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind VARCHAR(50) NOT NULL, -- e.g. itinerary.save
+    chat_id VARCHAR(64),
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    payload JSONB NOT NULL,
+    result JSONB,
+    status VARCHAR(20) NOT NULL DEFAULT 'queued', -- queued, running, succeeded, failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 5,
+    last_error TEXT,
+    run_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(), -- when the job may next be picked up
+    locked_at TIMESTAMP WITH TIME ZONE, -- when a worker claimed it
+    finished_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_jobs_queued ON jobs(run_at) WHERE status = 'queued';
+CREATE INDEX idx_jobs_running ON jobs(locked_at) WHERE status = 'running';
+CREATE INDEX idx_jobs_chat_id ON jobs(chat_id, created_at DESC);
+
+-- Enrichment jobs save the places they found as a version
+ALTER TABLE itinerary_versions
+    DROP CONSTRAINT itinerary_versions_source,
+    ADD CONSTRAINT itinerary_versions_source CHECK (source IN ('assistant', 'restore', 'edit', 'enrichment'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE itinerary_versions
+    DROP CONSTRAINT itinerary_versions_source,
+    ADD CONSTRAINT itinerary_versions_source CHECK (source IN ('assistant', 'restore', 'edit'));
+
+DROP TABLE IF EXISTS jobs;
+-- +goose StatementEnd
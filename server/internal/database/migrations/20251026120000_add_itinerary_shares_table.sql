@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Public links to an itinerary, only a hash of the share token is stored
+CREATE TABLE itinerary_shares (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    itinerary_id UUID NOT NULL REFERENCES itineraries(id) ON DELETE CASCADE,
+    token_hash VARCHAR(128) NOT NULL UNIQUE,
+    permission VARCHAR(20) NOT NULL, -- read, duplicate
+    expires_at TIMESTAMP WITH TIME ZONE, -- NULL never expires
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_itinerary_shares_itinerary_id ON itinerary_shares(itinerary_id, created_at DESC);
+
+-- A duplicated shared itinerary starts its copy with a version of its own
+ALTER TABLE itinerary_versions
+    DROP CONSTRAINT itinerary_versions_source,
+    ADD CONSTRAINT itinerary_versions_source CHECK (source IN ('assistant', 'restore', 'edit', 'enrichment', 'duplicate'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE itinerary_versions
+    DROP CONSTRAINT itinerary_versions_source,
+    ADD CONSTRAINT itinerary_versions_source CHECK (source IN ('assistant', 'restore', 'edit', 'enrichment'));
+
+DROP TABLE IF EXISTS itinerary_shares;
+-- +goose StatementEnd
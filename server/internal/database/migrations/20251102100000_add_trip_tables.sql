@@ -0,0 +1,50 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A trip is a chat shared by its members, the first user to message a chat owns it
+CREATE TABLE trips (
+    chat_id VARCHAR(64) PRIMARY KEY,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE trip_members (
+    chat_id VARCHAR(64) NOT NULL REFERENCES trips(chat_id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL, -- owner, editor, viewer
+    invited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    PRIMARY KEY (chat_id, user_id)
+);
+
+CREATE TABLE trip_invitations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    chat_id VARCHAR(64) NOT NULL REFERENCES trips(chat_id) ON DELETE CASCADE,
+    email VARCHAR(254) NOT NULL,
+    role VARCHAR(20) NOT NULL, -- editor, viewer
+    invited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    accepted_at TIMESTAMP WITH TIME ZONE,
+    accepted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_trip_members_user_id ON trip_members(user_id);
+CREATE INDEX idx_trip_invitations_chat_id ON trip_invitations(chat_id, created_at DESC);
+CREATE INDEX idx_trip_invitations_email ON trip_invitations(LOWER(email)) WHERE accepted_at IS NULL AND revoked_at IS NULL;
+
+-- existing itineraries become trips owned by the user who saved them
+INSERT INTO trips (chat_id, created_by, created_at)
+SELECT chat_id, user_id, created_at FROM itineraries WHERE user_id IS NOT NULL;
+
+INSERT INTO trip_members (chat_id, user_id, role, created_at)
+SELECT chat_id, user_id, 'owner', created_at FROM itineraries WHERE user_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS trip_invitations;
+DROP TABLE IF EXISTS trip_members;
+DROP TABLE IF EXISTS trips;
+-- +goose StatementEnd
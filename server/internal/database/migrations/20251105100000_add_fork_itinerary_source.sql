@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A fork starts the new chat's itinerary from a copy of the original
+ALTER TABLE itinerary_versions
+    DROP CONSTRAINT itinerary_versions_source,
+    ADD CONSTRAINT itinerary_versions_source CHECK (source IN ('assistant', 'restore', 'edit', 'enrichment', 'duplicate', 'fork'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE itinerary_versions
+    DROP CONSTRAINT itinerary_versions_source,
+    ADD CONSTRAINT itinerary_versions_source CHECK (source IN ('assistant', 'restore', 'edit', 'enrichment', 'duplicate'));
+-- +goose StatementEnd
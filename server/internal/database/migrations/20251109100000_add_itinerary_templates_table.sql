@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Admins curate public templates, everyone else keeps a private library
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Reusable itineraries, the plan is stored without dates
+CREATE TABLE itinerary_templates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    title VARCHAR(120) NOT NULL,
+    destination VARCHAR(120) NOT NULL,
+    duration_days INTEGER NOT NULL,
+    pace VARCHAR(20), -- relaxed, balanced, busy
+    interests TEXT[] NOT NULL DEFAULT '{}',
+    data JSONB NOT NULL,
+    public BOOLEAN NOT NULL DEFAULT FALSE,
+    uses INTEGER NOT NULL DEFAULT 0, -- times instantiated
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_itinerary_templates_destination ON itinerary_templates(LOWER(destination));
+CREATE INDEX idx_itinerary_templates_interests ON itinerary_templates USING GIN (interests);
+CREATE INDEX idx_itinerary_templates_created_by ON itinerary_templates(created_by);
+
+-- Itineraries started from a template
+ALTER TABLE itinerary_versions
+    DROP CONSTRAINT itinerary_versions_source,
+    ADD CONSTRAINT itinerary_versions_source CHECK (source IN ('assistant', 'restore', 'edit', 'enrichment', 'duplicate', 'fork', 'template'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE itinerary_versions
+    DROP CONSTRAINT itinerary_versions_source,
+    ADD CONSTRAINT itinerary_versions_source CHECK (source IN ('assistant', 'restore', 'edit', 'enrichment', 'duplicate', 'fork'));
+
+DROP TABLE IF EXISTS itinerary_templates;
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- One travel profile per user, given to the assistant at the start of every chat
+CREATE TABLE user_preferences (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    home_city VARCHAR(120),
+    home_currency VARCHAR(3),
+    dietary_restrictions TEXT[] NOT NULL DEFAULT '{}',
+    mobility_needs VARCHAR(500),
+    pace VARCHAR(20), -- relaxed, balanced, busy
+    interests TEXT[] NOT NULL DEFAULT '{}',
+    accommodation_style VARCHAR(120),
+    language VARCHAR(50),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_preferences;
+-- +goose StatementEnd
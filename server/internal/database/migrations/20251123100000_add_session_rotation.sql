@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Every refresh rotates the session, the rotated row is kept so a reused token can be detected.
+-- All sessions descending from one login share a family, which is revoked as a whole on reuse.
+ALTER TABLE sessions
+    ADD COLUMN family_id UUID,
+    ADD COLUMN rotated_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN replaced_by UUID REFERENCES sessions(id) ON DELETE SET NULL;
+
+UPDATE sessions SET family_id = id WHERE family_id IS NULL;
+
+ALTER TABLE sessions ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX idx_session_family ON sessions(family_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_session_family;
+
+ALTER TABLE sessions
+    DROP COLUMN IF EXISTS replaced_by,
+    DROP COLUMN IF EXISTS rotated_at,
+    DROP COLUMN IF EXISTS family_id;
+-- +goose StatementEnd
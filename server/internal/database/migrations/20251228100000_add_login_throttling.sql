@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Recent failed logins per account (by email) and per client address, and any lockout they caused
+CREATE TABLE login_throttles (
+    key VARCHAR(320) PRIMARY KEY, -- account:<email> or ip:<address>
+    failures INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Audit trail of login attempts, successful or not
+CREATE TABLE login_attempts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    email VARCHAR(254) NOT NULL,
+    ip_address TEXT NOT NULL,
+    user_agent TEXT,
+    success BOOLEAN NOT NULL,
+    reason VARCHAR(30) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_login_attempts_user ON login_attempts(user_id, created_at);
+CREATE INDEX idx_login_attempts_ip ON login_attempts(ip_address, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS login_throttles;
+-- +goose StatementEnd
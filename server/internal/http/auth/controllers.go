@@ -1,17 +1,21 @@
 package auth
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/netip"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/oidc"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/webauthn"
 )
 
 func NewController(config *Config) *Controller {
@@ -47,11 +51,161 @@ func MustLoad() *Config {
 		slog.Error("could not load refresh TTL " + err.Error())
 	}
 
+	app := appURL()
+
 	return &Config{
-		AccessSecret:  accessSecret,
-		RefreshSecret: refreshSecret,
-		AccessTTL:     accessTTL,
-		RefreshTTL:    refreshTTL,
+		AccessSecret:     accessSecret,
+		RefreshSecret:    refreshSecret,
+		AccessTTL:        accessTTL,
+		RefreshTTL:       refreshTTL,
+		Google:           loadGoogle(),
+		Providers:        loadProviders(),
+		OAuthRedirectURL: os.Getenv("OAUTH_REDIRECT_URL"),
+
+		AppURL:                 app,
+		VerificationTTL:        durationOr("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+		ResetTTL:               durationOr("PASSWORD_RESET_TTL", time.Hour),
+		UnverifiedRestrictions: unverifiedRestrictions(),
+		WebAuthn:               loadWebAuthn(app),
+		TrustedProxies:         trustedProxies(),
+	}
+}
+
+// appURL is where links in emails point, the web app's origin
+func appURL() string {
+	if url := os.Getenv("APP_URL"); url != "" {
+		return strings.TrimSuffix(url, "/")
+	}
+	return "http://localhost:5173"
+}
+
+func durationOr(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Error("could not load "+key, slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	return d
+}
+
+// loadWebAuthn scopes passkeys to the app's domain. WEBAUTHN_RP_ID can widen that to a
+// parent domain and WEBAUTHN_ORIGINS lists every origin the app is served from
+func loadWebAuthn(app string) webauthn.Config {
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		u, err := url.Parse(app)
+		if err != nil || u.Hostname() == "" {
+			slog.Error("could not derive the webauthn rp id from APP_URL, set WEBAUTHN_RP_ID")
+			os.Exit(1)
+		}
+		rpID = u.Hostname()
+	}
+
+	origins := []string{app}
+	if value := os.Getenv("WEBAUTHN_ORIGINS"); value != "" {
+		origins = origins[:0]
+		for _, o := range strings.Split(value, ",") {
+			if o = strings.TrimSuffix(strings.TrimSpace(o), "/"); o != "" {
+				origins = append(origins, o)
+			}
+		}
+	}
+
+	return webauthn.Config{RPID: rpID, RPName: "Kaiyo AI", Origins: origins}
+}
+
+// trustedProxies reads TRUSTED_PROXIES, comma separated addresses and CIDR ranges of the
+// proxies in front of the server
+func trustedProxies() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, value := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(value)
+			if aerr != nil {
+				slog.Error("could not load TRUSTED_PROXIES", slog.String("error", err.Error()))
+				os.Exit(1)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+// unverifiedRestrictions lists what users who have not verified their email cannot do yet,
+// UNVERIFIED_RESTRICTIONS=none lifts them all
+func unverifiedRestrictions() []string {
+	value, ok := os.LookupEnv("UNVERIFIED_RESTRICTIONS")
+	if !ok {
+		return []string{"invite", "share", "publish"}
+	}
+
+	restrictions := []string{}
+	for _, r := range strings.Split(value, ",") {
+		if r = strings.TrimSpace(r); r != "" && r != "none" {
+			restrictions = append(restrictions, r)
+		}
+	}
+	return restrictions
+}
+
+// loadProviders reads the company identity providers from OIDC_CONFIG_PATH, if set
+func loadProviders() []oidc.Config {
+	configPath := os.Getenv("OIDC_CONFIG_PATH")
+	if configPath == "" {
+		return nil
+	}
+
+	providers, err := oidc.LoadProviders(configPath)
+	if err != nil {
+		slog.Error("could not load oidc providers", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	for _, p := range providers {
+		slog.Info("Single sign on enabled", slog.String("provider", p.Name), slog.String("issuer", p.Issuer))
+	}
+
+	return providers
+}
+
+// loadGoogle returns nil unless a Google client is configured. GOOGLE_ISSUER can point
+// at a mock provider (cmd/mockoidc) for local development
+func loadGoogle() *oidc.Config {
+	clientID := os.Getenv("GOOGLE_CLIENT_ID")
+	if clientID == "" {
+		slog.Info("Google sign in is disabled, GOOGLE_CLIENT_ID is not set")
+		return nil
+	}
+
+	redirectURL := os.Getenv("GOOGLE_REDIRECT_URL")
+	if redirectURL == "" {
+		slog.Error("could not load google redirect url, GOOGLE_REDIRECT_URL is not set")
+		os.Exit(1)
+	}
+
+	issuer := os.Getenv("GOOGLE_ISSUER")
+	if issuer == "" {
+		issuer = "https://accounts.google.com"
+	}
+
+	return &oidc.Config{
+		Name:         "google",
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+		RedirectURL:  redirectURL,
 	}
 }
 
@@ -71,8 +225,10 @@ func NewJWTCustomClaims(userID uuid.UUID, email string, TTL time.Duration) *JWTC
 	}
 }
 
-func (c *Controller) GenerateAccessToken(userID uuid.UUID, email string) (string, error) {
-	claims := NewJWTCustomClaims(userID, email, c.auth.AccessTTL)
+func (c *Controller) GenerateAccessToken(user *models.User, sessionID uuid.UUID) (string, error) {
+	claims := NewJWTCustomClaims(user.ID, user.Email, c.auth.AccessTTL)
+	claims.SessionID = sessionID
+	claims.EmailVerified = user.EmailVerified
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	ss, err := token.SignedString(c.auth.AccessSecret)
@@ -119,8 +275,3 @@ func ValidateToken(tokenStr string, secret []byte) (*JWTCustomClaims, error) {
 
 	return claims, nil
 }
-
-func HashToken(token string) string {
-	h := sha256.Sum256([]byte(token))
-	return hex.EncodeToString(h[:])
-}
@@ -0,0 +1,593 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/mail"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/webauthn"
+)
+
+// The fakes implement what the tests exercise, the embedded interfaces are nil so anything
+// else panics and shows up as a test failure
+
+type fakeUsers struct {
+	repositories.UserRepository
+
+	mu    sync.Mutex
+	users map[uuid.UUID]*models.User
+}
+
+func (f *fakeUsers) add(user *models.User) *models.User {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.users == nil {
+		f.users = make(map[uuid.UUID]*models.User)
+	}
+	if user.ID == uuid.Nil {
+		user.ID = uuid.New()
+	}
+	user.IsActive = true
+	f.users[user.ID] = user
+	return user
+}
+
+// get returns a copy of the stored user, so tests see what was saved
+func (f *fakeUsers) get(id uuid.UUID) models.User {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return *f.users[id]
+}
+
+func (f *fakeUsers) Create(ctx context.Context, user *models.User) error {
+	stored := *user
+	f.add(&stored)
+	return nil
+}
+
+func (f *fakeUsers) find(match func(*models.User) bool) (*models.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, u := range f.users {
+		if match(u) {
+			found := *u
+			return &found, nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+func (f *fakeUsers) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return f.find(func(u *models.User) bool { return strings.EqualFold(u.Email, email) })
+}
+
+func (f *fakeUsers) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	return f.find(func(u *models.User) bool { return u.ID == id })
+}
+
+func (f *fakeUsers) GetByGoogleID(ctx context.Context, googleID string) (*models.User, error) {
+	return f.find(func(u *models.User) bool { return u.GoogleID != nil && *u.GoogleID == googleID })
+}
+
+func (f *fakeUsers) LinkGoogle(ctx context.Context, userID uuid.UUID, googleID string, unusablePassword string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u := f.users[userID]
+	u.GoogleID = &googleID
+	if !u.EmailVerified {
+		u.Password = unusablePassword
+	}
+	u.EmailVerified = true
+	return nil
+}
+
+func (f *fakeUsers) GetPasswordHash(ctx context.Context, userID uuid.UUID) (string, error) {
+	user, err := f.GetByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return user.Password, nil
+}
+
+func (f *fakeUsers) UpdatePassword(ctx context.Context, userID uuid.UUID, passwordHash string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.users[userID].Password = passwordHash
+	return nil
+}
+
+func (f *fakeUsers) MarkEmailVerified(ctx context.Context, userID uuid.UUID, email string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.users[userID]
+	if !ok || u.Email != email {
+		return models.ErrNotFound
+	}
+	u.EmailVerified = true
+	return nil
+}
+
+func (f *fakeUsers) UpdateLastLogin(ctx context.Context, userID uuid.UUID) error { return nil }
+
+func (f *fakeUsers) UpdateLastLoginAsync(userID uuid.UUID, email string) {}
+
+// fakeIdentities links identities to users of its fakeUsers
+type fakeIdentities struct {
+	repositories.IdentityRepository
+
+	users *fakeUsers
+
+	mu         sync.Mutex
+	identities map[string]models.UserIdentity
+}
+
+func (f *fakeIdentities) Get(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	identity, ok := f.identities[provider+"/"+subject]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return &identity, nil
+}
+
+func (f *fakeIdentities) Link(ctx context.Context, identity *models.UserIdentity, unusablePassword string) error {
+	f.mu.Lock()
+	if f.identities == nil {
+		f.identities = make(map[string]models.UserIdentity)
+	}
+	f.identities[identity.Provider+"/"+identity.Subject] = *identity
+	f.mu.Unlock()
+
+	f.users.mu.Lock()
+	defer f.users.mu.Unlock()
+
+	u := f.users.users[identity.UserID]
+	if !u.EmailVerified {
+		u.Password = unusablePassword
+	}
+	u.EmailVerified = true
+	return nil
+}
+
+func (f *fakeIdentities) Touch(ctx context.Context, provider, subject, email string) error {
+	return nil
+}
+
+// fakeTokens spends tokens like the database does, once and before they expire
+type fakeTokens struct {
+	repositories.UserTokenRepository
+
+	mu     sync.Mutex
+	tokens []*models.UserToken
+}
+
+func (f *fakeTokens) Create(ctx context.Context, token *models.UserToken) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	token.ID, token.CreatedAt = uuid.New(), time.Now()
+	stored := *token
+	f.tokens = append(f.tokens, &stored)
+	return nil
+}
+
+func (f *fakeTokens) Consume(ctx context.Context, purpose, tokenHash string) (*models.UserToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	for _, t := range f.tokens {
+		if t.TokenHash == tokenHash && t.Purpose == purpose && t.UsedAt == nil && t.ExpiresAt.After(now) {
+			t.UsedAt = &now
+			used := *t
+			return &used, nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+func (f *fakeTokens) CountSince(ctx context.Context, userID uuid.UUID, purpose string, since time.Time) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := 0
+	for _, t := range f.tokens {
+		if t.UserID == userID && t.Purpose == purpose && t.CreatedAt.After(since) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// fakeMailer keeps what was sent
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (f *fakeMailer) Send(ctx context.Context, msg mail.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+// fakeMFA holds one user's authenticator secret and recovery codes, spent like the database does
+type fakeMFA struct {
+	repositories.MFARepository
+
+	mu       sync.Mutex
+	totp     *models.TOTP
+	recovery map[string]bool // code hashes, true once used
+}
+
+func (f *fakeMFA) GetTOTP(ctx context.Context, userID uuid.UUID) (*models.TOTP, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.totp == nil || f.totp.UserID != userID {
+		return nil, models.ErrNotFound
+	}
+	t := *f.totp
+	return &t, nil
+}
+
+func (f *fakeMFA) UseStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.totp == nil || f.totp.UserID != userID || !f.totp.Enabled() || f.totp.LastStep >= step {
+		return models.ErrNotFound
+	}
+	f.totp.LastStep = step
+	return nil
+}
+
+func (f *fakeMFA) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	used, ok := f.recovery[codeHash]
+	if f.totp == nil || f.totp.UserID != userID || !ok || used {
+		return models.ErrNotFound
+	}
+	f.recovery[codeHash] = true
+	return nil
+}
+
+func (f *fakeMFA) DisableTOTP(ctx context.Context, userID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.totp != nil && f.totp.UserID == userID {
+		f.totp, f.recovery = nil, nil
+	}
+	return nil
+}
+
+type fakePasskeys struct {
+	repositories.PasskeyRepository
+
+	mu         sync.Mutex
+	passkeys   []*models.Passkey
+	challenges map[string]bool // hashes of spent challenges
+}
+
+func (f *fakePasskeys) Create(ctx context.Context, passkey *models.Passkey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	passkey.ID = uuid.New()
+	stored := *passkey
+	f.passkeys = append(f.passkeys, &stored)
+	return nil
+}
+
+func (f *fakePasskeys) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.Passkey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var list []models.Passkey
+	for _, p := range f.passkeys {
+		if p.UserID == userID {
+			list = append(list, *p)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakePasskeys) GetByCredentialID(ctx context.Context, credentialID []byte) (*models.Passkey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, p := range f.passkeys {
+		if bytes.Equal(p.CredentialID, credentialID) {
+			found := *p
+			return &found, nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+func (f *fakePasskeys) RecordUse(ctx context.Context, id uuid.UUID, signCount uint32, backedUp bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, p := range f.passkeys {
+		if p.ID == id {
+			p.SignCount, p.BackedUp = signCount, backedUp
+			return nil
+		}
+	}
+	return models.ErrNotFound
+}
+
+func (f *fakePasskeys) DeleteForUser(ctx context.Context, userID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	kept := f.passkeys[:0]
+	for _, p := range f.passkeys {
+		if p.UserID != userID {
+			kept = append(kept, p)
+		}
+	}
+	f.passkeys = kept
+	return nil
+}
+
+func (f *fakePasskeys) SpendChallenge(ctx context.Context, challengeHash string, expiresAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.challenges == nil {
+		f.challenges = make(map[string]bool)
+	}
+	if f.challenges[challengeHash] {
+		return models.ErrNotFound
+	}
+	f.challenges[challengeHash] = true
+	return nil
+}
+
+// fakeLogins keeps failure counts and the audit trail in memory
+type fakeLogins struct {
+	repositories.LoginRepository
+
+	mu       sync.Mutex
+	failures map[string]*models.LoginThrottle
+	locked   map[string]time.Time
+	attempts []models.LoginAttempt
+}
+
+func (f *fakeLogins) LockedUntil(ctx context.Context, keys []string) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var until time.Time
+	for _, key := range keys {
+		if t := f.locked[key]; t.After(time.Now()) && t.After(until) {
+			until = t
+		}
+	}
+	return until, nil
+}
+
+func (f *fakeLogins) RecordFailure(ctx context.Context, key string, since time.Time) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failures == nil {
+		f.failures = make(map[string]*models.LoginThrottle)
+	}
+
+	// like the database, the count starts over when the last failure is older than since
+	t, ok := f.failures[key]
+	if !ok || t.LastFailureAt.Before(since) {
+		t = &models.LoginThrottle{Key: key}
+		f.failures[key] = t
+	}
+	t.Failures++
+	t.LastFailureAt = time.Now()
+	return t.Failures, nil
+}
+
+func (f *fakeLogins) Lock(ctx context.Context, key string, until time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.locked == nil {
+		f.locked = make(map[string]time.Time)
+	}
+	f.locked[key] = until
+	return nil
+}
+
+func (f *fakeLogins) Clear(ctx context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.failures, key)
+	delete(f.locked, key)
+	return nil
+}
+
+func (f *fakeLogins) RecordAttempt(ctx context.Context, attempt *models.LoginAttempt) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.attempts = append(f.attempts, *attempt)
+	return nil
+}
+
+// fakeSessions keeps sessions like the database does, rotated ones stay behind so reuse shows
+type fakeSessions struct {
+	repositories.SessionRepository
+
+	mu       sync.Mutex
+	created  []models.Session
+	revoked  []uuid.UUID // users signed out everywhere
+	sessions []*models.Session
+}
+
+func (f *fakeSessions) Create(ctx context.Context, session *models.Session) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	session.ID = uuid.New()
+	session.FamilyID = session.ID
+	session.CreatedAt = time.Now()
+	f.created = append(f.created, *session)
+
+	stored := *session
+	f.sessions = append(f.sessions, &stored)
+	return nil
+}
+
+func (f *fakeSessions) GetByToken(ctx context.Context, tokenHash string) (*models.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, s := range f.sessions {
+		if s.TokenHash == tokenHash {
+			found := *s
+			return &found, nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+func (f *fakeSessions) Rotate(ctx context.Context, current *models.Session, next *models.Session) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	for _, s := range f.sessions {
+		if s.ID != current.ID {
+			continue
+		}
+		if s.RotatedAt != nil || s.RevokedAt != nil {
+			return models.ErrSessionReused
+		}
+
+		next.ID, next.FamilyID, next.UserID, next.CreatedAt = uuid.New(), current.FamilyID, current.UserID, now
+		s.RotatedAt, s.ReplacedBy = &now, &next.ID
+
+		stored := *next
+		f.sessions = append(f.sessions, &stored)
+		return nil
+	}
+	return models.ErrSessionReused
+}
+
+// revoke revokes the sessions match picks, the caller holds the lock
+func (f *fakeSessions) revoke(match func(*models.Session) bool) int {
+	now := time.Now()
+	revoked := 0
+	for _, s := range f.sessions {
+		if s.RevokedAt == nil && match(s) {
+			s.RevokedAt = &now
+			revoked++
+		}
+	}
+	return revoked
+}
+
+func (f *fakeSessions) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.revoke(func(s *models.Session) bool { return s.FamilyID == familyID })
+	return nil
+}
+
+func (f *fakeSessions) FamilyActive(ctx context.Context, familyID uuid.UUID, userID uuid.UUID) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, s := range f.sessions {
+		if s.FamilyID == familyID && s.UserID == userID && s.Active(time.Now()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeSessions) RevokeSessionByUserID(ctx context.Context, userID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.revoked = append(f.revoked, userID)
+	f.revoke(func(s *models.Session) bool { return s.UserID == userID })
+	return nil
+}
+
+func (f *fakeSessions) revokedFor(userID uuid.UUID) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, id := range f.revoked {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+type testEnv struct {
+	h          *Handler
+	users      *fakeUsers
+	identities *fakeIdentities
+	tokens     *fakeTokens
+	mailer     *fakeMailer
+	mfa        *fakeMFA
+	passkeys   *fakePasskeys
+	logins     *fakeLogins
+	sessions   *fakeSessions
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	env := &testEnv{users: &fakeUsers{}, tokens: &fakeTokens{}, mailer: &fakeMailer{}, mfa: &fakeMFA{}, passkeys: &fakePasskeys{}, logins: &fakeLogins{}, sessions: &fakeSessions{}}
+	env.identities = &fakeIdentities{users: env.users}
+	repo := &repositories.Repositories{
+		User:      env.users,
+		Identity:  env.identities,
+		UserToken: env.tokens,
+		MFA:       env.mfa,
+		Passkey:   env.passkeys,
+		Login:     env.logins,
+		Session:   env.sessions,
+	}
+
+	config := &Config{
+		AccessSecret:  []byte("access-secret"),
+		RefreshSecret: []byte("refresh-secret"),
+		AccessTTL:     15 * time.Minute,
+		RefreshTTL:    24 * time.Hour,
+		ResetTTL:      time.Hour,
+		AppURL:        "http://app.test",
+		WebAuthn:      webauthn.Config{RPID: "app.test", RPName: "Kaiyo AI", Origins: []string{"http://app.test"}},
+	}
+
+	env.h = NewHandler(NewController(config), repo, NewValidator(), NewSessionCache(env.sessions), env.mailer)
+	env.h.Passkeys = NewPasskeys(config, repo)
+	return env
+}
@@ -0,0 +1,415 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/oidc"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	oauthStateCookie = "oauth_state"
+	oauthStateTTL    = 10 * time.Minute
+	oauthStateAud    = "oauth_state" // keeps the state token from passing for any other token signed with the same secret
+)
+
+var (
+	errOAuthState       = errors.New("sign in expired or was started elsewhere")
+	errEmailNotVerified = errors.New("the provider has not verified this email")
+)
+
+// issueTokens starts a new session for the user, sets its refresh cookie and returns the access token
+func (h *Handler) issueTokens(w http.ResponseWriter, r *http.Request, user *models.User) (string, error) {
+	refresh, err := h.Controller.GenerateRefreshToken(user.ID, user.Email)
+	if err != nil {
+		return "", err
+	}
+
+	session, err := h.createSession(r, user.ID, refresh)
+	if err != nil {
+		return "", fmt.Errorf("failed to create session: %w", err)
+	}
+
+	access, err := h.Controller.GenerateAccessToken(user, session.FamilyID)
+	if err != nil {
+		return "", err
+	}
+
+	h.setRefreshTokenCookie(w, refresh)
+
+	return access, nil
+}
+
+// startOAuth redirects the browser to the provider. State, nonce and the PKCE verifier are
+// kept in a signed cookie scoped to the provider's callback
+func (h *Handler) startOAuth(w http.ResponseWriter, r *http.Request, provider *oidc.Provider, callbackPath string) {
+	to, err := h.authorizeURL(w, r, provider, callbackPath)
+	if err != nil {
+		slog.Error("Could not start sign in", slog.String("provider", provider.Name), slog.String("error", err.Error()))
+		h.oauthFailed(w, r, http.StatusBadGateway, "provider_unavailable", err)
+		return
+	}
+
+	http.Redirect(w, r, to, http.StatusFound)
+}
+
+func (h *Handler) authorizeURL(w http.ResponseWriter, r *http.Request, provider *oidc.Provider, callbackPath string) (string, error) {
+	st := oauthState{}
+
+	var err error
+	for _, v := range []*string{&st.State, &st.Nonce, &st.Verifier} {
+		if *v, err = oidc.RandomString(); err != nil {
+			return "", err
+		}
+	}
+
+	to, err := provider.AuthCodeURL(r.Context(), st.State, st.Nonce, oidc.Challenge(st.Verifier))
+	if err != nil {
+		return "", err
+	}
+
+	if err := h.setOAuthState(w, callbackPath, st); err != nil {
+		return "", err
+	}
+
+	return to, nil
+}
+
+func (h *Handler) setOAuthState(w http.ResponseWriter, path string, st oauthState) error {
+	st.ExpiresAt = jwt.NewNumericDate(time.Now().Add(oauthStateTTL))
+	st.Audience = jwt.ClaimStrings{oauthStateAud}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, st).SignedString(h.Controller.auth.RefreshSecret)
+	if err != nil {
+		return fmt.Errorf("failed to sign oauth state: %w", err)
+	}
+
+	// Lax, the callback is a top level navigation coming from the provider's site
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    signed,
+		Path:     path,
+		HttpOnly: true,
+		Secure:   h.isProd(),
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(oauthStateTTL / time.Second),
+	})
+
+	return nil
+}
+
+// takeOAuthState reads and clears the state cookie, it is only good for one callback
+func (h *Handler) takeOAuthState(w http.ResponseWriter, r *http.Request, path string) (*oauthState, error) {
+	cookie, err := r.Cookie(oauthStateCookie)
+	if err != nil {
+		return nil, errOAuthState
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    "",
+		Path:     path,
+		HttpOnly: true,
+		Secure:   h.isProd(),
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1,
+	})
+
+	st := &oauthState{}
+	_, err = jwt.ParseWithClaims(cookie.Value, st, func(t *jwt.Token) (any, error) {
+		return h.Controller.auth.RefreshSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(), jwt.WithAudience(oauthStateAud))
+	if err != nil {
+		return nil, errOAuthState
+	}
+
+	if st.State == "" || subtle.ConstantTimeCompare([]byte(st.State), []byte(r.URL.Query().Get("state"))) != 1 {
+		return nil, errOAuthState
+	}
+
+	return st, nil
+}
+
+// finishOAuth checks the callback and returns the provider's verified claims, it has already
+// answered the request when it returns an error
+func (h *Handler) finishOAuth(w http.ResponseWriter, r *http.Request, provider *oidc.Provider, callbackPath string) (*oidc.Claims, error) {
+	st, err := h.takeOAuthState(w, r, callbackPath)
+	if err != nil {
+		h.oauthFailed(w, r, http.StatusBadRequest, "invalid_state", err)
+		return nil, err
+	}
+
+	// the user declined or the provider refused, nothing to exchange
+	if reason := r.URL.Query().Get("error"); reason != "" {
+		err := fmt.Errorf("sign in was not completed: %s", reason)
+		h.oauthFailed(w, r, http.StatusUnauthorized, "access_denied", err)
+		return nil, err
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		err := errors.New("missing authorization code")
+		h.oauthFailed(w, r, http.StatusBadRequest, "invalid_request", err)
+		return nil, err
+	}
+
+	claims, err := provider.Exchange(r.Context(), code, st.Verifier, st.Nonce)
+	if err != nil {
+		slog.Warn("Sign in with provider failed", slog.String("provider", provider.Name), slog.String("error", err.Error()))
+		h.oauthFailed(w, r, http.StatusUnauthorized, "invalid_grant", err)
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// completeOAuth signs the user in, redirecting to the app or answering like the login endpoint
+func (h *Handler) completeOAuth(w http.ResponseWriter, r *http.Request, user *models.User, provider string) {
+	mfa, err := h.mfaEnabled(r.Context(), user.ID)
+	if err != nil {
+		slog.Error("Could not check mfa", slog.String("error", err.Error()))
+		h.oauthFailed(w, r, http.StatusInternalServerError, "server_error", err)
+		return
+	}
+	if mfa {
+		// the provider stands in for the password, the second factor is still needed
+		h.oauthMFAChallenge(w, r, user)
+		return
+	}
+
+	access, err := h.issueTokens(w, r, user)
+	if err != nil {
+		slog.Error("failed to issue tokens", slog.String("error", err.Error()))
+		h.oauthFailed(w, r, http.StatusInternalServerError, "server_error", err)
+		return
+	}
+
+	h.Repo.User.UpdateLastLoginAsync(user.ID, user.Email)
+	slog.Info("Login successful", slog.String("email", user.Email), slog.String("provider", provider))
+
+	// the app picks up its access token from /auth/refresh, tokens never go into the URL
+	if h.Controller.auth.OAuthRedirectURL != "" {
+		http.Redirect(w, r, h.Controller.auth.OAuthRedirectURL, http.StatusFound)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(map[string]any{
+		"access_token": access,
+		"expires_in":   int64(h.Controller.auth.AccessTTL / time.Second),
+		"user": map[string]any{
+			"name":       strings.TrimSpace(user.FirstName + " " + user.LastName),
+			"email":      user.Email,
+			"created_at": user.CreatedAt,
+		},
+	})
+
+	if err != nil {
+		slog.Error("Could not return access token", slog.String("error", err.Error()))
+	}
+}
+
+// oauthMFAChallenge hands the app the challenge POST /auth/login/mfa takes. It goes in the
+// fragment, which browsers neither send to servers nor put in the Referer
+func (h *Handler) oauthMFAChallenge(w http.ResponseWriter, r *http.Request, user *models.User) {
+	if h.Controller.auth.OAuthRedirectURL == "" {
+		h.sendMFAChallenge(w, r, user)
+		return
+	}
+
+	challenge, err := h.newMFAChallenge(user.ID)
+	if err != nil {
+		slog.Error("Could not create mfa challenge", slog.String("error", err.Error()))
+		h.oauthFailed(w, r, http.StatusInternalServerError, "server_error", err)
+		return
+	}
+
+	to, err := url.Parse(h.Controller.auth.OAuthRedirectURL)
+	if err != nil {
+		h.oauthFailed(w, r, http.StatusInternalServerError, "server_error", err)
+		return
+	}
+	to.Fragment = url.Values{"mfa_token": {challenge}}.Encode()
+
+	http.Redirect(w, r, to.String(), http.StatusFound)
+}
+
+func (h *Handler) oauthFailed(w http.ResponseWriter, r *http.Request, status int, code string, err error) {
+	if h.Controller.auth.OAuthRedirectURL != "" {
+		to, perr := url.Parse(h.Controller.auth.OAuthRedirectURL)
+		if perr == nil {
+			q := to.Query()
+			q.Set("error", code)
+			to.RawQuery = q.Encode()
+			http.Redirect(w, r, to.String(), http.StatusFound)
+			return
+		}
+	}
+
+	w.WriteHeader(status)
+	h.SendError(w, fmt.Errorf("%s", code), err.Error())
+}
+
+// unusablePassword is stored for accounts that only sign in through a provider. Its input is
+// random and thrown away, so the minimum cost loses nothing
+func unusablePassword() (string, error) {
+	secret, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.MinCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return string(hash), nil
+}
+
+// usernameFor derives a unique username from an email, usernames are at most 30 characters
+func usernameFor(email string) string {
+	local, _, _ := strings.Cut(email, "@")
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(local) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '.' {
+			b.WriteRune(r)
+		}
+		if b.Len() == 21 {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		b.WriteString("traveller")
+	}
+
+	return b.String() + "_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:8]
+}
+
+// GET /auth/google/login
+func (h *Handler) GoogleLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if h.Google == nil {
+		http.Error(w, "Google sign in is not configured", http.StatusNotFound)
+		return
+	}
+
+	h.startOAuth(w, r, h.Google, "/auth/google/")
+}
+
+// GET /auth/google/callback
+func (h *Handler) GoogleCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if h.Google == nil {
+		http.Error(w, "Google sign in is not configured", http.StatusNotFound)
+		return
+	}
+
+	claims, err := h.finishOAuth(w, r, h.Google, "/auth/google/")
+	if err != nil {
+		return
+	}
+
+	user, err := h.googleUser(r.Context(), claims)
+	if errors.Is(err, errEmailNotVerified) {
+		h.oauthFailed(w, r, http.StatusForbidden, "email_not_verified", err)
+		return
+	}
+	if err != nil {
+		slog.Error("Could not sign in with Google", slog.String("error", err.Error()))
+		h.oauthFailed(w, r, http.StatusInternalServerError, "server_error", err)
+		return
+	}
+
+	h.completeOAuth(w, r, user, "google")
+}
+
+// googleUser finds the user a Google account belongs to. An account seen before is found by
+// its subject, otherwise it is linked to the user with the same verified email or a new user
+// is created for it
+func (h *Handler) googleUser(ctx context.Context, claims *oidc.Claims) (*models.User, error) {
+	user, err := h.Repo.User.GetByGoogleID(ctx, claims.Subject)
+	if err == nil || !errors.Is(err, models.ErrNotFound) {
+		return user, err
+	}
+
+	// linking by an address the provider has not checked would hand the account to anyone
+	if !claims.EmailVerified || claims.Email == "" {
+		return nil, errEmailNotVerified
+	}
+
+	password, err := unusablePassword()
+	if err != nil {
+		return nil, err
+	}
+
+	user, err = h.Repo.User.GetByEmail(ctx, claims.Email)
+	if err == nil {
+		if err := h.Repo.User.LinkGoogle(ctx, user.ID, claims.Subject, password); err != nil {
+			return nil, err
+		}
+		if err := h.takeOverUnverified(ctx, user); err != nil {
+			return nil, err
+		}
+		slog.Info("Linked Google account", slog.String("user_id", user.ID.String()))
+		return user, nil
+	}
+	if !errors.Is(err, models.ErrNotFound) {
+		return nil, err
+	}
+
+	googleID := claims.Subject
+	user = &models.User{
+		ID:            uuid.New(),
+		Email:         claims.Email,
+		FirstName:     truncate(claims.GivenName, 50),
+		LastName:      truncate(claims.FamilyName, 50),
+		UserName:      usernameFor(claims.Email),
+		Password:      password,
+		GoogleID:      &googleID,
+		EmailVerified: true,
+		IsActive:      true,
+	}
+
+	if err := h.Repo.User.Create(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// takeOverUnverified signs everyone out of an account whose email was never verified once a provider
+// vouches for the address. Whoever registered it first may not own it, linking replaced their password
+// and their sessions and second factors go with it
+func (h *Handler) takeOverUnverified(ctx context.Context, user *models.User) error {
+	if user.EmailVerified {
+		return nil
+	}
+
+	if err := h.Repo.Session.RevokeSessionByUserID(ctx, user.ID); err != nil {
+		return err
+	}
+	h.Sessions.ForgetUser(user.ID)
+
+	// an authenticator they enrolled would lock the owner out behind a code only they have
+	if err := h.Repo.MFA.DisableTOTP(ctx, user.ID); err != nil {
+		return err
+	}
+
+	// and a passkey they registered would be a way back in without any password
+	if err := h.Repo.Passkey.DeleteForUser(ctx, user.ID); err != nil {
+		return err
+	}
+
+	user.EmailVerified = true
+	return nil
+}
@@ -0,0 +1,251 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/oidc"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/oidc/oidctest"
+)
+
+func withGoogle(t *testing.T, env *testEnv) *oidctest.Provider {
+	t.Helper()
+
+	mock, srv, err := oidctest.Start("google-client", "google-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+
+	env.h.Google = oidc.NewProvider(oidc.Config{
+		Name:         "google",
+		Issuer:       mock.Issuer,
+		ClientID:     "google-client",
+		ClientSecret: "google-secret",
+		RedirectURL:  "http://api.test/auth/google/callback",
+	})
+
+	return mock
+}
+
+// signIn runs a provider sign in the way a browser would: start it, let the provider redirect
+// back and call the callback with the state cookie. tamper may change the callback's query
+func signIn(t *testing.T, login, callback http.HandlerFunc, tamper func(url.Values)) *httptest.ResponseRecorder {
+	t.Helper()
+
+	start := httptest.NewRecorder()
+	login(start, httptest.NewRequest(http.MethodGet, "/auth/login", nil))
+	if start.Code != http.StatusFound {
+		t.Fatalf("login answered %d: %s", start.Code, start.Body)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.Get(start.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	back, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := back.Query()
+	if tamper != nil {
+		tamper(q)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/callback?"+q.Encode(), nil)
+	for _, c := range start.Result().Cookies() {
+		req.AddCookie(c)
+	}
+
+	rec := httptest.NewRecorder()
+	callback(rec, req)
+	return rec
+}
+
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("could not decode %q: %v", rec.Body, err)
+	}
+	return body.Error
+}
+
+func TestGoogleSignIn(t *testing.T) {
+	env := newTestEnv(t)
+	mock := withGoogle(t, env)
+	mock.SetIdentity(oidctest.Identity{Subject: "g-1", Email: "ana@example.com", EmailVerified: true, GivenName: "Ana"})
+
+	rec := signIn(t, env.h.GoogleLoginHandler, env.h.GoogleCallbackHandler, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback answered %d: %s", rec.Code, rec.Body)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.AccessToken == "" {
+		t.Fatalf("no access token in %s", rec.Body)
+	}
+
+	user, err := env.users.GetByGoogleID(context.Background(), "g-1")
+	if err != nil || user.Email != "ana@example.com" || !user.EmailVerified || user.FirstName != "Ana" {
+		t.Errorf("provisioned user %+v, %v", user, err)
+	}
+	if len(env.sessions.created) != 1 {
+		t.Errorf("created %d sessions, want 1", len(env.sessions.created))
+	}
+}
+
+func TestGoogleSignInRejectsState(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(url.Values)
+	}{
+		{"state mismatch", func(q url.Values) { q.Set("state", "forged") }},
+		{"missing state", func(q url.Values) { q.Del("state") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			withGoogle(t, env)
+
+			rec := signIn(t, env.h.GoogleLoginHandler, env.h.GoogleCallbackHandler, tt.tamper)
+			if rec.Code != http.StatusBadRequest || errorCode(t, rec) != "invalid_state" {
+				t.Errorf("got %d %s, want 400 invalid_state", rec.Code, rec.Body)
+			}
+			if len(env.sessions.created) != 0 {
+				t.Error("a session was created")
+			}
+		})
+	}
+}
+
+func TestGoogleSignInRejectsTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(mock *oidctest.Provider)
+		tamper  func(url.Values)
+	}{
+		{
+			name:    "JWKS signature failure",
+			prepare: func(mock *oidctest.Provider) { mock.ForgeSignatures() },
+		},
+		{
+			name:   "code the provider never issued",
+			tamper: func(q url.Values) { q.Set("code", "forged") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			mock := withGoogle(t, env)
+			if tt.prepare != nil {
+				tt.prepare(mock)
+			}
+
+			rec := signIn(t, env.h.GoogleLoginHandler, env.h.GoogleCallbackHandler, tt.tamper)
+			if rec.Code != http.StatusUnauthorized || errorCode(t, rec) != "invalid_grant" {
+				t.Errorf("got %d %s, want 401 invalid_grant", rec.Code, rec.Body)
+			}
+			if len(env.sessions.created) != 0 {
+				t.Error("a session was created")
+			}
+		})
+	}
+}
+
+func TestGoogleUserLinking(t *testing.T) {
+	googleID := "g-known"
+
+	tests := []struct {
+		name       string
+		existing   *models.User
+		claims     oidc.Claims
+		wantErr    error
+		wantLinked bool
+		wantRevoke bool
+	}{
+		{
+			name:     "known subject signs in its user",
+			existing: &models.User{Email: "old@example.com", GoogleID: &googleID, EmailVerified: true},
+			claims:   claims(googleID, "changed@example.com", false),
+		},
+		{
+			name:    "unverified provider email is refused",
+			claims:  claims("g-new", "ana@example.com", false),
+			wantErr: errEmailNotVerified,
+		},
+		{
+			name:       "verified account is linked and keeps its sessions",
+			existing:   &models.User{Email: "ana@example.com", Password: "hash", EmailVerified: true},
+			claims:     claims("g-new", "ANA@example.com", true),
+			wantLinked: true,
+		},
+		{
+			name:       "unverified account is taken over",
+			existing:   &models.User{Email: "ana@example.com", Password: "squatter-hash"},
+			claims:     claims("g-new", "ana@example.com", true),
+			wantLinked: true,
+			wantRevoke: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			var existing models.User
+			if tt.existing != nil {
+				existing = *env.users.add(tt.existing)
+			}
+
+			user, err := env.h.googleUser(context.Background(), &tt.claims)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if tt.existing != nil && user.ID != existing.ID {
+				t.Errorf("signed in user %s, want the existing %s", user.ID, existing.ID)
+			}
+			if !user.EmailVerified {
+				t.Error("signed in user is not verified")
+			}
+
+			stored := env.users.get(user.ID)
+			if tt.wantLinked {
+				if stored.GoogleID == nil || *stored.GoogleID != tt.claims.Subject {
+					t.Error("google account was not linked")
+				}
+				if replaced := stored.Password != existing.Password; replaced != tt.wantRevoke {
+					t.Errorf("password replaced = %v, want %v", replaced, tt.wantRevoke)
+				}
+			}
+			if revoked := env.sessions.revokedFor(user.ID); revoked != tt.wantRevoke {
+				t.Errorf("sessions revoked = %v, want %v", revoked, tt.wantRevoke)
+			}
+		})
+	}
+}
+
+func claims(subject, email string, verified bool) oidc.Claims {
+	c := oidc.Claims{Email: email, EmailVerified: oidc.Bool(verified)}
+	c.Subject = subject
+	return c
+}
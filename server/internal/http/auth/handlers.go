@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/mail"
 	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
 	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
 	"golang.org/x/crypto/bcrypt"
@@ -21,8 +23,8 @@ const (
 	bcryptCostFactor = 14
 )
 
-func NewHandler(ctrl *Controller, repo *repositories.Repositories, val Validator) *Handler {
-	return &Handler{Controller: ctrl, Repo: repo, Validator: val}
+func NewHandler(ctrl *Controller, repo *repositories.Repositories, val Validator, sessions *SessionCache, mailer mail.Mailer) *Handler {
+	return &Handler{Controller: ctrl, Repo: repo, Validator: val, Sessions: sessions, Mailer: mailer}
 }
 
 func (h *Handler) SendError(w http.ResponseWriter, err error, msg any) {
@@ -61,34 +63,50 @@ func (h *Handler) GetDeviceInfo(r *http.Request) *models.DeviceInfo {
 	}
 }
 
-// Get real client IP (handles proxies and load balancers)
+// getClientIP returns the client's address. X-Forwarded-For is read from the right and only
+// through the entries trusted proxies added, whatever comes before them is up to the client
 func (h *Handler) getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header (most common for proxies)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// Format: "client-ip, proxy1-ip, proxy2-ip"
-		ips := strings.Split(xff, ",")
-		clientIP := strings.TrimSpace(ips[0])
-		if clientIP != "" {
-			return clientIP
-		}
+	client, ok := parseHop(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
 	}
 
-	// Check X-Real-IP header (Nginx)
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
 	}
 
-	// Check X-Forwarded header
-	if xf := r.Header.Get("X-Forwarded"); xf != "" {
-		return xf
+	for i := len(hops) - 1; i >= 0 && h.trustedProxy(client); i-- {
+		hop, ok := parseHop(hops[i])
+		if !ok {
+			// the proxy passed on something that is not an address, it is the last hop known
+			break
+		}
+		client = hop
+	}
+
+	return client.String()
+}
+
+func (h *Handler) trustedProxy(addr netip.Addr) bool {
+	for _, prefix := range h.Controller.auth.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
 	}
+	return false
+}
 
-	// Fall back to RemoteAddr (remove port if present)
-	ip := r.RemoteAddr
-	if idx := strings.LastIndex(ip, ":"); idx != -1 {
-		ip = ip[:idx]
+// parseHop reads an address as proxies and RemoteAddr write it, with or without a port
+func parseHop(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), true
 	}
-	return ip
+	if addr, err := netip.ParseAddr(strings.Trim(s, "[]")); err == nil {
+		return addr.Unmap(), true
+	}
+	return netip.Addr{}, false
 }
 
 // Get preferred language from Accept-Language header
@@ -246,6 +264,33 @@ func (h *Handler) setRefreshTokenCookie(w http.ResponseWriter, refresh string) {
 	})
 }
 
+func (h *Handler) clearRefreshTokenCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "refresh_token",
+		Value:    "",
+		HttpOnly: true,
+		Secure:   h.isProd(),
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   -1,
+	})
+}
+
+// createSession stores the refresh token of a fresh login as the first session of a new family
+func (h *Handler) createSession(r *http.Request, userID uuid.UUID, refresh string) (*models.Session, error) {
+	session := &models.Session{
+		UserID:     userID,
+		TokenHash:  models.HashToken(refresh),
+		ExpiresAt:  time.Now().Add(h.Controller.auth.RefreshTTL),
+		DeviceInfo: *h.GetDeviceInfo(r),
+	}
+
+	if err := h.Repo.Session.Create(r.Context(), session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
 func (h *Handler) EmailSignInHandler(w http.ResponseWriter, r *http.Request) {
 	var req SignInRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -272,7 +317,7 @@ func (h *Handler) EmailSignInHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcryptCostFactor)
+	passwordHash, err := HashPassword(req.Password)
 
 	if err != nil {
 		slog.Error("could not hash the password", slog.String("error", err.Error()))
@@ -286,7 +331,7 @@ func (h *Handler) EmailSignInHandler(w http.ResponseWriter, r *http.Request) {
 		FirstName: req.FirstName,
 		LastName:  req.LastName,
 		UserName:  req.UserName,
-		Password:  string(passwordHash),
+		Password:  passwordHash,
 
 		EmailVerified: false,
 		IsActive:      true,
@@ -298,32 +343,30 @@ func (h *Handler) EmailSignInHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	access, err := h.Controller.GenerateAccessToken(user.ID, user.Email)
+	h.sendVerificationAsync(user)
+
+	refresh, err := h.Controller.GenerateRefreshToken(user.ID, user.Email)
 	if err != nil {
-		slog.Error("failed to generate access token", slog.String("error", err.Error()))
+		slog.Error("failed to generate refresh token", slog.String("error", err.Error()))
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	refresh, err := h.Controller.GenerateRefreshToken(user.ID, user.Email)
+	session, err := h.createSession(r, user.ID, refresh)
 	if err != nil {
-		slog.Error("failed to generate refresh token", slog.String("error", err.Error()))
+		slog.Error("failed to create session", slog.String("error", err.Error()))
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	h.setRefreshTokenCookie(w, refresh)
-
-	// hashedToken := HashToken(refresh)
-	// session := &models.Session{
-	// 	UserID: user.ID,
-	// 	TokenHash: hashedToken,
-	// 	ExpiresAt: time.Now().Add(h.Controller.auth.RefreshTTL),
-	// 	CreatedAt: time.Now(),
-	// 	// DeviceInfo: ,
-	// }
+	access, err := h.Controller.GenerateAccessToken(&user, session.FamilyID)
+	if err != nil {
+		slog.Error("failed to generate access token", slog.String("error", err.Error()))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
 
-	// err := h.Repo.Session.Create(r.Context(), u)
+	h.setRefreshTokenCookie(w, refresh)
 
 	w.WriteHeader(http.StatusCreated)
 	err = json.NewEncoder(w).Encode(map[string]any{
@@ -331,11 +374,12 @@ func (h *Handler) EmailSignInHandler(w http.ResponseWriter, r *http.Request) {
 		"access_token": access,
 		"expires_in":   int64(h.Controller.auth.AccessTTL / time.Second),
 		"user": map[string]any{
-			"id":        user.ID,
-			"email":     user.Email,
-			"firstName": user.FirstName,
-			"lastName":  user.LastName,
-			"createdAt": user.CreatedAt,
+			"id":            user.ID,
+			"email":         user.Email,
+			"firstName":     user.FirstName,
+			"lastName":      user.LastName,
+			"createdAt":     user.CreatedAt,
+			"emailVerified": user.EmailVerified,
 		},
 	})
 
@@ -357,22 +401,47 @@ func (h *Handler) EmailLoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.Repo.User.GetByEmail(r.Context(), req.Email)
+	retryAfter, err := h.loginLockout(r, req.Email)
 	if err != nil {
-		slog.Error(err.Error())
+		slog.Error("Could not check login lockout", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		h.auditLogin(r, req.Email, nil, false, models.LoginLocked)
+		h.sendLockedOut(w, retryAfter)
+		return
+	}
+
+	user, err := h.Repo.User.GetByEmail(r.Context(), req.Email)
+	if errors.Is(err, models.ErrNotFound) {
+		// as slow as a wrong password, so the answer does not tell whether the account exists
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(req.Password))
+		h.loginFailed(r, req.Email, nil, models.LoginUnknownEmail)
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
+	if err != nil {
+		slog.Error("Could not look up user", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		slog.Error(err.Error())
+		h.loginFailed(r, req.Email, &user.ID, models.LoginBadPassword)
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	access, err := h.Controller.GenerateAccessToken(user.ID, user.Email)
+	mfa, err := h.mfaEnabled(r.Context(), user.ID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		slog.Error("Could not check mfa", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if mfa {
+		// no session yet, the password alone is not enough
+		h.sendMFAChallenge(w, r, user)
 		return
 	}
 
@@ -382,10 +451,28 @@ func (h *Handler) EmailLoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// db.StoreRefreshToken(auth.HashToken(refresh), user.ID, time.Now().Add(refreshTTL))
+	session, err := h.createSession(r, user.ID, refresh)
+	if err != nil {
+		slog.Error("failed to create session", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	access, err := h.Controller.GenerateAccessToken(user, session.FamilyID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	h.setRefreshTokenCookie(w, refresh)
 
-	err = json.NewEncoder(w).Encode(map[string]any{
+	h.loginCompleted(r, user)
+	h.loginSucceeded(w, user, access)
+}
+
+// loginSucceeded answers a completed login with the access token
+func (h *Handler) loginSucceeded(w http.ResponseWriter, user *models.User, access string) {
+	err := json.NewEncoder(w).Encode(map[string]any{
 		"access_token": access,
 		"expires_in":   int64(h.Controller.auth.AccessTTL / time.Second),
 		"user": map[string]any{
@@ -424,19 +511,27 @@ func (h *Handler) EmailLogoutHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err == nil && cookie.Value != "" {
-		//TODO : Invalidate token in db
-		slog.Info("Refresh token invalidated")
+		session, err := h.Repo.Session.GetByToken(r.Context(), models.HashToken(cookie.Value))
+		if err != nil && !errors.Is(err, models.ErrNotFound) {
+			slog.Error("Could not look up session", slog.String("error", err.Error()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		// an unknown token has nothing to revoke, the cookie is cleared either way
+		if session != nil {
+			if err := h.Repo.Session.RevokeFamily(r.Context(), session.FamilyID); err != nil {
+				slog.Error("Could not revoke session", slog.String("error", err.Error()))
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			h.Sessions.Forget(session.FamilyID)
+			slog.Info("Refresh token invalidated", slog.String("user_id", session.UserID.String()))
+		}
 	}
 
 	// Clear refresh token cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    "",
-		HttpOnly: true,
-		Secure:   h.isProd(),
-		SameSite: http.SameSiteStrictMode,
-		MaxAge:   -1,
-	})
+	h.clearRefreshTokenCookie(w)
 
 	err = json.NewEncoder(w).Encode(map[string]string{
 		"message": "Logged out successfully",
@@ -447,7 +542,9 @@ func (h *Handler) EmailLogoutHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *Handler) EmailRefreshHandler(w http.ResponseWriter, r *http.Request) {
+// EmailLogoutAllHandler revokes every session of the user the refresh cookie belongs to,
+// logging them out on all devices
+func (h *Handler) EmailLogoutAllHandler(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie("refresh_token")
 	if errors.Is(err, http.ErrNoCookie) {
 		w.WriteHeader(http.StatusUnauthorized)
@@ -455,30 +552,110 @@ func (h *Handler) EmailRefreshHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: Validate refresh token from database
-	// claims, err := h.Controller.ValidateRefreshToken(cookie.Value)
-	// if err != nil {
-	//     http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
-	//     return
-	// }
+	if _, err := ValidateToken(cookie.Value, h.Controller.auth.RefreshSecret); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		h.SendError(w, fmt.Errorf("invalid refresh token"), "Invalid token")
+		return
+	}
+
+	// only a live session may end the others, a stolen rotated token must not lock the owner out
+	session, err := h.Repo.Session.GetByToken(r.Context(), models.HashToken(cookie.Value))
+	if errors.Is(err, models.ErrNotFound) || (err == nil && !session.Active(time.Now())) {
+		h.clearRefreshTokenCookie(w)
+		w.WriteHeader(http.StatusUnauthorized)
+		h.SendError(w, fmt.Errorf("session expired"), "Session has expired or was revoked")
+		return
+	}
+	if err != nil {
+		slog.Error("Could not look up session", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.Repo.Session.RevokeSessionByUserID(r.Context(), session.UserID); err != nil {
+		slog.Error("Could not revoke sessions", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	h.Sessions.ForgetUser(session.UserID)
+
+	h.clearRefreshTokenCookie(w)
+
+	err = json.NewEncoder(w).Encode(map[string]string{
+		"message": "Logged out of all sessions",
+	})
+
+	if err != nil {
+		slog.Error("Could not respond to logout request", slog.String("error", err.Error()))
+	}
+
+	slog.Info("All sessions revoked", slog.String("user_id", session.UserID.String()))
+}
+
+func (h *Handler) EmailRefreshHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("refresh_token")
+	if errors.Is(err, http.ErrNoCookie) {
+		w.WriteHeader(http.StatusUnauthorized)
+		h.SendError(w, err, "Refresh token does not exists")
+		return
+	}
 
-	// For now, validate the JWT directly
 	claims, err := ValidateToken(cookie.Value, h.Controller.auth.RefreshSecret)
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
-		h.SendError(w, err, "Invalid token")
+		h.SendError(w, fmt.Errorf("invalid refresh token"), "Invalid token")
+		return
+	}
+
+	// A signed token is only good while its session is, the session is the source of truth
+	session, err := h.Repo.Session.GetByToken(r.Context(), models.HashToken(cookie.Value))
+	if errors.Is(err, models.ErrNotFound) || (err == nil && session.UserID != claims.UserID) {
+		h.clearRefreshTokenCookie(w)
+		w.WriteHeader(http.StatusUnauthorized)
+		h.SendError(w, fmt.Errorf("unknown session"), "Invalid token")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to look up session", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if session.RotatedAt != nil {
+		h.revokeReusedSession(w, r, session)
+		return
+	}
+
+	if !session.Active(time.Now()) {
+		h.clearRefreshTokenCookie(w)
+		w.WriteHeader(http.StatusUnauthorized)
+		h.SendError(w, fmt.Errorf("session expired"), "Session has expired or was revoked")
+		return
+	}
+
+	// the access token carries the user's current state, such as a newly verified email
+	user, err := h.Repo.User.GetByID(r.Context(), session.UserID)
+	if errors.Is(err, models.ErrNotFound) {
+		h.clearRefreshTokenCookie(w)
+		w.WriteHeader(http.StatusUnauthorized)
+		h.SendError(w, fmt.Errorf("account disabled"), "Account no longer exists or was disabled")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to look up user", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	// Generate new access token
-	access, err := h.Controller.GenerateAccessToken(claims.UserID, claims.Email)
+	access, err := h.Controller.GenerateAccessToken(user, session.FamilyID)
 	if err != nil {
 		slog.Error("Failed to generate new access token", slog.String("error", err.Error()))
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Optionally generate new refresh token (token rotation)
+	// Every refresh rotates the refresh token, the old one stays behind to detect reuse
 	refresh, err := h.Controller.GenerateRefreshToken(claims.UserID, claims.Email)
 	if err != nil {
 		slog.Error("Failed to generate new refresh token", slog.String("error", err.Error()))
@@ -486,8 +663,22 @@ func (h *Handler) EmailRefreshHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: Update refresh token in database
-	// h.Controller.ReplaceRefreshToken(oldToken, refresh, claims.UserID)
+	next := &models.Session{
+		TokenHash:  models.HashToken(refresh),
+		ExpiresAt:  time.Now().Add(h.Controller.auth.RefreshTTL),
+		DeviceInfo: *h.GetDeviceInfo(r),
+	}
+
+	err = h.Repo.Session.Rotate(r.Context(), session, next)
+	if errors.Is(err, models.ErrSessionReused) {
+		h.revokeReusedSession(w, r, session)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to rotate session", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	// Update cookie with new refresh token
 	h.setRefreshTokenCookie(w, refresh)
@@ -505,3 +696,25 @@ func (h *Handler) EmailRefreshHandler(w http.ResponseWriter, r *http.Request) {
 
 	slog.Info("Token refreshed", slog.String("user_id", claims.UserID.String()))
 }
+
+// revokeReusedSession handles a refresh token presented after it was rotated. Either the
+// token leaked or the client replayed it, there is no telling which, so the whole family
+// is revoked and every holder has to log in again
+func (h *Handler) revokeReusedSession(w http.ResponseWriter, r *http.Request, session *models.Session) {
+	slog.Warn("Refresh token reuse detected, revoking session family",
+		slog.String("user_id", session.UserID.String()),
+		slog.String("family_id", session.FamilyID.String()),
+	)
+
+	if err := h.Repo.Session.RevokeFamily(r.Context(), session.FamilyID); err != nil {
+		slog.Error("Failed to revoke session family", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.Sessions.Forget(session.FamilyID)
+
+	h.clearRefreshTokenCookie(w)
+	w.WriteHeader(http.StatusUnauthorized)
+	h.SendError(w, fmt.Errorf("refresh token reused"), "Session has been revoked, please log in again")
+}
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/totp"
+)
+
+const (
+	mfaChallengeTTL = 5 * time.Minute
+	mfaChallengeAud = "mfa_challenge" // keeps the challenge from passing for any other token signed with the same secret
+
+	recoveryCodeCount = 10
+)
+
+// ErrInvalidMFACode is returned for wrong, reused and expired second factor codes alike
+var ErrInvalidMFACode = errors.New("invalid authentication code")
+
+var errMFAChallenge = errors.New("login expired, please start again")
+
+// NewRecoveryCodes returns fresh recovery codes to show the user once, and the hashes to store
+func NewRecoveryCodes() (codes, hashes []string, err error) {
+	for range recoveryCodeCount {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+
+		// 10 base32 characters, 50 bits, grouped so they are easy to copy down
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b)[:10])
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, models.HashToken(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// VerifySecondFactor accepts a current authenticator code or an unused recovery code for
+// the user. Either can only be used once
+func VerifySecondFactor(ctx context.Context, repo *repositories.Repositories, userID uuid.UUID, code string) error {
+	code = strings.ToLower(strings.Join(strings.Fields(code), ""))
+
+	if len(code) == totp.Digits {
+		t, err := repo.MFA.GetTOTP(ctx, userID)
+		if errors.Is(err, models.ErrNotFound) {
+			return ErrInvalidMFACode
+		}
+		if err != nil {
+			return err
+		}
+
+		step, ok := totp.Validate(t.Secret, code, time.Now())
+		if !ok || !t.Enabled() {
+			return ErrInvalidMFACode
+		}
+
+		err = repo.MFA.UseStep(ctx, userID, step)
+		if errors.Is(err, models.ErrNotFound) {
+			return ErrInvalidMFACode
+		}
+		return err
+	}
+
+	err := repo.MFA.UseRecoveryCode(ctx, userID, models.HashToken(strings.ReplaceAll(code, "-", "")))
+	if errors.Is(err, models.ErrNotFound) {
+		return ErrInvalidMFACode
+	}
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Recovery code used", slog.String("user_id", userID.String()))
+	return nil
+}
+
+// mfaEnabled reports whether logging in as the user takes a second factor
+func (h *Handler) mfaEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	t, err := h.Repo.MFA.GetTOTP(ctx, userID)
+	if errors.Is(err, models.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return t.Enabled(), nil
+}
+
+// newMFAChallenge signs a short lived token saying the user got their password right,
+// which POST /auth/login/mfa exchanges for a session together with a code
+func (h *Handler) newMFAChallenge(userID uuid.UUID) (string, error) {
+	claims := jwt.RegisteredClaims{
+		Subject:   userID.String(),
+		Audience:  jwt.ClaimStrings{mfaChallengeAud},
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(mfaChallengeTTL)),
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(h.Controller.auth.RefreshSecret)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign mfa challenge: %w", err)
+	}
+
+	return signed, nil
+}
+
+func (h *Handler) parseMFAChallenge(token string) (uuid.UUID, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		return h.Controller.auth.RefreshSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(), jwt.WithAudience(mfaChallengeAud))
+	if err != nil {
+		return uuid.Nil, errMFAChallenge
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, errMFAChallenge
+	}
+
+	return userID, nil
+}
+
+// sendMFAChallenge answers a correct password when a second factor is still needed, listing
+// the ones the user can use
+func (h *Handler) sendMFAChallenge(w http.ResponseWriter, r *http.Request, user *models.User) {
+	challenge, err := h.newMFAChallenge(user.ID)
+	if err != nil {
+		slog.Error("Could not create mfa challenge", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	methods := []string{"totp", "recovery_code"}
+	passkeys, err := h.Repo.Passkey.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		slog.Error("Could not list passkeys", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if len(passkeys) > 0 {
+		methods = append(methods, "passkey")
+	}
+
+	err = json.NewEncoder(w).Encode(map[string]any{
+		"mfa_required": true,
+		"mfa_token":    challenge,
+		"mfa_methods":  methods,
+		"expires_in":   int64(mfaChallengeTTL / time.Second),
+	})
+
+	if err != nil {
+		slog.Error("Could not return mfa challenge", slog.String("error", err.Error()))
+	}
+}
+
+// POST /auth/login/mfa
+func (h *Handler) LoginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var req LoginMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		h.SendError(w, fmt.Errorf("invalid request"), "The mfa token and a code are required")
+		return
+	}
+
+	userID, err := h.parseMFAChallenge(req.MFAToken)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		h.SendError(w, err, "Login expired, please start again")
+		return
+	}
+
+	user, err := h.Repo.User.GetByID(r.Context(), userID)
+	if errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		slog.Error("Could not load user", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// codes are guessed as easily as passwords, failures count towards the same lockout
+	retryAfter, err := h.loginLockout(r, user.Email)
+	if err != nil {
+		slog.Error("Could not check login lockout", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		h.auditLogin(r, user.Email, &user.ID, false, models.LoginLocked)
+		h.sendLockedOut(w, retryAfter)
+		return
+	}
+
+	err = VerifySecondFactor(r.Context(), h.Repo, user.ID, req.Code)
+	if errors.Is(err, ErrInvalidMFACode) {
+		h.loginFailed(r, user.Email, &user.ID, models.LoginBadMFACode)
+		w.WriteHeader(http.StatusUnauthorized)
+		h.SendError(w, err, "The code is invalid or was already used")
+		return
+	}
+	if err != nil {
+		slog.Error("Could not verify mfa code", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	access, err := h.issueTokens(w, r, user)
+	if err != nil {
+		slog.Error("Could not issue tokens", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.loginCompleted(r, user)
+	h.loginSucceeded(w, user, access)
+}
@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/oidc/oidctest"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/totp"
+)
+
+// enableMFA turns on authenticator codes for the user and returns the secret and recovery codes
+func enableMFA(t *testing.T, env *testEnv, userID uuid.UUID) (string, []string) {
+	t.Helper()
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, hashes, err := NewRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	confirmed := time.Now()
+	env.mfa.totp = &models.TOTP{UserID: userID, Secret: secret, ConfirmedAt: &confirmed}
+	env.mfa.recovery = make(map[string]bool)
+	for _, h := range hashes {
+		env.mfa.recovery[h] = false
+	}
+
+	return secret, codes
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+
+	format := regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`)
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		if !format.MatchString(code) {
+			t.Errorf("code %q is not two groups of five base32 characters", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q repeats", code)
+		}
+		seen[code] = true
+
+		// the hash is of the code without its dash, which users may leave out
+		if hashes[i] != models.HashToken(strings.ReplaceAll(code, "-", "")) {
+			t.Errorf("hash of %q doesn't match", code)
+		}
+	}
+}
+
+func TestVerifySecondFactor(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	userID := uuid.New()
+	secret, recovery := enableMFA(t, env, userID)
+
+	now := totp.Step(time.Now())
+	current, _ := totp.Code(secret, now)
+	previous, _ := totp.Code(secret, now-1)
+
+	steps := []struct {
+		name string
+		code string
+		want error
+	}{
+		{"wrong code", "000000", ErrInvalidMFACode},
+		{"current code", current[:3] + " " + current[3:], nil},
+		{"same step again", current, ErrInvalidMFACode},
+		{"earlier step", previous, ErrInvalidMFACode},
+		{"recovery code", strings.ToUpper(recovery[0]), nil},
+		{"recovery code without its dash", strings.ReplaceAll(recovery[1], "-", ""), nil},
+		{"spent recovery code", recovery[0], ErrInvalidMFACode},
+		{"unknown recovery code", "aaaaa-aaaaa", ErrInvalidMFACode},
+	}
+
+	// in order, each step sees what the ones before it spent
+	for _, tt := range steps {
+		if err := VerifySecondFactor(ctx, env.h.Repo, userID, tt.code); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if err := VerifySecondFactor(ctx, env.h.Repo, uuid.New(), current); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("user without mfa: got %v, want %v", err, ErrInvalidMFACode)
+	}
+
+	// a secret that was never confirmed doesn't count as a second factor
+	env.mfa.totp.ConfirmedAt = nil
+	env.mfa.totp.LastStep = 0
+	if err := VerifySecondFactor(ctx, env.h.Repo, userID, current); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("unconfirmed secret: got %v, want %v", err, ErrInvalidMFACode)
+	}
+}
+
+func TestGoogleSignInRequiresMFA(t *testing.T) {
+	env := newTestEnv(t)
+	mock := withGoogle(t, env)
+	mock.SetIdentity(oidctest.Identity{Subject: "g-1", Email: "ana@example.com", EmailVerified: true})
+
+	googleID := "g-1"
+	user := env.users.add(&models.User{Email: "ana@example.com", GoogleID: &googleID, EmailVerified: true})
+	enableMFA(t, env, user.ID)
+
+	rec := signIn(t, env.h.GoogleLoginHandler, env.h.GoogleCallbackHandler, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback answered %d: %s", rec.Code, rec.Body)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["mfa_required"] != true || body["access_token"] != nil {
+		t.Errorf("got %s, want an mfa challenge and no tokens", rec.Body)
+	}
+	if id, err := env.h.parseMFAChallenge(body["mfa_token"].(string)); err != nil || id != user.ID {
+		t.Errorf("challenge is for %s, %v, want %s", id, err, user.ID)
+	}
+	if len(env.sessions.created) != 0 {
+		t.Error("a session was created before the second factor")
+	}
+}
+
+func TestOAuthRedirectCarriesMFAChallenge(t *testing.T) {
+	env := newTestEnv(t)
+	env.h.Controller.auth.OAuthRedirectURL = "http://app.test/signed-in?from=google"
+	mock := withGoogle(t, env)
+	mock.SetIdentity(oidctest.Identity{Subject: "g-1", Email: "ana@example.com", EmailVerified: true})
+
+	googleID := "g-1"
+	user := env.users.add(&models.User{Email: "ana@example.com", GoogleID: &googleID, EmailVerified: true})
+	enableMFA(t, env, user.ID)
+
+	rec := signIn(t, env.h.GoogleLoginHandler, env.h.GoogleCallbackHandler, nil)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("callback answered %d: %s", rec.Code, rec.Body)
+	}
+
+	to, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if to.Host != "app.test" || to.Query().Get("from") != "google" || to.Query().Get("mfa_token") != "" {
+		t.Errorf("redirected to %s, want the app with the challenge only in the fragment", to)
+	}
+
+	fragment, _ := url.ParseQuery(to.Fragment)
+	if id, err := env.h.parseMFAChallenge(fragment.Get("mfa_token")); err != nil || id != user.ID {
+		t.Errorf("challenge is for %s, %v, want %s", id, err, user.ID)
+	}
+	if len(env.sessions.created) != 0 {
+		t.Error("a session was created before the second factor")
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "refresh_token" {
+			t.Error("a refresh token was set before the second factor")
+		}
+	}
+}
+
+func TestTakeOverDisablesMFA(t *testing.T) {
+	env := newTestEnv(t)
+	mock := withGoogle(t, env)
+	mock.SetIdentity(oidctest.Identity{Subject: "g-1", Email: "ana@example.com", EmailVerified: true})
+
+	// someone registered the address first and enrolled an authenticator of their own
+	squatter := env.users.add(&models.User{Email: "ana@example.com", Password: "squatter-hash"})
+	enableMFA(t, env, squatter.ID)
+
+	rec := signIn(t, env.h.GoogleLoginHandler, env.h.GoogleCallbackHandler, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback answered %d: %s", rec.Code, rec.Body)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["mfa_required"] == true || body["access_token"] == nil {
+		t.Errorf("got %s, want the owner signed in without the squatter's second factor", rec.Body)
+	}
+	if env.mfa.totp != nil || env.mfa.recovery != nil {
+		t.Error("the squatter's authenticator and recovery codes were kept")
+	}
+}
+
+func TestResetTakeOverDisablesMFA(t *testing.T) {
+	env := newTestEnv(t)
+
+	// the squatter never verified the address, the owner asks for a reset link and gets it
+	squatter := env.users.add(&models.User{Email: "ana@example.com", Password: "squatter-hash"})
+	enableMFA(t, env, squatter.ID)
+	token := requestReset(t, env, squatter)
+
+	if _, err := env.h.resetPassword(context.Background(), token, "owner-hash"); err != nil {
+		t.Fatal(err)
+	}
+
+	if env.mfa.totp != nil || env.mfa.recovery != nil {
+		t.Error("the squatter's authenticator and recovery codes were kept")
+	}
+	if user := env.users.get(squatter.ID); !user.EmailVerified {
+		t.Error("the reset did not verify the address")
+	}
+}
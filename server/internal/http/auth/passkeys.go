@@ -0,0 +1,391 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/mail"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/webauthn"
+)
+
+const (
+	passkeyStateAud = "passkey_state" // keeps the state from passing for any other token signed with the same secret
+
+	passkeyRegister = "register"
+	passkeyLogin    = "login"
+	passkeyMFA      = "mfa"
+
+	maxPasskeyName = 100
+)
+
+var (
+	// ErrPasskeyState is returned when a ceremony expired, was already finished or is for someone else
+	ErrPasskeyState = errors.New("passkey request expired, please try again")
+	// ErrPasskeyRejected is returned for responses that do not verify
+	ErrPasskeyRejected = errors.New("passkey could not be verified")
+)
+
+func NewPasskeys(config *Config, repo *repositories.Repositories) *Passkeys {
+	return &Passkeys{rp: webauthn.New(config.WebAuthn), repo: repo, secret: config.RefreshSecret}
+}
+
+// PasskeyAddedEmail tells users a passkey was added, since it signs in without the password
+func PasskeyAddedEmail(user *models.User, name string) mail.Message {
+	return mail.Message{
+		To:      user.Email,
+		Subject: "A passkey was added to your Kaiyo AI account",
+		Text: fmt.Sprintf(`Hi %s,
+
+A passkey named "%s" was just added to your Kaiyo AI account. It can be used to log in without your password.
+
+If this was not you, remove it under your account's security settings and change your password.
+`, greetingName(user), name),
+	}
+}
+
+// BeginRegistration starts adding a passkey to the user's account
+func (p *Passkeys) BeginRegistration(ctx context.Context, user *models.User) (*PasskeyCeremony, error) {
+	existing, err := p.credentials(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		name = user.Email
+	}
+
+	opts, session, err := p.rp.BeginRegistration(webauthn.User{
+		ID:          user.ID[:],
+		Name:        user.Email,
+		DisplayName: name,
+	}, existing)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.ceremony(passkeyRegister, user.ID, opts, session)
+}
+
+// FinishRegistration verifies the browser's response and stores the new passkey
+func (p *Passkeys) FinishRegistration(ctx context.Context, userID uuid.UUID, state string, resp *webauthn.RegistrationResponse, name string) (*models.Passkey, error) {
+	session, err := p.takeState(ctx, state, passkeyRegister, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	cred, err := p.rp.FinishRegistration(session, resp)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPasskeyRejected, err)
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if utf8.RuneCountInString(name) > maxPasskeyName {
+		name = string([]rune(name)[:maxPasskeyName])
+	}
+
+	passkey := &models.Passkey{
+		UserID:         userID,
+		CredentialID:   cred.ID,
+		PublicKey:      cred.PublicKey,
+		SignCount:      cred.SignCount,
+		Transports:     cred.Transports,
+		AAGUID:         cred.AAGUID,
+		BackupEligible: cred.BackupEligible,
+		BackedUp:       cred.BackedUp,
+		Name:           name,
+	}
+	if err := p.repo.Passkey.Create(ctx, passkey); err != nil {
+		return nil, err
+	}
+
+	return passkey, nil
+}
+
+// beginLogin starts an assertion. Without a user it is a passwordless login with any of the
+// site's passkeys, which must verify the user. With one it is the second factor after a
+// password, limited to that user's passkeys
+func (p *Passkeys) beginLogin(ctx context.Context, userID uuid.UUID) (*PasskeyCeremony, error) {
+	if userID == uuid.Nil {
+		opts, session, err := p.rp.BeginLogin(nil, webauthn.VerificationRequired)
+		if err != nil {
+			return nil, err
+		}
+		return p.ceremony(passkeyLogin, uuid.Nil, opts, session)
+	}
+
+	allowed, err := p.credentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(allowed) == 0 {
+		return nil, ErrPasskeyRejected
+	}
+
+	opts, session, err := p.rp.BeginLogin(allowed, webauthn.VerificationDiscouraged)
+	if err != nil {
+		return nil, err
+	}
+	return p.ceremony(passkeyMFA, userID, opts, session)
+}
+
+// finishLogin verifies an assertion and returns whose passkey it was
+func (p *Passkeys) finishLogin(ctx context.Context, state string, resp *webauthn.AssertionResponse, userID uuid.UUID) (uuid.UUID, error) {
+	purpose := passkeyLogin
+	if userID != uuid.Nil {
+		purpose = passkeyMFA
+	}
+
+	session, err := p.takeState(ctx, state, purpose, userID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	var passkey *models.Passkey
+	cred, err := p.rp.FinishLogin(session, resp, func(credentialID, userHandle []byte) (*webauthn.Credential, error) {
+		found, err := p.repo.Passkey.GetByCredentialID(ctx, credentialID)
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, ErrPasskeyRejected
+		}
+		if err != nil {
+			return nil, err
+		}
+		passkey = found
+
+		// a discoverable login is only told who signs in by the user handle
+		if userID == uuid.Nil && !bytes.Equal(userHandle, passkey.UserID[:]) {
+			return nil, ErrPasskeyRejected
+		}
+		if userID != uuid.Nil && passkey.UserID != userID {
+			return nil, ErrPasskeyRejected
+		}
+
+		return credentialFrom(passkey), nil
+	})
+	if errors.Is(err, webauthn.ErrInvalidResponse) || errors.Is(err, webauthn.ErrVerification) {
+		return uuid.Nil, fmt.Errorf("%w: %v", ErrPasskeyRejected, err)
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if err := p.repo.Passkey.RecordUse(ctx, passkey.ID, cred.SignCount, cred.BackedUp); err != nil {
+		return uuid.Nil, err
+	}
+
+	return passkey.UserID, nil
+}
+
+func (p *Passkeys) credentials(ctx context.Context, userID uuid.UUID) ([]webauthn.Credential, error) {
+	passkeys, err := p.repo.Passkey.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := make([]webauthn.Credential, 0, len(passkeys))
+	for i := range passkeys {
+		creds = append(creds, *credentialFrom(&passkeys[i]))
+	}
+	return creds, nil
+}
+
+func credentialFrom(p *models.Passkey) *webauthn.Credential {
+	return &webauthn.Credential{
+		ID:             p.CredentialID,
+		PublicKey:      p.PublicKey,
+		SignCount:      p.SignCount,
+		Transports:     p.Transports,
+		AAGUID:         p.AAGUID,
+		BackupEligible: p.BackupEligible,
+		BackedUp:       p.BackedUp,
+	}
+}
+
+func (p *Passkeys) ceremony(purpose string, userID uuid.UUID, opts any, session *webauthn.Session) (*PasskeyCeremony, error) {
+	st := passkeyState{Purpose: purpose, Session: *session}
+	st.Audience = jwt.ClaimStrings{passkeyStateAud}
+	st.ExpiresAt = jwt.NewNumericDate(time.Now().Add(webauthn.Timeout))
+	if userID != uuid.Nil {
+		st.Subject = userID.String()
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, st).SignedString(p.secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign passkey state: %w", err)
+	}
+
+	return &PasskeyCeremony{PublicKey: opts, State: signed}, nil
+}
+
+// takeState checks a ceremony's state and spends its challenge, so each response is only
+// accepted once
+func (p *Passkeys) takeState(ctx context.Context, token, purpose string, userID uuid.UUID) (*webauthn.Session, error) {
+	st := &passkeyState{}
+	_, err := jwt.ParseWithClaims(token, st, func(t *jwt.Token) (any, error) {
+		return p.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired(), jwt.WithAudience(passkeyStateAud))
+	if err != nil || st.Purpose != purpose {
+		return nil, ErrPasskeyState
+	}
+
+	subject := ""
+	if userID != uuid.Nil {
+		subject = userID.String()
+	}
+	if st.Subject != subject {
+		return nil, ErrPasskeyState
+	}
+
+	err = p.repo.Passkey.SpendChallenge(ctx, models.HashToken(st.Session.Challenge), st.ExpiresAt.Time)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, ErrPasskeyState
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &st.Session, nil
+}
+
+// POST /auth/passkey/login/begin
+func (h *Handler) PasskeyLoginBeginHandler(w http.ResponseWriter, r *http.Request) {
+	ceremony, err := h.Passkeys.beginLogin(r.Context(), uuid.Nil)
+	if err != nil {
+		slog.Error("Could not start passkey login", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(ceremony); err != nil {
+		slog.Error("Could not encode passkey options", slog.String("error", err.Error()))
+	}
+}
+
+// POST /auth/passkey/login/finish
+func (h *Handler) PasskeyLoginFinishHandler(w http.ResponseWriter, r *http.Request) {
+	var req PasskeyLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.State == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		h.SendError(w, fmt.Errorf("invalid request"), "The state and a credential are required")
+		return
+	}
+
+	userID, err := h.Passkeys.finishLogin(r.Context(), req.State, &req.Credential, uuid.Nil)
+	if err != nil {
+		h.passkeyFailed(w, err)
+		return
+	}
+
+	h.passkeySignIn(w, r, userID)
+}
+
+// POST /auth/login/mfa/passkey/begin
+func (h *Handler) MFAPasskeyBeginHandler(w http.ResponseWriter, r *http.Request) {
+	var req MFAPasskeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		h.SendError(w, fmt.Errorf("invalid request"), "The mfa token is required")
+		return
+	}
+
+	userID, err := h.parseMFAChallenge(req.MFAToken)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		h.SendError(w, err, "Login expired, please start again")
+		return
+	}
+
+	ceremony, err := h.Passkeys.beginLogin(r.Context(), userID)
+	if errors.Is(err, ErrPasskeyRejected) {
+		w.WriteHeader(http.StatusBadRequest)
+		h.SendError(w, err, "This account has no passkeys")
+		return
+	}
+	if err != nil {
+		slog.Error("Could not start passkey login", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(ceremony); err != nil {
+		slog.Error("Could not encode passkey options", slog.String("error", err.Error()))
+	}
+}
+
+// POST /auth/login/mfa/passkey/finish
+func (h *Handler) MFAPasskeyFinishHandler(w http.ResponseWriter, r *http.Request) {
+	var req MFAPasskeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" || req.State == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		h.SendError(w, fmt.Errorf("invalid request"), "The mfa token, state and a credential are required")
+		return
+	}
+
+	userID, err := h.parseMFAChallenge(req.MFAToken)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		h.SendError(w, err, "Login expired, please start again")
+		return
+	}
+
+	if _, err := h.Passkeys.finishLogin(r.Context(), req.State, &req.Credential, userID); err != nil {
+		h.passkeyFailed(w, err)
+		return
+	}
+
+	h.passkeySignIn(w, r, userID)
+}
+
+// passkeySignIn completes a login the user proved with a passkey
+func (h *Handler) passkeySignIn(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	user, err := h.Repo.User.GetByID(r.Context(), userID)
+	if errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		slog.Error("Could not load user", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	access, err := h.issueTokens(w, r, user)
+	if err != nil {
+		slog.Error("Could not issue tokens", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.loginCompleted(r, user)
+	h.loginSucceeded(w, user, access)
+}
+
+func (h *Handler) passkeyFailed(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrPasskeyState):
+		w.WriteHeader(http.StatusUnauthorized)
+		h.SendError(w, err, "Login expired, please start again")
+	case errors.Is(err, ErrPasskeyRejected):
+		slog.Warn("Passkey rejected", slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusUnauthorized)
+		h.SendError(w, ErrPasskeyRejected, "The passkey could not be verified")
+	default:
+		slog.Error("Could not finish passkey login", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
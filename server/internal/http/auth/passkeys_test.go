@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/oidc/oidctest"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/webauthn"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/webauthn/webauthntest"
+)
+
+// addPasskey registers a passkey on the authenticator for the user
+func addPasskey(t *testing.T, env *testEnv, a *webauthntest.Authenticator, user *models.User) *models.Passkey {
+	t.Helper()
+
+	ceremony, err := env.h.Passkeys.BeginRegistration(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := a.Create(ceremony.PublicKey.(*webauthn.CreationOptions))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passkey, err := env.h.Passkeys.FinishRegistration(context.Background(), user.ID, ceremony.State, resp, "Laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return passkey
+}
+
+func post(handler http.HandlerFunc, body any) *httptest.ResponseRecorder {
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/auth/passkey", bytes.NewReader(b))
+	req.RemoteAddr = "203.0.113.7:4000"
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// beginPasskeyLogin starts a passwordless login and answers it with the authenticator
+func beginPasskeyLogin(t *testing.T, env *testEnv, a *webauthntest.Authenticator) PasskeyLoginRequest {
+	t.Helper()
+
+	rec := post(env.h.PasskeyLoginBeginHandler, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("begin answered %d: %s", rec.Code, rec.Body)
+	}
+
+	var ceremony struct {
+		PublicKey webauthn.RequestOptions `json:"publicKey"`
+		State     string                  `json:"state"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &ceremony); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := a.Get(&ceremony.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return PasskeyLoginRequest{State: ceremony.State, Credential: *resp}
+}
+
+func TestPasskeyRegistrationState(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.users.add(&models.User{Email: "ana@example.com", EmailVerified: true})
+	a := webauthntest.New("http://app.test")
+
+	ceremony, err := env.h.Passkeys.BeginRegistration(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := a.Create(ceremony.PublicKey.(*webauthn.CreationOptions))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the state is bound to the user who started the ceremony
+	other := env.users.add(&models.User{Email: "bo@example.com"})
+	if _, err := env.h.Passkeys.FinishRegistration(context.Background(), other.ID, ceremony.State, resp, ""); !errors.Is(err, ErrPasskeyState) {
+		t.Errorf("other user: got %v, want %v", err, ErrPasskeyState)
+	}
+
+	if _, err := env.h.Passkeys.FinishRegistration(context.Background(), user.ID, ceremony.State, resp, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.h.Passkeys.FinishRegistration(context.Background(), user.ID, ceremony.State, resp, ""); !errors.Is(err, ErrPasskeyState) {
+		t.Errorf("spent challenge: got %v, want %v", err, ErrPasskeyState)
+	}
+	if list, _ := env.passkeys.ListByUser(context.Background(), user.ID); len(list) != 1 {
+		t.Errorf("user has %d passkeys, want 1", len(list))
+	}
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.users.add(&models.User{Email: "ana@example.com", EmailVerified: true})
+	a := webauthntest.New("http://app.test")
+	a.Counter = true
+	addPasskey(t, env, a, user)
+
+	req := beginPasskeyLogin(t, env, a)
+	rec := post(env.h.PasskeyLoginFinishHandler, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("finish answered %d: %s", rec.Code, rec.Body)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.AccessToken == "" {
+		t.Fatalf("no access token in %s", rec.Body)
+	}
+	if len(env.sessions.created) != 1 {
+		t.Errorf("created %d sessions, want 1", len(env.sessions.created))
+	}
+
+	// passkey logins are audited like password ones
+	attempts := env.logins.attempts
+	if len(attempts) != 1 || !attempts[0].Success || attempts[0].UserID == nil || *attempts[0].UserID != user.ID {
+		t.Errorf("audited %+v, want one successful login for %s", attempts, user.ID)
+	}
+
+	if list, _ := env.passkeys.ListByUser(context.Background(), user.ID); list[0].SignCount != 1 {
+		t.Errorf("stored sign count %d, want 1", list[0].SignCount)
+	}
+
+	// the same response again, its challenge is spent
+	if rec := post(env.h.PasskeyLoginFinishHandler, req); rec.Code != http.StatusUnauthorized {
+		t.Errorf("replay answered %d, want 401", rec.Code)
+	}
+	if len(env.sessions.created) != 1 {
+		t.Error("a replayed response signed in")
+	}
+}
+
+func TestPasskeyLoginRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, env *testEnv, a *webauthntest.Authenticator)
+	}{
+		{
+			name: "other origin",
+			prepare: func(t *testing.T, env *testEnv, a *webauthntest.Authenticator) {
+				a.Origin = "http://evil.test"
+			},
+		},
+		{
+			name: "user not verified",
+			prepare: func(t *testing.T, env *testEnv, a *webauthntest.Authenticator) {
+				a.SkipVerification = true
+			},
+		},
+		{
+			name: "sign count went backwards",
+			prepare: func(t *testing.T, env *testEnv, a *webauthntest.Authenticator) {
+				// the stored counter is ahead of the authenticator's, as it would be for a clone
+				env.passkeys.passkeys[0].SignCount = 10
+			},
+		},
+		{
+			name: "passkey was removed",
+			prepare: func(t *testing.T, env *testEnv, a *webauthntest.Authenticator) {
+				env.passkeys.passkeys = nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			user := env.users.add(&models.User{Email: "ana@example.com", EmailVerified: true})
+			a := webauthntest.New("http://app.test")
+			a.Counter = true
+			addPasskey(t, env, a, user)
+			tt.prepare(t, env, a)
+
+			rec := post(env.h.PasskeyLoginFinishHandler, beginPasskeyLogin(t, env, a))
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("finish answered %d: %s, want 401", rec.Code, rec.Body)
+			}
+			if len(env.sessions.created) != 0 {
+				t.Error("a session was created")
+			}
+		})
+	}
+}
+
+func TestTakeOverRemovesPasskeys(t *testing.T) {
+	env := newTestEnv(t)
+	mock := withGoogle(t, env)
+	mock.SetIdentity(oidctest.Identity{Subject: "g-1", Email: "ana@example.com", EmailVerified: true})
+
+	// someone registered the address first and added a passkey of their own
+	squatter := env.users.add(&models.User{Email: "ana@example.com", Password: "squatter-hash"})
+	a := webauthntest.New("http://app.test")
+	addPasskey(t, env, a, squatter)
+
+	if rec := signIn(t, env.h.GoogleLoginHandler, env.h.GoogleCallbackHandler, nil); rec.Code != http.StatusOK {
+		t.Fatalf("callback answered %d: %s", rec.Code, rec.Body)
+	}
+	if list, _ := env.passkeys.ListByUser(context.Background(), squatter.ID); len(list) != 0 {
+		t.Errorf("the squatter kept %d passkeys", len(list))
+	}
+
+	created := len(env.sessions.created)
+	if rec := post(env.h.PasskeyLoginFinishHandler, beginPasskeyLogin(t, env, a)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("the squatter's passkey login answered %d, want 401", rec.Code)
+	}
+	if len(env.sessions.created) != created {
+		t.Error("the squatter's passkey signed in")
+	}
+}
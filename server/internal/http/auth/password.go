@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/mail"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// resets are limited like verification emails, per user and window
+const resetLimit = 3
+
+// ValidatePassword applies the signup password rules
+func ValidatePassword(password string) error {
+	return validatePassword(password)
+}
+
+// HashPassword hashes a password the way it is stored
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCostFactor)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches the stored hash
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// PasswordChangedEmail tells users their password changed, so they notice if it was not them
+func PasswordChangedEmail(user *models.User) mail.Message {
+	return mail.Message{
+		To:      user.Email,
+		Subject: "Your Kaiyo AI password was changed",
+		Text: fmt.Sprintf(`Hi %s,
+
+The password of your Kaiyo AI account was just changed and every device was signed out.
+
+If this was not you, reset your password right away with "Forgot password" on the login page.
+`, greetingName(user)),
+	}
+}
+
+// sendPasswordReset mails the user a reset link, earlier links stop working
+func (h *Handler) sendPasswordReset(ctx context.Context, user *models.User) error {
+	sent, err := h.Repo.UserToken.CountSince(ctx, user.ID, models.TokenPurposeResetPassword, time.Now().Add(-verificationWindow))
+	if err != nil {
+		return err
+	}
+	if sent >= resetLimit {
+		return errTooManyEmails
+	}
+
+	token, err := models.NewToken()
+	if err != nil {
+		return err
+	}
+
+	err = h.Repo.UserToken.Create(ctx, &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposeResetPassword,
+		TokenHash: models.HashToken(token),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(h.Controller.auth.ResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := h.Controller.auth.AppURL + "/reset-password?token=" + url.QueryEscape(token)
+
+	return h.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Kaiyo AI password",
+		Text: fmt.Sprintf(`Hi %s,
+
+Someone asked to reset the password of your Kaiyo AI account. To choose a new one, open the link below:
+
+%s
+
+The link works once and expires in %s. If you did not ask for this you can ignore this email, your password stays the same.
+`, greetingName(user), link, h.Controller.auth.ResetTTL),
+	})
+}
+
+// POST /auth/forgot-password
+func (h *Handler) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Email) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		h.SendError(w, fmt.Errorf("invalid request"), "An email is required")
+		return
+	}
+
+	// every request gets the same answer at the same speed, whether or not the account exists
+	go func(email string) {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+
+		user, err := h.Repo.User.GetByEmail(ctx, email)
+		if err != nil {
+			return
+		}
+
+		if err := h.sendPasswordReset(ctx, user); err != nil {
+			slog.Warn("Could not send password reset email",
+				slog.String("user_id", user.ID.String()),
+				slog.String("error", err.Error()))
+		}
+	}(strings.TrimSpace(req.Email))
+
+	w.WriteHeader(http.StatusAccepted)
+	err := json.NewEncoder(w).Encode(map[string]string{
+		"message": "If an account exists for this email, a reset link is on its way",
+	})
+
+	if err != nil {
+		slog.Error("Could not respond to forgot password request", slog.String("error", err.Error()))
+	}
+}
+
+// POST /auth/reset-password
+func (h *Handler) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		h.SendError(w, fmt.Errorf("invalid request"), "A token is required")
+		return
+	}
+
+	// checked before the token is used up, so a weak password can be corrected with the same link
+	if err := validatePassword(req.Password); err != nil {
+		w.WriteHeader(http.StatusNotAcceptable)
+		h.SendError(w, fmt.Errorf("Validation failed"), ValidationErrors{"password": err.Error()})
+		return
+	}
+
+	hash, err := HashPassword(req.Password)
+	if err != nil {
+		slog.Error("could not hash the password", slog.String("error", err.Error()))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.resetPassword(r.Context(), req.Token, hash)
+	if errors.Is(err, models.ErrNotFound) {
+		w.WriteHeader(http.StatusBadRequest)
+		h.SendError(w, fmt.Errorf("invalid token"), "The link is invalid, expired or was already used")
+		return
+	}
+	if err != nil {
+		slog.Error("Could not reset password", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	mail.SendAsync(h.Mailer, PasswordChangedEmail(user))
+	slog.Info("Password reset", slog.String("user_id", user.ID.String()))
+
+	err = json.NewEncoder(w).Encode(map[string]string{
+		"message": "Password changed, please log in again",
+	})
+
+	if err != nil {
+		slog.Error("Could not respond to reset password request", slog.String("error", err.Error()))
+	}
+}
+
+// resetPassword uses up a reset token and replaces the password of the user it was sent to.
+// Every session is revoked, whoever knew the old password is signed out
+func (h *Handler) resetPassword(ctx context.Context, rawToken, hash string) (*models.User, error) {
+	token, err := h.Repo.UserToken.Consume(ctx, models.TokenPurposeResetPassword, models.HashToken(rawToken))
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.Repo.User.GetByID(ctx, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// a link sent before an email change is not proof of owning the current address
+	if !strings.EqualFold(user.Email, token.Email) {
+		return nil, models.ErrNotFound
+	}
+
+	if err := h.Repo.User.UpdatePassword(ctx, user.ID, hash); err != nil {
+		return nil, err
+	}
+
+	// the link reached the inbox, which verifies the address as well as a verification link would.
+	// An account unverified until now is taken over, as when a provider vouches for the address
+	if user.EmailVerified {
+		if err := h.Repo.Session.RevokeSessionByUserID(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		h.Sessions.ForgetUser(user.ID)
+	} else {
+		if err := h.takeOverUnverified(ctx, user); err != nil {
+			return nil, err
+		}
+		if err := h.Repo.User.MarkEmailVerified(ctx, user.ID, token.Email); err != nil {
+			slog.Warn("Could not mark email verified", slog.String("user_id", user.ID.String()), slog.String("error", err.Error()))
+		}
+	}
+
+	// whoever reset the password proved they own the account, guesses by others no longer lock it
+	if err := h.Repo.Login.Clear(ctx, accountKey(user.Email)); err != nil {
+		slog.Warn("Could not clear login failures", slog.String("user_id", user.ID.String()), slog.String("error", err.Error()))
+	}
+
+	return user, nil
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var resetLink = regexp.MustCompile(`/reset-password\?token=(\S+)`)
+
+// requestReset mails the user a reset link and returns the token in it
+func requestReset(t *testing.T, env *testEnv, user *models.User) string {
+	t.Helper()
+
+	if err := env.h.sendPasswordReset(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+
+	env.mailer.mu.Lock()
+	defer env.mailer.mu.Unlock()
+
+	msg := env.mailer.sent[len(env.mailer.sent)-1]
+	m := resetLink.FindStringSubmatch(msg.Text)
+	if msg.To != user.Email || m == nil {
+		t.Fatalf("reset email %+v has no link", msg)
+	}
+	token, err := url.QueryUnescape(m[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func resetPassword(h *Handler, token, password string) *httptest.ResponseRecorder {
+	b, _ := json.Marshal(ResetPasswordRequest{Token: token, Password: password})
+	rec := httptest.NewRecorder()
+	h.ResetPasswordHandler(rec, httptest.NewRequest(http.MethodPost, "/auth/reset-password", bytes.NewReader(b)))
+	return rec
+}
+
+func TestResetPassword(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.users.add(&models.User{Email: "ana@example.com", Password: "old-hash", EmailVerified: true})
+	refresh, _ := startSession(t, env, user)
+
+	token := requestReset(t, env, user)
+
+	// a weak password leaves the link usable
+	if rec := resetPassword(env.h, token, "short"); rec.Code != http.StatusNotAcceptable {
+		t.Fatalf("weak password answered %d, want 406", rec.Code)
+	}
+
+	if rec := resetPassword(env.h, token, "N3w-Passw0rd!"); rec.Code != http.StatusOK {
+		t.Fatalf("reset answered %d: %s", rec.Code, rec.Body)
+	}
+	if got := env.users.get(user.ID).Password; got == "old-hash" {
+		t.Error("the new password was not stored")
+	}
+
+	// whoever knew the old password is signed out
+	if rec := withRefreshCookie(env.h.EmailRefreshHandler, http.MethodGet, refresh); rec.Code != http.StatusUnauthorized {
+		t.Errorf("session answered %d after the reset, want 401", rec.Code)
+	}
+
+	// the link works once
+	hash, _ := bcrypt.GenerateFromPassword([]byte("An0ther-Passw0rd!"), bcrypt.MinCost)
+	if _, err := env.h.resetPassword(context.Background(), token, string(hash)); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("second use: got %v, want %v", err, models.ErrNotFound)
+	}
+	if got := env.users.get(user.ID).Password; got == string(hash) {
+		t.Error("the spent link changed the password")
+	}
+}
+
+func TestResetPasswordChecksEmail(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.users.add(&models.User{Email: "ana@example.com", Password: "old-hash", EmailVerified: true})
+
+	token := requestReset(t, env, user)
+
+	// the address changed after the link went out, the old inbox no longer speaks for the account
+	env.users.mu.Lock()
+	env.users.users[user.ID].Email = "ana@work.example"
+	env.users.mu.Unlock()
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("N3w-Passw0rd!"), bcrypt.MinCost)
+	if _, err := env.h.resetPassword(context.Background(), token, string(hash)); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("got %v, want %v", err, models.ErrNotFound)
+	}
+	if got := env.users.get(user.ID).Password; got != "old-hash" {
+		t.Errorf("password changed to %q", got)
+	}
+}
@@ -3,25 +3,51 @@ package auth
 import (
 	"net/http"
 
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/mail"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/oidc"
 	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
 )
 
-func New(config *Config, repo *repositories.Repositories) *http.ServeMux {
+func New(config *Config, repo *repositories.Repositories, sessions *SessionCache, mailer mail.Mailer, passkeys *Passkeys) *http.ServeMux {
 	ctrl := NewController(config)
 	val := NewValidator()
-	h := NewHandler(ctrl, repo, val)
-	mux := http.NewServeMux()
+	h := NewHandler(ctrl, repo, val, sessions, mailer)
+	if config.Google != nil {
+		h.Google = oidc.NewProvider(*config.Google)
+	}
+	h.Passkeys = passkeys
+
+	// the dummy hash takes as long as a login, make it before the first one needs it
+	go dummyHash()
 
-	dummy := func(w http.ResponseWriter, r *http.Request) {
-		// TODO: implement dummy handler logic
+	h.Providers = make(map[string]*oidc.Provider, len(config.Providers))
+	for _, p := range config.Providers {
+		h.Providers[p.Name] = oidc.NewProvider(p)
 	}
+	mux := http.NewServeMux()
 
 	mux.HandleFunc("POST /login", h.EmailLoginHandler)
+	mux.HandleFunc("POST /login/mfa", h.LoginMFAHandler)
+	mux.HandleFunc("POST /login/mfa/passkey/begin", h.MFAPasskeyBeginHandler)
+	mux.HandleFunc("POST /login/mfa/passkey/finish", h.MFAPasskeyFinishHandler)
 	mux.HandleFunc("POST /signin", h.EmailSignInHandler)
 	mux.HandleFunc("GET /logout", h.EmailLogoutHandler)
+	mux.HandleFunc("POST /logout-all", h.EmailLogoutAllHandler)
 	mux.HandleFunc("GET /refresh", h.EmailRefreshHandler)
+	mux.HandleFunc("POST /verify-email", h.VerifyEmailHandler)
+	mux.HandleFunc("POST /resend-verification", h.ResendVerificationHandler)
+	mux.HandleFunc("POST /forgot-password", h.ForgotPasswordHandler)
+	mux.HandleFunc("POST /reset-password", h.ResetPasswordHandler)
+
+	mux.HandleFunc("POST /passkey/login/begin", h.PasskeyLoginBeginHandler)
+	mux.HandleFunc("POST /passkey/login/finish", h.PasskeyLoginFinishHandler)
+
+	mux.HandleFunc("GET /google/login", h.GoogleLoginHandler)
+	mux.HandleFunc("GET /google/callback", h.GoogleCallbackHandler)
 
-	mux.HandleFunc("GET /google/callback", dummy)
+	mux.HandleFunc("GET /oidc", h.ListProvidersHandler)
+	mux.HandleFunc("GET /oidc/{provider}/login", h.OIDCLoginHandler)
+	mux.HandleFunc("GET /oidc/{provider}/callback", h.OIDCCallbackHandler)
 
 	return mux
 }
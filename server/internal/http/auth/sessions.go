@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+const (
+	sessionCacheTTL  = 30 * time.Second
+	sessionCacheSize = 10000
+)
+
+type sessionEntry struct {
+	userID    uuid.UUID
+	active    bool
+	checkedAt time.Time
+}
+
+// SessionCache answers whether the session an access token was issued for is still active.
+// Answers are kept for a short while so not every request costs a query, a revocation on
+// another replica therefore takes up to sessionCacheTTL to reach this one
+type SessionCache struct {
+	sessions repositories.SessionRepository
+
+	mu      sync.Mutex
+	entries map[uuid.UUID]sessionEntry
+}
+
+func NewSessionCache(sessions repositories.SessionRepository) *SessionCache {
+	return &SessionCache{
+		sessions: sessions,
+		entries:  make(map[uuid.UUID]sessionEntry),
+	}
+}
+
+// Active reports whether the session family is neither revoked nor expired
+func (c *SessionCache) Active(ctx context.Context, familyID uuid.UUID, userID uuid.UUID) (bool, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[familyID]
+	c.mu.Unlock()
+
+	if ok && now.Sub(entry.checkedAt) < sessionCacheTTL {
+		return entry.active && entry.userID == userID, nil
+	}
+
+	active, err := c.sessions.FamilyActive(ctx, familyID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= sessionCacheSize {
+		c.evict(now)
+	}
+	c.entries[familyID] = sessionEntry{userID: userID, active: active, checkedAt: now}
+
+	return active, nil
+}
+
+// Forget drops a session family so its revocation takes effect here immediately
+func (c *SessionCache) Forget(familyID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, familyID)
+}
+
+// ForgetUser drops every cached session of a user
+func (c *SessionCache) ForgetUser(userID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, entry := range c.entries {
+		if entry.userID == userID {
+			delete(c.entries, id)
+		}
+	}
+}
+
+// evict drops stale entries, and everything if that was not enough. Caller holds mu
+func (c *SessionCache) evict(now time.Time) {
+	for id, entry := range c.entries {
+		if now.Sub(entry.checkedAt) >= sessionCacheTTL {
+			delete(c.entries, id)
+		}
+	}
+
+	if len(c.entries) >= sessionCacheSize {
+		c.entries = make(map[uuid.UUID]sessionEntry)
+	}
+}
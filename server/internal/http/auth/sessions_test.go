@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+// startSession logs the user in on a new device and returns its refresh token
+func startSession(t *testing.T, env *testEnv, user *models.User) (string, *models.Session) {
+	t.Helper()
+
+	refresh, err := env.h.Controller.GenerateRefreshToken(user.ID, user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := env.h.createSession(httptest.NewRequest(http.MethodPost, "/auth/login", nil), user.ID, refresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return refresh, session
+}
+
+// withRefreshCookie calls the handler the way the browser does, with the refresh cookie
+func withRefreshCookie(handler http.HandlerFunc, method, refresh string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/auth", nil)
+	req.AddCookie(&http.Cookie{Name: "refresh_token", Value: refresh})
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// refreshCookie returns the refresh cookie the response set, nil if it set none
+func refreshCookie(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "refresh_token" {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestRefreshRotatesSession(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.users.add(&models.User{Email: "ana@example.com", EmailVerified: true})
+	refresh, _ := startSession(t, env, user)
+
+	for range 3 {
+		rec := withRefreshCookie(env.h.EmailRefreshHandler, http.MethodGet, refresh)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("refresh answered %d: %s", rec.Code, rec.Body)
+		}
+
+		cookie := refreshCookie(rec)
+		if cookie == nil || cookie.Value == "" || cookie.Value == refresh {
+			t.Fatalf("refresh set cookie %+v, want a new token", cookie)
+		}
+		refresh = cookie.Value
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	user := env.users.add(&models.User{Email: "ana@example.com", EmailVerified: true})
+
+	stolen, session := startSession(t, env, user)
+	laptop, _ := startSession(t, env, user)
+
+	rec := withRefreshCookie(env.h.EmailRefreshHandler, http.MethodGet, stolen)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh answered %d: %s", rec.Code, rec.Body)
+	}
+	current := refreshCookie(rec).Value
+
+	// access tokens of the family pass the middleware until the reuse
+	if active, err := env.h.Sessions.Active(ctx, session.FamilyID, user.ID); err != nil || !active {
+		t.Fatalf("family active: got %v, %v", active, err)
+	}
+
+	// the rotated token comes back, from the thief or a replaying client
+	rec = withRefreshCookie(env.h.EmailRefreshHandler, http.MethodGet, stolen)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("reused token answered %d, want 401", rec.Code)
+	}
+	if cookie := refreshCookie(rec); cookie == nil || cookie.MaxAge >= 0 {
+		t.Errorf("reuse did not clear the cookie: %+v", cookie)
+	}
+
+	// whoever holds the latest token is signed out with it, at once
+	if rec := withRefreshCookie(env.h.EmailRefreshHandler, http.MethodGet, current); rec.Code != http.StatusUnauthorized {
+		t.Errorf("latest token of the family answered %d, want 401", rec.Code)
+	}
+	if active, err := env.h.Sessions.Active(ctx, session.FamilyID, user.ID); err != nil || active {
+		t.Errorf("family active after reuse: got %v, %v", active, err)
+	}
+
+	// other logins of the user are not affected
+	if rec := withRefreshCookie(env.h.EmailRefreshHandler, http.MethodGet, laptop); rec.Code != http.StatusOK {
+		t.Errorf("other device answered %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestLogoutAll(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.users.add(&models.User{Email: "ana@example.com", EmailVerified: true})
+	other := env.users.add(&models.User{Email: "bo@example.com", EmailVerified: true})
+
+	phone, _ := startSession(t, env, user)
+	laptop, _ := startSession(t, env, user)
+	others, _ := startSession(t, env, other)
+
+	rec := withRefreshCookie(env.h.EmailLogoutAllHandler, http.MethodPost, phone)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("logout-all answered %d: %s", rec.Code, rec.Body)
+	}
+	if cookie := refreshCookie(rec); cookie == nil || cookie.MaxAge >= 0 {
+		t.Errorf("logout-all did not clear the cookie: %+v", cookie)
+	}
+
+	for name, refresh := range map[string]string{"phone": phone, "laptop": laptop} {
+		if rec := withRefreshCookie(env.h.EmailRefreshHandler, http.MethodGet, refresh); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s refreshed with %d after logout-all, want 401", name, rec.Code)
+		}
+	}
+	if rec := withRefreshCookie(env.h.EmailRefreshHandler, http.MethodGet, others); rec.Code != http.StatusOK {
+		t.Errorf("another user's session answered %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestLogoutAllNeedsLiveSession(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.users.add(&models.User{Email: "ana@example.com", EmailVerified: true})
+	stolen, _ := startSession(t, env, user)
+
+	rec := withRefreshCookie(env.h.EmailRefreshHandler, http.MethodGet, stolen)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh answered %d: %s", rec.Code, rec.Body)
+	}
+	current := refreshCookie(rec).Value
+
+	// a rotated token is no proof of a login, it must not sign the owner out everywhere
+	if rec := withRefreshCookie(env.h.EmailLogoutAllHandler, http.MethodPost, stolen); rec.Code != http.StatusUnauthorized {
+		t.Errorf("rotated token answered %d, want 401", rec.Code)
+	}
+	if env.sessions.revokedFor(user.ID) {
+		t.Error("rotated token revoked the user's sessions")
+	}
+	if rec := withRefreshCookie(env.h.EmailRefreshHandler, http.MethodGet, current); rec.Code != http.StatusOK {
+		t.Errorf("owner's session answered %d: %s", rec.Code, rec.Body)
+	}
+}
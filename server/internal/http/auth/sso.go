@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/oidc"
+)
+
+var (
+	errDomainNotAllowed = errors.New("this email domain may not sign in with this provider")
+	errAccountDisabled  = errors.New("this account has been disabled")
+	errAccountExists    = errors.New("an account with this email already exists, sign in with its password or provider")
+)
+
+func callbackPath(provider string) string {
+	return "/auth/oidc/" + provider + "/"
+}
+
+// GET /auth/oidc
+func (h *Handler) ListProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	providers := make([]ProviderInfo, 0, len(h.Providers))
+	for name, p := range h.Providers {
+		providers = append(providers, ProviderInfo{
+			Name:        name,
+			DisplayName: p.DisplayName,
+			LoginURL:    callbackPath(name) + "login",
+		})
+	}
+	slices.SortFunc(providers, func(a, b ProviderInfo) int { return strings.Compare(a.Name, b.Name) })
+
+	if err := json.NewEncoder(w).Encode(providers); err != nil {
+		slog.Error("Could not encode providers", slog.String("error", err.Error()))
+	}
+}
+
+// GET /auth/oidc/{provider}/login
+func (h *Handler) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.Providers[r.PathValue("provider")]
+	if !ok {
+		http.Error(w, "Unknown sign in provider", http.StatusNotFound)
+		return
+	}
+
+	h.startOAuth(w, r, provider, callbackPath(provider.Name))
+}
+
+// GET /auth/oidc/{provider}/callback
+func (h *Handler) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.Providers[r.PathValue("provider")]
+	if !ok {
+		http.Error(w, "Unknown sign in provider", http.StatusNotFound)
+		return
+	}
+
+	claims, err := h.finishOAuth(w, r, provider, callbackPath(provider.Name))
+	if err != nil {
+		return
+	}
+
+	user, err := h.oidcUser(r.Context(), provider, claims)
+	switch {
+	case errors.Is(err, errDomainNotAllowed):
+		h.oauthFailed(w, r, http.StatusForbidden, "domain_not_allowed", err)
+		return
+	case errors.Is(err, errEmailNotVerified):
+		h.oauthFailed(w, r, http.StatusForbidden, "email_not_verified", err)
+		return
+	case errors.Is(err, errAccountDisabled):
+		h.oauthFailed(w, r, http.StatusForbidden, "account_disabled", err)
+		return
+	case errors.Is(err, errAccountExists):
+		h.oauthFailed(w, r, http.StatusConflict, "account_exists", err)
+		return
+	case err != nil:
+		slog.Error("Could not sign in with provider", slog.String("provider", provider.Name), slog.String("error", err.Error()))
+		h.oauthFailed(w, r, http.StatusInternalServerError, "server_error", err)
+		return
+	}
+
+	h.completeOAuth(w, r, user, provider.Name)
+}
+
+// oidcUser finds or provisions the user an identity belongs to. A known identity signs in its
+// user, otherwise it is linked to the user with the same verified email or a new user is
+// created for it. Linking to an existing user needs the email to be at one of the provider's
+// allowed domains, a provider without them could claim anyone's address. The domain restriction
+// is checked on every sign in so tightening it shuts out identities that were linked before
+func (h *Handler) oidcUser(ctx context.Context, provider *oidc.Provider, claims *oidc.Claims) (*models.User, error) {
+	if !provider.AllowsEmail(claims.Email) {
+		return nil, errDomainNotAllowed
+	}
+
+	identity, err := h.Repo.Identity.Get(ctx, provider.Name, claims.Subject)
+	if err == nil {
+		user, err := h.Repo.User.GetByID(ctx, identity.UserID)
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, errAccountDisabled
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := h.Repo.Identity.Touch(ctx, provider.Name, claims.Subject, claims.Email); err != nil {
+			slog.Error("Could not record sign in", slog.String("provider", provider.Name), slog.String("error", err.Error()))
+		}
+
+		return user, nil
+	}
+	if !errors.Is(err, models.ErrNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" || !(bool(claims.EmailVerified) || provider.TrustEmail) {
+		return nil, errEmailNotVerified
+	}
+
+	password, err := unusablePassword()
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.Repo.User.GetByEmail(ctx, claims.Email)
+	if err == nil && !provider.ManagesEmail(claims.Email) {
+		return nil, errAccountExists
+	}
+	if errors.Is(err, models.ErrNotFound) {
+		// just in time provisioning, the provider has vouched for who this is
+		firstName, lastName := claims.GivenName, claims.FamilyName
+		if firstName == "" && lastName == "" {
+			firstName, lastName, _ = strings.Cut(strings.TrimSpace(claims.Name), " ")
+		}
+
+		user = &models.User{
+			ID:            uuid.New(),
+			Email:         claims.Email,
+			FirstName:     truncate(firstName, 50),
+			LastName:      truncate(lastName, 50),
+			UserName:      usernameFor(claims.Email),
+			Password:      password,
+			EmailVerified: true,
+			IsActive:      true,
+		}
+
+		if err := h.Repo.User.Create(ctx, user); err != nil {
+			return nil, err
+		}
+		slog.Info("Provisioned user", slog.String("provider", provider.Name), slog.String("user_id", user.ID.String()))
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = h.Repo.Identity.Link(ctx, &models.UserIdentity{
+		Provider: provider.Name,
+		Subject:  claims.Subject,
+		UserID:   user.ID,
+		Email:    claims.Email,
+	}, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.takeOverUnverified(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// truncate cuts s to at most n runes, names from providers are not limited like ours
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/oidc"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/oidc/oidctest"
+)
+
+func withProvider(t *testing.T, env *testEnv, cfg oidc.Config) *oidctest.Provider {
+	t.Helper()
+
+	mock, srv, err := oidctest.Start("acme-client", "acme-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+
+	cfg.Name = "acme"
+	cfg.Issuer = mock.Issuer
+	cfg.ClientID = "acme-client"
+	cfg.ClientSecret = "acme-secret"
+	cfg.RedirectURL = "http://api.test/auth/oidc/acme/callback"
+
+	env.h.Providers = map[string]*oidc.Provider{"acme": oidc.NewProvider(cfg)}
+	return mock
+}
+
+// onProvider fills in the path value the router would
+func onProvider(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("provider", "acme")
+		next(w, r)
+	}
+}
+
+func TestOIDCSignInMapsClaims(t *testing.T) {
+	env := newTestEnv(t)
+	mock := withProvider(t, env, oidc.Config{
+		AllowedDomains: []string{"acme.com"},
+		TrustEmail:     true,
+		Claims:         oidc.ClaimMapping{Email: "upn", GivenName: "profile.first", FamilyName: "profile.last"},
+	})
+	mock.SetIdentity(oidctest.Identity{
+		Subject: "acme-1",
+		Email:   "ana@gmail.com",
+		Claims: map[string]any{
+			"upn":     "ana@acme.com",
+			"profile": map[string]any{"first": "Ana", "last": "Lima"},
+		},
+	})
+
+	rec := signIn(t, onProvider(env.h.OIDCLoginHandler), onProvider(env.h.OIDCCallbackHandler), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback answered %d: %s", rec.Code, rec.Body)
+	}
+
+	user, err := env.users.GetByEmail(context.Background(), "ana@acme.com")
+	if err != nil || user.FirstName != "Ana" || user.LastName != "Lima" || !user.EmailVerified {
+		t.Fatalf("provisioned user %+v, %v", user, err)
+	}
+	identity, err := env.identities.Get(context.Background(), "acme", "acme-1")
+	if err != nil || identity.UserID != user.ID {
+		t.Errorf("identity %+v, %v, want it linked to %s", identity, err, user.ID)
+	}
+}
+
+func TestOIDCSignInRefusesExistingAccount(t *testing.T) {
+	env := newTestEnv(t)
+	mock := withProvider(t, env, oidc.Config{TrustEmail: true})
+	mock.SetIdentity(oidctest.Identity{Subject: "acme-1", Email: "ana@example.com"})
+	existing := env.users.add(&models.User{Email: "ana@example.com", Password: "hash", EmailVerified: true})
+
+	rec := signIn(t, onProvider(env.h.OIDCLoginHandler), onProvider(env.h.OIDCCallbackHandler), nil)
+	if rec.Code != http.StatusConflict || errorCode(t, rec) != "account_exists" {
+		t.Errorf("got %d %s, want 409 account_exists", rec.Code, rec.Body)
+	}
+	if _, err := env.identities.Get(context.Background(), "acme", "acme-1"); err == nil {
+		t.Error("identity was linked")
+	}
+	if stored := env.users.get(existing.ID); stored.Password != "hash" {
+		t.Error("password was replaced")
+	}
+}
+
+func TestOIDCUser(t *testing.T) {
+	tests := []struct {
+		name       string
+		domains    []string
+		trust      bool
+		existing   *models.User
+		linked     bool // the identity is known already
+		claims     oidc.Claims
+		wantErr    error
+		wantRevoke bool
+	}{
+		{
+			name:     "known identity signs in its user",
+			domains:  []string{"acme.com"},
+			existing: &models.User{Email: "ana@acme.com", EmailVerified: true},
+			linked:   true,
+			claims:   claims("acme-1", "ana@acme.com", false),
+		},
+		{
+			name:     "known identity outside the allowed domains is refused",
+			domains:  []string{"acme.com"},
+			existing: &models.User{Email: "ana@acme.com", EmailVerified: true},
+			linked:   true,
+			claims:   claims("acme-1", "ana@example.com", true),
+			wantErr:  errDomainNotAllowed,
+		},
+		{
+			name:    "unverified email is refused",
+			claims:  claims("acme-1", "ana@example.com", false),
+			wantErr: errEmailNotVerified,
+		},
+		{
+			name:   "trusted email provisions a user",
+			trust:  true,
+			claims: claims("acme-1", "ana@example.com", false),
+		},
+		{
+			name:     "provider without domains doesn't link existing accounts",
+			existing: &models.User{Email: "ana@example.com", EmailVerified: true},
+			claims:   claims("acme-1", "ana@example.com", true),
+			wantErr:  errAccountExists,
+		},
+		{
+			name:     "trusted provider without domains doesn't link existing accounts",
+			trust:    true,
+			existing: &models.User{Email: "ana@example.com"},
+			claims:   claims("acme-1", "ana@example.com", false),
+			wantErr:  errAccountExists,
+		},
+		{
+			name:     "verified account at an allowed domain is linked and keeps its sessions",
+			domains:  []string{"acme.com"},
+			existing: &models.User{Email: "ana@acme.com", Password: "hash", EmailVerified: true},
+			claims:   claims("acme-1", "ANA@acme.com", true),
+		},
+		{
+			name:       "unverified account at an allowed domain is taken over",
+			domains:    []string{"acme.com"},
+			existing:   &models.User{Email: "ana@acme.com", Password: "squatter-hash"},
+			claims:     claims("acme-1", "ana@acme.com", true),
+			wantRevoke: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			provider := oidc.NewProvider(oidc.Config{Name: "acme", AllowedDomains: tt.domains, TrustEmail: tt.trust})
+
+			var existing models.User
+			if tt.existing != nil {
+				existing = *env.users.add(tt.existing)
+			}
+			if tt.linked {
+				env.identities.Link(context.Background(), &models.UserIdentity{Provider: "acme", Subject: tt.claims.Subject, UserID: existing.ID}, "")
+			}
+
+			user, err := env.h.oidcUser(context.Background(), provider, &tt.claims)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if len(env.sessions.revoked) != 0 {
+					t.Error("sessions were revoked")
+				}
+				return
+			}
+
+			if tt.existing != nil && user.ID != existing.ID {
+				t.Errorf("signed in user %s, want the existing %s", user.ID, existing.ID)
+			}
+			if !user.EmailVerified {
+				t.Error("signed in user is not verified")
+			}
+			if identity, err := env.identities.Get(context.Background(), "acme", tt.claims.Subject); err != nil || identity.UserID != user.ID {
+				t.Errorf("identity %+v, %v, want it linked to %s", identity, err, user.ID)
+			}
+
+			if tt.existing != nil {
+				if replaced := env.users.get(user.ID).Password != existing.Password; replaced != tt.wantRevoke {
+					t.Errorf("password replaced = %v, want %v", replaced, tt.wantRevoke)
+				}
+			}
+			if revoked := env.sessions.revokedFor(user.ID); revoked != tt.wantRevoke {
+				t.Errorf("sessions revoked = %v, want %v", revoked, tt.wantRevoke)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+// failureWindow is how long failed logins are remembered after the last one
+const failureWindow = time.Hour
+
+// throttlePolicy locks logins out after free failures, for base at first and twice as long
+// for every failure after that, up to max
+type throttlePolicy struct {
+	free int
+	base time.Duration
+	max  time.Duration
+}
+
+var (
+	// per account, keyed by email whether or not the account exists
+	accountPolicy = throttlePolicy{free: 5, base: 30 * time.Second, max: 15 * time.Minute}
+	// per client address, looser since offices and mobile networks share one
+	addressPolicy = throttlePolicy{free: 20, base: time.Minute, max: time.Hour}
+)
+
+// LockedOutError refuses a password check while the account is locked out
+type LockedOutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedOutError) Error() string {
+	return "too many failed password attempts, please try again later"
+}
+
+func (p throttlePolicy) lockout(failures int) time.Duration {
+	if failures < p.free {
+		return 0
+	}
+
+	d := p.base
+	for i := p.free; i < failures && d < p.max; i++ {
+		d *= 2
+	}
+	return min(d, p.max)
+}
+
+// dummyHash stands in for the password hash of unknown emails. Comparing against it takes as
+// long as a wrong password, so response times do not tell which accounts exist
+var dummyHash = sync.OnceValue(func() []byte {
+	password, err := models.NewToken()
+	if err != nil {
+		slog.Error("Could not create dummy password", slog.String("error", err.Error()))
+		return nil
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		slog.Error("Could not create dummy password hash", slog.String("error", err.Error()))
+		return nil
+	}
+	return []byte(hash)
+})
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// addressKey groups IPv6 clients by their /64, which a single host can otherwise rotate through
+func addressKey(ip string) string {
+	addr, err := netip.ParseAddr(strings.Trim(ip, "[]"))
+	if err != nil {
+		// only a RemoteAddr that isn't an address gets here, such as a unix socket's
+		return "ip:" + ip
+	}
+
+	addr = addr.Unmap()
+	if addr.Is6() {
+		prefix, _ := addr.Prefix(64)
+		return "ip:" + prefix.String()
+	}
+	return "ip:" + addr.String()
+}
+
+// loginLockout returns how long logins for the email from this client are still locked out.
+// It is checked before any password is compared, locked out attempts cost no bcrypt work
+func (h *Handler) loginLockout(r *http.Request, email string) (time.Duration, error) {
+	until, err := h.Repo.Login.LockedUntil(r.Context(), []string{accountKey(email), addressKey(h.getClientIP(r))})
+	if err != nil {
+		return 0, err
+	}
+	if until.IsZero() {
+		return 0, nil
+	}
+
+	return time.Until(until), nil
+}
+
+// loginFailed counts a failed attempt against the account and the client, locking them out
+// once they exceed their policy
+func (h *Handler) loginFailed(r *http.Request, email string, userID *uuid.UUID, reason string) {
+	ctx := r.Context()
+	ip := h.getClientIP(r)
+
+	for key, policy := range map[string]throttlePolicy{accountKey(email): accountPolicy, addressKey(ip): addressPolicy} {
+		recordFailure(ctx, h.Repo.Login, key, policy)
+	}
+
+	h.auditLogin(r, email, userID, false, reason)
+}
+
+// recordFailure counts a failure against the key and locks it out once it exceeds the policy
+func recordFailure(ctx context.Context, logins repositories.LoginRepository, key string, policy throttlePolicy) {
+	failures, err := logins.RecordFailure(ctx, key, time.Now().Add(-failureWindow))
+	if err != nil {
+		slog.Error("Could not record login failure", slog.String("error", err.Error()))
+		return
+	}
+
+	if d := policy.lockout(failures); d > 0 {
+		if err := logins.Lock(ctx, key, time.Now().Add(d)); err != nil {
+			slog.Error("Could not lock login", slog.String("error", err.Error()))
+			return
+		}
+		slog.Warn("Login locked out",
+			slog.String("key", key),
+			slog.Int("failures", failures),
+			slog.Duration("duration", d))
+	}
+}
+
+// CheckAccountPassword checks the password of a signed in user, such as before changing it.
+// Wrong passwords count against the account like failed logins and share their lockout, so an
+// access token is no way around the login's limit on guesses
+func CheckAccountPassword(ctx context.Context, repo *repositories.Repositories, user *models.User, password string) (bool, error) {
+	key := accountKey(user.Email)
+
+	until, err := repo.Login.LockedUntil(ctx, []string{key})
+	if err != nil {
+		return false, err
+	}
+	if d := time.Until(until); d > 0 {
+		return false, &LockedOutError{RetryAfter: d}
+	}
+
+	hash, err := repo.User.GetPasswordHash(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	if CheckPassword(hash, password) {
+		return true, nil
+	}
+
+	recordFailure(ctx, repo.Login, key, accountPolicy)
+	return false, nil
+}
+
+// loginCompleted forgets the account's failures, the client's are kept so logging in to an
+// account of one's own does not reset the guesses against others
+func (h *Handler) loginCompleted(r *http.Request, user *models.User) {
+	if err := h.Repo.Login.Clear(r.Context(), accountKey(user.Email)); err != nil {
+		slog.Error("Could not clear login failures", slog.String("error", err.Error()))
+	}
+
+	h.auditLogin(r, user.Email, &user.ID, true, models.LoginSucceeded)
+}
+
+func (h *Handler) auditLogin(r *http.Request, email string, userID *uuid.UUID, success bool, reason string) {
+	err := h.Repo.Login.RecordAttempt(r.Context(), &models.LoginAttempt{
+		UserID:    userID,
+		Email:     strings.ToLower(strings.TrimSpace(email)),
+		IPAddress: h.getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   success,
+		Reason:    reason,
+	})
+	if err != nil {
+		slog.Error("Could not record login attempt", slog.String("error", err.Error()))
+	}
+}
+
+// sendLockedOut answers attempts made during a lockout, the same way for every email
+func (h *Handler) sendLockedOut(w http.ResponseWriter, retryAfter time.Duration) {
+	SetRetryAfter(w, retryAfter)
+	w.WriteHeader(http.StatusTooManyRequests)
+	h.SendError(w, fmt.Errorf("too many failed login attempts"), "Too many failed login attempts, please try again later")
+}
+
+// SetRetryAfter tells the client how many whole seconds to wait, at least one
+func SetRetryAfter(w http.ResponseWriter, d time.Duration) {
+	seconds := int64(d.Round(time.Second) / time.Second)
+	w.Header().Set("Retry-After", strconv.FormatInt(max(seconds, 1), 10))
+}
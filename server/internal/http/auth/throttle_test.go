@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLockout(t *testing.T) {
+	tests := []struct {
+		policy   throttlePolicy
+		failures int
+		want     time.Duration
+	}{
+		{accountPolicy, 0, 0},
+		{accountPolicy, 4, 0},
+		{accountPolicy, 5, 30 * time.Second},
+		{accountPolicy, 6, time.Minute},
+		{accountPolicy, 9, 8 * time.Minute},
+		{accountPolicy, 10, 15 * time.Minute},
+		{accountPolicy, 1000, 15 * time.Minute},
+		{addressPolicy, 19, 0},
+		{addressPolicy, 20, time.Minute},
+		{addressPolicy, 25, 32 * time.Minute},
+		{addressPolicy, 26, time.Hour},
+		{addressPolicy, 1 << 20, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.lockout(tt.failures); got != tt.want {
+			t.Errorf("%d failures under %+v: got %v, want %v", tt.failures, tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestAddressKey(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"203.0.113.7", "ip:203.0.113.7"},
+		{"::ffff:203.0.113.7", "ip:203.0.113.7"},
+		{"2001:db8:1:2:3:4:5:6", "ip:2001:db8:1:2::/64"},
+		{"2001:db8:1:2:ffff::1", "ip:2001:db8:1:2::/64"},
+		{"[2001:db8::1]", "ip:2001:db8::/64"},
+		{"@", "ip:@"},
+	}
+
+	for _, tt := range tests {
+		if got := addressKey(tt.ip); got != tt.want {
+			t.Errorf("addressKey(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestGetClientIP(t *testing.T) {
+	proxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8:ffff::1/128")}
+
+	tests := []struct {
+		name    string
+		remote  string
+		xff     []string
+		trusted []netip.Prefix
+		want    string
+	}{
+		{name: "no proxy", remote: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "forwarded for by an untrusted peer", remote: "203.0.113.7:5000", xff: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "forwarded for without trusted proxies", remote: "10.0.0.2:5000", xff: []string{"198.51.100.1"}, want: "10.0.0.2"},
+		{name: "trusted proxy", remote: "10.0.0.2:5000", xff: []string{"198.51.100.1"}, trusted: proxies, want: "198.51.100.1"},
+		{
+			name:    "entries before the proxy's are the client's",
+			remote:  "10.0.0.2:5000",
+			xff:     []string{"192.0.2.99, 198.51.100.1"},
+			trusted: proxies,
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "chain of trusted proxies",
+			remote:  "10.0.0.2:5000",
+			xff:     []string{"192.0.2.99, 198.51.100.1, 10.1.1.1", "10.2.2.2"},
+			trusted: proxies,
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "all hops trusted",
+			remote:  "10.0.0.2:5000",
+			xff:     []string{"10.1.1.1"},
+			trusted: proxies,
+			want:    "10.1.1.1",
+		},
+		{
+			name:    "proxy passed on something else",
+			remote:  "10.0.0.2:5000",
+			xff:     []string{"198.51.100.1, unknown"},
+			trusted: proxies,
+			want:    "10.0.0.2",
+		},
+		{
+			name:    "entries with ports and brackets",
+			remote:  "[2001:db8:ffff::1]:443",
+			xff:     []string{"[2001:db8:1::5]:1234"},
+			trusted: proxies,
+			want:    "2001:db8:1::5",
+		},
+		{name: "not an address", remote: "@", xff: []string{"198.51.100.1"}, trusted: proxies, want: "@"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.h.Controller.auth.TrustedProxies = tt.trusted
+
+			r := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+
+			if got := env.h.getClientIP(r); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", " 10.0.0.0/8, 192.0.2.1,::ffff:198.51.100.1 ,2001:db8::1:2/64,")
+
+	got := trustedProxies()
+	want := []string{"10.0.0.0/8", "192.0.2.1/32", "198.51.100.1/32", "2001:db8::/64"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].String() != want[i] {
+			t.Errorf("got %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestAddressLockoutIgnoresForwardedFor(t *testing.T) {
+	env := newTestEnv(t)
+
+	attempt := func(remote, xff string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+		r.RemoteAddr = remote
+		r.Header.Set("X-Forwarded-For", xff)
+		return r
+	}
+
+	// an attacker rotating X-Forwarded-For, and naming a victim's address in it, over many emails
+	for i := range addressPolicy.free {
+		env.h.loginFailed(attempt("203.0.113.7:5000", "198.51.100.1"), fmt.Sprintf("user%d@example.com", i), nil, models.LoginBadPassword)
+		env.h.loginFailed(attempt("203.0.113.7:5000", fmt.Sprintf("192.0.2.%d", i)), fmt.Sprintf("other%d@example.com", i), nil, models.LoginBadPassword)
+	}
+
+	if d, err := env.h.loginLockout(attempt("203.0.113.7:5000", "192.0.2.250"), "new@example.com"); err != nil || d <= 0 {
+		t.Errorf("attacker: locked out for %v, %v, want a lockout", d, err)
+	}
+	if d, err := env.h.loginLockout(attempt("198.51.100.1:5000", ""), "new@example.com"); err != nil || d != 0 {
+		t.Errorf("victim: locked out for %v, %v, want none", d, err)
+	}
+}
+
+func TestCheckAccountPassword(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	user := env.users.add(&models.User{Email: "ana@example.com", Password: string(hash), EmailVerified: true})
+
+	if ok, err := CheckAccountPassword(ctx, env.h.Repo, user, "correct horse"); !ok || err != nil {
+		t.Fatalf("right password: got %v, %v", ok, err)
+	}
+
+	// someone holding an access token guessing the current password
+	for range accountPolicy.free {
+		if ok, err := CheckAccountPassword(ctx, env.h.Repo, user, "guess"); ok || err != nil {
+			t.Fatalf("wrong password: got %v, %v", ok, err)
+		}
+	}
+
+	var locked *LockedOutError
+	if _, err := CheckAccountPassword(ctx, env.h.Repo, user, "correct horse"); !errors.As(err, &locked) || locked.RetryAfter <= 0 {
+		t.Errorf("during the lockout: got %v, want a LockedOutError", err)
+	}
+
+	// the guesses locked the login as well
+	r := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+	if d, err := env.h.loginLockout(r, "ANA@example.com"); err != nil || d <= 0 {
+		t.Errorf("login locked out for %v, %v, want a lockout", d, err)
+	}
+}
@@ -1,11 +1,15 @@
 package auth
 
 import (
+	"net/netip"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/mail"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/oidc"
 	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/webauthn"
 )
 
 type Config struct {
@@ -13,6 +17,23 @@ type Config struct {
 	RefreshSecret []byte
 	AccessTTL     time.Duration
 	RefreshTTL    time.Duration
+
+	// Google is nil when Google sign in is not configured
+	Google *oidc.Config
+	// Providers are the company identity providers users may sign in with
+	Providers []oidc.Config
+	// OAuthRedirectURL is the app page social sign in returns to, errors are passed as ?error=.
+	// Without one the callback answers with JSON like the login endpoint
+	OAuthRedirectURL string
+
+	AppURL          string
+	VerificationTTL time.Duration
+	ResetTTL        time.Duration
+	// UnverifiedRestrictions are the actions kept from users until they verify their email
+	UnverifiedRestrictions []string
+	WebAuthn               webauthn.Config
+	// TrustedProxies are the proxies whose X-Forwarded-For entries are believed, none by default
+	TrustedProxies []netip.Prefix
 }
 
 type Controller struct {
@@ -22,6 +43,9 @@ type Controller struct {
 type JWTCustomClaims struct {
 	UserID uuid.UUID `json:"userID"`
 	Email  string    `json:"email"`
+	// SessionID is the session family an access token was issued for, so logging out revokes it
+	SessionID     uuid.UUID `json:"sid,omitempty"`
+	EmailVerified bool      `json:"ev,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -35,6 +59,43 @@ type Handler struct {
 	Controller *Controller
 	Repo       *repositories.Repositories
 	Validator  Validator
+	Sessions   *SessionCache
+	Google     *oidc.Provider
+	Providers  map[string]*oidc.Provider
+	Mailer     mail.Mailer
+	Passkeys   *Passkeys
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ProviderInfo is what the login page needs to offer a provider
+type ProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	LoginURL    string `json:"loginUrl"`
+}
+
+// oauthState travels in a signed cookie from the redirect to the provider until its callback
+type oauthState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
 }
 
 type SignInRequest struct {
@@ -50,6 +111,48 @@ type LogInRequest struct {
 	Password string `json:"password" mapstructure:"password"`
 }
 
+// LoginMFARequest completes a login with a code from the authenticator app or a recovery code
+type LoginMFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// Passkeys runs WebAuthn ceremonies. Their state travels with the client in a signed token
+// between the begin and finish requests
+type Passkeys struct {
+	rp     *webauthn.RelyingParty
+	repo   *repositories.Repositories
+	secret []byte
+}
+
+// PasskeyCeremony starts a ceremony in the browser, publicKey goes to
+// navigator.credentials and state comes back with its result
+type PasskeyCeremony struct {
+	PublicKey any    `json:"publicKey"`
+	State     string `json:"state"`
+}
+
+// passkeyState is the signed state of a ceremony. Subject is the user it is for, if known
+type passkeyState struct {
+	Purpose string           `json:"purpose"`
+	Session webauthn.Session `json:"session"`
+	jwt.RegisteredClaims
+}
+
+// PasskeyLoginRequest finishes a passkey login
+type PasskeyLoginRequest struct {
+	State      string                     `json:"state"`
+	Credential webauthn.AssertionResponse `json:"credential"`
+}
+
+// MFAPasskeyRequest uses a passkey as the second factor of a password login. Starting it
+// only takes the mfa token
+type MFAPasskeyRequest struct {
+	MFAToken   string                     `json:"mfa_token"`
+	State      string                     `json:"state"`
+	Credential webauthn.AssertionResponse `json:"credential"`
+}
+
 type Validator interface {
 	ValidateSignInRequest(req SignInRequest) ValidationErrors
 	ValidateLoginRequest(req LogInRequest) ValidationErrors
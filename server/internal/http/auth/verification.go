@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/mail"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+const (
+	mailTimeout = 30 * time.Second
+
+	// at most this many verification emails per user and window
+	verificationLimit  = 3
+	verificationWindow = time.Hour
+)
+
+var errTooManyEmails = errors.New("too many verification emails requested")
+
+// sendVerification mails the user a new verification link, earlier links stop working
+func (h *Handler) sendVerification(ctx context.Context, user *models.User) error {
+	sent, err := h.Repo.UserToken.CountSince(ctx, user.ID, models.TokenPurposeVerifyEmail, time.Now().Add(-verificationWindow))
+	if err != nil {
+		return err
+	}
+	if sent >= verificationLimit {
+		return errTooManyEmails
+	}
+
+	token, err := models.NewToken()
+	if err != nil {
+		return err
+	}
+
+	err = h.Repo.UserToken.Create(ctx, &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TokenPurposeVerifyEmail,
+		TokenHash: models.HashToken(token),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(h.Controller.auth.VerificationTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := h.Controller.auth.AppURL + "/verify-email?token=" + url.QueryEscape(token)
+
+	return h.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email for Kaiyo AI",
+		Text: fmt.Sprintf(`Hi %s,
+
+Please confirm this is your email address by opening the link below:
+
+%s
+
+The link works once and expires in %s. If you did not create a Kaiyo AI account you can ignore this email.
+`, greetingName(user), link, h.Controller.auth.VerificationTTL),
+	})
+}
+
+// sendVerificationAsync keeps mail delivery out of the request, failures are only logged
+func (h *Handler) sendVerificationAsync(user models.User) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+
+		if err := h.sendVerification(ctx, &user); err != nil {
+			slog.Error("Could not send verification email",
+				slog.String("user_id", user.ID.String()),
+				slog.String("error", err.Error()))
+		}
+	}()
+}
+
+func greetingName(user *models.User) string {
+	if name := strings.TrimSpace(user.FirstName); name != "" {
+		return name
+	}
+	return "there"
+}
+
+// POST /auth/verify-email
+func (h *Handler) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		h.SendError(w, fmt.Errorf("invalid request"), "A token is required")
+		return
+	}
+
+	token, err := h.Repo.UserToken.Consume(r.Context(), models.TokenPurposeVerifyEmail, models.HashToken(req.Token))
+	if err == nil {
+		// the user may have changed their email since, the link only verifies the address it went to
+		err = h.Repo.User.MarkEmailVerified(r.Context(), token.UserID, token.Email)
+	}
+	if errors.Is(err, models.ErrNotFound) {
+		w.WriteHeader(http.StatusBadRequest)
+		h.SendError(w, fmt.Errorf("invalid token"), "The link is invalid, expired or was already used")
+		return
+	}
+	if err != nil {
+		slog.Error("Could not verify email", slog.String("error", err.Error()))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Email verified", slog.String("user_id", token.UserID.String()))
+
+	// access tokens say whether the email is verified, a refresh picks up the new state
+	err = json.NewEncoder(w).Encode(map[string]any{
+		"message":       "Email verified successfully",
+		"emailVerified": true,
+	})
+
+	if err != nil {
+		slog.Error("Could not respond to verify request", slog.String("error", err.Error()))
+	}
+}
+
+// POST /auth/resend-verification
+func (h *Handler) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	var req ResendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Email) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		h.SendError(w, fmt.Errorf("invalid request"), "An email is required")
+		return
+	}
+
+	// the answer is the same whether or not the account exists, so it cannot be used to find
+	// out who is signed up. The lookup happens after responding for the same reason
+	go func(email string) {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+
+		user, err := h.Repo.User.GetByEmail(ctx, email)
+		if err != nil || user.EmailVerified {
+			return
+		}
+
+		if err := h.sendVerification(ctx, user); err != nil {
+			slog.Warn("Could not resend verification email",
+				slog.String("user_id", user.ID.String()),
+				slog.String("error", err.Error()))
+		}
+	}(strings.TrimSpace(req.Email))
+
+	w.WriteHeader(http.StatusAccepted)
+	err := json.NewEncoder(w).Encode(map[string]string{
+		"message": "If the account exists and is not verified yet, a new link is on its way",
+	})
+
+	if err != nil {
+		slog.Error("Could not respond to resend request", slog.String("error", err.Error()))
+	}
+}
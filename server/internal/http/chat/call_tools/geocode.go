@@ -7,8 +7,46 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"sync"
+	"time"
 )
 
+// Nominatim's usage policy allows one request per second from the whole application
+const geocodeInterval = time.Second
+
+// geocodeLimiter spaces out every request to Nominatim in the process, whether it comes from
+// a tool call, the itinerary validator or an enrichment job
+var geocodeLimiter = &limiter{interval: geocodeInterval}
+
+// limiter lets callers through one at a time, at most once per interval
+type limiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time // when the next caller may go
+}
+
+// wait blocks until it is the caller's turn or ctx is done
+func (l *limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	at := time.Now()
+	if l.next.After(at) {
+		at = l.next
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 func (t *Tools) GetGeoCodeData(ctx context.Context, amenity string, street string, city string, state string, country string) ([]map[string]any, error) {
 	baseURL := "https://nominatim.openstreetmap.org/search?"
 
@@ -48,6 +86,10 @@ func (t *Tools) GetGeoCodeData(ctx context.Context, amenity string, street strin
 		return nil, err
 	}
 
+	if err := geocodeLimiter.wait(ctx); err != nil {
+		return nil, err
+	}
+
 	req.Header.Set("User-Agent", "kaiyo-ai/1.0 (contact: nakulkrishnakumar86@gmail.com)")
 
 	client := &http.Client{}
@@ -0,0 +1,49 @@
+package calltools
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiterSpacesCallers(t *testing.T) {
+	l := &limiter{interval: 20 * time.Millisecond}
+	start := time.Now()
+
+	// concurrent callers, as jobs and chats geocoding at once are
+	var mu sync.Mutex
+	var times []time.Duration
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.wait(context.Background()); err != nil {
+				t.Error(err)
+			}
+			mu.Lock()
+			times = append(times, time.Since(start))
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if last := max(times[0], times[1], times[2], times[3]); last < 3*l.interval {
+		t.Errorf("four callers were through after %v, want at least %v", last, 3*l.interval)
+	}
+}
+
+func TestLimiterGivesUpWithContext(t *testing.T) {
+	l := &limiter{interval: time.Hour}
+	if err := l.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -6,16 +6,26 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"runtime/debug"
+	"strconv"
 	"strings"
 
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/access"
 	calltools "github.com/nakul-krishnakumar/kaiyo-ai/internal/http/chat/call_tools"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary/render"
 	"github.com/nakul-krishnakumar/kaiyo-ai/internal/llm"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/queue"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/realtime"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
 	"github.com/openai/openai-go/v3"
 	"github.com/spf13/viper"
 )
 
-func NewController() *Controller {
+func NewController(repo *repositories.Repositories, jobs *queue.Queue, hub *realtime.Hub) *Controller {
 	if err := godotenv.Load(); err != nil {
 		slog.Error("could not load model env " + err.Error())
 	}
@@ -52,28 +62,38 @@ func NewController() *Controller {
 		slog.Error("No system prompt specified")
 	}
 
-	var msgs []openai.ChatCompletionMessageParamUnion
-	msgs = append(msgs, openai.ChatCompletionMessageParamUnion{
-		OfSystem: &openai.ChatCompletionSystemMessageParam{
-			Content: openai.ChatCompletionSystemMessageParamContentUnion{
-				OfString: openai.String(model.SystemPrompt),
-			},
-		},
-	})
+	switch model.ResponseMode {
+	case "":
+		model.ResponseMode = ResponseModeNarrative
+	case ResponseModeNarrative, ResponseModeRendered:
+	default:
+		slog.Error("Unknown response mode, using narrative", slog.String("response_mode", model.ResponseMode))
+		model.ResponseMode = ResponseModeNarrative
+	}
 
 	var tools = calltools.NewCallTools()
 
-	return &Controller{
-		Client:  client,
-		History: msgs,
-		Model:   model,
-		Tools:   tools,
+	ctrl := &Controller{
+		Client:        client,
+		Model:         model,
+		Tools:         tools,
+		Repo:          repo,
+		Jobs:          jobs,
+		Hub:           hub,
+		conversations: make(map[string]*Conversation),
 	}
+	ctrl.Validator = itinerary.NewValidator(ctrl.locateCity)
+	ctrl.structuredOutputs.Store(model.StructuredOutputs)
+
+	jobs.Register(JobSaveItinerary, ctrl.runSaveJob)
+	jobs.Register(JobEnrichItinerary, ctrl.runEnrichJob)
+
+	return ctrl
 }
 
-func (c *Controller) doToolCalling(ctx context.Context) error {
+func (c *Controller) doToolCalling(ctx context.Context, conv *Conversation) error {
 	params := openai.ChatCompletionNewParams{
-		Messages:        c.History,
+		Messages:        conv.History,
 		Tools:           c.Tools.InitOpenAITools(),
 		Seed:            openai.Int(0),
 		Model:           openai.ChatModel(c.Model.Name),
@@ -89,24 +109,18 @@ func (c *Controller) doToolCalling(ctx context.Context) error {
 	// if no tools called, then stop the chat
 	if len(toolCalls) == 0 {
 		fmt.Println("NO TOOL CALLED")
-		c.History = append(c.History, openai.ChatCompletionMessageParamUnion{
-			OfAssistant: &openai.ChatCompletionAssistantMessageParam{
-				Content: openai.ChatCompletionAssistantMessageParamContentUnion{
-					OfString: openai.String(completion.Choices[0].Message.Content),
-				},
-			},
-		})
+		conv.History = append(conv.History, assistantMessage(completion.Choices[0].Message.Content))
 
 		return nil
 	}
 
-	c.History = append(c.History, completion.Choices[0].Message.ToParam())
+	conv.History = append(conv.History, completion.Choices[0].Message.ToParam())
 	for _, toolCall := range toolCalls {
 		result := c.Tools.HandleToolCall(ctx, toolCall.Function.Name, toolCall.Function.Arguments)
 
 		// Append tool result to history
 		resultJSON, _ := json.Marshal(result)
-		c.History = append(c.History, openai.ChatCompletionMessageParamUnion{
+		conv.History = append(conv.History, openai.ChatCompletionMessageParamUnion{
 			OfTool: &openai.ChatCompletionToolMessageParam{
 				ToolCallID: toolCall.ID,
 				Content: openai.ChatCompletionToolMessageParamContentUnion{
@@ -119,19 +133,13 @@ func (c *Controller) doToolCalling(ctx context.Context) error {
 	return nil
 }
 
-func (c *Controller) performPlanningPhase(ctx context.Context, userInput UserInput) error {
-	// Add user query to history
-	c.History = append(c.History, openai.ChatCompletionMessageParamUnion{
-		OfUser: &openai.ChatCompletionUserMessageParam{
-			Content: openai.ChatCompletionUserMessageParamContentUnion{
-				OfString: openai.String(userInput.Content),
-			},
-		},
-	})
+func (c *Controller) performPlanningPhase(ctx context.Context, conv *Conversation, userInput UserInput, author string) error {
+	// Add user query to history, attributed to its author since trip members share the chat
+	conv.History = append(conv.History, memberMessage(userInput.Content, author))
 
 	const maxIters = 3
 	for iter := 0; iter < maxIters; iter++ {
-		if err := c.doToolCalling(ctx); err != nil {
+		if err := c.doToolCalling(ctx, conv); err != nil {
 			return err
 		}
 	}
@@ -139,51 +147,64 @@ func (c *Controller) performPlanningPhase(ctx context.Context, userInput UserInp
 	return nil
 }
 
-func (c *Controller) performStreamingPhase(ctx context.Context, chunkCh chan<- string) error {
-	defer close(chunkCh)
+func (c *Controller) performStreamingPhase(ctx context.Context, conv *Conversation, prompt string, emit func(string)) error {
 	fmt.Println("INSIDE PHASE 2") /////////////////////////////////////
 
 	// Add a user prompt to trigger narrative generation
-	c.History = append(c.History, openai.ChatCompletionMessageParamUnion{
-		OfUser: &openai.ChatCompletionUserMessageParam{
-			Content: openai.ChatCompletionUserMessageParamContentUnion{
-				OfString: openai.String(`Generate the complete itinerary in proper Markdown format, ONLY if all necessary data is available.
-
-CRITICAL FORMATTING RULES:
-1. Add TWO newlines (\n\n) after every heading (##)
-2. Add TWO newlines (\n\n) before and after horizontal rules (---)
-3. Add ONE newline (\n) after each bullet point
-4. Add TWO newlines (\n\n) between different sections
-5. Use proper markdown syntax:
-   - Headings: ## Day 1: Title
-   - Horizontal rules: ---
-   - Bullet points: - Item text
-   - Bold: **text**
-   - Italic: *text*
-
-Example format:
-## Day 1: Monday, April 22 – Welcome to Paris
-
-- 09:00 – 11:00 • Activity Name
-  Description here
-- 11:00 – 14:00 • Next Activity
-  Description here
-
----
-
-## Day 2: Tuesday, April 23 – Next Day
-
-- 08:30 – 10:00 • Morning Activity
-  Description here
-
-Generate the itinerary now with proper spacing.`),
-			},
-		},
+	conv.History = append(conv.History, userMessage(prompt))
+
+	var content strings.Builder
+	err := c.streamCompletion(ctx, conv, func(delta string) {
+		content.WriteString(delta)
+		emit(delta) // add the response chunk to channel
 	})
+	if err != nil {
+		return err
+	}
+
+	// Add assistant response to History
+	conv.History = append(conv.History, assistantMessage(content.String()))
+	c.publishReply(conv.ChatID, content.String())
+
+	return nil
+}
+
+// performRenderedStreamingPhase streams the model's prose around the saved itinerary,
+// the plan itself is rendered from the saved data so both always agree
+func (c *Controller) performRenderedStreamingPhase(ctx context.Context, conv *Conversation, itin *itinerary.Itinerary, emit func(string)) error {
+	markdown, err := render.Markdown(itin)
+	if err != nil {
+		return fmt.Errorf("could not render itinerary: %w", err)
+	}
+
+	conv.History = append(conv.History, userMessage(renderedPrompt))
+
+	var content strings.Builder
+	s := &splicer{
+		marker: itineraryMarker,
+		insert: "\n\n" + markdown + "\n",
+		emit: func(chunk string) {
+			content.WriteString(chunk)
+			emit(chunk)
+		},
+	}
 
+	if err := c.streamCompletion(ctx, conv, s.write); err != nil {
+		return err
+	}
+	s.flush()
+
+	conv.History = append(conv.History, assistantMessage(content.String()))
+	c.publishReply(conv.ChatID, content.String())
+
+	return nil
+}
+
+// streamCompletion streams a reply to the conversation, passing each content delta to emit
+func (c *Controller) streamCompletion(ctx context.Context, conv *Conversation, emit func(string)) error {
 	stream := c.Client.Chat.Completions.NewStreaming(ctx, openai.ChatCompletionNewParams{
 		Model:    openai.ChatModel(c.Model.Name),
-		Messages: c.History,
+		Messages: conv.History,
 		StreamOptions: openai.ChatCompletionStreamOptionsParam{
 			IncludeUsage: openai.Bool(true),
 		},
@@ -191,7 +212,6 @@ Generate the itinerary now with proper spacing.`),
 	})
 
 	acc := openai.ChatCompletionAccumulator{}
-	var tokenBuilder strings.Builder
 
 	for stream.Next() { // returns false when stream ends
 		chunk := stream.Current()
@@ -201,9 +221,7 @@ Generate the itinerary now with proper spacing.`),
 			fmt.Print(chunk.Choices[0].Delta.Content)
 
 			if chunk.Choices[0].Delta.Content != "" {
-				delta := chunk.Choices[0].Delta.Content
-				tokenBuilder.WriteString(delta)
-				chunkCh <- delta // add the response chunk to channel
+				emit(chunk.Choices[0].Delta.Content)
 			}
 		}
 	}
@@ -212,114 +230,235 @@ Generate the itinerary now with proper spacing.`),
 		return fmt.Errorf("chat streaming error: %w", err)
 	}
 
-	finalContent := tokenBuilder.String()
+	return nil
+}
 
-	// Add assistant response to History
-	c.History = append(c.History, openai.ChatCompletionMessageParamUnion{
-		OfAssistant: &openai.ChatCompletionAssistantMessageParam{
-			Content: openai.ChatCompletionAssistantMessageParamContentUnion{
-				OfString: openai.String(finalContent),
-			},
-		},
-	})
+// performDraftingPhase has the model save the itinerary before anything is shown to the user,
+// it returns nil when the model doesn't have enough details for a plan yet
+func (c *Controller) performDraftingPhase(ctx context.Context, conv *Conversation, userInput UserInput, userID *uuid.UUID) (*itinerary.Itinerary, error) {
+	itin, err := c.draftItinerary(ctx, conv, draftPrompt)
+	if err != nil || itin == nil {
+		return nil, err
+	}
 
-	return nil
+	if _, err := c.storeItinerary(ctx, itin, userInput, userID); err != nil {
+		return nil, err
+	}
+
+	return itin, nil
 }
 
-func (c *Controller) performSavingPhase() error {
-	// Add a user prompt to trigger save_itinerary tool call
-	c.History = append(c.History, openai.ChatCompletionMessageParamUnion{
-		OfUser: &openai.ChatCompletionUserMessageParam{
-			Content: openai.ChatCompletionUserMessageParamContentUnion{
-				OfString: openai.String(`
-				IF AND ONLY IF all the necessary details for an itinerary exists, call save_itinerary tool to save the data.`),
-			},
-		},
-	})
+// storeItinerary saves a drafted itinerary as the chat's next version and queues its enrichment
+func (c *Controller) storeItinerary(ctx context.Context, saved *itinerary.Itinerary, userInput UserInput, userID *uuid.UUID) (*models.ItineraryVersion, error) {
+	version := &models.ItineraryVersion{
+		Data:      *saved,
+		Source:    models.ItinerarySourceAssistant,
+		Message:   userInput.Content,
+		CreatedBy: userID,
+	}
 
-	tools := []openai.ChatCompletionToolUnionParam{
-		{
-			OfFunction: &openai.ChatCompletionFunctionToolParam{
-				Function: openai.FunctionDefinitionParam{
-					Name:        "save_itinerary",
-					Description: openai.String("Call this ONLY after narrative, to save the finalised itinerary."),
-					Parameters:  itinerarySchema,
-				},
-			},
-		},
+	itin, err := c.Repo.Itinerary.SaveVersion(ctx, userInput.ChatID, userID, version)
+	if err != nil {
+		return nil, fmt.Errorf("could not store itinerary version: %w", err)
 	}
+	c.publishItinerary(userInput.ChatID, version)
 
-	params := openai.ChatCompletionNewParams{
-		Messages:        c.History,
-		Tools:           tools,
-		Seed:            openai.Int(0),
-		Model:           openai.ChatModel(c.Model.Name),
-		ReasoningEffort: openai.ReasoningEffortMedium,
+	slog.Info("Itinerary version saved",
+		slog.String("itinerary_id", itin.ID.String()),
+		slog.Int("version", version.Version))
+
+	payload := enrichJobPayload{ItineraryID: itin.ID, Version: version.Version}
+	if _, err := c.Jobs.Enqueue(ctx, JobEnrichItinerary, userInput.ChatID, userID, payload); err != nil {
+		slog.Error("Could not queue itinerary enrichment", slog.String("error", err.Error()))
 	}
 
-	completion, err := c.Client.Chat.Completions.New(context.Background(), params)
+	return version, nil
+}
+
+// locateCity geocodes a city name for the itinerary validator
+func (c *Controller) locateCity(ctx context.Context, city string) (float64, float64, error) {
+	return c.geocode(ctx, "", city)
+}
+
+// geocode returns the coordinates of the best match for a place, either part may be empty
+func (c *Controller) geocode(ctx context.Context, place string, city string) (float64, float64, error) {
+	results, err := c.Tools.GetGeoCodeData(ctx, place, "", city, "", "")
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 
-	toolCalls := completion.Choices[0].Message.ToolCalls
+	name := strings.TrimSpace(place + " " + city)
 
-	if len(toolCalls) == 0 {
-		fmt.Println("NO TOOL CALLED")
+	lat, err := strconv.ParseFloat(fmt.Sprint(results[0]["lat"]), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid latitude for %s: %w", name, err)
 	}
 
-	for _, toolCall := range toolCalls {
-		if toolCall.Function.Name == "save_itinerary" {
-			fmt.Println("SAVE_ITINERARY TOOL CALLED!")
-			var itin Itinerary
-			err := json.Unmarshal([]byte(toolCall.Function.Arguments), &itin)
-			if err != nil {
-				panic(err)
-			}
+	lon, err := strconv.ParseFloat(fmt.Sprint(results[0]["lon"]), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid longitude for %s: %w", name, err)
+	}
+
+	return lat, lon, nil
+}
 
-			c.Itinerary = &itin
+func (c *Controller) StreamMessage(ctx context.Context, userInput UserInput, events chan<- StreamEvent) error {
+	defer close(events)
+
+	// stop sending once the client has gone away
+	send := func(ev StreamEvent) {
+		select {
+		case events <- ev:
+		case <-ctx.Done():
 		}
 	}
 
+	// this runs on its own goroutine, a panic here would take the whole server down
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Chat stream panicked", slog.Any("panic", r), slog.String("stack", string(debug.Stack())))
+			send(errorEvent("Something went wrong while answering, please try again"))
+		}
+	}()
+
+	job, err := c.respond(ctx, userInput, func(chunk string) { send(StreamEvent{Data: chunk}) })
+	if err != nil || job == nil {
+		return err
+	}
+
+	// keep the stream open until the itinerary is saved, clients can also poll the job
+	send(jobEvent(job))
+
+	waitCtx, cancel := context.WithTimeout(ctx, jobWaitTimeout)
+	defer cancel()
+
+	if job, err = c.Jobs.Wait(waitCtx, job.ID); err == nil {
+		send(jobEvent(job))
+	}
+
 	return nil
 }
 
-func (c *Controller) StreamMessage(ctx context.Context, userInput UserInput, chunkCh chan<- string) error {
+// respond runs the phases for a message, it returns the job saving the itinerary if there is one
+func (c *Controller) respond(ctx context.Context, userInput UserInput, emit func(string)) (*models.Job, error) {
+	var userID *uuid.UUID
+	if id, err := uuid.Parse(userInput.UserID); err == nil {
+		userID = &id
+	}
+	author := c.author(ctx, userID)
+
+	conv := c.conversation(userInput.ChatID)
+
+	// one message at a time per chat, the phases all build on the same history
+	conv.mu.Lock()
+	defer conv.mu.Unlock()
+
+	// other members see the question while the assistant works on it
+	c.Hub.Publish(userInput.ChatID, realtime.EventMessage, realtime.ChatMessage{
+		Role:    "user",
+		UserID:  userID,
+		Author:  author,
+		Content: userInput.Content,
+	})
+
+	// returning travellers aren't asked again for what they already told us
+	c.addProfile(ctx, conv, userID, author)
+
+	// popular plans for the destination, the model adapts them instead of starting from scratch
+	c.addTemplateExamples(ctx, conv, userInput.Content)
 
 	// Synchronous tool orchestration
-	if err := c.performPlanningPhase(ctx, userInput); err != nil {
-		return err
+	if err := c.performPlanningPhase(ctx, conv, userInput, author); err != nil {
+		return nil, err
 	}
 
 	fmt.Println("PHASE 1 DONE")
 
+	if c.Model.ResponseMode == ResponseModeRendered {
+		itin, err := c.performDraftingPhase(ctx, conv, userInput, userID)
+		if err != nil {
+			slog.Error("Could not save itinerary", slog.String("error", err.Error()))
+		}
+
+		if itin != nil {
+			return nil, c.performRenderedStreamingPhase(ctx, conv, itin, emit)
+		}
+
+		// no plan yet, the model is still gathering details
+		return nil, c.performStreamingPhase(ctx, conv, followUpPrompt, emit)
+	}
+
 	// Streaming final response
-	if err := c.performStreamingPhase(ctx, chunkCh); err != nil {
-		return err
+	if err := c.performStreamingPhase(ctx, conv, narrativePrompt, emit); err != nil {
+		return nil, err
 	}
 
-	// save_itinerary tool is called as a background job
-	if err := c.performSavingPhase(); err != nil {
-		slog.Error("Could not save itinerary", slog.String("error", err.Error()))
+	// the itinerary is saved by a background job working on a snapshot of the conversation
+	payload := saveJobPayload{
+		ChatID:  userInput.ChatID,
+		UserID:  userID,
+		Message: userInput.Content,
+		History: conv.History,
 	}
 
-	return nil
+	job, err := c.Jobs.Enqueue(ctx, JobSaveItinerary, userInput.ChatID, userID, payload)
+	if err != nil {
+		slog.Error("Could not queue itinerary save", slog.String("error", err.Error()))
+		return nil, nil
+	}
+
+	return job, nil
 }
 
-func (c *Controller) GetHistory(chatID string) ([]openai.ChatCompletionMessageParamUnion, error) {
-	// instead of keeping history as chatcompletion obj,
-	// keep it as a []Message object
-	// then write a function to convert []Message to chatcompletion
-	// this should run once at the beginning of the chat session
+// author names the member sending a message, messages stay unattributed if the user can't be loaded
+func (c *Controller) author(ctx context.Context, userID *uuid.UUID) string {
+	if userID == nil {
+		return ""
+	}
 
-	return c.History, nil
+	user, err := c.Repo.User.GetByID(ctx, *userID)
+	if err != nil {
+		slog.Error("Could not load message author", slog.String("error", err.Error()))
+		return ""
+	}
+
+	return participantName(user)
+}
+
+// JoinChat checks the requesting user may post to a chat, the first user to post to a chat owns its trip
+func (c *Controller) JoinChat(ctx context.Context, chatID string) error {
+	_, err := access.Join(ctx, c.Repo.Trip, chatID, models.TripRoleEditor)
+	return err
 }
 
-func (c *Controller) GetItinerary(chatID string) (*Itinerary, error) {
+func (c *Controller) GetHistory(ctx context.Context, chatID string) ([]openai.ChatCompletionMessageParamUnion, error) {
+	if _, err := access.Require(ctx, c.Repo.Trip, chatID, models.TripRoleViewer); err != nil {
+		return nil, err
+	}
+
 	// instead of keeping history as chatcompletion obj,
 	// keep it as a []Message object
 	// then write a function to convert []Message to chatcompletion
 	// this should run once at the beginning of the chat session
 
-	return c.Itinerary, nil
+	conv := c.conversation(chatID)
+
+	conv.mu.Lock()
+	defer conv.mu.Unlock()
+
+	return conv.History, nil
+}
+
+// GetItinerary returns the latest saved version of a chat's itinerary
+func (c *Controller) GetItinerary(ctx context.Context, chatID string) (*models.ItineraryVersion, error) {
+	if _, err := access.Require(ctx, c.Repo.Trip, chatID, models.TripRoleViewer); err != nil {
+		return nil, err
+	}
+
+	itin, err := c.Repo.Itinerary.GetByChatID(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Repo.Itinerary.GetVersion(ctx, itin.ID, itin.CurrentVersion)
 }
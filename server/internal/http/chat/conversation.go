@@ -0,0 +1,96 @@
+package chat
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/openai/openai-go/v3"
+)
+
+// conversation returns the chat's conversation, starting a new one with the system prompt if needed
+func (c *Controller) conversation(chatID string) *Conversation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	conv, ok := c.conversations[chatID]
+	if !ok {
+		conv = &Conversation{
+			ChatID:   chatID,
+			History:  []openai.ChatCompletionMessageParamUnion{systemMessage(c.Model.SystemPrompt)},
+			examples: make(map[uuid.UUID]bool),
+			profiles: make(map[uuid.UUID]time.Time),
+		}
+		c.conversations[chatID] = conv
+	}
+
+	return conv
+}
+
+// AddNote gives the model context about something that happened outside the chat,
+// such as the user editing the itinerary by hand
+func (c *Controller) AddNote(chatID string, note string) {
+	conv := c.conversation(chatID)
+
+	conv.mu.Lock()
+	defer conv.mu.Unlock()
+
+	conv.History = append(conv.History, systemMessage(note))
+}
+
+func systemMessage(content string) openai.ChatCompletionMessageParamUnion {
+	return openai.ChatCompletionMessageParamUnion{
+		OfSystem: &openai.ChatCompletionSystemMessageParam{
+			Content: openai.ChatCompletionSystemMessageParamContentUnion{
+				OfString: openai.String(content),
+			},
+		},
+	}
+}
+
+func userMessage(content string) openai.ChatCompletionMessageParamUnion {
+	return openai.ChatCompletionMessageParamUnion{
+		OfUser: &openai.ChatCompletionUserMessageParam{
+			Content: openai.ChatCompletionUserMessageParamContentUnion{
+				OfString: openai.String(content),
+			},
+		},
+	}
+}
+
+// memberMessage is a user message attributed to the trip member who wrote it
+func memberMessage(content string, name string) openai.ChatCompletionMessageParamUnion {
+	msg := userMessage(content)
+	if name != "" {
+		msg.OfUser.Name = openai.String(name)
+	}
+	return msg
+}
+
+// names may only contain letters, digits, underscores and hyphens
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// participantName is how a member is named to the model
+func participantName(user *models.User) string {
+	name := user.UserName
+	if name == "" {
+		name = user.FirstName
+	}
+
+	name = invalidNameChars.ReplaceAllString(name, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+func assistantMessage(content string) openai.ChatCompletionMessageParamUnion {
+	return openai.ChatCompletionMessageParamUnion{
+		OfAssistant: &openai.ChatCompletionAssistantMessageParam{
+			Content: openai.ChatCompletionAssistantMessageParamContentUnion{
+				OfString: openai.String(content),
+			},
+		},
+	}
+}
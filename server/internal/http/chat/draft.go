@@ -0,0 +1,320 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary"
+	"github.com/openai/openai-go/v3"
+)
+
+// number of times the model is asked to fix an itinerary that fails validation
+const maxRepairRounds = 1
+
+// number of times the model is asked again when its output can't be parsed into an itinerary
+const maxParseRetries = 2
+
+// attempt is an itinerary parsed from the model's output, respond answers the model about it
+// in the same form it was produced in (tool result or plain message)
+type attempt struct {
+	itin    *itinerary.Itinerary
+	respond func(result map[string]any)
+}
+
+// draftItinerary asks the model for the structured itinerary and validates it, requesting repairs
+// when needed. It returns nil if the model doesn't have enough details for a plan yet.
+func (c *Controller) draftItinerary(ctx context.Context, conv *Conversation, prompt string) (*itinerary.Itinerary, error) {
+	structured := c.structuredOutputs.Load()
+
+	instruction := toolSaveInstruction
+	if structured {
+		instruction = jsonSaveInstruction
+	}
+	conv.History = append(conv.History, userMessage(prompt+"\n"+instruction))
+
+	for round := 0; ; round++ {
+		var a *attempt
+		var err error
+
+		if structured {
+			a, err = c.requestJSONItinerary(ctx, conv)
+			if isUnsupportedResponseFormat(err) {
+				slog.Warn("Structured outputs are not supported, falling back to tool calling",
+					slog.String("model", c.Model.Name), slog.String("error", err.Error()))
+
+				c.structuredOutputs.Store(false)
+				structured = false
+
+				conv.History = append(conv.History, userMessage(toolSaveInstruction))
+				a, err = c.requestToolItinerary(ctx, conv)
+			}
+		} else {
+			a, err = c.requestToolItinerary(ctx, conv)
+		}
+
+		if err != nil || a == nil {
+			return nil, err
+		}
+
+		violations := c.Validator.Validate(ctx, a.itin)
+		a.itin.Warnings = violations.Strings()
+
+		switch {
+		case len(violations) == 0:
+			a.respond(map[string]any{"status": "saved"})
+			return a.itin, nil
+
+		case round == maxRepairRounds:
+			a.respond(map[string]any{"status": "saved_with_warnings", "warnings": violations})
+			slog.Warn("Itinerary saved with unresolved violations", slog.Int("count", len(violations)))
+			return a.itin, nil
+
+		default:
+			a.respond(map[string]any{
+				"status":      "rejected",
+				"violations":  violations,
+				"instruction": "Fix every violation and save the complete corrected itinerary again.",
+			})
+			slog.Info("Requesting itinerary repair", slog.Int("round", round+1), slog.Int("violations", len(violations)))
+		}
+	}
+}
+
+// requestToolItinerary reads the itinerary from a save_itinerary tool call
+func (c *Controller) requestToolItinerary(ctx context.Context, conv *Conversation) (*attempt, error) {
+	tools := []openai.ChatCompletionToolUnionParam{
+		{
+			OfFunction: &openai.ChatCompletionFunctionToolParam{
+				Function: openai.FunctionDefinitionParam{
+					Name:        "save_itinerary",
+					Description: openai.String("Call this to save the finalised itinerary."),
+					Parameters:  itinerarySchema,
+				},
+			},
+		},
+	}
+
+	for retry := 0; ; retry++ {
+		params := openai.ChatCompletionNewParams{
+			Messages:        conv.History,
+			Tools:           tools,
+			Seed:            openai.Int(0),
+			Model:           openai.ChatModel(c.Model.Name),
+			ReasoningEffort: openai.ReasoningEffortMedium,
+		}
+
+		completion, err := c.Client.Chat.Completions.New(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+
+		message := completion.Choices[0].Message
+		if len(message.ToolCalls) == 0 {
+			slog.Debug("save_itinerary not called, details are still missing")
+			return nil, nil
+		}
+
+		conv.History = append(conv.History, message.ToParam())
+
+		answer := func(toolCallID string, result map[string]any) {
+			resultJSON, _ := json.Marshal(result)
+			conv.History = append(conv.History, openai.ChatCompletionMessageParamUnion{
+				OfTool: &openai.ChatCompletionToolMessageParam{
+					ToolCallID: toolCallID,
+					Content: openai.ChatCompletionToolMessageParamContentUnion{
+						OfString: openai.String(string(resultJSON)),
+					},
+				},
+			})
+		}
+
+		// the first save_itinerary call is used, every other call still needs an answer
+		var saveCallID string
+		var arguments string
+		for _, toolCall := range message.ToolCalls {
+			if toolCall.Function.Name == "save_itinerary" && saveCallID == "" {
+				saveCallID, arguments = toolCall.ID, toolCall.Function.Arguments
+				continue
+			}
+			answer(toolCall.ID, map[string]any{"status": "ignored"})
+		}
+
+		parseErr := errors.New("save_itinerary was not called")
+		var itin itinerary.Itinerary
+		if saveCallID != "" {
+			parseErr = json.Unmarshal([]byte(arguments), &itin)
+		}
+
+		if parseErr == nil {
+			return &attempt{
+				itin:    &itin,
+				respond: func(result map[string]any) { answer(saveCallID, result) },
+			}, nil
+		}
+
+		if saveCallID != "" {
+			answer(saveCallID, map[string]any{
+				"status":      "error",
+				"error":       "arguments are not valid itinerary JSON: " + parseErr.Error(),
+				"instruction": "Call save_itinerary again with the complete itinerary as valid JSON.",
+			})
+		}
+
+		if retry == maxParseRetries {
+			return nil, fmt.Errorf("could not parse itinerary after %d retries: %w", maxParseRetries, parseErr)
+		}
+
+		slog.Warn("Retrying unparseable itinerary", slog.Int("retry", retry+1), slog.String("error", parseErr.Error()))
+	}
+}
+
+// requestJSONItinerary reads the itinerary from a reply constrained by itineraryResponseFormat
+func (c *Controller) requestJSONItinerary(ctx context.Context, conv *Conversation) (*attempt, error) {
+	for retry := 0; ; retry++ {
+		params := openai.ChatCompletionNewParams{
+			Messages:        conv.History,
+			ResponseFormat:  itineraryResponseFormat,
+			Seed:            openai.Int(0),
+			Model:           openai.ChatModel(c.Model.Name),
+			ReasoningEffort: openai.ReasoningEffortMedium,
+		}
+
+		completion, err := c.Client.Chat.Completions.New(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+
+		message := completion.Choices[0].Message
+		if message.Refusal != "" {
+			return nil, fmt.Errorf("model refused to produce an itinerary: %s", message.Refusal)
+		}
+
+		conv.History = append(conv.History, assistantMessage(message.Content))
+
+		var draft struct {
+			Ready     bool                 `json:"ready"`
+			Itinerary *itinerary.Itinerary `json:"itinerary"`
+		}
+
+		parseErr := json.Unmarshal([]byte(message.Content), &draft)
+		switch {
+		case parseErr == nil && !draft.Ready:
+			return nil, nil
+		case parseErr == nil && draft.Itinerary == nil:
+			parseErr = errors.New(`"itinerary" is null although "ready" is true`)
+		case parseErr == nil:
+			return &attempt{
+				itin: draft.Itinerary,
+				respond: func(result map[string]any) {
+					resultJSON, _ := json.Marshal(result)
+					conv.History = append(conv.History, userMessage("Save result: "+string(resultJSON)))
+				},
+			}, nil
+		}
+
+		if retry == maxParseRetries {
+			return nil, fmt.Errorf("could not parse itinerary after %d retries: %w", maxParseRetries, parseErr)
+		}
+
+		slog.Warn("Retrying unparseable itinerary", slog.Int("retry", retry+1), slog.String("error", parseErr.Error()))
+		conv.History = append(conv.History, userMessage("Your reply could not be parsed: "+parseErr.Error()+"\n"+jsonSaveInstruction))
+	}
+}
+
+// isUnsupportedResponseFormat reports whether the provider rejected the json_schema response format
+func isUnsupportedResponseFormat(err error) bool {
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+
+	return apiErr.Param == "response_format" || strings.Contains(apiErr.Message, "response_format")
+}
+
+// itineraryResponseFormat constrains a reply to a readiness flag and the itinerary
+var itineraryResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
+	OfJSONSchema: &openai.ResponseFormatJSONSchemaParam{
+		JSONSchema: openai.ResponseFormatJSONSchemaJSONSchemaParam{
+			Name:        "itinerary_draft",
+			Description: openai.String("The finalised itinerary, or ready=false when details are still missing."),
+			Strict:      openai.Bool(true),
+			Schema: map[string]any{
+				"type":     "object",
+				"required": []string{"ready", "itinerary"},
+				"properties": map[string]any{
+					"ready": map[string]any{"type": "boolean"},
+					"itinerary": map[string]any{
+						"anyOf": []any{strictSchema(itinerarySchema), map[string]any{"type": "null"}},
+					},
+				},
+				"additionalProperties": false,
+			},
+		},
+	},
+}
+
+// keywords strict structured outputs reject, the validator checks the same constraints anyway
+var unsupportedKeywords = map[string]bool{"$schema": true, "title": true, "minimum": true, "minItems": true}
+
+// constraintHints describe the dropped constraints in the description, so the model still sees them
+var constraintHints = map[string]string{"minimum": "Minimum %v.", "minItems": "Minimum length %v."}
+
+// strictSchema adapts a tool schema for strict structured outputs: every property is required,
+// the optional ones become nullable instead
+func strictSchema(schema map[string]any) map[string]any {
+	out := make(map[string]any, len(schema))
+	var hints []string
+	for k, v := range schema {
+		if !unsupportedKeywords[k] {
+			out[k] = v
+		} else if hint, ok := constraintHints[k]; ok {
+			hints = append(hints, fmt.Sprintf(hint, v))
+		}
+	}
+
+	if len(hints) > 0 {
+		sort.Strings(hints)
+		if description, ok := out["description"].(string); ok {
+			hints = append([]string{description}, hints...)
+		}
+		out["description"] = strings.Join(hints, " ")
+	}
+
+	if items, ok := schema["items"].(map[string]any); ok {
+		out["items"] = strictSchema(items)
+	}
+
+	properties, ok := schema["properties"].(map[string]any)
+	if !ok {
+		return out
+	}
+
+	required := make(map[string]bool)
+	if names, ok := schema["required"].([]string); ok {
+		for _, name := range names {
+			required[name] = true
+		}
+	}
+
+	strict := make(map[string]any, len(properties))
+	names := make([]string, 0, len(properties))
+	for name, p := range properties {
+		prop := strictSchema(p.(map[string]any))
+		if t, ok := prop["type"].(string); ok && !required[name] {
+			prop["type"] = []string{t, "null"}
+		}
+		strict[name] = prop
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out["properties"] = strict
+	out["required"] = names
+	return out
+}
@@ -0,0 +1,88 @@
+package chat
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// walkSchema calls fn for the schema and every nested property and items schema, with its path
+func walkSchema(path string, schema map[string]any, fn func(path string, schema map[string]any)) {
+	fn(path, schema)
+	if items, ok := schema["items"].(map[string]any); ok {
+		walkSchema(path+"[]", items, fn)
+	}
+	if properties, ok := schema["properties"].(map[string]any); ok {
+		for name, p := range properties {
+			walkSchema(path+"."+name, p.(map[string]any), fn)
+		}
+	}
+}
+
+func TestStrictSchema(t *testing.T) {
+	before, _ := json.Marshal(itinerarySchema)
+	strict := strictSchema(itinerarySchema)
+	if after, _ := json.Marshal(itinerarySchema); string(before) != string(after) {
+		t.Fatal("strictSchema modified the tool schema")
+	}
+
+	walkSchema("itinerary", strict, func(path string, schema map[string]any) {
+		for k := range unsupportedKeywords {
+			if _, ok := schema[k]; ok {
+				t.Errorf("%s: %q was kept", path, k)
+			}
+		}
+
+		properties, ok := schema["properties"].(map[string]any)
+		if !ok {
+			return
+		}
+		if schema["additionalProperties"] != false {
+			t.Errorf("%s: additionalProperties isn't false", path)
+		}
+
+		var names []string
+		for name := range properties {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		if required, _ := schema["required"].([]string); !slices.Equal(required, names) {
+			t.Errorf("%s: required = %v, want every property %v", path, required, names)
+		}
+	})
+
+	days := strict["properties"].(map[string]any)["days"].(map[string]any)
+	item := days["items"].(map[string]any)
+	dayItem := item["properties"].(map[string]any)["items"].(map[string]any)["items"].(map[string]any)
+	props := dayItem["properties"].(map[string]any)
+
+	// originally required properties keep their type, optional ones become nullable
+	if got := props["title"].(map[string]any)["type"]; got != "string" {
+		t.Errorf("title type = %v, want string", got)
+	}
+	if got := props["notes"].(map[string]any)["type"]; !slices.Equal(got.([]string), []string{"string", "null"}) {
+		t.Errorf("notes type = %v, want nullable string", got)
+	}
+	if got := strict["properties"].(map[string]any)["startDate"].(map[string]any)["type"]; !slices.Equal(got.([]string), []string{"string", "null"}) {
+		t.Errorf("startDate type = %v, want nullable string", got)
+	}
+
+	// dropped constraints move into the description
+	for _, tt := range []struct {
+		name        string
+		schema      map[string]any
+		description []string
+	}{
+		{"days", days, []string{"Minimum length 1."}},
+		{"day", item["properties"].(map[string]any)["day"].(map[string]any), []string{"Minimum 1."}},
+		{"cost", props["cost"].(map[string]any), []string{"Estimated cost per group", "Minimum 0."}},
+	} {
+		description, _ := tt.schema["description"].(string)
+		for _, want := range tt.description {
+			if !strings.Contains(description, want) {
+				t.Errorf("%s description = %q, want it to mention %q", tt.name, description, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// addTemplateExamples gives the model popular templates for destinations the message mentions,
+// each template is added to a conversation once
+func (c *Controller) addTemplateExamples(ctx context.Context, conv *Conversation, content string) {
+	if c.Model.TemplateExamples <= 0 {
+		return
+	}
+
+	templates, err := c.Repo.Template.MatchDestination(ctx, content, c.Model.TemplateExamples)
+	if err != nil {
+		slog.Error("Could not load template examples", slog.String("error", err.Error()))
+		return
+	}
+
+	var examples strings.Builder
+	for _, t := range templates {
+		if conv.examples[t.ID] {
+			continue
+		}
+
+		plan, err := json.Marshal(t.Data)
+		if err != nil {
+			continue
+		}
+
+		details := fmt.Sprintf("%d days", t.DurationDays)
+		if t.Pace != "" {
+			details += ", " + t.Pace + " pace"
+		}
+		if len(t.Interests) > 0 {
+			details += ", " + strings.Join(t.Interests, ", ")
+		}
+
+		fmt.Fprintf(&examples, "\n\n%s (%s):\n%s", t.Title, details, plan)
+		conv.examples[t.ID] = true
+	}
+
+	if examples.Len() > 0 {
+		conv.History = append(conv.History, systemMessage(templateExamplesPrompt+examples.String()))
+	}
+}
@@ -2,11 +2,19 @@ package chat
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/access"
+	mw "github.com/nakul-krishnakumar/kaiyo-ai/internal/middlewares"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
 )
 
+const eventsPingInterval = 25 * time.Second
+
 func NewHandler(ctrl *Controller) *Handler {
 	return &Handler{Controller: ctrl}
 }
@@ -14,7 +22,7 @@ func NewHandler(ctrl *Controller) *Handler {
 // POST api/v1/chats/
 func (h *Handler) PostChat(w http.ResponseWriter, r *http.Request) {
 
-	chunkCh := make(chan string)
+	events := make(chan StreamEvent)
 	done := make(chan error, 1)
 
 	ctx := r.Context()
@@ -37,11 +45,31 @@ func (h *Handler) PostChat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if userInput.ChatID == "" {
+		http.Error(w, "chatId is missing", http.StatusBadRequest)
+		return
+	}
+
+	// the author is always the authenticated user, never the request body
+	userInput.UserID = ""
+	if userID, ok := mw.UserIDFromContext(ctx); ok {
+		userInput.UserID = userID.String()
+	}
+
+	if err := h.Controller.JoinChat(ctx, userInput.ChatID); err != nil {
+		if errors.Is(err, access.ErrForbidden) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	go func() {
-		done <- h.Controller.StreamMessage(ctx, userInput, chunkCh)
+		done <- h.Controller.StreamMessage(ctx, userInput, events)
 	}()
 
-	// listen to both done and chunkCh channels at the same time
+	// listen to both done and events channels at the same time
 	for { // inifinite loop
 		select { // listen from the channel which gives output first
 		case <-ctx.Done():
@@ -53,16 +81,73 @@ func (h *Handler) PostChat(w http.ResponseWriter, r *http.Request) {
 			}
 			return
 
-		case chunk, ok := <-chunkCh:
+		case ev, ok := <-events:
 			if !ok {
 				return
 			}
+
+			// named events (e.g. job updates) carry JSON on a single line
+			if ev.Event != "" {
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Event, ev.Data)
+				flusher.Flush()
+				continue
+			}
+
 			// Escape newlines for SSE transmission
-			escapedChunk := strings.ReplaceAll(chunk, "\n", "\\n")
+			escapedChunk := strings.ReplaceAll(ev.Data, "\n", "\\n")
 			fmt.Fprintf(w, "data: %s\n\n", escapedChunk) // buffer
 			flusher.Flush()                              // returns the buffer
 
-			fmt.Print(chunk)
+			fmt.Print(ev.Data)
+		}
+	}
+}
+
+// GET api/v1/chats/events/{chatID}
+// streams live events of a shared trip: messages, itinerary versions and who is viewing
+func (h *Handler) GetEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	sub, err := h.Controller.Subscribe(ctx, r.PathValue("chatID"))
+	if errors.Is(err, access.ErrForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer sub.Close()
+
+	// comments keep proxies from closing an idle stream
+	ping := time.NewTicker(eventsPingInterval)
+	defer ping.Stop()
+
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ping.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+
+		case ev, ok := <-sub.C:
+			if !ok {
+				return // dropped or shutting down, the client reconnects
+			}
+
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, ev.Data)
+			flusher.Flush()
 		}
 	}
 }
@@ -75,7 +160,11 @@ func (h *Handler) GetHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	msgs, err := h.Controller.GetHistory(chatID)
+	msgs, err := h.Controller.GetHistory(r.Context(), chatID)
+	if errors.Is(err, access.ErrForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
@@ -92,11 +181,19 @@ func (h *Handler) GetItinerary(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	msgs, err := h.Controller.GetItinerary(chatID)
+	itin, err := h.Controller.GetItinerary(r.Context(), chatID)
+	if errors.Is(err, access.ErrForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, models.ErrNotFound) {
+		http.Error(w, "no itinerary saved for this chat", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	json.NewEncoder(w).Encode(msgs)
+	json.NewEncoder(w).Encode(itin)
 }
@@ -0,0 +1,172 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/queue"
+	"github.com/openai/openai-go/v3"
+)
+
+// Background job kinds run by the chat controller
+const (
+	JobSaveItinerary   = "itinerary.save"   // draft, validate and store the itinerary from a conversation
+	JobEnrichItinerary = "itinerary.enrich" // geocode stops without coordinates and revalidate
+)
+
+// how long the chat stream waits for the save job before leaving the client to poll it
+const jobWaitTimeout = 2 * time.Minute
+
+type saveJobPayload struct {
+	ChatID  string                                   `json:"chatId"`
+	UserID  *uuid.UUID                               `json:"userId,omitempty"`
+	Message string                                   `json:"message"` // the chat message that produced the itinerary
+	History []openai.ChatCompletionMessageParamUnion `json:"history"`
+}
+
+type enrichJobPayload struct {
+	ItineraryID uuid.UUID `json:"itineraryId"`
+	Version     int       `json:"version"`
+}
+
+func jobEvent(job *models.Job) StreamEvent {
+	data, _ := json.Marshal(job)
+	return StreamEvent{Event: "job", Data: string(data)}
+}
+
+// errorEvent tells the client the reply failed after the stream had started
+func errorEvent(message string) StreamEvent {
+	data, _ := json.Marshal(map[string]string{"error": message})
+	return StreamEvent{Event: "error", Data: string(data)}
+}
+
+// runSaveJob drafts and stores the itinerary from the snapshot of the conversation in the payload,
+// so it doesn't depend on the in-memory conversation still being around
+func (c *Controller) runSaveJob(ctx context.Context, job *models.Job) (any, error) {
+	var payload saveJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil, queue.Permanent(fmt.Errorf("invalid save job payload: %w", err))
+	}
+
+	conv := &Conversation{ChatID: payload.ChatID, History: payload.History}
+
+	itin, err := c.draftItinerary(ctx, conv, savePrompt)
+	if err != nil {
+		return nil, err
+	}
+	if itin == nil {
+		return map[string]any{"saved": false}, nil
+	}
+
+	userInput := UserInput{ChatID: payload.ChatID, Content: payload.Message}
+	version, err := c.storeItinerary(ctx, itin, userInput, payload.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"saved":       true,
+		"itineraryId": version.ItineraryID,
+		"version":     version.Version,
+		"warnings":    itin.Warnings,
+	}, nil
+}
+
+// runEnrichJob geocodes the stops the model left without coordinates and revalidates the itinerary,
+// saving the result as a new version unless the itinerary has changed in the meantime
+func (c *Controller) runEnrichJob(ctx context.Context, job *models.Job) (any, error) {
+	var payload enrichJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil, queue.Permanent(fmt.Errorf("invalid enrich job payload: %w", err))
+	}
+
+	skipped := map[string]any{"changed": false, "reason": "itinerary has a newer version"}
+
+	itin, err := c.Repo.Itinerary.GetByID(ctx, payload.ItineraryID)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, queue.Permanent(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if itin.CurrentVersion != payload.Version {
+		return skipped, nil
+	}
+
+	current, err := c.Repo.Itinerary.GetVersion(ctx, itin.ID, payload.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	data := current.Data.Clone()
+
+	geocoded, missed := 0, 0
+	for d := range data.Days {
+		for i := range data.Days[d].Items {
+			item := &data.Days[d].Items[i]
+			if item.HasCoords() {
+				continue
+			}
+
+			place := item.Place
+			if place == "" {
+				place = item.Title
+			}
+			city := item.City
+			if city == "" {
+				city = data.Destination
+			}
+
+			// the geocoder keeps to Nominatim's rate limit across every job and chat in the process
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			lat, lon, err := c.geocode(ctx, place, city)
+			if err != nil {
+				// a stop the geocoder doesn't know is not worth failing the job over
+				slog.Debug("Could not geocode itinerary stop", slog.String("place", place), slog.String("error", err.Error()))
+				missed++
+				continue
+			}
+
+			item.Lat, item.Lon = lat, lon
+			geocoded++
+		}
+	}
+
+	data.Warnings = c.Validator.Validate(ctx, data).Strings()
+
+	if geocoded == 0 && slices.Equal(data.Warnings, current.Data.Warnings) {
+		return map[string]any{"changed": false, "missed": missed}, nil
+	}
+
+	version := &models.ItineraryVersion{
+		Data:    *data,
+		Source:  models.ItinerarySourceEnrichment,
+		Message: fmt.Sprintf("Added coordinates for %d stops", geocoded),
+	}
+
+	if _, err := c.Repo.Itinerary.AppendVersion(ctx, itin.ID, current.Version, version); err != nil {
+		if errors.Is(err, models.ErrVersionConflict) {
+			return skipped, nil
+		}
+		return nil, err
+	}
+	c.publishItinerary(itin.ChatID, version)
+
+	return map[string]any{
+		"changed":  true,
+		"version":  version.Version,
+		"geocoded": geocoded,
+		"missed":   missed,
+		"warnings": data.Warnings,
+	}, nil
+}
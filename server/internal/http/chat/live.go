@@ -0,0 +1,43 @@
+package chat
+
+import (
+	"context"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/access"
+	mw "github.com/nakul-krishnakumar/kaiyo-ai/internal/middlewares"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/realtime"
+)
+
+// publishReply shows an assistant reply to every member viewing the trip
+func (c *Controller) publishReply(chatID string, content string) {
+	c.Hub.Publish(chatID, realtime.EventMessage, realtime.ChatMessage{
+		Role:    "assistant",
+		Content: content,
+	})
+}
+
+// publishItinerary tells every member viewing the trip a new itinerary version was saved
+func (c *Controller) publishItinerary(chatID string, version *models.ItineraryVersion) {
+	c.Hub.Publish(chatID, realtime.EventItinerary, realtime.ItineraryUpdate{
+		ItineraryID: version.ItineraryID,
+		Version:     version.Version,
+		Source:      version.Source,
+		Message:     version.Message,
+	})
+}
+
+// Subscribe follows a chat's live events, the requesting user shows up as viewing the trip until it is closed
+func (c *Controller) Subscribe(ctx context.Context, chatID string) (*realtime.Subscription, error) {
+	if _, err := access.Require(ctx, c.Repo.Trip, chatID, models.TripRoleViewer); err != nil {
+		return nil, err
+	}
+
+	userID, _ := mw.UserIDFromContext(ctx)
+	viewer := realtime.Viewer{UserID: userID}
+	if user, err := c.Repo.User.GetByID(ctx, userID); err == nil {
+		viewer.UserName = user.UserName
+	}
+
+	return c.Hub.Subscribe(chatID, viewer), nil
+}
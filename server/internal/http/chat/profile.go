@@ -0,0 +1,71 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+// profileBlock is the compact form of a traveller's preferences given to the model
+func profileBlock(name string, p *models.Preferences) string {
+	var b strings.Builder
+
+	b.WriteString("## Traveller profile")
+	if name != "" {
+		b.WriteString(": " + name)
+	}
+	b.WriteString("\n" + profilePrompt + "\n")
+
+	line := func(label string, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "- %s: %s\n", label, value)
+		}
+	}
+	line("Home city", p.HomeCity)
+	line("Home currency", p.HomeCurrency)
+	line("Dietary restrictions", strings.Join(p.DietaryRestrictions, ", "))
+	line("Mobility needs", p.MobilityNeeds)
+	line("Preferred pace", p.Pace)
+	line("Interests", strings.Join(p.Interests, ", "))
+	line("Accommodation style", p.AccommodationStyle)
+	line("Reply in", p.Language)
+
+	return strings.TrimSpace(b.String())
+}
+
+// addProfile gives the model the author's saved preferences. A new conversation gets them in its
+// system message, members joining later or changing their preferences get a system note.
+func (c *Controller) addProfile(ctx context.Context, conv *Conversation, userID *uuid.UUID, name string) {
+	if userID == nil {
+		return
+	}
+
+	prefs, err := c.Repo.Preferences.Get(ctx, *userID)
+	if errors.Is(err, models.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		slog.Error("Could not load preferences", slog.String("error", err.Error()))
+		return
+	}
+
+	if prefs.Empty() {
+		return
+	}
+	if seen, ok := conv.profiles[*userID]; ok && !prefs.UpdatedAt.After(seen) {
+		return
+	}
+	conv.profiles[*userID] = prefs.UpdatedAt
+
+	block := profileBlock(name, prefs)
+	if len(conv.History) == 1 {
+		conv.History[0] = systemMessage(c.Model.SystemPrompt + "\n\n" + block)
+		return
+	}
+	conv.History = append(conv.History, systemMessage(block))
+}
@@ -0,0 +1,66 @@
+package chat
+
+// itineraryMarker is where the rendered itinerary is spliced into the model's reply
+const itineraryMarker = "[[ITINERARY]]"
+
+// narrativePrompt has the model write the itinerary itself, it is saved as JSON afterwards
+const narrativePrompt = `Generate the complete itinerary in proper Markdown format, ONLY if all necessary data is available.
+
+CRITICAL FORMATTING RULES:
+1. Add TWO newlines (\n\n) after every heading (##)
+2. Add TWO newlines (\n\n) before and after horizontal rules (---)
+3. Add ONE newline (\n) after each bullet point
+4. Add TWO newlines (\n\n) between different sections
+5. Use proper markdown syntax:
+   - Headings: ## Day 1: Title
+   - Horizontal rules: ---
+   - Bullet points: - Item text
+   - Bold: **text**
+   - Italic: *text*
+
+Example format:
+## Day 1: Monday, April 22 – Welcome to Paris
+
+- 09:00 – 11:00 • Activity Name
+  Description here
+- 11:00 – 14:00 • Next Activity
+  Description here
+
+---
+
+## Day 2: Tuesday, April 23 – Next Day
+
+- 08:30 – 10:00 • Morning Activity
+  Description here
+
+Generate the itinerary now with proper spacing.`
+
+// savePrompt asks for the structured version of the itinerary the model just wrote
+const savePrompt = `IF AND ONLY IF all the necessary details for an itinerary exist, save the itinerary you just presented.`
+
+// draftPrompt asks for the structured itinerary before anything is shown to the user
+const draftPrompt = `IF AND ONLY IF all the necessary details for an itinerary exist, save the complete day-by-day plan now.
+The user will see the itinerary exactly as you save it, so include every activity with its time window, place, city, category, notes and estimated cost.`
+
+// toolSaveInstruction and jsonSaveInstruction tell the model how to save in each output mode
+const toolSaveInstruction = `Save it by calling save_itinerary. If details are still missing, do not call any tool.`
+
+const jsonSaveInstruction = `Reply with JSON only. Set "ready" to true and "itinerary" to the complete plan,
+or "ready" to false and "itinerary" to null if details are still missing.`
+
+// renderedPrompt asks for the prose around an itinerary the server renders itself
+const renderedPrompt = `The itinerary you just saved will be shown to the user as Markdown rendered from the saved data.
+Write your reply around it: a short introduction, then the line ` + itineraryMarker + ` on its own, then a few closing tips or follow-up questions.
+Do NOT list the days or activities yourself and do not contradict the saved plan.`
+
+// followUpPrompt is used when no itinerary could be saved yet
+const followUpPrompt = `No itinerary has been saved yet, so do NOT write a day-by-day plan.
+Reply to the user in Markdown and ask concisely for the details you still need.`
+
+// templateExamplesPrompt introduces saved templates for a destination the user mentioned
+const templateExamplesPrompt = `Here are itineraries other travellers used for a destination the user mentioned.
+Use them as a reference for structure, pacing and places worth including, but adapt them to the user's dates, group and interests instead of copying them.`
+
+// profilePrompt introduces a traveller's saved preferences
+const profilePrompt = `Saved preferences of this traveller. Use them instead of asking again,
+only ask about details they don't cover or that the user wants to change for this trip.`
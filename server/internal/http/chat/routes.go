@@ -6,14 +6,14 @@ import (
 	mw "github.com/nakul-krishnakumar/kaiyo-ai/internal/middlewares"
 )
 
-func New() *http.ServeMux {
-	ctrl := NewController()
+func New(ctrl *Controller) *http.ServeMux {
 	h := NewHandler(ctrl)
 
 	mux := http.NewServeMux()
-	mux.Handle("POST /{$}", mw.SSEHandler(http.HandlerFunc(h.PostChat))) //(sse output) api/v1/chats/
-	mux.HandleFunc("GET /history/{chatID}", h.GetHistory)                // api/v1/chats/history/{chatID}
-	mux.HandleFunc("GET /itinerary/{chatID}", h.GetItinerary)            // api/v1/itinerary/history/{chatID}
+	mux.Handle("POST /{$}", mw.SSEHandler(http.HandlerFunc(h.PostChat)))             //(sse output) api/v1/chats/
+	mux.HandleFunc("GET /history/{chatID}", h.GetHistory)                            // api/v1/chats/history/{chatID}
+	mux.Handle("GET /events/{chatID}", mw.SSEHandler(http.HandlerFunc(h.GetEvents))) //(sse output) api/v1/chats/events/{chatID}
+	mux.HandleFunc("GET /itinerary/{chatID}", h.GetItinerary)                        // api/v1/itinerary/history/{chatID}
 
 	return mux
 }
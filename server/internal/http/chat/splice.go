@@ -0,0 +1,56 @@
+package chat
+
+import "strings"
+
+// splicer replaces the first occurrence of marker in a stream of chunks with insert.
+// Text that could be the start of the marker is held back until the next chunk decides it.
+type splicer struct {
+	marker string
+	insert string
+	emit   func(string)
+
+	pending string
+	done    bool
+}
+
+func (s *splicer) write(chunk string) {
+	if s.done {
+		s.emit(chunk)
+		return
+	}
+
+	s.pending += chunk
+	if i := strings.Index(s.pending, s.marker); i >= 0 {
+		s.send(s.pending[:i])
+		s.send(s.insert)
+		s.send(s.pending[i+len(s.marker):])
+		s.pending, s.done = "", true
+		return
+	}
+
+	// hold back the longest suffix that is a prefix of the marker
+	keep := min(len(s.pending), len(s.marker)-1)
+	for keep > 0 && !strings.HasPrefix(s.marker, s.pending[len(s.pending)-keep:]) {
+		keep--
+	}
+
+	s.send(s.pending[:len(s.pending)-keep])
+	s.pending = s.pending[len(s.pending)-keep:]
+}
+
+// flush sends whatever is held back, appending the insert if the marker never came
+func (s *splicer) flush() {
+	if s.done {
+		return
+	}
+
+	s.send(s.pending)
+	s.send(s.insert)
+	s.pending, s.done = "", true
+}
+
+func (s *splicer) send(text string) {
+	if text != "" {
+		s.emit(text)
+	}
+}
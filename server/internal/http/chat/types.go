@@ -1,9 +1,16 @@
 package chat
 
 import (
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	calltools "github.com/nakul-krishnakumar/kaiyo-ai/internal/http/chat/call_tools"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/queue"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/realtime"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
 	"github.com/openai/openai-go/v3"
 )
 
@@ -11,52 +18,62 @@ type Model struct {
 	Name         string `mapstructure:"model_name"`
 	Type         string `mapstructure:"model_type"`
 	SystemPrompt string `mapstructure:"system_prompt"`
+	ResponseMode string `mapstructure:"response_mode"`
+
+	// use json_schema structured outputs for the itinerary, tool calling is the fallback
+	StructuredOutputs bool `mapstructure:"structured_outputs"`
+
+	// how many public templates for a mentioned destination to show the model, 0 disables them
+	TemplateExamples int `mapstructure:"template_examples"`
 }
 
+// Response modes, how the itinerary shown in the chat relates to the saved one
+const (
+	ResponseModeNarrative = "narrative" // the model writes the plan, then saves it as JSON (default)
+	ResponseModeRendered  = "rendered"  // the model saves the plan, the server renders what users read
+)
+
 type Message struct {
 	Role      string
 	Content   string
 	CreatedAt time.Time
 }
 
-type Itinerary struct {
-	Destination string    `json:"destination"`         // e.g., "Coorg"
-	StartDate   string    `json:"startDate,omitempty"` // ISO date string, e.g., "2025-11-01"
-	EndDate     string    `json:"endDate,omitempty"`   // ISO date string, e.g., "2025-11-03"
-	Currency    string    `json:"currency,omitempty"`  // e.g., "INR", "USD"
-	Days        []DayPlan `json:"days"`                // Day-wise plan
-}
-
-type DayPlan struct {
-	Day   int       `json:"day"`             // 1-based day index
-	Label string    `json:"label,omitempty"` // Optional label, e.g., "Arrival", "Trek day"
-	Items []DayItem `json:"items"`           // Stops/activities for the day
-}
-
-type DayItem struct {
-	Title     string  `json:"title"`               // Activity/title, e.g., "Tadiandamol Trek"
-	City      string  `json:"city,omitempty"`      // City/town context, e.g., "Madikeri"
-	Place     string  `json:"place,omitempty"`     // POI name, e.g., "Abbey Falls"
-	Category  string  `json:"category,omitempty"`  // e.g., "sightseeing", "food", "trek"
-	StartTime string  `json:"startTime,omitempty"` // "09:00" (24h) or ISO time
-	EndTime   string  `json:"endTime,omitempty"`   // "11:30"
-	Notes     string  `json:"notes,omitempty"`     // Free-form notes
-	Lat       float64 `json:"lat,omitempty"`       // Geocoded latitude
-	Lon       float64 `json:"lon,omitempty"`       // Geocoded longitude
-}
-
 type Controller struct {
 	Client *openai.Client // OpenAI Client
 	Model
-	History   []openai.ChatCompletionMessageParamUnion // context memory to store messages
-	Itinerary *Itinerary
 	Tools     calltools.ToolBox
+	Validator *itinerary.Validator
+	Repo      *repositories.Repositories
+	Jobs      *queue.Queue
+	Hub       *realtime.Hub // live updates for every member viewing the trip
+
+	conversations map[string]*Conversation // chatID -> context memory
+	mu            sync.Mutex
+
+	structuredOutputs atomic.Bool // cleared if the provider rejects structured outputs
+}
+
+// Conversation is the model context memory of a single chat
+type Conversation struct {
+	ChatID  string
+	History []openai.ChatCompletionMessageParamUnion
+	mu      sync.Mutex // held while a message is being processed
+
+	examples map[uuid.UUID]bool      // templates already given as examples
+	profiles map[uuid.UUID]time.Time // members whose preferences were given, as of their last update
 }
 
 type Handler struct {
 	Controller *Controller
 }
 
+// StreamEvent is a server-sent event on the chat stream, an empty Event is a chunk of the reply
+type StreamEvent struct {
+	Event string
+	Data  string
+}
+
 type UserInput struct {
 	ChatID  string
 	UserID  string
@@ -92,6 +109,7 @@ var itinerarySchema = openai.FunctionParameters{
 								"startTime": map[string]any{"type": "string"},
 								"endTime":   map[string]any{"type": "string"},
 								"notes":     map[string]any{"type": "string"},
+								"cost":      map[string]any{"type": "number", "minimum": 0, "description": "Estimated cost per group in the itinerary currency"},
 								"lat":       map[string]any{"type": "number"},
 								"lon":       map[string]any{"type": "number"},
 							},
@@ -0,0 +1,359 @@
+package itineraries
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/access"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary"
+	mw "github.com/nakul-krishnakumar/kaiyo-ai/internal/middlewares"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/realtime"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+func NewController(repo *repositories.Repositories, notifier Notifier, hub *realtime.Hub) *Controller {
+	return &Controller{
+		Repo:      repo,
+		Notifier:  notifier,
+		Validator: itinerary.NewValidator(nil),
+		Hub:       hub,
+	}
+}
+
+func currentUser(ctx context.Context) *uuid.UUID {
+	if userID, ok := mw.UserIDFromContext(ctx); ok {
+		return &userID
+	}
+	return nil
+}
+
+// authorize loads an itinerary and checks the requesting user has at least role in its trip
+func (c *Controller) authorize(ctx context.Context, id uuid.UUID, role string) (*models.Itinerary, error) {
+	itin, err := c.Repo.Itinerary.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := access.Require(ctx, c.Repo.Trip, itin.ChatID, role); err != nil {
+		return nil, err
+	}
+
+	return itin, nil
+}
+
+// published tells every member viewing the trip about a new version
+func (c *Controller) published(chatID string, version *models.ItineraryVersion) {
+	c.Hub.Publish(chatID, realtime.EventItinerary, realtime.ItineraryUpdate{
+		ItineraryID: version.ItineraryID,
+		Version:     version.Version,
+		Source:      version.Source,
+		Message:     version.Message,
+	})
+}
+
+func (c *Controller) GetCurrent(ctx context.Context, id uuid.UUID) (*models.ItineraryVersion, error) {
+	itin, err := c.authorize(ctx, id, models.TripRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Repo.Itinerary.GetVersion(ctx, itin.ID, itin.CurrentVersion)
+}
+
+func (c *Controller) ListVersions(ctx context.Context, id uuid.UUID) ([]VersionSummary, error) {
+	itin, err := c.authorize(ctx, id, models.TripRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := c.Repo.Itinerary.ListVersions(ctx, itin.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]VersionSummary, 0, len(versions))
+	for _, v := range versions {
+		out = append(out, VersionSummary{ItineraryVersion: v, Current: v.Version == itin.CurrentVersion})
+	}
+
+	return out, nil
+}
+
+func (c *Controller) GetVersion(ctx context.Context, id uuid.UUID, version int) (*models.ItineraryVersion, error) {
+	itin, err := c.authorize(ctx, id, models.TripRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Repo.Itinerary.GetVersion(ctx, itin.ID, version)
+}
+
+// Restore saves an old version's itinerary as a new version, history is never rewritten
+func (c *Controller) Restore(ctx context.Context, id uuid.UUID, version int) (*models.ItineraryVersion, error) {
+	itin, err := c.authorize(ctx, id, models.TripRoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	old, err := c.Repo.Itinerary.GetVersion(ctx, itin.ID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	restored := &models.ItineraryVersion{
+		Data:      old.Data,
+		Source:    models.ItinerarySourceRestore,
+		Message:   fmt.Sprintf("Restored version %d", version),
+		CreatedBy: currentUser(ctx),
+	}
+
+	if _, err := c.Repo.Itinerary.SaveVersion(ctx, itin.ChatID, itin.UserID, restored); err != nil {
+		return nil, err
+	}
+
+	c.published(itin.ChatID, restored)
+
+	c.Notifier.AddNote(itin.ChatID, fmt.Sprintf(
+		"The user restored itinerary version %d, it is now version %d. Treat it as the current plan.",
+		version, restored.Version))
+
+	return restored, nil
+}
+
+// Diff compares two versions, to = 0 means the current version
+func (c *Controller) Diff(ctx context.Context, id uuid.UUID, from, to int) (*DiffResponse, error) {
+	itin, err := c.authorize(ctx, id, models.TripRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	if to == 0 {
+		to = itin.CurrentVersion
+	}
+
+	a, err := c.Repo.Itinerary.GetVersion(ctx, itin.ID, from)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := c.Repo.Itinerary.GetVersion(ctx, itin.ID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DiffResponse{
+		ItineraryID: itin.ID.String(),
+		From:        from,
+		To:          to,
+		Diff:        itinerary.Compare(&a.Data, &b.Data),
+	}, nil
+}
+
+// Edit applies fn to a copy of the current version and saves the result as a new version.
+// expectedVersion must match the current version, otherwise the edit is based on stale data.
+func (c *Controller) Edit(ctx context.Context, id uuid.UUID, expectedVersion int, fn func(*itinerary.Itinerary) error) (*models.ItineraryVersion, error) {
+	itin, err := c.authorize(ctx, id, models.TripRoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	if itin.CurrentVersion != expectedVersion {
+		return nil, models.ErrVersionConflict
+	}
+
+	current, err := c.Repo.Itinerary.GetVersion(ctx, itin.ID, itin.CurrentVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	edited := current.Data.Clone()
+	if err := fn(edited); err != nil {
+		return nil, err
+	}
+	edited.Warnings = c.Validator.Validate(ctx, edited).Strings()
+
+	diff := itinerary.Compare(&current.Data, edited)
+	if diff.Empty() {
+		return current, nil
+	}
+	changes := diff.Summary()
+
+	version := &models.ItineraryVersion{
+		Data:      *edited,
+		Source:    models.ItinerarySourceEdit,
+		Message:   strings.Join(changes, "; "),
+		CreatedBy: currentUser(ctx),
+	}
+
+	if _, err := c.Repo.Itinerary.AppendVersion(ctx, itin.ID, expectedVersion, version); err != nil {
+		return nil, err
+	}
+
+	c.published(itin.ChatID, version)
+
+	c.Notifier.AddNote(itin.ChatID, fmt.Sprintf(
+		"The user edited the itinerary directly, it is now version %d. Changes:\n- %s\n"+
+			"Treat the edited itinerary as the current plan and keep these changes unless the user asks otherwise.",
+		version.Version, strings.Join(changes, "\n- ")))
+
+	return version, nil
+}
+
+// CreateShare publishes an itinerary through a new share link
+func (c *Controller) CreateShare(ctx context.Context, id uuid.UUID, req CreateShareRequest) (*ShareResponse, error) {
+	itin, err := c.authorize(ctx, id, models.TripRoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.Permission {
+	case "":
+		req.Permission = models.SharePermissionRead
+	case models.SharePermissionRead, models.SharePermissionDuplicate:
+	default:
+		return nil, ErrInvalidPermission
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, ErrExpiryInPast
+	}
+
+	token, err := models.NewToken()
+	if err != nil {
+		return nil, err
+	}
+
+	share := &models.ItineraryShare{
+		ItineraryID: itin.ID,
+		TokenHash:   models.HashToken(token),
+		Permission:  req.Permission,
+		ExpiresAt:   req.ExpiresAt,
+		CreatedBy:   currentUser(ctx),
+	}
+	if err := c.Repo.Share.Create(ctx, share); err != nil {
+		return nil, err
+	}
+
+	return &ShareResponse{
+		ItineraryShare: *share,
+		Token:          token,
+		URL:            "/public/itineraries/" + token,
+	}, nil
+}
+
+func (c *Controller) ListShares(ctx context.Context, id uuid.UUID) ([]models.ItineraryShare, error) {
+	itin, err := c.authorize(ctx, id, models.TripRoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Repo.Share.ListByItinerary(ctx, itin.ID)
+}
+
+// RevokeShare disables a share link, revoked links stay listed
+func (c *Controller) RevokeShare(ctx context.Context, id uuid.UUID, shareID uuid.UUID) error {
+	itin, err := c.authorize(ctx, id, models.TripRoleOwner)
+	if err != nil {
+		return err
+	}
+
+	return c.Repo.Share.Revoke(ctx, itin.ID, shareID)
+}
+
+// Duplicate copies the current version of a shared itinerary into a new chat owned by the requesting user
+func (c *Controller) Duplicate(ctx context.Context, req DuplicateRequest) (*ForkResponse, error) {
+	share, err := c.Repo.Share.GetByTokenHash(ctx, models.HashToken(req.Token))
+	if err != nil {
+		return nil, err
+	}
+	// expired and revoked links look the same as unknown ones
+	if !share.Active(time.Now()) {
+		return nil, models.ErrNotFound
+	}
+	if share.Permission != models.SharePermissionDuplicate {
+		return nil, ErrCannotDuplicate
+	}
+
+	source, err := c.Repo.Itinerary.GetByID(ctx, share.ItineraryID)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := c.Repo.Itinerary.GetVersion(ctx, source.ID, source.CurrentVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.fork(ctx, current, req.StartDate, models.ItinerarySourceDuplicate,
+		"Duplicated from a shared itinerary",
+		"This chat starts from a copy of an itinerary someone shared with the user.")
+}
+
+// Fork copies the current version of an itinerary the user can see into a new chat they own,
+// so it can be adapted without touching the original
+func (c *Controller) Fork(ctx context.Context, id uuid.UUID, req ForkRequest) (*ForkResponse, error) {
+	itin, err := c.authorize(ctx, id, models.TripRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := c.Repo.Itinerary.GetVersion(ctx, itin.ID, itin.CurrentVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.fork(ctx, current, req.StartDate, models.ItinerarySourceFork,
+		fmt.Sprintf("Forked from version %d of an earlier trip", current.Version),
+		fmt.Sprintf("This chat is a fork of an earlier trip to %s, started so the user can adapt it.", current.Data.Destination))
+}
+
+// fork saves a copy of a version as the first version of a new trip owned by the requesting user,
+// and seeds the new chat with the copy and where it came from
+func (c *Controller) fork(ctx context.Context, from *models.ItineraryVersion, startDate string, source string, message string, origin string) (*ForkResponse, error) {
+	data := from.Data.Clone()
+	if startDate != "" {
+		if err := data.ShiftDates(startDate); err != nil {
+			return nil, err
+		}
+		data.Warnings = c.Validator.Validate(ctx, data).Strings()
+		message += ", moved to start on " + data.StartDate
+	}
+
+	// the chat's context is created when the note is added, the plan goes in with it
+	plan, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode itinerary: %w", err)
+	}
+
+	chatID := uuid.NewString()
+	if _, err := access.Join(ctx, c.Repo.Trip, chatID, models.TripRoleOwner); err != nil {
+		return nil, err
+	}
+
+	version := &models.ItineraryVersion{
+		Data:      *data,
+		Source:    source,
+		Message:   message,
+		CreatedBy: currentUser(ctx),
+	}
+
+	copied, err := c.Repo.Itinerary.SaveVersion(ctx, chatID, currentUser(ctx), version)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Notifier.AddNote(chatID, fmt.Sprintf(
+		"%s Its itinerary is already saved as version %d, treat it as the current plan and change it as the user asks:\n%s",
+		origin, version.Version, plan))
+
+	return &ForkResponse{
+		ChatID:      chatID,
+		ItineraryID: copied.ID.String(),
+		Version:     version.Version,
+	}, nil
+}
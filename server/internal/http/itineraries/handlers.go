@@ -0,0 +1,641 @@
+package itineraries
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/access"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary/export"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary/render"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+func NewHandler(ctrl *Controller) *Handler {
+	return &Handler{Controller: ctrl}
+}
+
+func (h *Handler) sendJSON(w http.ResponseWriter, status int, body any) {
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("Could not encode response", slog.String("error", err.Error()))
+	}
+}
+
+func (h *Handler) sendError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, models.ErrNotFound),
+		errors.Is(err, export.ErrNoSuchDay),
+		errors.Is(err, itinerary.ErrDayNotFound),
+		errors.Is(err, itinerary.ErrItemNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, access.ErrForbidden),
+		errors.Is(err, ErrCannotDuplicate):
+		status = http.StatusForbidden
+	case errors.Is(err, models.ErrVersionConflict):
+		status = http.StatusPreconditionFailed
+	case errors.Is(err, itinerary.ErrInvalidPosition),
+		errors.Is(err, itinerary.ErrInvalidOrder),
+		errors.Is(err, ErrInvalidPermission),
+		errors.Is(err, ErrExpiryInPast),
+		errors.Is(err, itinerary.ErrInvalidDate):
+		status = http.StatusBadRequest
+	case errors.Is(err, export.ErrNoDates):
+		status = http.StatusUnprocessableEntity
+	default:
+		slog.Error("Itinerary request failed", slog.String("error", err.Error()))
+	}
+
+	h.sendJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (h *Handler) itineraryID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid itinerary id"})
+		return uuid.Nil, false
+	}
+
+	return id, true
+}
+
+func (h *Handler) decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return false
+	}
+
+	return true
+}
+
+func etag(version int) string {
+	return fmt.Sprintf("%q", strconv.Itoa(version))
+}
+
+// ifMatch reads the version an edit is based on from the If-Match header
+func (h *Handler) ifMatch(w http.ResponseWriter, r *http.Request) (int, bool) {
+	raw := r.Header.Get("If-Match")
+	if raw == "" {
+		h.sendJSON(w, http.StatusPreconditionRequired, map[string]string{
+			"error": "If-Match header with the itinerary ETag is required",
+		})
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(raw, "W/"), `"`))
+	if err != nil {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid If-Match header"})
+		return 0, false
+	}
+
+	return version, true
+}
+
+// edit runs an itinerary edit guarded by the If-Match header and returns the new version
+func (h *Handler) edit(w http.ResponseWriter, r *http.Request, fn func(*itinerary.Itinerary) error) {
+	id, ok := h.itineraryID(w, r)
+	if !ok {
+		return
+	}
+
+	expected, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	version, err := h.Controller.Edit(r.Context(), id, expected, fn)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(version.Version))
+	h.sendJSON(w, http.StatusOK, version)
+}
+
+func (h *Handler) positiveParam(w http.ResponseWriter, raw string, name string) (int, bool) {
+	version, err := strconv.Atoi(raw)
+	if err != nil || version < 1 {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid " + name})
+		return 0, false
+	}
+
+	return version, true
+}
+
+// GET api/v1/itineraries/{id}
+func (h *Handler) GetItinerary(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.itineraryID(w, r)
+	if !ok {
+		return
+	}
+
+	version, err := h.Controller.GetCurrent(r.Context(), id)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(version.Version))
+	h.sendJSON(w, http.StatusOK, version)
+}
+
+// GET api/v1/itineraries/{id}/versions
+func (h *Handler) ListVersions(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.itineraryID(w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := h.Controller.ListVersions(r.Context(), id)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, versions)
+}
+
+// GET api/v1/itineraries/{id}/versions/{version}
+func (h *Handler) GetVersion(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.itineraryID(w, r)
+	if !ok {
+		return
+	}
+
+	version, ok := h.positiveParam(w, r.PathValue("version"), "version")
+	if !ok {
+		return
+	}
+
+	v, err := h.Controller.GetVersion(r.Context(), id, version)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, v)
+}
+
+// POST api/v1/itineraries/{id}/versions/{version}/restore
+func (h *Handler) RestoreVersion(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.itineraryID(w, r)
+	if !ok {
+		return
+	}
+
+	version, ok := h.positiveParam(w, r.PathValue("version"), "version")
+	if !ok {
+		return
+	}
+
+	restored, err := h.Controller.Restore(r.Context(), id, version)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(restored.Version))
+	h.sendJSON(w, http.StatusCreated, restored)
+}
+
+// GET api/v1/itineraries/{id}/diff?from={version}&to={version}
+func (h *Handler) DiffVersions(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.itineraryID(w, r)
+	if !ok {
+		return
+	}
+
+	from, ok := h.positiveParam(w, r.URL.Query().Get("from"), "from version")
+	if !ok {
+		return
+	}
+
+	to := 0 // current version
+	if raw := r.URL.Query().Get("to"); raw != "" {
+		if to, ok = h.positiveParam(w, raw, "to version"); !ok {
+			return
+		}
+	}
+
+	diff, err := h.Controller.Diff(r.Context(), id, from, to)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, diff)
+}
+
+// POST api/v1/itineraries/{id}/shares
+func (h *Handler) CreateShare(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.itineraryID(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateShareRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	share, err := h.Controller.CreateShare(r.Context(), id, req)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusCreated, share)
+}
+
+// GET api/v1/itineraries/{id}/shares
+func (h *Handler) ListShares(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.itineraryID(w, r)
+	if !ok {
+		return
+	}
+
+	shares, err := h.Controller.ListShares(r.Context(), id)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, shares)
+}
+
+// DELETE api/v1/itineraries/{id}/shares/{share}
+func (h *Handler) RevokeShare(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.itineraryID(w, r)
+	if !ok {
+		return
+	}
+
+	shareID, err := uuid.Parse(r.PathValue("share"))
+	if err != nil {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid share id"})
+		return
+	}
+
+	if err := h.Controller.RevokeShare(r.Context(), id, shareID); err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST api/v1/itineraries/duplicate
+func (h *Handler) Duplicate(w http.ResponseWriter, r *http.Request) {
+	var req DuplicateRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	if req.Token == "" {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": "token is required"})
+		return
+	}
+
+	copied, err := h.Controller.Duplicate(r.Context(), req)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusCreated, copied)
+}
+
+// POST api/v1/itineraries/{id}/fork
+func (h *Handler) Fork(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.itineraryID(w, r)
+	if !ok {
+		return
+	}
+
+	// the body is optional, without one the copy keeps its dates
+	var req ForkRequest
+	if r.ContentLength != 0 && !h.decode(w, r, &req) {
+		return
+	}
+
+	forked, err := h.Controller.Fork(r.Context(), id, req)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusCreated, forked)
+}
+
+// POST api/v1/itineraries/{id}/days
+func (h *Handler) AddDay(w http.ResponseWriter, r *http.Request) {
+	var req AddDayRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	h.edit(w, r, func(it *itinerary.Itinerary) error {
+		return it.AddDay(req.Position, itinerary.DayPlan{Label: req.Label, Items: req.Items})
+	})
+}
+
+// PUT api/v1/itineraries/{id}/days/order
+func (h *Handler) ReorderDays(w http.ResponseWriter, r *http.Request) {
+	var req ReorderRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	h.edit(w, r, func(it *itinerary.Itinerary) error {
+		return it.ReorderDays(req.Order)
+	})
+}
+
+// PUT api/v1/itineraries/{id}/days/{day}
+func (h *Handler) UpdateDay(w http.ResponseWriter, r *http.Request) {
+	day, ok := h.positiveParam(w, r.PathValue("day"), "day")
+	if !ok {
+		return
+	}
+
+	var req UpdateDayRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	h.edit(w, r, func(it *itinerary.Itinerary) error {
+		return it.UpdateDay(day, req.Label)
+	})
+}
+
+// DELETE api/v1/itineraries/{id}/days/{day}
+func (h *Handler) DeleteDay(w http.ResponseWriter, r *http.Request) {
+	day, ok := h.positiveParam(w, r.PathValue("day"), "day")
+	if !ok {
+		return
+	}
+
+	h.edit(w, r, func(it *itinerary.Itinerary) error {
+		return it.RemoveDay(day)
+	})
+}
+
+// POST api/v1/itineraries/{id}/days/{day}/items
+func (h *Handler) AddItem(w http.ResponseWriter, r *http.Request) {
+	day, ok := h.positiveParam(w, r.PathValue("day"), "day")
+	if !ok {
+		return
+	}
+
+	var req AddItemRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	if strings.TrimSpace(req.Item.Title) == "" {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": "item title is required"})
+		return
+	}
+
+	h.edit(w, r, func(it *itinerary.Itinerary) error {
+		return it.AddItem(day, req.Position, req.Item)
+	})
+}
+
+// PUT api/v1/itineraries/{id}/days/{day}/items/order
+func (h *Handler) ReorderItems(w http.ResponseWriter, r *http.Request) {
+	day, ok := h.positiveParam(w, r.PathValue("day"), "day")
+	if !ok {
+		return
+	}
+
+	var req ReorderRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	h.edit(w, r, func(it *itinerary.Itinerary) error {
+		return it.ReorderItems(day, req.Order)
+	})
+}
+
+// PUT api/v1/itineraries/{id}/days/{day}/items/{item}
+func (h *Handler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	day, ok := h.positiveParam(w, r.PathValue("day"), "day")
+	if !ok {
+		return
+	}
+
+	item, ok := h.positiveParam(w, r.PathValue("item"), "item")
+	if !ok {
+		return
+	}
+
+	var req itinerary.DayItem
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	if strings.TrimSpace(req.Title) == "" {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": "item title is required"})
+		return
+	}
+
+	h.edit(w, r, func(it *itinerary.Itinerary) error {
+		return it.UpdateItem(day, item, req)
+	})
+}
+
+// DELETE api/v1/itineraries/{id}/days/{day}/items/{item}
+func (h *Handler) DeleteItem(w http.ResponseWriter, r *http.Request) {
+	day, ok := h.positiveParam(w, r.PathValue("day"), "day")
+	if !ok {
+		return
+	}
+
+	item, ok := h.positiveParam(w, r.PathValue("item"), "item")
+	if !ok {
+		return
+	}
+
+	h.edit(w, r, func(it *itinerary.Itinerary) error {
+		return it.RemoveItem(day, item)
+	})
+}
+
+// POST api/v1/itineraries/{id}/days/{day}/items/{item}/move
+func (h *Handler) MoveItem(w http.ResponseWriter, r *http.Request) {
+	day, ok := h.positiveParam(w, r.PathValue("day"), "day")
+	if !ok {
+		return
+	}
+
+	item, ok := h.positiveParam(w, r.PathValue("item"), "item")
+	if !ok {
+		return
+	}
+
+	var req MoveItemRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	h.edit(w, r, func(it *itinerary.Itinerary) error {
+		return it.MoveItem(day, item, req.ToDay, req.Position)
+	})
+}
+
+// exportVersion loads the version to export, ?version= selects an older one
+func (h *Handler) exportVersion(w http.ResponseWriter, r *http.Request) (*models.ItineraryVersion, bool) {
+	id, ok := h.itineraryID(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	var v *models.ItineraryVersion
+	var err error
+	if raw := r.URL.Query().Get("version"); raw != "" {
+		version, ok := h.positiveParam(w, raw, "version")
+		if !ok {
+			return nil, false
+		}
+		v, err = h.Controller.GetVersion(r.Context(), id, version)
+	} else {
+		v, err = h.Controller.GetCurrent(r.Context(), id)
+	}
+
+	if err != nil {
+		h.sendError(w, err)
+		return nil, false
+	}
+
+	return v, true
+}
+
+func (h *Handler) sendFile(w http.ResponseWriter, contentType string, filename string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write(body); err != nil {
+		slog.Error("Could not write export", slog.String("error", err.Error()))
+	}
+}
+
+// GET api/v1/itineraries/{id}/export.ics
+func (h *Handler) ExportICS(w http.ResponseWriter, r *http.Request) {
+	v, ok := h.exportVersion(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := export.ICS(v)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendFile(w, "text/calendar; charset=utf-8", export.Filename(&v.Data, "ics"), body)
+}
+
+// GET api/v1/itineraries/{id}/export.geojson?day={day}
+func (h *Handler) ExportGeoJSON(w http.ResponseWriter, r *http.Request) {
+	v, ok := h.exportVersion(w, r)
+	if !ok {
+		return
+	}
+
+	day := 0 // whole trip
+	if raw := r.URL.Query().Get("day"); raw != "" {
+		if day, ok = h.positiveParam(w, raw, "day"); !ok {
+			return
+		}
+	}
+
+	body, err := export.GeoJSON(v, day)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendFile(w, "application/geo+json", export.Filename(&v.Data, "geojson"), body)
+}
+
+// GET api/v1/itineraries/{id}/export.kml
+func (h *Handler) ExportKML(w http.ResponseWriter, r *http.Request) {
+	v, ok := h.exportVersion(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := export.KML(v)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendFile(w, "application/vnd.google-earth.kml+xml", export.Filename(&v.Data, "kml"), body)
+}
+
+// GET api/v1/itineraries/{id}/export.gpx
+func (h *Handler) ExportGPX(w http.ResponseWriter, r *http.Request) {
+	v, ok := h.exportVersion(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := export.GPX(v)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendFile(w, "application/gpx+xml", export.Filename(&v.Data, "gpx"), body)
+}
+
+// GET api/v1/itineraries/{id}/export.pdf
+func (h *Handler) ExportPDF(w http.ResponseWriter, r *http.Request) {
+	v, ok := h.exportVersion(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := render.PDF(v)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendFile(w, "application/pdf", export.Filename(&v.Data, "pdf"), body)
+}
+
+// GET api/v1/itineraries/{id}/print.html
+func (h *Handler) PrintHTML(w http.ResponseWriter, r *http.Request) {
+	v, ok := h.exportVersion(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := render.HTML(v)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	// shown in the browser so it can be printed straight away
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", export.Filename(&v.Data, "html")))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write(body); err != nil {
+		slog.Error("Could not write export", slog.String("error", err.Error()))
+	}
+}
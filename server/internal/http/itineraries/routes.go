@@ -0,0 +1,50 @@
+package itineraries
+
+import (
+	"net/http"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/realtime"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+func New(repo *repositories.Repositories, notifier Notifier, hub *realtime.Hub) *http.ServeMux {
+	ctrl := NewController(repo, notifier, hub)
+	h := NewHandler(ctrl)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{id}", h.GetItinerary)                               // api/v1/itineraries/{id}
+	mux.HandleFunc("GET /{id}/versions", h.ListVersions)                      // api/v1/itineraries/{id}/versions
+	mux.HandleFunc("GET /{id}/versions/{version}", h.GetVersion)              // api/v1/itineraries/{id}/versions/{version}
+	mux.HandleFunc("POST /{id}/versions/{version}/restore", h.RestoreVersion) // api/v1/itineraries/{id}/versions/{version}/restore
+	mux.HandleFunc("GET /{id}/diff", h.DiffVersions)                          // api/v1/itineraries/{id}/diff?from=&to=
+
+	// share links, the token is only returned on creation and is served under /public
+	mux.HandleFunc("POST /{id}/shares", h.CreateShare)           // api/v1/itineraries/{id}/shares
+	mux.HandleFunc("GET /{id}/shares", h.ListShares)             // api/v1/itineraries/{id}/shares
+	mux.HandleFunc("DELETE /{id}/shares/{share}", h.RevokeShare) // api/v1/itineraries/{id}/shares/{share}
+	mux.HandleFunc("POST /duplicate", h.Duplicate)               // api/v1/itineraries/duplicate
+
+	// copies into a new chat, a startDate in the body moves the copy to new dates
+	mux.HandleFunc("POST /{id}/fork", h.Fork) // api/v1/itineraries/{id}/fork
+
+	// exports, ?version= selects an older version
+	mux.HandleFunc("GET /{id}/export.ics", h.ExportICS)         // api/v1/itineraries/{id}/export.ics
+	mux.HandleFunc("GET /{id}/export.geojson", h.ExportGeoJSON) // api/v1/itineraries/{id}/export.geojson?day=
+	mux.HandleFunc("GET /{id}/export.kml", h.ExportKML)         // api/v1/itineraries/{id}/export.kml
+	mux.HandleFunc("GET /{id}/export.gpx", h.ExportGPX)         // api/v1/itineraries/{id}/export.gpx
+	mux.HandleFunc("GET /{id}/export.pdf", h.ExportPDF)         // api/v1/itineraries/{id}/export.pdf
+	mux.HandleFunc("GET /{id}/print.html", h.PrintHTML)         // api/v1/itineraries/{id}/print.html
+
+	// direct edits, each requires If-Match with the current version's ETag
+	mux.HandleFunc("POST /{id}/days", h.AddDay)                           // api/v1/itineraries/{id}/days
+	mux.HandleFunc("PUT /{id}/days/order", h.ReorderDays)                 // api/v1/itineraries/{id}/days/order
+	mux.HandleFunc("PUT /{id}/days/{day}", h.UpdateDay)                   // api/v1/itineraries/{id}/days/{day}
+	mux.HandleFunc("DELETE /{id}/days/{day}", h.DeleteDay)                // api/v1/itineraries/{id}/days/{day}
+	mux.HandleFunc("POST /{id}/days/{day}/items", h.AddItem)              // api/v1/itineraries/{id}/days/{day}/items
+	mux.HandleFunc("PUT /{id}/days/{day}/items/order", h.ReorderItems)    // api/v1/itineraries/{id}/days/{day}/items/order
+	mux.HandleFunc("PUT /{id}/days/{day}/items/{item}", h.UpdateItem)     // api/v1/itineraries/{id}/days/{day}/items/{item}
+	mux.HandleFunc("DELETE /{id}/days/{day}/items/{item}", h.DeleteItem)  // api/v1/itineraries/{id}/days/{day}/items/{item}
+	mux.HandleFunc("POST /{id}/days/{day}/items/{item}/move", h.MoveItem) // api/v1/itineraries/{id}/days/{day}/items/{item}/move
+
+	return mux
+}
@@ -0,0 +1,97 @@
+package itineraries
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/realtime"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+var (
+	ErrInvalidPermission = errors.New("permission must be read or duplicate")
+	ErrExpiryInPast      = errors.New("expiresAt must be in the future")
+	ErrCannotDuplicate   = errors.New("this share link does not allow duplicating")
+)
+
+// Notifier receives notes about itinerary changes made outside the chat
+type Notifier interface {
+	AddNote(chatID string, note string)
+}
+
+type Controller struct {
+	Repo      *repositories.Repositories
+	Notifier  Notifier
+	Validator *itinerary.Validator
+	Hub       *realtime.Hub
+}
+
+type Handler struct {
+	Controller *Controller
+}
+
+type VersionSummary struct {
+	models.ItineraryVersion
+	Current bool `json:"current"`
+}
+
+type DiffResponse struct {
+	ItineraryID string `json:"itineraryId"`
+	From        int    `json:"from"`
+	To          int    `json:"to"`
+	itinerary.Diff
+}
+
+type AddDayRequest struct {
+	Position int                 `json:"position"` // 1-based, 0 appends
+	Label    string              `json:"label"`
+	Items    []itinerary.DayItem `json:"items"`
+}
+
+type UpdateDayRequest struct {
+	Label string `json:"label"`
+}
+
+type ReorderRequest struct {
+	Order []int `json:"order"` // current positions in their new order
+}
+
+type AddItemRequest struct {
+	Position int               `json:"position"` // 1-based, 0 appends
+	Item     itinerary.DayItem `json:"item"`
+}
+
+type MoveItemRequest struct {
+	ToDay    int `json:"toDay"`
+	Position int `json:"position"` // 1-based, 0 appends
+}
+
+type CreateShareRequest struct {
+	Permission string     `json:"permission"`          // read (default) or duplicate
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"` // omitted links never expire
+}
+
+// ShareResponse carries the share token, which is only ever returned when the link is created
+type ShareResponse struct {
+	models.ItineraryShare
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+type DuplicateRequest struct {
+	Token     string `json:"token"`
+	StartDate string `json:"startDate,omitempty"` // YYYY-MM-DD, moves the copy to new dates
+}
+
+type ForkRequest struct {
+	StartDate string `json:"startDate,omitempty"` // YYYY-MM-DD, moves the copy to new dates
+}
+
+// ForkResponse points at the new chat a copied itinerary starts
+type ForkResponse struct {
+	ChatID      string `json:"chatId"`
+	ItineraryID string `json:"itineraryId"`
+	Version     int    `json:"version"`
+}
@@ -0,0 +1,37 @@
+package jobs
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/access"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+func NewController(repo *repositories.Repositories) *Controller {
+	return &Controller{Repo: repo}
+}
+
+// Get returns a job to any member of the trip it belongs to
+func (c *Controller) Get(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	job, err := c.Repo.Job.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := access.Require(ctx, c.Repo.Trip, job.ChatID, models.TripRoleViewer); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// ListByChat returns a chat's jobs, newest first
+func (c *Controller) ListByChat(ctx context.Context, chatID string) ([]models.Job, error) {
+	if _, err := access.Require(ctx, c.Repo.Trip, chatID, models.TripRoleViewer); err != nil {
+		return nil, err
+	}
+
+	return c.Repo.Job.ListByChatID(ctx, chatID)
+}
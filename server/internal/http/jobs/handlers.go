@@ -0,0 +1,78 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/access"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+func NewHandler(ctrl *Controller) *Handler {
+	return &Handler{Controller: ctrl}
+}
+
+func (h *Handler) sendJSON(w http.ResponseWriter, status int, body any) {
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("Could not encode response", slog.String("error", err.Error()))
+	}
+}
+
+func (h *Handler) sendError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, access.ErrForbidden):
+		status = http.StatusForbidden
+	}
+
+	if status == http.StatusInternalServerError {
+		slog.Error("Job request failed", slog.String("error", err.Error()))
+	}
+
+	h.sendJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// GET api/v1/jobs/{id}
+func (h *Handler) GetJob(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid job id"})
+		return
+	}
+
+	job, err := h.Controller.Get(r.Context(), id)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	// clients poll until the job is done
+	if !job.Done() {
+		w.Header().Set("Retry-After", "2")
+	}
+
+	h.sendJSON(w, http.StatusOK, job)
+}
+
+// GET api/v1/jobs?chatId={chatId}
+func (h *Handler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	chatID := r.URL.Query().Get("chatId")
+	if chatID == "" {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": "chatId is missing"})
+		return
+	}
+
+	jobs, err := h.Controller.ListByChat(r.Context(), chatID)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, jobs)
+}
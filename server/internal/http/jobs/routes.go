@@ -0,0 +1,18 @@
+package jobs
+
+import (
+	"net/http"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+func New(repo *repositories.Repositories) *http.ServeMux {
+	ctrl := NewController(repo)
+	h := NewHandler(ctrl)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", h.ListJobs) // api/v1/jobs?chatId=
+	mux.HandleFunc("GET /{id}", h.GetJob)  // api/v1/jobs/{id}
+
+	return mux
+}
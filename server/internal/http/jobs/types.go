@@ -0,0 +1,13 @@
+package jobs
+
+import (
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+type Controller struct {
+	Repo *repositories.Repositories
+}
+
+type Handler struct {
+	Controller *Controller
+}
@@ -0,0 +1,226 @@
+package me
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/http/auth"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/mail"
+	mw "github.com/nakul-krishnakumar/kaiyo-ai/internal/middlewares"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+const (
+	maxField = 120 // limit of the short text fields
+	maxNeeds = 500
+	maxTags  = 20
+)
+
+func NewController(repo *repositories.Repositories, sessions *auth.SessionCache, mailer mail.Mailer, passkeys *auth.Passkeys) *Controller {
+	return &Controller{Repo: repo, Sessions: sessions, Mailer: mailer, Passkeys: passkeys}
+}
+
+func currentUser(ctx context.Context) (uuid.UUID, error) {
+	userID, ok := mw.UserIDFromContext(ctx)
+	if !ok {
+		return uuid.Nil, ErrUnauthenticated
+	}
+	return userID, nil
+}
+
+// tags trims a list, dropping blanks and repeats
+func tags(in []string) ([]string, error) {
+	out := []string{}
+	for _, tag := range in {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.ContainsFunc(out, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			out = append(out, tag)
+		}
+	}
+
+	if len(out) > maxTags {
+		return nil, ErrTooLong
+	}
+	for _, tag := range out {
+		if utf8.RuneCountInString(tag) > maxField {
+			return nil, ErrTooLong
+		}
+	}
+
+	return out, nil
+}
+
+// GetPreferences returns the user's profile, empty if they never saved one
+func (c *Controller) GetPreferences(ctx context.Context) (*models.Preferences, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prefs, err := c.Repo.Preferences.Get(ctx, userID)
+	if errors.Is(err, models.ErrNotFound) {
+		return &models.Preferences{UserID: userID, DietaryRestrictions: []string{}, Interests: []string{}}, nil
+	}
+
+	return prefs, err
+}
+
+func (c *Controller) UpdatePreferences(ctx context.Context, req PreferencesRequest) (*models.Preferences, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prefs := &models.Preferences{
+		UserID:             userID,
+		HomeCity:           strings.TrimSpace(req.HomeCity),
+		HomeCurrency:       strings.ToUpper(strings.TrimSpace(req.HomeCurrency)),
+		MobilityNeeds:      strings.TrimSpace(req.MobilityNeeds),
+		Pace:               strings.ToLower(strings.TrimSpace(req.Pace)),
+		AccommodationStyle: strings.TrimSpace(req.AccommodationStyle),
+		Language:           strings.TrimSpace(req.Language),
+	}
+
+	if prefs.Pace != "" && !models.ValidPace(prefs.Pace) {
+		return nil, ErrInvalidPace
+	}
+
+	if prefs.HomeCurrency != "" && (len(prefs.HomeCurrency) != 3 || strings.Trim(prefs.HomeCurrency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "") {
+		return nil, ErrInvalidCurrency
+	}
+
+	for _, field := range []string{prefs.HomeCity, prefs.AccommodationStyle, prefs.Language} {
+		if utf8.RuneCountInString(field) > maxField {
+			return nil, ErrTooLong
+		}
+	}
+	if utf8.RuneCountInString(prefs.MobilityNeeds) > maxNeeds {
+		return nil, ErrTooLong
+	}
+
+	if prefs.DietaryRestrictions, err = tags(req.DietaryRestrictions); err != nil {
+		return nil, err
+	}
+	if prefs.Interests, err = tags(req.Interests); err != nil {
+		return nil, err
+	}
+
+	if err := c.Repo.Preferences.Upsert(ctx, prefs); err != nil {
+		return nil, err
+	}
+
+	return prefs, nil
+}
+
+// ListSessions returns the devices the user is signed in on, marking the one making the request
+func (c *Controller) ListSessions(ctx context.Context) ([]ActiveSession, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := c.Repo.Session.ListActive(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	current, _ := mw.SessionIDFromContext(ctx)
+
+	active := make([]ActiveSession, 0, len(sessions))
+	for _, s := range sessions {
+		active = append(active, ActiveSession{
+			ID:         s.FamilyID,
+			Device:     s.DeviceInfo,
+			SignedInAt: s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.FamilyID == current,
+		})
+	}
+
+	return active, nil
+}
+
+// RevokeSession signs the user out on one device, revoking the current session logs this one out
+func (c *Controller) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Repo.Session.RevokeForUser(ctx, userID, sessionID); err != nil {
+		return err
+	}
+
+	// access tokens of the device stop working here at once, other replicas catch up from the cache TTL
+	c.Sessions.Forget(sessionID)
+
+	return nil
+}
+
+// ChangePassword replaces the password after checking the current one. Every session is
+// revoked, including the one making the request, so the user logs in again with the new password
+func (c *Controller) ChangePassword(ctx context.Context, req PasswordRequest) error {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	user, err := c.checkPassword(ctx, userID, req.CurrentPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := auth.ValidatePassword(req.NewPassword); err != nil {
+		return fmt.Errorf("%w: %s", ErrWeakPassword, err.Error())
+	}
+
+	hash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Repo.User.UpdatePassword(ctx, userID, hash); err != nil {
+		return err
+	}
+
+	if err := c.Repo.Session.RevokeSessionByUserID(ctx, userID); err != nil {
+		return err
+	}
+	c.Sessions.ForgetUser(userID)
+
+	mail.SendAsync(c.Mailer, auth.PasswordChangedEmail(user))
+
+	return nil
+}
+
+// checkPassword checks the signed in user's current password, wrong ones count towards the
+// account's login lockout
+func (c *Controller) checkPassword(ctx context.Context, userID uuid.UUID, password string) (*models.User, error) {
+	user, err := c.Repo.User.GetByID(ctx, userID)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := auth.CheckAccountPassword(ctx, c.Repo, user, password)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrWrongPassword
+	}
+
+	return user, nil
+}
@@ -0,0 +1,246 @@
+package me
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/http/auth"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+func NewHandler(ctrl *Controller) *Handler {
+	return &Handler{Controller: ctrl}
+}
+
+func (h *Handler) sendJSON(w http.ResponseWriter, status int, body any) {
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("Could not encode response", slog.String("error", err.Error()))
+	}
+}
+
+func (h *Handler) sendError(w http.ResponseWriter, err error) {
+	var locked *auth.LockedOutError
+
+	status := http.StatusInternalServerError
+	switch {
+	case errors.As(err, &locked):
+		auth.SetRetryAfter(w, locked.RetryAfter)
+		status = http.StatusTooManyRequests
+	case errors.Is(err, ErrUnauthenticated):
+		status = http.StatusUnauthorized
+	case errors.Is(err, models.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrWrongPassword),
+		errors.Is(err, auth.ErrInvalidMFACode):
+		status = http.StatusForbidden
+	case errors.Is(err, ErrMFAEnabled),
+		errors.Is(err, ErrMFANotPending),
+		errors.Is(err, ErrMFANotEnabled):
+		status = http.StatusConflict
+	case errors.Is(err, ErrInvalidPace),
+		errors.Is(err, ErrInvalidCurrency),
+		errors.Is(err, ErrTooLong),
+		errors.Is(err, ErrInvalidID),
+		errors.Is(err, ErrInvalidPasskeyID),
+		errors.Is(err, ErrWeakPassword),
+		errors.Is(err, auth.ErrPasskeyState),
+		errors.Is(err, auth.ErrPasskeyRejected):
+		status = http.StatusBadRequest
+	default:
+		slog.Error("Account request failed", slog.String("error", err.Error()))
+	}
+
+	h.sendJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// GET api/v1/me/preferences
+func (h *Handler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	prefs, err := h.Controller.GetPreferences(r.Context())
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, prefs)
+}
+
+// PUT api/v1/me/preferences
+func (h *Handler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	var req PreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	prefs, err := h.Controller.UpdatePreferences(r.Context(), req)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, prefs)
+}
+
+// GET api/v1/me/sessions
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := h.Controller.ListSessions(r.Context())
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, sessions)
+}
+
+// DELETE api/v1/me/sessions/{id}
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		h.sendError(w, ErrInvalidID)
+		return
+	}
+
+	if err := h.Controller.RevokeSession(r.Context(), sessionID); err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST api/v1/me/password
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req PasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := h.Controller.ChangePassword(r.Context(), req); err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	// the refresh cookie now belongs to a revoked session, the client has to log in again
+	h.sendJSON(w, http.StatusOK, map[string]string{"message": "Password changed, please log in again"})
+}
+
+// GET api/v1/me/mfa
+func (h *Handler) GetMFA(w http.ResponseWriter, r *http.Request) {
+	status, err := h.Controller.GetMFA(r.Context())
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, status)
+}
+
+// POST api/v1/me/mfa/totp
+func (h *Handler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	var req TOTPEnrollRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	enrollment, err := h.Controller.EnrollTOTP(r.Context(), req)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, enrollment)
+}
+
+// POST api/v1/me/mfa/totp/confirm
+func (h *Handler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.Controller.ConfirmTOTP(r.Context(), req)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, codes)
+}
+
+// DELETE api/v1/me/mfa/totp
+func (h *Handler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := h.Controller.DisableTOTP(r.Context(), req); err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET api/v1/me/passkeys
+func (h *Handler) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	passkeys, err := h.Controller.ListPasskeys(r.Context())
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, passkeys)
+}
+
+// POST api/v1/me/passkeys/register/begin
+func (h *Handler) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	ceremony, err := h.Controller.BeginPasskeyRegistration(r.Context())
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, ceremony)
+}
+
+// POST api/v1/me/passkeys/register/finish
+func (h *Handler) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	var req PasskeyRegistrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	passkey, err := h.Controller.FinishPasskeyRegistration(r.Context(), req)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusCreated, passkey)
+}
+
+// DELETE api/v1/me/passkeys/{id}
+func (h *Handler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	passkeyID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		h.sendError(w, ErrInvalidPasskeyID)
+		return
+	}
+
+	if err := h.Controller.DeletePasskey(r.Context(), passkeyID); err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
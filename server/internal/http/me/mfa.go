@@ -0,0 +1,146 @@
+package me
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/http/auth"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/totp"
+)
+
+// totpIssuer names the account in authenticator apps
+const totpIssuer = "Kaiyo AI"
+
+func (c *Controller) GetMFA(ctx context.Context) (*MFAStatus, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &MFAStatus{}
+
+	t, err := c.Repo.MFA.GetTOTP(ctx, userID)
+	if errors.Is(err, models.ErrNotFound) {
+		return status, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	status.TOTPEnabled = t.Enabled()
+
+	if status.TOTPEnabled {
+		if status.RecoveryCodesLeft, err = c.Repo.MFA.CountRecoveryCodes(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	return status, nil
+}
+
+// EnrollTOTP creates a new secret for the user to add to their authenticator app. It only
+// takes effect once confirmed with a code, starting again replaces an unconfirmed secret
+func (c *Controller) EnrollTOTP(ctx context.Context, req TOTPEnrollRequest) (*TOTPEnrollment, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := c.checkPassword(ctx, userID, req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.Repo.MFA.SetPendingTOTP(ctx, userID, secret)
+	if errors.Is(err, models.ErrVersionConflict) {
+		return nil, ErrMFAEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables the pending secret once the user proves their app produces its codes,
+// and returns the recovery codes that come with it
+func (c *Controller) ConfirmTOTP(ctx context.Context, req MFACodeRequest) (*RecoveryCodes, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := c.Repo.MFA.GetTOTP(ctx, userID)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, ErrMFANotPending
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.Enabled() {
+		return nil, ErrMFAEnabled
+	}
+
+	step, ok := totp.Validate(t.Secret, req.Code, time.Now())
+	if !ok {
+		return nil, auth.ErrInvalidMFACode
+	}
+
+	codes, hashes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.Repo.MFA.EnableTOTP(ctx, userID, step, hashes)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, ErrMFAEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Two-factor authentication enabled", slog.String("user_id", userID.String()))
+
+	return &RecoveryCodes{Codes: codes}, nil
+}
+
+// DisableTOTP turns two-factor authentication off, which takes a current code or a recovery code
+func (c *Controller) DisableTOTP(ctx context.Context, req MFACodeRequest) error {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	t, err := c.Repo.MFA.GetTOTP(ctx, userID)
+	if errors.Is(err, models.ErrNotFound) {
+		return ErrMFANotEnabled
+	}
+	if err != nil {
+		return err
+	}
+
+	// an unconfirmed secret never guarded anything, it can go without a code
+	if t.Enabled() {
+		if err := auth.VerifySecondFactor(ctx, c.Repo, userID, req.Code); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Repo.MFA.DisableTOTP(ctx, userID); err != nil {
+		return err
+	}
+
+	slog.Info("Two-factor authentication disabled", slog.String("user_id", userID.String()))
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package me
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/http/auth"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/mail"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+func (c *Controller) ListPasskeys(ctx context.Context) ([]models.Passkey, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Repo.Passkey.ListByUser(ctx, userID)
+}
+
+// BeginPasskeyRegistration returns the options for navigator.credentials.create
+func (c *Controller) BeginPasskeyRegistration(ctx context.Context) (*auth.PasskeyCeremony, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := c.Repo.User.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Passkeys.BeginRegistration(ctx, user)
+}
+
+// FinishPasskeyRegistration stores the passkey the browser created. The user is told by email,
+// a passkey signs in without the password
+func (c *Controller) FinishPasskeyRegistration(ctx context.Context, req PasskeyRegistrationRequest) (*models.Passkey, error) {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	passkey, err := c.Passkeys.FinishRegistration(ctx, userID, req.State, &req.Credential, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Passkey added", slog.String("user_id", userID.String()), slog.String("passkey_id", passkey.ID.String()))
+
+	if user, err := c.Repo.User.GetByID(ctx, userID); err == nil {
+		mail.SendAsync(c.Mailer, auth.PasskeyAddedEmail(user, passkey.Name))
+	}
+
+	return passkey, nil
+}
+
+func (c *Controller) DeletePasskey(ctx context.Context, passkeyID uuid.UUID) error {
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.Repo.Passkey.Delete(ctx, userID, passkeyID)
+}
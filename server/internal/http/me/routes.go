@@ -0,0 +1,32 @@
+package me
+
+import (
+	"net/http"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/http/auth"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/mail"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+// New serves the signed in user's own account settings
+func New(repo *repositories.Repositories, sessions *auth.SessionCache, mailer mail.Mailer, passkeys *auth.Passkeys) *http.ServeMux {
+	ctrl := NewController(repo, sessions, mailer, passkeys)
+	h := NewHandler(ctrl)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /preferences", h.GetPreferences)                          // api/v1/me/preferences
+	mux.HandleFunc("PUT /preferences", h.UpdatePreferences)                       // api/v1/me/preferences
+	mux.HandleFunc("GET /sessions", h.ListSessions)                               // api/v1/me/sessions
+	mux.HandleFunc("DELETE /sessions/{id}", h.RevokeSession)                      // api/v1/me/sessions/{id}
+	mux.HandleFunc("POST /password", h.ChangePassword)                            // api/v1/me/password
+	mux.HandleFunc("GET /mfa", h.GetMFA)                                          // api/v1/me/mfa
+	mux.HandleFunc("POST /mfa/totp", h.EnrollTOTP)                                // api/v1/me/mfa/totp
+	mux.HandleFunc("POST /mfa/totp/confirm", h.ConfirmTOTP)                       // api/v1/me/mfa/totp/confirm
+	mux.HandleFunc("DELETE /mfa/totp", h.DisableTOTP)                             // api/v1/me/mfa/totp
+	mux.HandleFunc("GET /passkeys", h.ListPasskeys)                               // api/v1/me/passkeys
+	mux.HandleFunc("POST /passkeys/register/begin", h.BeginPasskeyRegistration)   // api/v1/me/passkeys/register/begin
+	mux.HandleFunc("POST /passkeys/register/finish", h.FinishPasskeyRegistration) // api/v1/me/passkeys/register/finish
+	mux.HandleFunc("DELETE /passkeys/{id}", h.DeletePasskey)                      // api/v1/me/passkeys/{id}
+
+	return mux
+}
@@ -0,0 +1,166 @@
+package me
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/http/auth"
+	mw "github.com/nakul-krishnakumar/kaiyo-ai/internal/middlewares"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+// fakeSessions keeps one session per login, which is all listing and revoking look at.
+// The embedded interface is nil so anything else panics and shows up as a test failure
+type fakeSessions struct {
+	repositories.SessionRepository
+
+	mu       sync.Mutex
+	sessions []*models.Session
+}
+
+func (f *fakeSessions) add(userID uuid.UUID) *models.Session {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := uuid.New()
+	s := &models.Session{ID: id, FamilyID: id, UserID: userID, CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+	f.sessions = append(f.sessions, s)
+	return s
+}
+
+func (f *fakeSessions) ListActive(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := []models.Session{}
+	for _, s := range f.sessions {
+		if s.UserID == userID && s.Active(time.Now()) {
+			list = append(list, *s)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeSessions) RevokeForUser(ctx context.Context, userID uuid.UUID, familyID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	for _, s := range f.sessions {
+		if s.FamilyID == familyID && s.UserID == userID && s.RevokedAt == nil {
+			s.RevokedAt = &now
+			return nil
+		}
+	}
+	return models.ErrNotFound
+}
+
+func (f *fakeSessions) FamilyActive(ctx context.Context, familyID uuid.UUID, userID uuid.UUID) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, s := range f.sessions {
+		if s.FamilyID == familyID && s.UserID == userID && s.Active(time.Now()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sessionsAPI serves the account routes behind the auth middleware, as the server does,
+// and signs requests with an access token of the given session
+func sessionsAPI(t *testing.T, sessions *fakeSessions) func(method, path string, session *models.Session) *httptest.ResponseRecorder {
+	t.Helper()
+
+	config := &auth.Config{AccessSecret: []byte("access-secret"), AccessTTL: 15 * time.Minute}
+	cache := auth.NewSessionCache(sessions)
+	api := mw.Auth(config, cache)(New(&repositories.Repositories{Session: sessions}, cache, nil, nil))
+	tokens := auth.NewController(config)
+
+	return func(method, path string, session *models.Session) *httptest.ResponseRecorder {
+		access, err := tokens.GenerateAccessToken(&models.User{ID: session.UserID}, session.FamilyID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+access)
+
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		return rec
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	sessions := &fakeSessions{}
+	call := sessionsAPI(t, sessions)
+
+	user := uuid.New()
+	phone, laptop := sessions.add(user), sessions.add(user)
+	sessions.add(uuid.New())
+
+	rec := call(http.MethodGet, "/sessions", laptop)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list answered %d: %s", rec.Code, rec.Body)
+	}
+
+	var list []ActiveSession
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("listed %d sessions, want the user's 2", len(list))
+	}
+	for _, s := range list {
+		if s.Current != (s.ID == laptop.FamilyID) || (s.ID != phone.FamilyID && s.ID != laptop.FamilyID) {
+			t.Errorf("listed %+v", s)
+		}
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	sessions := &fakeSessions{}
+	call := sessionsAPI(t, sessions)
+
+	user := uuid.New()
+	phone, laptop := sessions.add(user), sessions.add(user)
+	theirs := sessions.add(uuid.New())
+
+	// the phone is in use, so the middleware has it cached as active
+	if rec := call(http.MethodGet, "/sessions", phone); rec.Code != http.StatusOK {
+		t.Fatalf("phone answered %d: %s", rec.Code, rec.Body)
+	}
+
+	// another user's session is not found rather than revoked
+	if rec := call(http.MethodDelete, "/sessions/"+theirs.FamilyID.String(), laptop); rec.Code != http.StatusNotFound {
+		t.Errorf("revoking another user's session answered %d, want 404", rec.Code)
+	}
+	if rec := call(http.MethodGet, "/sessions", theirs); rec.Code != http.StatusOK {
+		t.Errorf("other user's session answered %d after the attempt: %s", rec.Code, rec.Body)
+	}
+
+	if rec := call(http.MethodDelete, "/sessions/"+phone.FamilyID.String(), laptop); rec.Code != http.StatusNoContent {
+		t.Fatalf("revoke answered %d: %s", rec.Code, rec.Body)
+	}
+
+	// the phone's access token stops working at once, not when the cache entry runs out
+	if rec := call(http.MethodGet, "/sessions", phone); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked phone answered %d, want 401", rec.Code)
+	}
+	if rec := call(http.MethodGet, "/sessions", laptop); rec.Code != http.StatusOK {
+		t.Errorf("laptop answered %d: %s", rec.Code, rec.Body)
+	}
+
+	// a login revoked already has nothing left to revoke
+	if rec := call(http.MethodDelete, "/sessions/"+phone.FamilyID.String(), laptop); rec.Code != http.StatusNotFound {
+		t.Errorf("revoking twice answered %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,100 @@
+package me
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/http/auth"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/mail"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/webauthn"
+)
+
+var (
+	ErrUnauthenticated  = errors.New("not signed in")
+	ErrInvalidPace      = errors.New("pace must be relaxed, balanced or busy")
+	ErrInvalidCurrency  = errors.New("homeCurrency must be a three letter currency code")
+	ErrTooLong          = errors.New("preferences are too long")
+	ErrInvalidID        = errors.New("invalid session id")
+	ErrInvalidPasskeyID = errors.New("invalid passkey id")
+	ErrWrongPassword    = errors.New("current password is incorrect")
+	ErrWeakPassword     = errors.New("new password is too weak")
+	ErrMFAEnabled       = errors.New("two-factor authentication is already enabled")
+	ErrMFANotPending    = errors.New("start two-factor setup first")
+	ErrMFANotEnabled    = errors.New("two-factor authentication is not enabled")
+)
+
+type Controller struct {
+	Repo     *repositories.Repositories
+	Sessions *auth.SessionCache
+	Mailer   mail.Mailer
+	Passkeys *auth.Passkeys
+}
+
+type Handler struct {
+	Controller *Controller
+}
+
+// PreferencesRequest replaces the whole profile, omitted fields are cleared
+type PreferencesRequest struct {
+	HomeCity            string   `json:"homeCity"`
+	HomeCurrency        string   `json:"homeCurrency"`
+	DietaryRestrictions []string `json:"dietaryRestrictions"`
+	MobilityNeeds       string   `json:"mobilityNeeds"`
+	Pace                string   `json:"pace"`
+	Interests           []string `json:"interests"`
+	AccommodationStyle  string   `json:"accommodationStyle"`
+	Language            string   `json:"language"`
+}
+
+// ActiveSession is one signed in device. ID stays the same across refreshes of the login
+type ActiveSession struct {
+	ID         uuid.UUID         `json:"id"`
+	Device     models.DeviceInfo `json:"device"`
+	SignedInAt time.Time         `json:"signedInAt"`
+	LastUsedAt *time.Time        `json:"lastUsedAt,omitempty"`
+	ExpiresAt  time.Time         `json:"expiresAt"`
+	Current    bool              `json:"current"`
+}
+
+// PasswordRequest changes the password, which signs the user out everywhere
+type PasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// MFAStatus says which second factors protect the account
+type MFAStatus struct {
+	TOTPEnabled       bool `json:"totpEnabled"`
+	RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+}
+
+// TOTPEnrollRequest starts authenticator app setup, the password guards against a stolen session
+type TOTPEnrollRequest struct {
+	Password string `json:"password"`
+}
+
+// TOTPEnrollment is shown to the user once, to add the account to their authenticator app
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// MFACodeRequest carries a code from the authenticator app, or a recovery code where accepted
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+// RecoveryCodes are shown to the user once, each one signs in a single time
+type RecoveryCodes struct {
+	Codes []string `json:"recoveryCodes"`
+}
+
+// PasskeyRegistrationRequest finishes adding a passkey, name helps the user tell them apart
+type PasskeyRegistrationRequest struct {
+	State      string                        `json:"state"`
+	Name       string                        `json:"name"`
+	Credential webauthn.RegistrationResponse `json:"credential"`
+}
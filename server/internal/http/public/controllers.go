@@ -0,0 +1,47 @@
+package public
+
+import (
+	"context"
+	"time"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+func NewController(repo *repositories.Repositories) *Controller {
+	return &Controller{Repo: repo}
+}
+
+// GetItinerary returns the current version of the itinerary behind a share token
+func (c *Controller) GetItinerary(ctx context.Context, token string) (*SharedItinerary, error) {
+	share, err := c.Repo.Share.GetByTokenHash(ctx, models.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	// expired and revoked links look the same as unknown ones
+	if !share.Active(time.Now()) {
+		return nil, models.ErrNotFound
+	}
+
+	itin, err := c.Repo.Itinerary.GetByID(ctx, share.ItineraryID)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := c.Repo.Itinerary.GetVersion(ctx, itin.ID, itin.CurrentVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	data := current.Data
+	data.Warnings = nil // validation notes are meant for the owner
+
+	return &SharedItinerary{
+		Itinerary:    data,
+		Version:      current.Version,
+		UpdatedAt:    current.CreatedAt,
+		Permission:   share.Permission,
+		CanDuplicate: share.Permission == models.SharePermissionDuplicate,
+		ExpiresAt:    share.ExpiresAt,
+	}, nil
+}
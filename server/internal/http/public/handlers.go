@@ -0,0 +1,45 @@
+package public
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+func NewHandler(ctrl *Controller) *Handler {
+	return &Handler{Controller: ctrl}
+}
+
+func (h *Handler) sendJSON(w http.ResponseWriter, status int, body any) {
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("Could not encode response", slog.String("error", err.Error()))
+	}
+}
+
+func (h *Handler) sendError(w http.ResponseWriter, err error) {
+	if errors.Is(err, models.ErrNotFound) {
+		h.sendJSON(w, http.StatusNotFound, map[string]string{"error": "this link does not exist or is no longer shared"})
+		return
+	}
+
+	slog.Error("Public request failed", slog.String("error", err.Error()))
+	h.sendJSON(w, http.StatusInternalServerError, map[string]string{"error": "something went wrong"})
+}
+
+// GET public/itineraries/{token}
+func (h *Handler) GetItinerary(w http.ResponseWriter, r *http.Request) {
+	shared, err := h.Controller.GetItinerary(r.Context(), r.PathValue("token"))
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	// links can be revoked at any time
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	h.sendJSON(w, http.StatusOK, shared)
+}
@@ -0,0 +1,18 @@
+package public
+
+import (
+	"net/http"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+// New serves unauthenticated routes, everything here must be safe to show to anyone holding the link
+func New(repo *repositories.Repositories) *http.ServeMux {
+	ctrl := NewController(repo)
+	h := NewHandler(ctrl)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /itineraries/{token}", h.GetItinerary) // public/itineraries/{token}
+
+	return mux
+}
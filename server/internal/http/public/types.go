@@ -0,0 +1,26 @@
+package public
+
+import (
+	"time"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+type Controller struct {
+	Repo *repositories.Repositories
+}
+
+type Handler struct {
+	Controller *Controller
+}
+
+// SharedItinerary is what a share link exposes, it never includes the chat, its owner or the chat history
+type SharedItinerary struct {
+	Itinerary    itinerary.Itinerary `json:"itinerary"`
+	Version      int                 `json:"version"`
+	UpdatedAt    time.Time           `json:"updatedAt"`
+	Permission   string              `json:"permission"`
+	CanDuplicate bool                `json:"canDuplicate"`
+	ExpiresAt    *time.Time          `json:"expiresAt,omitempty"`
+}
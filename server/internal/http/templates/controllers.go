@@ -0,0 +1,219 @@
+package templates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/access"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary"
+	mw "github.com/nakul-krishnakumar/kaiyo-ai/internal/middlewares"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+func NewController(repo *repositories.Repositories, notifier Notifier) *Controller {
+	return &Controller{
+		Repo:      repo,
+		Notifier:  notifier,
+		Validator: itinerary.NewValidator(nil),
+	}
+}
+
+// currentUser loads the requesting user
+func (c *Controller) currentUser(ctx context.Context) (*models.User, error) {
+	userID, ok := mw.UserIDFromContext(ctx)
+	if !ok {
+		return nil, access.ErrForbidden
+	}
+
+	return c.Repo.User.GetByID(ctx, userID)
+}
+
+// normaliseTags lowercases tags and drops blanks and repeats
+func normaliseTags(tags []string) []string {
+	out := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+func checkPace(pace string) error {
+	if pace != "" && !models.ValidPace(pace) {
+		return ErrInvalidPace
+	}
+	return nil
+}
+
+// Create saves the current version of an itinerary the user can see as a template, without its dates
+func (c *Controller) Create(ctx context.Context, req CreateTemplateRequest) (*models.ItineraryTemplate, error) {
+	user, err := c.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Public && !user.IsAdmin {
+		return nil, ErrAdminOnly
+	}
+
+	req.Pace = strings.ToLower(strings.TrimSpace(req.Pace))
+	if err := checkPace(req.Pace); err != nil {
+		return nil, err
+	}
+
+	itin, err := c.Repo.Itinerary.GetByID(ctx, req.ItineraryID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := access.Require(ctx, c.Repo.Trip, itin.ChatID, models.TripRoleViewer); err != nil {
+		return nil, err
+	}
+
+	current, err := c.Repo.Itinerary.GetVersion(ctx, itin.ID, itin.CurrentVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	data := current.Data.Clone()
+	if len(data.Days) == 0 {
+		return nil, ErrEmptyPlan
+	}
+	data.StripDates()
+	data.Warnings = nil
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		title = fmt.Sprintf("%d days in %s", len(data.Days), data.Destination)
+	}
+
+	template := &models.ItineraryTemplate{
+		Title:        title,
+		Destination:  data.Destination,
+		DurationDays: len(data.Days),
+		Pace:         req.Pace,
+		Interests:    normaliseTags(req.Interests),
+		Data:         *data,
+		Public:       req.Public,
+		CreatedBy:    &user.ID,
+	}
+	if err := c.Repo.Template.Create(ctx, template); err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+// Get returns a template, other users' private templates look like unknown ones
+func (c *Controller) Get(ctx context.Context, id uuid.UUID) (*models.ItineraryTemplate, error) {
+	template, err := c.Repo.Template.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !template.Public {
+		userID, ok := mw.UserIDFromContext(ctx)
+		if !ok || template.CreatedBy == nil || *template.CreatedBy != userID {
+			return nil, models.ErrNotFound
+		}
+	}
+
+	return template, nil
+}
+
+// Search returns public templates and the user's own
+func (c *Controller) Search(ctx context.Context, query models.TemplateQuery) ([]models.ItineraryTemplate, error) {
+	if err := checkPace(query.Pace); err != nil {
+		return nil, err
+	}
+	query.Interests = normaliseTags(query.Interests)
+
+	if userID, ok := mw.UserIDFromContext(ctx); ok {
+		query.UserID = &userID
+	}
+
+	return c.Repo.Template.Search(ctx, query)
+}
+
+func (c *Controller) Delete(ctx context.Context, id uuid.UUID) error {
+	template, err := c.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	user, err := c.currentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !user.IsAdmin && (template.CreatedBy == nil || *template.CreatedBy != user.ID) {
+		return ErrForbidden
+	}
+
+	return c.Repo.Template.Delete(ctx, id)
+}
+
+// Instantiate starts a new chat owned by the requesting user from a template, optionally dated from startDate
+func (c *Controller) Instantiate(ctx context.Context, id uuid.UUID, req InstantiateRequest) (*InstantiateResponse, error) {
+	template, err := c.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	data := template.Data.Clone()
+	if req.StartDate != "" {
+		if err := data.ShiftDates(req.StartDate); err != nil {
+			return nil, err
+		}
+	}
+	data.Warnings = c.Validator.Validate(ctx, data).Strings()
+
+	plan, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode itinerary: %w", err)
+	}
+
+	chatID := uuid.NewString()
+	if _, err := access.Join(ctx, c.Repo.Trip, chatID, models.TripRoleOwner); err != nil {
+		return nil, err
+	}
+
+	var userID *uuid.UUID
+	if id, ok := mw.UserIDFromContext(ctx); ok {
+		userID = &id
+	}
+
+	version := &models.ItineraryVersion{
+		Data:      *data,
+		Source:    models.ItinerarySourceTemplate,
+		Message:   "Started from the template " + template.Title,
+		CreatedBy: userID,
+	}
+
+	itin, err := c.Repo.Itinerary.SaveVersion(ctx, chatID, userID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Repo.Template.IncrementUses(ctx, template.ID); err != nil {
+		slog.Error("Could not count template use", slog.String("error", err.Error()))
+	}
+
+	c.Notifier.AddNote(chatID, fmt.Sprintf(
+		"This chat starts from the template %q. Its itinerary is already saved as version %d, "+
+			"treat it as the current plan and adapt it as the user asks, asking for dates if it has none:\n%s",
+		template.Title, version.Version, plan))
+
+	return &InstantiateResponse{
+		ChatID:      chatID,
+		ItineraryID: itin.ID.String(),
+		Version:     version.Version,
+	}, nil
+}
@@ -0,0 +1,169 @@
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/access"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+func NewHandler(ctrl *Controller) *Handler {
+	return &Handler{Controller: ctrl}
+}
+
+func (h *Handler) sendJSON(w http.ResponseWriter, status int, body any) {
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("Could not encode response", slog.String("error", err.Error()))
+	}
+}
+
+func (h *Handler) sendError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, access.ErrForbidden),
+		errors.Is(err, ErrForbidden),
+		errors.Is(err, ErrAdminOnly):
+		status = http.StatusForbidden
+	case errors.Is(err, ErrInvalidPace),
+		errors.Is(err, ErrInvalidQuery),
+		errors.Is(err, itinerary.ErrInvalidDate):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrEmptyPlan):
+		status = http.StatusUnprocessableEntity
+	default:
+		slog.Error("Template request failed", slog.String("error", err.Error()))
+	}
+
+	h.sendJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (h *Handler) templateID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid template id"})
+		return uuid.Nil, false
+	}
+
+	return id, true
+}
+
+// GET api/v1/templates?destination=&days=&pace=&interests=food,trekking&limit=
+func (h *Handler) SearchTemplates(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := models.TemplateQuery{
+		Destination: strings.TrimSpace(q.Get("destination")),
+		Pace:        strings.ToLower(q.Get("pace")),
+	}
+
+	for _, param := range []struct {
+		name string
+		dst  *int
+	}{{"days", &query.Days}, {"limit", &query.Limit}} {
+		raw := q.Get(param.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			h.sendError(w, ErrInvalidQuery)
+			return
+		}
+		*param.dst = n
+	}
+	query.Limit = min(query.Limit, 50)
+
+	if raw := q.Get("interests"); raw != "" {
+		query.Interests = strings.Split(raw, ",")
+	}
+
+	templates, err := h.Controller.Search(r.Context(), query)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, templates)
+}
+
+// POST api/v1/templates
+func (h *Handler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var req CreateTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	template, err := h.Controller.Create(r.Context(), req)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusCreated, template)
+}
+
+// GET api/v1/templates/{id}
+func (h *Handler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.templateID(w, r)
+	if !ok {
+		return
+	}
+
+	template, err := h.Controller.Get(r.Context(), id)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, template)
+}
+
+// DELETE api/v1/templates/{id}
+func (h *Handler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.templateID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Controller.Delete(r.Context(), id); err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST api/v1/templates/{id}/instantiate
+func (h *Handler) Instantiate(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.templateID(w, r)
+	if !ok {
+		return
+	}
+
+	// the body is optional, without one the plan stays undated
+	var req InstantiateRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	started, err := h.Controller.Instantiate(r.Context(), id, req)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusCreated, started)
+}
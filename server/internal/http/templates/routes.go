@@ -0,0 +1,21 @@
+package templates
+
+import (
+	"net/http"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+func New(repo *repositories.Repositories, notifier Notifier) *http.ServeMux {
+	ctrl := NewController(repo, notifier)
+	h := NewHandler(ctrl)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", h.SearchTemplates)           // api/v1/templates?destination=&days=&pace=&interests=
+	mux.HandleFunc("POST /{$}", h.CreateTemplate)           // api/v1/templates
+	mux.HandleFunc("GET /{id}", h.GetTemplate)              // api/v1/templates/{id}
+	mux.HandleFunc("DELETE /{id}", h.DeleteTemplate)        // api/v1/templates/{id}
+	mux.HandleFunc("POST /{id}/instantiate", h.Instantiate) // api/v1/templates/{id}/instantiate
+
+	return mux
+}
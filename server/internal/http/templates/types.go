@@ -0,0 +1,51 @@
+package templates
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+var (
+	ErrForbidden    = errors.New("only its creator or an admin can change this template")
+	ErrAdminOnly    = errors.New("only admins can publish templates")
+	ErrInvalidPace  = errors.New("pace must be relaxed, balanced or busy")
+	ErrEmptyPlan    = errors.New("the itinerary has no days to keep")
+	ErrInvalidQuery = errors.New("days must be a positive number")
+)
+
+// Notifier receives notes for the chats templates start
+type Notifier interface {
+	AddNote(chatID string, note string)
+}
+
+type Controller struct {
+	Repo      *repositories.Repositories
+	Notifier  Notifier
+	Validator *itinerary.Validator
+}
+
+type Handler struct {
+	Controller *Controller
+}
+
+type CreateTemplateRequest struct {
+	ItineraryID uuid.UUID `json:"itineraryId"`         // its current version becomes the template
+	Title       string    `json:"title,omitempty"`     // defaults to the duration and destination
+	Pace        string    `json:"pace,omitempty"`      // relaxed, balanced or busy
+	Interests   []string  `json:"interests,omitempty"` // e.g. "food", "trekking"
+	Public      bool      `json:"public,omitempty"`    // admins only
+}
+
+type InstantiateRequest struct {
+	StartDate string `json:"startDate,omitempty"` // YYYY-MM-DD, otherwise the plan stays undated
+}
+
+// InstantiateResponse points at the new chat a template starts
+type InstantiateResponse struct {
+	ChatID      string `json:"chatId"`
+	ItineraryID string `json:"itineraryId"`
+	Version     int    `json:"version"`
+}
@@ -0,0 +1,244 @@
+package trips
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/access"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/mail"
+	mw "github.com/nakul-krishnakumar/kaiyo-ai/internal/middlewares"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+const invitationTTL = 7 * 24 * time.Hour
+
+func NewController(repo *repositories.Repositories, notifier Notifier, mailer mail.Mailer, appURL string) *Controller {
+	return &Controller{
+		Repo:     repo,
+		Notifier: notifier,
+		Mailer:   mailer,
+		AppURL:   appURL,
+	}
+}
+
+// memberRole checks a role can be given through an invitation or a role change, there is only ever one owner
+func memberRole(role string) error {
+	if role != models.TripRoleEditor && role != models.TripRoleViewer {
+		return ErrInvalidRole
+	}
+	return nil
+}
+
+// currentUser loads the requesting user
+func (c *Controller) currentUser(ctx context.Context) (*models.User, error) {
+	userID, ok := mw.UserIDFromContext(ctx)
+	if !ok {
+		return nil, access.ErrForbidden
+	}
+
+	return c.Repo.User.GetByID(ctx, userID)
+}
+
+// invitee loads the requesting user to match invitations against their email. Invitations go
+// to whoever owns the address, so it has to be verified whatever UNVERIFIED_RESTRICTIONS says
+func (c *Controller) invitee(ctx context.Context) (*models.User, error) {
+	user, err := c.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !user.EmailVerified {
+		return nil, ErrUnverified
+	}
+
+	return user, nil
+}
+
+// List returns the requesting user's trips with their role in each
+func (c *Controller) List(ctx context.Context) ([]models.TripMember, error) {
+	userID, ok := mw.UserIDFromContext(ctx)
+	if !ok {
+		return nil, access.ErrForbidden
+	}
+
+	return c.Repo.Trip.ListByUser(ctx, userID)
+}
+
+func (c *Controller) ListMembers(ctx context.Context, chatID string) ([]models.TripMember, error) {
+	if _, err := access.Require(ctx, c.Repo.Trip, chatID, models.TripRoleViewer); err != nil {
+		return nil, err
+	}
+
+	return c.Repo.Trip.ListMembers(ctx, chatID)
+}
+
+func (c *Controller) UpdateMember(ctx context.Context, chatID string, userID uuid.UUID, role string) error {
+	if _, err := access.Require(ctx, c.Repo.Trip, chatID, models.TripRoleOwner); err != nil {
+		return err
+	}
+
+	if err := memberRole(role); err != nil {
+		return err
+	}
+
+	current, err := c.Repo.Trip.GetRole(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if current == models.TripRoleOwner {
+		return ErrOwnerRole
+	}
+
+	return c.Repo.Trip.UpdateRole(ctx, chatID, userID, role)
+}
+
+// RemoveMember lets the owner remove anyone else and every other member leave the trip
+func (c *Controller) RemoveMember(ctx context.Context, chatID string, userID uuid.UUID) error {
+	required := models.TripRoleOwner
+	if self, ok := mw.UserIDFromContext(ctx); ok && self == userID {
+		required = models.TripRoleViewer
+	}
+
+	if _, err := access.Require(ctx, c.Repo.Trip, chatID, required); err != nil {
+		return err
+	}
+
+	role, err := c.Repo.Trip.GetRole(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if role == models.TripRoleOwner {
+		return ErrOwnerRole
+	}
+
+	return c.Repo.Trip.RemoveMember(ctx, chatID, userID)
+}
+
+// Invite emails an invitation to the trip, the invitee accepts it once signed in with that address and verified it
+func (c *Controller) Invite(ctx context.Context, chatID string, req InviteRequest) (*models.TripInvitation, error) {
+	if _, err := access.Require(ctx, c.Repo.Trip, chatID, models.TripRoleOwner); err != nil {
+		return nil, err
+	}
+
+	inviter, err := c.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if !strings.Contains(email, "@") {
+		return nil, ErrInvalidEmail
+	}
+
+	if req.Role == "" {
+		req.Role = models.TripRoleEditor
+	}
+	if err := memberRole(req.Role); err != nil {
+		return nil, err
+	}
+
+	invitation := &models.TripInvitation{
+		ChatID:    chatID,
+		Email:     email,
+		Role:      req.Role,
+		ExpiresAt: time.Now().Add(invitationTTL),
+	}
+	invitation.InvitedBy = &inviter.ID
+
+	if err := c.Repo.Trip.CreateInvitation(ctx, invitation); err != nil {
+		return nil, err
+	}
+
+	mail.SendAsync(c.Mailer, c.invitationEmail(inviter, invitation))
+
+	return invitation, nil
+}
+
+// invitationEmail asks the invitee to sign in or sign up with the invited address and verify it to accept
+func (c *Controller) invitationEmail(inviter *models.User, invitation *models.TripInvitation) mail.Message {
+	name := strings.TrimSpace(inviter.FirstName + " " + inviter.LastName)
+	if name == "" {
+		name = inviter.UserName
+	}
+	if name == "" {
+		name = "A Kaiyo AI user"
+	}
+
+	return mail.Message{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("%s invited you to plan a trip on Kaiyo AI", name),
+		Text: fmt.Sprintf(`Hi,
+
+%s invited you to plan a trip together on Kaiyo AI as %s.
+
+To accept, sign in or create an account with this email address and verify it, the invitation is waiting for you here:
+
+%s
+
+The invitation expires on %s. If you weren't expecting it you can ignore this email.
+`, name, article(invitation.Role), c.AppURL+"/invitations", invitation.ExpiresAt.Format("2 January 2006")),
+	}
+}
+
+// article prefixes a role with its indefinite article, e.g. "an editor"
+func article(role string) string {
+	if strings.ContainsAny(role[:1], "aeiou") {
+		return "an " + role
+	}
+	return "a " + role
+}
+
+func (c *Controller) ListInvitations(ctx context.Context, chatID string) ([]models.TripInvitation, error) {
+	if _, err := access.Require(ctx, c.Repo.Trip, chatID, models.TripRoleOwner); err != nil {
+		return nil, err
+	}
+
+	return c.Repo.Trip.ListInvitations(ctx, chatID)
+}
+
+func (c *Controller) RevokeInvitation(ctx context.Context, chatID string, id uuid.UUID) error {
+	if _, err := access.Require(ctx, c.Repo.Trip, chatID, models.TripRoleOwner); err != nil {
+		return err
+	}
+
+	return c.Repo.Trip.RevokeInvitation(ctx, chatID, id)
+}
+
+// PendingInvitations returns the invitations sent to the requesting user's verified email
+func (c *Controller) PendingInvitations(ctx context.Context) ([]models.TripInvitation, error) {
+	user, err := c.invitee(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Repo.Trip.ListPendingInvitations(ctx, user.Email)
+}
+
+// AcceptInvitation adds the requesting user to the trip, invitations sent to other addresses look like unknown ones
+func (c *Controller) AcceptInvitation(ctx context.Context, id uuid.UUID) (*models.TripInvitation, error) {
+	user, err := c.invitee(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation, err := c.Repo.Trip.GetInvitation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(invitation.Email, user.Email) || !invitation.Pending(time.Now()) {
+		return nil, models.ErrNotFound
+	}
+
+	if err := c.Repo.Trip.AcceptInvitation(ctx, id, user.ID); err != nil {
+		return nil, err
+	}
+
+	c.Notifier.AddNote(invitation.ChatID, fmt.Sprintf(
+		"%s joined the trip as %s. Messages from trip members are labelled with their names.",
+		user.UserName, invitation.Role))
+
+	return c.Repo.Trip.GetInvitation(ctx, id)
+}
@@ -0,0 +1,187 @@
+package trips
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/access"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+func NewHandler(ctrl *Controller) *Handler {
+	return &Handler{Controller: ctrl}
+}
+
+func (h *Handler) sendJSON(w http.ResponseWriter, status int, body any) {
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("Could not encode response", slog.String("error", err.Error()))
+	}
+}
+
+func (h *Handler) sendError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, access.ErrForbidden),
+		errors.Is(err, ErrOwnerRole),
+		errors.Is(err, ErrUnverified):
+		status = http.StatusForbidden
+	case errors.Is(err, ErrInvalidRole),
+		errors.Is(err, ErrInvalidEmail):
+		status = http.StatusBadRequest
+	default:
+		slog.Error("Trip request failed", slog.String("error", err.Error()))
+	}
+
+	h.sendJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (h *Handler) decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return false
+	}
+
+	return true
+}
+
+func (h *Handler) uuidParam(w http.ResponseWriter, r *http.Request, name string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue(name))
+	if err != nil {
+		h.sendJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid " + name})
+		return uuid.Nil, false
+	}
+
+	return id, true
+}
+
+// GET api/v1/trips
+func (h *Handler) ListTrips(w http.ResponseWriter, r *http.Request) {
+	trips, err := h.Controller.List(r.Context())
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, trips)
+}
+
+// GET api/v1/trips/{chatID}/members
+func (h *Handler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	members, err := h.Controller.ListMembers(r.Context(), r.PathValue("chatID"))
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, members)
+}
+
+// PUT api/v1/trips/{chatID}/members/{userID}
+func (h *Handler) UpdateMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.uuidParam(w, r, "userID")
+	if !ok {
+		return
+	}
+
+	var req UpdateMemberRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	if err := h.Controller.UpdateMember(r.Context(), r.PathValue("chatID"), userID, req.Role); err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE api/v1/trips/{chatID}/members/{userID}
+func (h *Handler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.uuidParam(w, r, "userID")
+	if !ok {
+		return
+	}
+
+	if err := h.Controller.RemoveMember(r.Context(), r.PathValue("chatID"), userID); err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST api/v1/trips/{chatID}/invitations
+func (h *Handler) Invite(w http.ResponseWriter, r *http.Request) {
+	var req InviteRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	invitation, err := h.Controller.Invite(r.Context(), r.PathValue("chatID"), req)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusCreated, invitation)
+}
+
+// GET api/v1/trips/{chatID}/invitations
+func (h *Handler) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err := h.Controller.ListInvitations(r.Context(), r.PathValue("chatID"))
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, invitations)
+}
+
+// DELETE api/v1/trips/{chatID}/invitations/{id}
+func (h *Handler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.uuidParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.Controller.RevokeInvitation(r.Context(), r.PathValue("chatID"), id); err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET api/v1/trips/invitations
+func (h *Handler) PendingInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err := h.Controller.PendingInvitations(r.Context())
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, invitations)
+}
+
+// POST api/v1/trips/invitations/{id}/accept
+func (h *Handler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.uuidParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	invitation, err := h.Controller.AcceptInvitation(r.Context(), id)
+	if err != nil {
+		h.sendError(w, err)
+		return
+	}
+
+	h.sendJSON(w, http.StatusOK, invitation)
+}
@@ -0,0 +1,30 @@
+package trips
+
+import (
+	"net/http"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/mail"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+func New(repo *repositories.Repositories, notifier Notifier, mailer mail.Mailer, appURL string) *http.ServeMux {
+	ctrl := NewController(repo, notifier, mailer, appURL)
+	h := NewHandler(ctrl)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", h.ListTrips) // api/v1/trips
+
+	// invitations sent to the signed in user
+	mux.HandleFunc("GET /invitations", h.PendingInvitations)            // api/v1/trips/invitations
+	mux.HandleFunc("POST /invitations/{id}/accept", h.AcceptInvitation) // api/v1/trips/invitations/{id}/accept
+
+	// a trip is identified by its chat
+	mux.HandleFunc("GET /{chatID}/members", h.ListMembers)                  // api/v1/trips/{chatID}/members
+	mux.HandleFunc("PUT /{chatID}/members/{userID}", h.UpdateMember)        // api/v1/trips/{chatID}/members/{userID}
+	mux.HandleFunc("DELETE /{chatID}/members/{userID}", h.RemoveMember)     // api/v1/trips/{chatID}/members/{userID}
+	mux.HandleFunc("POST /{chatID}/invitations", h.Invite)                  // api/v1/trips/{chatID}/invitations
+	mux.HandleFunc("GET /{chatID}/invitations", h.ListInvitations)          // api/v1/trips/{chatID}/invitations
+	mux.HandleFunc("DELETE /{chatID}/invitations/{id}", h.RevokeInvitation) // api/v1/trips/{chatID}/invitations/{id}
+
+	return mux
+}
@@ -0,0 +1,40 @@
+package trips
+
+import (
+	"errors"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/mail"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+var (
+	ErrInvalidRole  = errors.New("role must be editor or viewer")
+	ErrOwnerRole    = errors.New("the trip owner cannot be removed or change role")
+	ErrInvalidEmail = errors.New("a valid email is required")
+	ErrUnverified   = errors.New("verify your email to see and accept trip invitations")
+)
+
+// Notifier receives notes about trip changes made outside the chat
+type Notifier interface {
+	AddNote(chatID string, note string)
+}
+
+type Controller struct {
+	Repo     *repositories.Repositories
+	Notifier Notifier
+	Mailer   mail.Mailer
+	AppURL   string // where links in invitation emails point
+}
+
+type Handler struct {
+	Controller *Controller
+}
+
+type InviteRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"` // editor or viewer
+}
+
+type UpdateMemberRequest struct {
+	Role string `json:"role"` // editor or viewer
+}
@@ -0,0 +1,435 @@
+package itinerary
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Change kinds
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeMoved   = "moved"
+	ChangeRetimed = "retimed"
+	ChangeUpdated = "updated"
+)
+
+type Diff struct {
+	Trip  []FieldChange `json:"trip"`
+	Days  []DayChange   `json:"days"`
+	Items []ItemChange  `json:"items"`
+}
+
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+type DayChange struct {
+	Kind    string `json:"kind"` // added, removed, moved, updated
+	Day     int    `json:"day"`
+	Label   string `json:"label,omitempty"`
+	From    string `json:"from,omitempty"`    // previous label when relabelled
+	FromDay int    `json:"fromDay,omitempty"` // previous position when moved
+}
+
+type ItemChange struct {
+	Kind   string   `json:"kind"` // added, removed, moved, retimed, updated
+	Title  string   `json:"title"`
+	Place  string   `json:"place,omitempty"`
+	Day    int      `json:"day"`              // day the item is on after the change (before, for removals)
+	Item   int      `json:"item"`             // 1-based position on that day
+	From   *ItemRef `json:"from,omitempty"`   // previous position and times
+	Fields []string `json:"fields,omitempty"` // changed fields for updates
+	Start  string   `json:"startTime,omitempty"`
+	End    string   `json:"endTime,omitempty"`
+}
+
+type ItemRef struct {
+	Day   int    `json:"day"`
+	Item  int    `json:"item"`
+	Start string `json:"startTime,omitempty"`
+	End   string `json:"endTime,omitempty"`
+}
+
+func (d Diff) Empty() bool {
+	return len(d.Trip) == 0 && len(d.Days) == 0 && len(d.Items) == 0
+}
+
+type located struct {
+	day, pos int
+	item     DayItem
+	paired   bool
+}
+
+// Compare returns the structured changes needed to turn from into to.
+// Items are matched by title and place, preferring matches on the same day.
+func Compare(from, to *Itinerary) Diff {
+	d := Diff{Trip: []FieldChange{}, Days: []DayChange{}, Items: []ItemChange{}}
+
+	for _, f := range []FieldChange{
+		{"destination", from.Destination, to.Destination},
+		{"startDate", from.StartDate, to.StartDate},
+		{"endDate", from.EndDate, to.EndDate},
+		{"currency", from.Currency, to.Currency},
+	} {
+		if f.From != f.To {
+			d.Trip = append(d.Trip, f)
+		}
+	}
+
+	days := pairDays(from, to)
+	d.Days = compareDays(from, to, days)
+	d.Items = compareItems(from, to, days)
+
+	return d
+}
+
+// pairDays maps the day numbers of from to those of the same days in to. Adding, removing or
+// reordering days renumbers them, so days are matched by label first, then by the items they
+// share, and only what is left by number
+func pairDays(from, to *Itinerary) map[int]int {
+	pairs := make(map[int]int)
+	paired := make(map[int]bool) // days of to
+	pair := func(a, b int) {
+		pairs[a] = b
+		paired[b] = true
+	}
+
+	for _, b := range to.Days {
+		if b.Label == "" {
+			continue
+		}
+		best := 0
+		for _, a := range from.Days {
+			if _, ok := pairs[a.Day]; ok || a.Label != b.Label {
+				continue
+			}
+			if best == 0 || a.Day == b.Day {
+				best = a.Day
+			}
+		}
+		if best != 0 {
+			pair(best, b.Day)
+		}
+	}
+
+	for _, b := range to.Days {
+		if paired[b.Day] {
+			continue
+		}
+		keys := make(map[string]bool)
+		for _, item := range b.Items {
+			keys[item.Key()] = true
+		}
+
+		best, most := 0, 0
+		for _, a := range from.Days {
+			if _, ok := pairs[a.Day]; ok {
+				continue
+			}
+			shared := 0
+			for _, item := range a.Items {
+				if keys[item.Key()] {
+					shared++
+				}
+			}
+			if shared > most {
+				best, most = a.Day, shared
+			}
+		}
+		if best != 0 {
+			pair(best, b.Day)
+		}
+	}
+
+	for _, b := range to.Days {
+		if paired[b.Day] {
+			continue
+		}
+		for _, a := range from.Days {
+			if _, ok := pairs[a.Day]; !ok && a.Day == b.Day {
+				pair(a.Day, b.Day)
+				break
+			}
+		}
+	}
+
+	return pairs
+}
+
+func compareDays(from, to *Itinerary, pairs map[int]int) []DayChange {
+	out := []DayChange{}
+
+	old := make(map[int]DayPlan)
+	for _, day := range from.Days {
+		old[day.Day] = day
+	}
+	prev := make(map[int]int) // the reverse of pairs
+	for a, b := range pairs {
+		prev[b] = a
+	}
+
+	// a day moved when its order among the days in both versions changed, days added or
+	// removed around it only renumber it
+	oldRank := rankDays(pairs)
+	newRank := rankDays(prev)
+
+	for _, day := range to.Days {
+		a, ok := prev[day.Day]
+		if !ok {
+			out = append(out, DayChange{Kind: ChangeAdded, Day: day.Day, Label: day.Label})
+			continue
+		}
+
+		relabelled := old[a].Label != day.Label
+		change := DayChange{Day: day.Day, Label: day.Label}
+		if relabelled {
+			change.From = old[a].Label
+		}
+		switch {
+		case oldRank[a] != newRank[day.Day]:
+			change.Kind = ChangeMoved
+			change.FromDay = a
+		case relabelled:
+			change.Kind = ChangeUpdated
+		default:
+			continue
+		}
+		out = append(out, change)
+	}
+
+	for _, day := range from.Days {
+		if _, ok := pairs[day.Day]; !ok {
+			out = append(out, DayChange{Kind: ChangeRemoved, Day: day.Day, Label: day.Label})
+		}
+	}
+
+	return out
+}
+
+// rankDays numbers the paired days of one side by their position
+func rankDays(pairs map[int]int) map[int]int {
+	days := make([]int, 0, len(pairs))
+	for day := range pairs {
+		days = append(days, day)
+	}
+	sort.Ints(days)
+
+	rank := make(map[int]int)
+	for i, day := range days {
+		rank[day] = i
+	}
+	return rank
+}
+
+func flatten(itin *Itinerary) map[string][]*located {
+	out := make(map[string][]*located)
+	for _, day := range itin.Days {
+		for i, item := range day.Items {
+			key := item.Key()
+			out[key] = append(out[key], &located{day: day.Day, pos: i + 1, item: item})
+		}
+	}
+	return out
+}
+
+// compareItems pairs items by key, days maps the days of from to theirs in to
+func compareItems(from, to *Itinerary, days map[int]int) []ItemChange {
+	oldItems := flatten(from)
+	newItems := flatten(to)
+
+	type pair struct{ a, b *located }
+	var pairs []pair
+
+	// pair occurrences on the same day first, then whatever is left in order
+	for key, news := range newItems {
+		olds := oldItems[key]
+		for _, b := range news {
+			for _, a := range olds {
+				if !a.paired && days[a.day] == b.day {
+					a.paired, b.paired = true, true
+					pairs = append(pairs, pair{a, b})
+					break
+				}
+			}
+		}
+		for _, b := range news {
+			if b.paired {
+				continue
+			}
+			for _, a := range olds {
+				if !a.paired {
+					a.paired, b.paired = true, true
+					pairs = append(pairs, pair{a, b})
+					break
+				}
+			}
+		}
+	}
+
+	// relative order of items that stayed on their day, to detect reordering
+	var sameDay []pair
+	for _, p := range pairs {
+		if days[p.a.day] == p.b.day {
+			sameDay = append(sameDay, p)
+		}
+	}
+	oldRank := rankPaired(sameDay, func(p pair) *located { return p.a })
+	newRank := rankPaired(sameDay, func(p pair) *located { return p.b })
+
+	out := []ItemChange{}
+	for _, p := range pairs {
+		a, b := p.a, p.b
+		change := ItemChange{
+			Title: b.item.Title, Place: b.item.Place, Day: b.day, Item: b.pos,
+			Start: b.item.StartTime, End: b.item.EndTime,
+			From: &ItemRef{Day: a.day, Item: a.pos, Start: a.item.StartTime, End: a.item.EndTime},
+		}
+
+		retimed := a.item.StartTime != b.item.StartTime || a.item.EndTime != b.item.EndTime
+		switch {
+		case days[a.day] != b.day || oldRank[a] != newRank[b]:
+			change.Kind = ChangeMoved
+		case retimed:
+			change.Kind = ChangeRetimed
+		default:
+			fields := changedFields(a.item, b.item)
+			if len(fields) == 0 {
+				continue
+			}
+			change.Kind = ChangeUpdated
+			change.Fields = fields
+		}
+		out = append(out, change)
+	}
+
+	for _, olds := range oldItems {
+		for _, a := range olds {
+			if !a.paired {
+				out = append(out, ItemChange{
+					Kind: ChangeRemoved, Title: a.item.Title, Place: a.item.Place, Day: a.day, Item: a.pos,
+					Start: a.item.StartTime, End: a.item.EndTime,
+				})
+			}
+		}
+	}
+
+	for _, news := range newItems {
+		for _, b := range news {
+			if !b.paired {
+				out = append(out, ItemChange{
+					Kind: ChangeAdded, Title: b.item.Title, Place: b.item.Place, Day: b.day, Item: b.pos,
+					Start: b.item.StartTime, End: b.item.EndTime,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Day != out[j].Day {
+			return out[i].Day < out[j].Day
+		}
+		return out[i].Item < out[j].Item
+	})
+
+	return out
+}
+
+// rankPaired numbers the paired items on each day by their position
+func rankPaired[P any](pairs []P, side func(P) *located) map[*located]int {
+	byDay := make(map[int][]*located)
+	for _, p := range pairs {
+		l := side(p)
+		byDay[l.day] = append(byDay[l.day], l)
+	}
+
+	rank := make(map[*located]int)
+	for _, ls := range byDay {
+		sort.Slice(ls, func(i, j int) bool { return ls[i].pos < ls[j].pos })
+		for i, l := range ls {
+			rank[l] = i
+		}
+	}
+
+	return rank
+}
+
+func changedFields(a, b DayItem) []string {
+	var fields []string
+	if a.City != b.City {
+		fields = append(fields, "city")
+	}
+	if a.Category != b.Category {
+		fields = append(fields, "category")
+	}
+	if a.Notes != b.Notes {
+		fields = append(fields, "notes")
+	}
+	if a.Cost != b.Cost {
+		fields = append(fields, "cost")
+	}
+	if a.Lat != b.Lat || a.Lon != b.Lon {
+		fields = append(fields, "coordinates")
+	}
+	return fields
+}
+
+// Summary describes the changes as plain text lines, suitable as model context
+func (d Diff) Summary() []string {
+	var out []string
+
+	for _, f := range d.Trip {
+		out = append(out, fmt.Sprintf("changed %s from %q to %q", f.Field, f.From, f.To))
+	}
+
+	for _, day := range d.Days {
+		switch day.Kind {
+		case ChangeAdded:
+			out = append(out, fmt.Sprintf("added day %d %q", day.Day, day.Label))
+		case ChangeRemoved:
+			out = append(out, fmt.Sprintf("removed day %d %q", day.Day, day.Label))
+		case ChangeMoved:
+			line := fmt.Sprintf("moved day %d %q to day %d", day.FromDay, cmp.Or(day.From, day.Label), day.Day)
+			if day.From != "" {
+				line += fmt.Sprintf(" and relabelled it %q", day.Label)
+			}
+			out = append(out, line)
+		case ChangeUpdated:
+			out = append(out, fmt.Sprintf("relabelled day %d from %q to %q", day.Day, day.From, day.Label))
+		}
+	}
+
+	for _, item := range d.Items {
+		switch item.Kind {
+		case ChangeAdded:
+			out = append(out, fmt.Sprintf("added %q to day %d at position %d%s", item.Title, item.Day, item.Item, timeRange(item.Start, item.End)))
+		case ChangeRemoved:
+			out = append(out, fmt.Sprintf("removed %q from day %d", item.Title, item.Day))
+		case ChangeMoved:
+			out = append(out, fmt.Sprintf("moved %q from day %d position %d to day %d position %d%s",
+				item.Title, item.From.Day, item.From.Item, item.Day, item.Item, timeRange(item.Start, item.End)))
+		case ChangeRetimed:
+			out = append(out, fmt.Sprintf("retimed %q on day %d from%s to%s",
+				item.Title, item.Day, timeRange(item.From.Start, item.From.End), timeRange(item.Start, item.End)))
+		case ChangeUpdated:
+			out = append(out, fmt.Sprintf("updated %s of %q on day %d", strings.Join(item.Fields, ", "), item.Title, item.Day))
+		}
+	}
+
+	return out
+}
+
+func timeRange(start, end string) string {
+	switch {
+	case start != "" && end != "":
+		return fmt.Sprintf(" (%s-%s)", start, end)
+	case start != "":
+		return fmt.Sprintf(" (from %s)", start)
+	default:
+		return " (untimed)"
+	}
+}
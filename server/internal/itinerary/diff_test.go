@@ -0,0 +1,164 @@
+package itinerary
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(it *Itinerary)
+		trip  []string
+		days  []string
+		items []string
+	}{
+		{
+			name: "no changes",
+			edit: func(it *Itinerary) {},
+		},
+		{
+			name: "trip fields",
+			edit: func(it *Itinerary) {
+				it.Destination = "Kodagu"
+				it.Currency = "INR"
+			},
+			trip: []string{"destination", "currency"},
+		},
+		{
+			name: "day added and relabelled",
+			edit: func(it *Itinerary) {
+				_ = it.AddDay(0, DayPlan{Label: "Departure"})
+				_ = it.UpdateDay(1, "Getting there")
+			},
+			trip: []string{"endDate"},
+			days: []string{ChangeUpdated, ChangeAdded},
+		},
+		{
+			name:  "day removed with its items",
+			edit:  func(it *Itinerary) { _ = it.RemoveDay(2) },
+			trip:  []string{"endDate"},
+			days:  []string{ChangeRemoved},
+			items: []string{ChangeRemoved},
+		},
+		{
+			name: "days reordered",
+			edit: func(it *Itinerary) { _ = it.ReorderDays([]int{2, 1}) },
+			days: []string{ChangeMoved, ChangeMoved},
+		},
+		{
+			name: "unlabelled days reordered are matched by their items",
+			edit: func(it *Itinerary) {
+				_ = it.ReorderDays([]int{2, 1})
+				_ = it.UpdateDay(1, "")
+				_ = it.UpdateDay(2, "")
+			},
+			days: []string{ChangeMoved, ChangeMoved},
+		},
+		{
+			name: "day inserted before the others",
+			edit: func(it *Itinerary) { _ = it.AddDay(1, DayPlan{Label: "Travel"}) },
+			trip: []string{"endDate"},
+			days: []string{ChangeAdded},
+		},
+		{
+			name:  "item added",
+			edit:  func(it *Itinerary) { _ = it.AddItem(2, 0, DayItem{Title: "Dubare"}) },
+			items: []string{ChangeAdded},
+		},
+		{
+			name:  "item moved to another day",
+			edit:  func(it *Itinerary) { _ = it.MoveItem(1, 2, 2, 0) },
+			items: []string{ChangeMoved},
+		},
+		{
+			name:  "items swapped on a day",
+			edit:  func(it *Itinerary) { _ = it.ReorderItems(1, []int{2, 1}) },
+			items: []string{ChangeMoved, ChangeMoved},
+		},
+		{
+			name:  "item retimed",
+			edit:  func(it *Itinerary) { it.Days[1].Items[0].StartTime = "10:00" },
+			items: []string{ChangeRetimed},
+		},
+		{
+			name:  "item details updated",
+			edit:  func(it *Itinerary) { it.Days[1].Items[0].Notes = "book ahead" },
+			items: []string{ChangeUpdated},
+		},
+		{
+			name:  "item renamed counts as a replacement",
+			edit:  func(it *Itinerary) { it.Days[1].Items[0].Title = "Tea estate" },
+			items: []string{ChangeRemoved, ChangeAdded},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from := sample()
+			to := from.Clone()
+			tt.edit(to)
+
+			d := Compare(from, to)
+
+			var trip, days, items []string
+			for _, f := range d.Trip {
+				trip = append(trip, f.Field)
+			}
+			for _, c := range d.Days {
+				days = append(days, c.Kind)
+			}
+			for _, c := range d.Items {
+				items = append(items, c.Kind)
+			}
+
+			if !slices.Equal(trip, tt.trip) {
+				t.Errorf("trip changes = %v, want %v", trip, tt.trip)
+			}
+			if !slices.Equal(days, tt.days) {
+				t.Errorf("day changes = %v, want %v", days, tt.days)
+			}
+			if !slices.Equal(items, tt.items) {
+				t.Errorf("item changes = %v, want %v", items, tt.items)
+			}
+			if d.Empty() != (len(tt.trip)+len(tt.days)+len(tt.items) == 0) {
+				t.Errorf("Empty() = %v", d.Empty())
+			}
+		})
+	}
+}
+
+func TestCompareSummary(t *testing.T) {
+	from := sample()
+	to := from.Clone()
+	_ = to.MoveItem(1, 2, 2, 1)
+	to.Days[1].Items[0].StartTime = "10:00"
+	to.Days[1].Items[0].EndTime = "11:30"
+	to.Days[1].Items[1].Cost = 250
+
+	want := []string{
+		`moved "Abbey Falls" from day 1 position 2 to day 2 position 1 (10:00-11:30)`,
+		`updated cost of "Coffee estate" on day 2`,
+	}
+	if got := Compare(from, to).Summary(); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCompareSummaryDays(t *testing.T) {
+	from := sample()
+	to := from.Clone()
+	_ = to.ReorderDays([]int{2, 1})
+	_ = to.UpdateDay(2, "Getting there")
+	_ = to.MoveItem(2, 2, 2, 1)
+
+	want := []string{
+		`moved day 2 "Plantations" to day 1`,
+		`moved day 1 "Arrival" to day 2 and relabelled it "Getting there"`,
+		`moved "Abbey Falls" from day 1 position 2 to day 2 position 1 (from 15:00)`,
+		`moved "Check in" from day 1 position 1 to day 2 position 2 (from 2025-11-01T12:00)`,
+	}
+	if got := Compare(from, to).Summary(); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,287 @@
+package itinerary
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrDayNotFound     = errors.New("day not found")
+	ErrItemNotFound    = errors.New("item not found")
+	ErrInvalidPosition = errors.New("invalid position")
+	ErrInvalidOrder    = errors.New("order must list every existing position exactly once")
+	ErrInvalidDate     = errors.New("dates must be formatted as YYYY-MM-DD")
+)
+
+// layouts of item times that carry a date, these move with the trip
+var datedTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02T15:04:05"}
+
+// Clone returns a deep copy, edits are applied to copies so saved versions stay immutable
+func (it *Itinerary) Clone() *Itinerary {
+	var out Itinerary
+	data, _ := json.Marshal(it)
+	_ = json.Unmarshal(data, &out)
+	return &out
+}
+
+func (it *Itinerary) day(day int) (*DayPlan, error) {
+	if day < 1 || day > len(it.Days) {
+		return nil, ErrDayNotFound
+	}
+	return &it.Days[day-1], nil
+}
+
+func (d *DayPlan) checkItem(item int) error {
+	if item < 1 || item > len(d.Items) {
+		return ErrItemNotFound
+	}
+	return nil
+}
+
+// AddDay inserts a day at a 1-based position, 0 appends it
+func (it *Itinerary) AddDay(position int, plan DayPlan) error {
+	if position == 0 {
+		position = len(it.Days) + 1
+	}
+	if position < 1 || position > len(it.Days)+1 {
+		return ErrInvalidPosition
+	}
+	if plan.Items == nil {
+		plan.Items = []DayItem{}
+	}
+
+	it.Days = insert(it.Days, position-1, plan)
+	it.renumber()
+	return nil
+}
+
+func (it *Itinerary) UpdateDay(day int, label string) error {
+	d, err := it.day(day)
+	if err != nil {
+		return err
+	}
+	d.Label = label
+	return nil
+}
+
+func (it *Itinerary) RemoveDay(day int) error {
+	if _, err := it.day(day); err != nil {
+		return err
+	}
+	it.Days = append(it.Days[:day-1], it.Days[day:]...)
+	it.renumber()
+	return nil
+}
+
+// ReorderDays rearranges days, order lists the current day numbers in their new order
+func (it *Itinerary) ReorderDays(order []int) error {
+	perm, err := permutation(order, len(it.Days))
+	if err != nil {
+		return err
+	}
+
+	days := make([]DayPlan, len(it.Days))
+	for i, from := range perm {
+		days[i] = it.Days[from]
+	}
+	it.Days = days
+	it.renumber()
+	return nil
+}
+
+// AddItem inserts an item at a 1-based position within a day, 0 appends it
+func (it *Itinerary) AddItem(day, position int, item DayItem) error {
+	d, err := it.day(day)
+	if err != nil {
+		return err
+	}
+	if position == 0 {
+		position = len(d.Items) + 1
+	}
+	if position < 1 || position > len(d.Items)+1 {
+		return ErrInvalidPosition
+	}
+
+	d.Items = insert(d.Items, position-1, item)
+	return nil
+}
+
+func (it *Itinerary) UpdateItem(day, item int, updated DayItem) error {
+	d, err := it.day(day)
+	if err != nil {
+		return err
+	}
+	if err := d.checkItem(item); err != nil {
+		return err
+	}
+
+	d.Items[item-1] = updated
+	return nil
+}
+
+func (it *Itinerary) RemoveItem(day, item int) error {
+	d, err := it.day(day)
+	if err != nil {
+		return err
+	}
+	if err := d.checkItem(item); err != nil {
+		return err
+	}
+
+	d.Items = append(d.Items[:item-1], d.Items[item:]...)
+	return nil
+}
+
+// MoveItem moves an item to a 1-based position on another (or the same) day, position 0 appends it
+func (it *Itinerary) MoveItem(day, item, toDay, position int) error {
+	d, err := it.day(day)
+	if err != nil {
+		return err
+	}
+	if err := d.checkItem(item); err != nil {
+		return err
+	}
+	target, err := it.day(toDay)
+	if err != nil {
+		return err
+	}
+
+	moved := d.Items[item-1]
+	d.Items = append(d.Items[:item-1], d.Items[item:]...)
+
+	if position == 0 {
+		position = len(target.Items) + 1
+	}
+	if position < 1 || position > len(target.Items)+1 {
+		// put it back so the itinerary is left untouched
+		d.Items = insert(d.Items, item-1, moved)
+		return ErrInvalidPosition
+	}
+
+	target.Items = insert(target.Items, position-1, moved)
+	return nil
+}
+
+// ReorderItems rearranges a day's items, order lists the current positions in their new order
+func (it *Itinerary) ReorderItems(day int, order []int) error {
+	d, err := it.day(day)
+	if err != nil {
+		return err
+	}
+
+	perm, err := permutation(order, len(d.Items))
+	if err != nil {
+		return err
+	}
+
+	items := make([]DayItem, len(d.Items))
+	for i, from := range perm {
+		items[i] = d.Items[from]
+	}
+	d.Items = items
+	return nil
+}
+
+// ShiftDates moves the trip to a new start date. Each day's date follows from the start date,
+// the end date is recomputed from the number of days and dated item times move by the same number of days.
+func (it *Itinerary) ShiftDates(startDate string) error {
+	start, err := time.Parse(DateLayout, startDate)
+	if err != nil {
+		return ErrInvalidDate
+	}
+
+	old, err := time.Parse(DateLayout, it.StartDate)
+	it.StartDate = start.Format(DateLayout)
+	it.EndDate = it.StartDate
+	it.renumber()
+
+	// an undated trip has nothing to move
+	if err != nil {
+		return nil
+	}
+
+	days := int(start.Sub(old).Hours() / 24)
+	for d := range it.Days {
+		for i := range it.Days[d].Items {
+			item := &it.Days[d].Items[i]
+			item.StartTime = shiftTime(item.StartTime, days)
+			item.EndTime = shiftTime(item.EndTime, days)
+		}
+	}
+
+	return nil
+}
+
+// StripDates removes the trip's dates, keeping its days. Dated item times keep only their time of day.
+func (it *Itinerary) StripDates() {
+	it.StartDate = ""
+	it.EndDate = ""
+
+	for d := range it.Days {
+		for i := range it.Days[d].Items {
+			item := &it.Days[d].Items[i]
+			item.StartTime = clockTime(item.StartTime)
+			item.EndTime = clockTime(item.EndTime)
+		}
+	}
+}
+
+// clockTime drops the date from a dated time
+func clockTime(s string) string {
+	for _, layout := range datedTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("15:04")
+		}
+	}
+	return s
+}
+
+// shiftTime moves a dated time by a number of days, times of day are left as they are
+func shiftTime(s string, days int) string {
+	for _, layout := range datedTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.AddDate(0, 0, days).Format(layout)
+		}
+	}
+	return s
+}
+
+// renumber keeps day numbers contiguous and the end date in line with the number of days
+func (it *Itinerary) renumber() {
+	for i := range it.Days {
+		it.Days[i].Day = i + 1
+	}
+
+	start, err := time.Parse(DateLayout, it.StartDate)
+	if err != nil || len(it.Days) == 0 {
+		return
+	}
+	it.EndDate = start.AddDate(0, 0, len(it.Days)-1).Format(DateLayout)
+}
+
+// permutation converts a 1-based order into 0-based indexes, checking it covers 1..n once
+func permutation(order []int, n int) ([]int, error) {
+	if len(order) != n {
+		return nil, ErrInvalidOrder
+	}
+
+	seen := make([]bool, n)
+	perm := make([]int, n)
+	for i, pos := range order {
+		if pos < 1 || pos > n || seen[pos-1] {
+			return nil, ErrInvalidOrder
+		}
+		seen[pos-1] = true
+		perm[i] = pos - 1
+	}
+
+	return perm, nil
+}
+
+func insert[T any](s []T, i int, v T) []T {
+	s = append(s, v)
+	copy(s[i+1:], s[i:])
+	s[i] = v
+	return s
+}
@@ -0,0 +1,197 @@
+package itinerary
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func sample() *Itinerary {
+	return &Itinerary{
+		Destination: "Coorg",
+		StartDate:   "2025-11-01",
+		EndDate:     "2025-11-02",
+		Days: []DayPlan{
+			{Day: 1, Label: "Arrival", Items: []DayItem{
+				{Title: "Check in", StartTime: "2025-11-01T12:00"},
+				{Title: "Abbey Falls", StartTime: "15:00"},
+			}},
+			{Day: 2, Label: "Plantations", Items: []DayItem{
+				{Title: "Coffee estate", StartTime: "09:00"},
+			}},
+		},
+	}
+}
+
+func titles(d DayPlan) []string {
+	var out []string
+	for _, item := range d.Items {
+		out = append(out, item.Title)
+	}
+	return out
+}
+
+func checkDays(t *testing.T, it *Itinerary, labels ...string) {
+	t.Helper()
+	if len(it.Days) != len(labels) {
+		t.Fatalf("got %d days, want %d", len(it.Days), len(labels))
+	}
+	for i, d := range it.Days {
+		if d.Day != i+1 || d.Label != labels[i] {
+			t.Errorf("day %d = (%d, %q), want (%d, %q)", i+1, d.Day, d.Label, i+1, labels[i])
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	it := sample()
+	clone := it.Clone()
+	clone.Days[0].Items[0].Title = "changed"
+
+	if it.Days[0].Items[0].Title != "Check in" {
+		t.Error("editing the clone changed the original")
+	}
+}
+
+func TestDayEdits(t *testing.T) {
+	it := sample()
+
+	if err := it.AddDay(0, DayPlan{Label: "Departure"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := it.AddDay(1, DayPlan{Day: 9, Label: "Travel"}); err != nil {
+		t.Fatal(err)
+	}
+	checkDays(t, it, "Travel", "Arrival", "Plantations", "Departure")
+	if it.EndDate != "2025-11-04" {
+		t.Errorf("end date = %s, want 2025-11-04", it.EndDate)
+	}
+	if it.Days[3].Items == nil {
+		t.Error("added day has nil items")
+	}
+
+	if err := it.ReorderDays([]int{2, 3, 4, 1}); err != nil {
+		t.Fatal(err)
+	}
+	checkDays(t, it, "Arrival", "Plantations", "Departure", "Travel")
+
+	if err := it.RemoveDay(4); err != nil {
+		t.Fatal(err)
+	}
+	if err := it.UpdateDay(3, "Home"); err != nil {
+		t.Fatal(err)
+	}
+	checkDays(t, it, "Arrival", "Plantations", "Home")
+	if it.EndDate != "2025-11-03" {
+		t.Errorf("end date = %s, want 2025-11-03", it.EndDate)
+	}
+}
+
+func TestItemEdits(t *testing.T) {
+	it := sample()
+
+	if err := it.AddItem(1, 2, DayItem{Title: "Lunch"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := it.UpdateItem(2, 1, DayItem{Title: "Tea estate"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := it.MoveItem(1, 3, 2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := titles(it.Days[0]), []string{"Check in", "Lunch"}; !slices.Equal(got, want) {
+		t.Errorf("day 1 = %v, want %v", got, want)
+	}
+	if got, want := titles(it.Days[1]), []string{"Tea estate", "Abbey Falls"}; !slices.Equal(got, want) {
+		t.Errorf("day 2 = %v, want %v", got, want)
+	}
+
+	if err := it.ReorderItems(2, []int{2, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := it.RemoveItem(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := titles(it.Days[0]), []string{"Lunch"}; !slices.Equal(got, want) {
+		t.Errorf("day 1 = %v, want %v", got, want)
+	}
+	if got, want := titles(it.Days[1]), []string{"Abbey Falls", "Tea estate"}; !slices.Equal(got, want) {
+		t.Errorf("day 2 = %v, want %v", got, want)
+	}
+}
+
+func TestEditErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(it *Itinerary) error
+		want error
+	}{
+		{"add day past the end", func(it *Itinerary) error { return it.AddDay(4, DayPlan{}) }, ErrInvalidPosition},
+		{"remove day zero", func(it *Itinerary) error { return it.RemoveDay(0) }, ErrDayNotFound},
+		{"update missing day", func(it *Itinerary) error { return it.UpdateDay(3, "x") }, ErrDayNotFound},
+		{"reorder days short", func(it *Itinerary) error { return it.ReorderDays([]int{1}) }, ErrInvalidOrder},
+		{"reorder days repeated", func(it *Itinerary) error { return it.ReorderDays([]int{1, 1}) }, ErrInvalidOrder},
+		{"add item to missing day", func(it *Itinerary) error { return it.AddItem(3, 0, DayItem{}) }, ErrDayNotFound},
+		{"add item past the end", func(it *Itinerary) error { return it.AddItem(1, 4, DayItem{}) }, ErrInvalidPosition},
+		{"update missing item", func(it *Itinerary) error { return it.UpdateItem(2, 2, DayItem{}) }, ErrItemNotFound},
+		{"remove missing item", func(it *Itinerary) error { return it.RemoveItem(1, -1) }, ErrItemNotFound},
+		{"move to missing day", func(it *Itinerary) error { return it.MoveItem(1, 1, 5, 0) }, ErrDayNotFound},
+		{"move past the end", func(it *Itinerary) error { return it.MoveItem(1, 1, 2, 3) }, ErrInvalidPosition},
+		{"reorder items out of range", func(it *Itinerary) error { return it.ReorderItems(1, []int{1, 3}) }, ErrInvalidOrder},
+		{"shift to bad date", func(it *Itinerary) error { return it.ShiftDates("01/11/2025") }, ErrInvalidDate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it := sample()
+			if err := tt.edit(it); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			// failed edits leave the itinerary as it was
+			if d := Compare(sample(), it); !d.Empty() {
+				t.Errorf("itinerary changed: %v", d.Summary())
+			}
+		})
+	}
+}
+
+func TestShiftDates(t *testing.T) {
+	it := sample()
+	if err := it.ShiftDates("2025-12-30"); err != nil {
+		t.Fatal(err)
+	}
+
+	if it.StartDate != "2025-12-30" || it.EndDate != "2025-12-31" {
+		t.Errorf("dates = %s to %s, want 2025-12-30 to 2025-12-31", it.StartDate, it.EndDate)
+	}
+	if got := it.Days[0].Items[0].StartTime; got != "2025-12-30T12:00" {
+		t.Errorf("dated time = %s, want 2025-12-30T12:00", got)
+	}
+	if got := it.Days[0].Items[1].StartTime; got != "15:00" {
+		t.Errorf("time of day = %s, want it unchanged", got)
+	}
+
+	undated := sample()
+	undated.StartDate, undated.EndDate = "", ""
+	if err := undated.ShiftDates("2026-01-10"); err != nil {
+		t.Fatal(err)
+	}
+	if undated.EndDate != "2026-01-11" || undated.Days[0].Items[0].StartTime != "2025-11-01T12:00" {
+		t.Errorf("undated trip shifted to end %s with time %s", undated.EndDate, undated.Days[0].Items[0].StartTime)
+	}
+}
+
+func TestStripDates(t *testing.T) {
+	it := sample()
+	it.StripDates()
+
+	if it.StartDate != "" || it.EndDate != "" {
+		t.Errorf("dates = %q to %q, want none", it.StartDate, it.EndDate)
+	}
+	if got := it.Days[0].Items[0].StartTime; got != "12:00" {
+		t.Errorf("dated time = %s, want 12:00", got)
+	}
+	if len(it.Days) != 2 {
+		t.Errorf("got %d days, want 2", len(it.Days))
+	}
+}
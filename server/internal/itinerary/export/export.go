@@ -0,0 +1,141 @@
+package export
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+var (
+	ErrNoDates   = errors.New("itinerary has no valid start date")
+	ErrNoSuchDay = errors.New("itinerary has no such day")
+)
+
+// defaultDuration is used for items that have a start but no end time
+const defaultDuration = time.Hour
+
+// Stop is a day item with its position and resolved calendar times
+type Stop struct {
+	Day      int // the day's own number, which isn't guaranteed to match its position
+	DayIndex int // 0-based position of the day in the itinerary
+	Index    int // 1-based position within the day
+	Item     itinerary.DayItem
+	UID      string // stable across versions, see stopUIDs
+
+	Date  time.Time // zero if the itinerary has no dates
+	Start time.Time // zero if the item has no parseable start time
+	End   time.Time
+}
+
+func (s Stop) Timed() bool {
+	return !s.Start.IsZero()
+}
+
+// Location joins the place and city of an item, e.g. "Abbey Falls, Madikeri"
+func (s Stop) Location() string {
+	var parts []string
+	for _, p := range []string{s.Item.Place, s.Item.City} {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// startDate parses the itinerary start date, ok is false if it's missing or invalid
+func startDate(itin *itinerary.Itinerary) (time.Time, bool) {
+	t, err := time.Parse(itinerary.DateLayout, itin.StartDate)
+	return t, err == nil
+}
+
+// Stops flattens an itinerary version into stops, resolving dates and times where possible
+func Stops(v *models.ItineraryVersion) []Stop {
+	itin := &v.Data
+	start, dated := startDate(itin)
+	uids := stopUIDs(v.ItineraryID.String(), itin)
+
+	var stops []Stop
+	for d, day := range itin.Days {
+		for i, item := range day.Items {
+			s := Stop{Day: day.Day, DayIndex: d, Index: i + 1, Item: item, UID: uids[d][i]}
+
+			if dated {
+				s.Date = start.AddDate(0, 0, d)
+				s.Start, s.End = clockRange(s.Date, item)
+			}
+
+			stops = append(stops, s)
+		}
+	}
+
+	return stops
+}
+
+func clockRange(date time.Time, item itinerary.DayItem) (time.Time, time.Time) {
+	at := func(clock time.Time) time.Time {
+		return time.Date(date.Year(), date.Month(), date.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, time.UTC)
+	}
+
+	startClock, err := itinerary.ParseClock(item.StartTime)
+	if err != nil {
+		return time.Time{}, time.Time{}
+	}
+	start := at(startClock)
+
+	end := start.Add(defaultDuration)
+	if endClock, err := itinerary.ParseClock(item.EndTime); err == nil {
+		if e := at(endClock); e.After(start) {
+			end = e
+		} else if e.Before(start) {
+			end = e.AddDate(0, 0, 1) // runs past midnight
+		}
+	}
+
+	return start, end
+}
+
+// stopUIDs derives an id per item from the itinerary id and the item's title and place,
+// so the same activity keeps its id when it's retimed or moved to another day
+func stopUIDs(itineraryID string, itin *itinerary.Itinerary) [][]string {
+	seen := make(map[string]int)
+	out := make([][]string, len(itin.Days))
+
+	for d, day := range itin.Days {
+		out[d] = make([]string, len(day.Items))
+		for i, item := range day.Items {
+			key := item.Key()
+			seen[key]++
+
+			sum := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%d", itineraryID, key, seen[key])))
+			out[d][i] = hex.EncodeToString(sum[:16])
+		}
+	}
+
+	return out
+}
+
+// Filename builds a download filename from the destination, e.g. "coorg-itinerary.ics"
+func Filename(itin *itinerary.Itinerary, ext string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(itin.Destination) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "-"):
+			b.WriteByte('-')
+		}
+	}
+
+	name := strings.Trim(b.String(), "-")
+	if name == "" {
+		name = "trip"
+	}
+
+	return name + "-itinerary." + ext
+}
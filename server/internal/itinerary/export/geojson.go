@@ -0,0 +1,136 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+// dayColors cycles through distinct marker colours per day (simplestyle-spec)
+var dayColors = []string{"#e6194b", "#3cb44b", "#4363d8", "#f58231", "#911eb4", "#42d4f4", "#f032e6", "#9a6324"}
+
+// DayColor returns the colour used on maps for the day at a 0-based position in the itinerary.
+// It's keyed on the position rather than the day number, which comes from the model and may be anything.
+func DayColor(index int) string {
+	n := len(dayColors)
+	return dayColors[(index%n+n)%n]
+}
+
+type FeatureCollection struct {
+	Type       string         `json:"type"`
+	Properties map[string]any `json:"properties,omitempty"`
+	Features   []Feature      `json:"features"`
+}
+
+type Feature struct {
+	Type       string         `json:"type"`
+	ID         string         `json:"id,omitempty"`
+	Geometry   Geometry       `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+type Geometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+// GeoJSONDays builds one FeatureCollection per day: a Point per geocoded stop
+// and a LineString connecting them in visiting order
+func GeoJSONDays(v *models.ItineraryVersion) []FeatureCollection {
+	stops := Stops(v)
+	start, dated := startDate(&v.Data)
+
+	days := make([]FeatureCollection, 0, len(v.Data.Days))
+	for d, day := range v.Data.Days {
+		fc := FeatureCollection{
+			Type: "FeatureCollection",
+			Properties: map[string]any{
+				"destination": v.Data.Destination,
+				"day":         day.Day,
+				"label":       day.Label,
+				"version":     v.Version,
+			},
+			Features: []Feature{},
+		}
+
+		if dated {
+			fc.Properties["date"] = start.AddDate(0, 0, d).Format(itinerary.DateLayout)
+		}
+
+		var route [][]float64
+		for _, s := range stops {
+			if s.DayIndex != d || !s.Item.HasCoords() {
+				continue
+			}
+
+			point := []float64{s.Item.Lon, s.Item.Lat} // GeoJSON is lon, lat
+			route = append(route, point)
+
+			fc.Features = append(fc.Features, Feature{
+				Type:     "Feature",
+				ID:       s.UID,
+				Geometry: Geometry{Type: "Point", Coordinates: point},
+				Properties: map[string]any{
+					"day":           s.Day,
+					"index":         s.Index,
+					"title":         s.Item.Title,
+					"place":         s.Item.Place,
+					"city":          s.Item.City,
+					"category":      s.Item.Category,
+					"startTime":     s.Item.StartTime,
+					"endTime":       s.Item.EndTime,
+					"notes":         s.Item.Notes,
+					"marker-color":  DayColor(s.DayIndex),
+					"marker-symbol": fmt.Sprint(s.Index),
+				},
+			})
+		}
+
+		if len(route) > 1 {
+			fc.Features = append(fc.Features, Feature{
+				Type:     "Feature",
+				ID:       fmt.Sprintf("day-%d-route", d+1),
+				Geometry: Geometry{Type: "LineString", Coordinates: route},
+				Properties: map[string]any{
+					"day":    day.Day,
+					"label":  day.Label,
+					"stroke": DayColor(d),
+				},
+			})
+		}
+
+		days = append(days, fc)
+	}
+
+	return days
+}
+
+// GeoJSON renders a single FeatureCollection of the whole trip, or of one day when day > 0
+func GeoJSON(v *models.ItineraryVersion, day int) ([]byte, error) {
+	days := GeoJSONDays(v)
+
+	if day > 0 {
+		if day > len(days) {
+			return nil, fmt.Errorf("day %d: %w", day, ErrNoSuchDay)
+		}
+		return json.MarshalIndent(days[day-1], "", "  ")
+	}
+
+	trip := FeatureCollection{
+		Type: "FeatureCollection",
+		Properties: map[string]any{
+			"destination": v.Data.Destination,
+			"startDate":   v.Data.StartDate,
+			"endDate":     v.Data.EndDate,
+			"version":     v.Version,
+		},
+		Features: []Feature{},
+	}
+	for _, fc := range days {
+		trip.Features = append(trip.Features, fc.Features...)
+	}
+
+	return json.MarshalIndent(trip, "", "  ")
+}
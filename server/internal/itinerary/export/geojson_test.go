@@ -0,0 +1,92 @@
+package export
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+)
+
+func TestDayColor(t *testing.T) {
+	for _, index := range []int{-9, -1, 0, 1, 7, 8, 100} {
+		if DayColor(index) == "" {
+			t.Errorf("DayColor(%d) is empty", index)
+		}
+	}
+	if DayColor(0) == DayColor(1) {
+		t.Error("adjacent days share a colour")
+	}
+}
+
+func TestGeoJSONMisnumberedDays(t *testing.T) {
+	days := GeoJSONDays(misnumbered())
+	if len(days) != 3 {
+		t.Fatalf("got %d days, want 3", len(days))
+	}
+
+	// each day keeps its own stops even when two days share a number
+	for i, want := range []int{3, 1, 1} {
+		if got := len(days[i].Features); got != want {
+			t.Errorf("day %d has %d features, want %d", i+1, got, want)
+		}
+	}
+
+	colors := map[any]bool{}
+	for _, fc := range days {
+		colors[fc.Features[0].Properties["marker-color"]] = true
+	}
+	if len(colors) != 3 {
+		t.Errorf("got %d day colours, want 3", len(colors))
+	}
+
+	body, err := GeoJSON(misnumbered(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trip FeatureCollection
+	if err := json.Unmarshal(body, &trip); err != nil {
+		t.Fatal(err)
+	}
+	if len(trip.Features) != 5 {
+		t.Errorf("trip has %d features, want 5", len(trip.Features))
+	}
+}
+
+func TestKMLMisnumberedDays(t *testing.T) {
+	body, err := KML(misnumbered())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc kmlDoc
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int{3, 1, 1} {
+		if got := len(doc.Document.Folders[i].Placemarks); got != want {
+			t.Errorf("folder %d has %d placemarks, want %d", i+1, got, want)
+		}
+	}
+	if doc.Document.Styles[1].ID == doc.Document.Styles[2].ID {
+		t.Errorf("days share style %q", doc.Document.Styles[1].ID)
+	}
+}
+
+func TestGPXMisnumberedDays(t *testing.T) {
+	body, err := GPX(misnumbered())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc gpxDoc
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Waypoints) != 4 || len(doc.Routes) != 3 {
+		t.Fatalf("got %d waypoints and %d routes, want 4 and 3", len(doc.Waypoints), len(doc.Routes))
+	}
+	for i, want := range []int{2, 1, 1} {
+		if got := len(doc.Routes[i].Points); got != want {
+			t.Errorf("route %d has %d points, want %d", i+1, got, want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package export
+
+import (
+	"encoding/xml"
+	"time"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+type gpxDoc struct {
+	XMLName   xml.Name      `xml:"gpx"`
+	Xmlns     string        `xml:"xmlns,attr"`
+	Version   string        `xml:"version,attr"`
+	Creator   string        `xml:"creator,attr"`
+	Metadata  gpxMetadata   `xml:"metadata"`
+	Waypoints []gpxWaypoint `xml:"wpt"`
+	Routes    []gpxRoute    `xml:"rte"`
+}
+
+type gpxMetadata struct {
+	Name string `xml:"name"`
+	Desc string `xml:"desc,omitempty"`
+	Time string `xml:"time"`
+}
+
+type gpxWaypoint struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Time string  `xml:"time,omitempty"`
+	Name string  `xml:"name"`
+	Desc string  `xml:"desc,omitempty"`
+	Type string  `xml:"type,omitempty"`
+}
+
+type gpxRoute struct {
+	Name   string        `xml:"name"`
+	Desc   string        `xml:"desc,omitempty"`
+	Number int           `xml:"number"`
+	Points []gpxWaypoint `xml:"rtept"`
+}
+
+// GPX renders the itinerary as GPX 1.1, every geocoded stop is a waypoint
+// and each day is a route through that day's stops
+func GPX(v *models.ItineraryVersion) ([]byte, error) {
+	doc := gpxDoc{
+		Xmlns:   "http://www.topografix.com/GPX/1/1",
+		Version: "1.1",
+		Creator: "Kaiyo AI",
+		Metadata: gpxMetadata{
+			Name: v.Data.Destination,
+			Desc: dateRange(v),
+			Time: v.CreatedAt.UTC().Format(time.RFC3339),
+		},
+	}
+
+	stops := Stops(v)
+	for d, day := range v.Data.Days {
+		route := gpxRoute{Name: dayTitle(day.Day, day.Label), Number: day.Day}
+
+		for _, s := range stops {
+			if s.DayIndex != d || !s.Item.HasCoords() {
+				continue
+			}
+
+			wpt := gpxWaypoint{
+				Lat:  s.Item.Lat,
+				Lon:  s.Item.Lon,
+				Name: s.Item.Title,
+				Desc: stopDescription(s),
+				Type: s.Item.Category,
+			}
+			if s.Timed() {
+				// GPX wants UTC, the itinerary only has local times so this is nominal
+				wpt.Time = s.Start.Format("2006-01-02T15:04:05Z")
+			}
+
+			doc.Waypoints = append(doc.Waypoints, wpt)
+			route.Points = append(route.Points, gpxWaypoint{Lat: wpt.Lat, Lon: wpt.Lon, Name: wpt.Name})
+		}
+
+		if len(route.Points) > 0 {
+			doc.Routes = append(doc.Routes, route)
+		}
+	}
+
+	return marshalXML(doc)
+}
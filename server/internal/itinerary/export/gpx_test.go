@@ -0,0 +1,42 @@
+package export
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestGPX(t *testing.T) {
+	body, err := GPX(coorgTrip())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc gpxDoc
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != "1.1" || doc.Metadata.Name != "Coorg" || doc.Metadata.Desc != "2025-11-01 to 2025-11-02" {
+		t.Errorf("gpx %s, metadata %+v", doc.Version, doc.Metadata)
+	}
+
+	// stops without coordinates are left out, and so is a day with nothing left
+	if len(doc.Waypoints) != 2 || len(doc.Routes) != 1 {
+		t.Fatalf("got %d waypoints and %d routes, want 2 and 1", len(doc.Waypoints), len(doc.Routes))
+	}
+
+	falls := doc.Waypoints[0]
+	if falls.Lat != 12.4556 || falls.Lon != 75.7191 || falls.Name != "Abbey Falls" || falls.Type != "sightseeing" {
+		t.Errorf("waypoint %+v", falls)
+	}
+	if falls.Time != "2025-11-01T10:00:00Z" {
+		t.Errorf("waypoint time %q", falls.Time)
+	}
+	if seat := doc.Waypoints[1]; seat.Name != "Raja's Seat" || seat.Time != "" {
+		t.Errorf("untimed waypoint %+v", seat)
+	}
+
+	route := doc.Routes[0]
+	if route.Name != "Day 1 – Arrival" || route.Number != 1 || len(route.Points) != 2 {
+		t.Errorf("route %q number %d with %d points", route.Name, route.Number, len(route.Points))
+	}
+}
@@ -0,0 +1,112 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+const (
+	icsDateTime = "20060102T150405"
+	icsDate     = "20060102"
+	icsLineMax  = 75 // octets, RFC 5545 section 3.1
+)
+
+// ICS renders an itinerary version as an iCalendar VCALENDAR with one VEVENT per item.
+// Times are floating local times at the destination. UIDs are stable and SEQUENCE is the
+// version number, so importing a newer version updates events instead of duplicating them.
+func ICS(v *models.ItineraryVersion) ([]byte, error) {
+	if _, ok := startDate(&v.Data); !ok {
+		return nil, ErrNoDates
+	}
+
+	w := &icsWriter{}
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:-//Kaiyo AI//Itinerary//EN")
+	w.line("CALSCALE:GREGORIAN")
+	w.line("METHOD:PUBLISH")
+	w.prop("X-WR-CALNAME", v.Data.Destination+" trip")
+
+	stamp := v.CreatedAt.UTC().Format(icsDateTime) + "Z"
+
+	for _, s := range Stops(v) {
+		w.line("BEGIN:VEVENT")
+		w.line("UID:" + s.UID + "@kaiyo-ai")
+		w.line(fmt.Sprintf("SEQUENCE:%d", v.Version))
+		w.line("DTSTAMP:" + stamp)
+
+		if s.Timed() {
+			w.line("DTSTART:" + s.Start.Format(icsDateTime))
+			w.line("DTEND:" + s.End.Format(icsDateTime))
+		} else {
+			w.line("DTSTART;VALUE=DATE:" + s.Date.Format(icsDate))
+			w.line("DTEND;VALUE=DATE:" + s.Date.AddDate(0, 0, 1).Format(icsDate))
+			w.line("TRANSP:TRANSPARENT")
+		}
+
+		w.prop("SUMMARY", s.Item.Title)
+		if loc := s.Location(); loc != "" {
+			w.prop("LOCATION", loc)
+		}
+		if s.Item.HasCoords() {
+			w.line(fmt.Sprintf("GEO:%.6f;%.6f", s.Item.Lat, s.Item.Lon))
+		}
+		if s.Item.Category != "" {
+			w.prop("CATEGORIES", s.Item.Category)
+		}
+
+		description := s.Item.Notes
+		if label := v.Data.Days[s.DayIndex].Label; label != "" {
+			description = strings.TrimSpace(fmt.Sprintf("Day %d: %s\n\n%s", s.Day, label, description))
+		}
+		if description != "" {
+			w.prop("DESCRIPTION", description)
+		}
+
+		w.line("END:VEVENT")
+	}
+
+	w.line("END:VCALENDAR")
+
+	return []byte(w.String()), nil
+}
+
+type icsWriter struct {
+	strings.Builder
+}
+
+// prop writes a property with an escaped text value
+func (w *icsWriter) prop(name, value string) {
+	w.line(name + ":" + icsEscape(value))
+}
+
+// line writes a content line, folding it at 75 octets without splitting UTF-8 sequences
+func (w *icsWriter) line(s string) {
+	limit := icsLineMax
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8Start(s[cut]) {
+			cut--
+		}
+		w.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		limit = icsLineMax - 1 // continuation lines start with a space
+	}
+	w.WriteString(s + "\r\n")
+}
+
+func utf8Start(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+func icsEscape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
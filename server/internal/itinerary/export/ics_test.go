@@ -0,0 +1,57 @@
+package export
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+// misnumbered has day numbers that don't match their positions, which the validator only warns about
+func misnumbered() *models.ItineraryVersion {
+	return &models.ItineraryVersion{
+		Version: 1,
+		Data: itinerary.Itinerary{
+			Destination: "Coorg",
+			StartDate:   "2025-11-01",
+			EndDate:     "2025-11-03",
+			Days: []itinerary.DayPlan{
+				{Day: 0, Label: "Arrival", Items: []itinerary.DayItem{
+					{Title: "Abbey Falls", StartTime: "10:00", Lat: 12.4556, Lon: 75.7191},
+					{Title: "Raja's Seat", StartTime: "17:00", Lat: 12.4207, Lon: 75.7376},
+				}},
+				{Day: 5, Label: "Plantations", Items: []itinerary.DayItem{
+					{Title: "Coffee estate", StartTime: "09:00", Lat: 12.3375, Lon: 75.8069},
+				}},
+				{Day: 5, Label: "Departure", Items: []itinerary.DayItem{
+					{Title: "Dubare", StartTime: "08:00", Lat: 12.3685, Lon: 75.9075},
+				}},
+			},
+		},
+	}
+}
+
+func TestICSMisnumberedDays(t *testing.T) {
+	body, err := ICS(misnumbered())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ics := string(body)
+	if n := strings.Count(ics, "BEGIN:VEVENT"); n != 4 {
+		t.Errorf("got %d events, want 4", n)
+	}
+	for _, want := range []string{
+		"DTSTART:20251101T100000",
+		"DTSTART:20251102T090000",
+		"DTSTART:20251103T080000",
+		`DESCRIPTION:Day 0: Arrival`,
+		`DESCRIPTION:Day 5: Plantations`,
+		`DESCRIPTION:Day 5: Departure`,
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+type kmlDoc struct {
+	XMLName  xml.Name    `xml:"kml"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Document kmlDocument `xml:"Document"`
+}
+
+type kmlDocument struct {
+	Name        string      `xml:"name"`
+	Description string      `xml:"description,omitempty"`
+	Styles      []kmlStyle  `xml:"Style"`
+	Folders     []kmlFolder `xml:"Folder"`
+}
+
+type kmlStyle struct {
+	ID        string `xml:"id,attr"`
+	IconColor string `xml:"IconStyle>color"`
+	LineColor string `xml:"LineStyle>color"`
+	LineWidth int    `xml:"LineStyle>width"`
+}
+
+type kmlFolder struct {
+	Name        string         `xml:"name"`
+	Description string         `xml:"description,omitempty"`
+	Placemarks  []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	ID          string         `xml:"id,attr,omitempty"`
+	Name        string         `xml:"name"`
+	Description string         `xml:"description,omitempty"`
+	Address     string         `xml:"address,omitempty"`
+	StyleURL    string         `xml:"styleUrl"`
+	TimeSpan    *kmlTimeSpan   `xml:"TimeSpan,omitempty"`
+	Point       *kmlPoint      `xml:"Point,omitempty"`
+	LineString  *kmlLineString `xml:"LineString,omitempty"`
+}
+
+type kmlTimeSpan struct {
+	Begin string `xml:"begin"`
+	End   string `xml:"end"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlLineString struct {
+	Tessellate  int    `xml:"tessellate"`
+	Coordinates string `xml:"coordinates"`
+}
+
+// kmlColor converts "#rrggbb" to KML's aabbggrr
+func kmlColor(hex string) string {
+	hex = strings.TrimPrefix(hex, "#")
+	return "ff" + hex[4:6] + hex[2:4] + hex[0:2]
+}
+
+// KML renders the itinerary as a KML document with one folder per day,
+// a placemark per geocoded stop and a line connecting each day's stops
+func KML(v *models.ItineraryVersion) ([]byte, error) {
+	doc := kmlDoc{
+		Xmlns: "http://www.opengis.net/kml/2.2",
+		Document: kmlDocument{
+			Name:        v.Data.Destination,
+			Description: dateRange(v),
+		},
+	}
+
+	stops := Stops(v)
+	for d, day := range v.Data.Days {
+		style := fmt.Sprintf("day-%d", d+1)
+		color := kmlColor(DayColor(d))
+		doc.Document.Styles = append(doc.Document.Styles, kmlStyle{ID: style, IconColor: color, LineColor: color, LineWidth: 4})
+
+		folder := kmlFolder{Name: dayTitle(day.Day, day.Label)}
+
+		var route []string
+		for _, s := range stops {
+			if s.DayIndex != d || !s.Item.HasCoords() {
+				continue
+			}
+
+			coords := fmt.Sprintf("%.6f,%.6f,0", s.Item.Lon, s.Item.Lat)
+			route = append(route, coords)
+
+			p := kmlPlacemark{
+				ID:          s.UID,
+				Name:        fmt.Sprintf("%d. %s", s.Index, s.Item.Title),
+				Description: stopDescription(s),
+				Address:     s.Location(),
+				StyleURL:    "#" + style,
+				Point:       &kmlPoint{Coordinates: coords},
+			}
+			if s.Timed() {
+				p.TimeSpan = &kmlTimeSpan{Begin: s.Start.Format("2006-01-02T15:04:05"), End: s.End.Format("2006-01-02T15:04:05")}
+			}
+
+			folder.Placemarks = append(folder.Placemarks, p)
+		}
+
+		if len(route) > 1 {
+			folder.Placemarks = append(folder.Placemarks, kmlPlacemark{
+				Name:       dayTitle(day.Day, day.Label) + " route",
+				StyleURL:   "#" + style,
+				LineString: &kmlLineString{Tessellate: 1, Coordinates: strings.Join(route, " ")},
+			})
+		}
+
+		doc.Document.Folders = append(doc.Document.Folders, folder)
+	}
+
+	return marshalXML(doc)
+}
+
+func marshalXML(v any) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), body...), nil
+}
+
+func dayTitle(day int, label string) string {
+	if label == "" {
+		return fmt.Sprintf("Day %d", day)
+	}
+	return fmt.Sprintf("Day %d – %s", day, label)
+}
+
+func dateRange(v *models.ItineraryVersion) string {
+	if v.Data.StartDate == "" {
+		return ""
+	}
+	if v.Data.EndDate == "" || v.Data.EndDate == v.Data.StartDate {
+		return v.Data.StartDate
+	}
+	return v.Data.StartDate + " to " + v.Data.EndDate
+}
+
+// stopDescription summarises time, category and notes of a stop as plain text
+func stopDescription(s Stop) string {
+	var lines []string
+
+	switch {
+	case s.Item.StartTime != "" && s.Item.EndTime != "":
+		lines = append(lines, s.Item.StartTime+" – "+s.Item.EndTime)
+	case s.Item.StartTime != "":
+		lines = append(lines, s.Item.StartTime)
+	}
+
+	if s.Item.Category != "" {
+		lines = append(lines, "Category: "+s.Item.Category)
+	}
+
+	if s.Item.Notes != "" {
+		lines = append(lines, s.Item.Notes)
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,86 @@
+package export
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+// coorgTrip has a stop without coordinates and a day with nothing to put on a map
+func coorgTrip() *models.ItineraryVersion {
+	return &models.ItineraryVersion{
+		Version: 1,
+		Data: itinerary.Itinerary{
+			Destination: "Coorg",
+			StartDate:   "2025-11-01",
+			EndDate:     "2025-11-02",
+			Days: []itinerary.DayPlan{
+				{Day: 1, Label: "Arrival", Items: []itinerary.DayItem{
+					{Title: "Abbey Falls", Place: "Abbey Falls", City: "Madikeri", Category: "sightseeing", StartTime: "10:00", EndTime: "11:30", Lat: 12.4556, Lon: 75.7191},
+					{Title: "Lunch", StartTime: "13:00"},
+					{Title: "Raja's Seat", City: "Madikeri", Lat: 12.4207, Lon: 75.7376},
+				}},
+				{Day: 2, Items: []itinerary.DayItem{
+					{Title: "Pack up", StartTime: "08:00"},
+				}},
+			},
+		},
+	}
+}
+
+func TestKMLColor(t *testing.T) {
+	if got := kmlColor("#e6194b"); got != "ff4b19e6" {
+		t.Errorf("kmlColor(#e6194b) = %q, want ff4b19e6", got)
+	}
+}
+
+func TestKML(t *testing.T) {
+	body, err := KML(coorgTrip())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc kmlDoc
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Document.Name != "Coorg" || doc.Document.Description != "2025-11-01 to 2025-11-02" {
+		t.Errorf("document %q, %q", doc.Document.Name, doc.Document.Description)
+	}
+	if len(doc.Document.Folders) != 2 {
+		t.Fatalf("got %d folders, want one per day", len(doc.Document.Folders))
+	}
+
+	// the stop without coordinates is left out, the others keep their number in the day
+	day := doc.Document.Folders[0]
+	if day.Name != "Day 1 – Arrival" || len(day.Placemarks) != 3 {
+		t.Fatalf("day 1 is %q with %d placemarks, want two stops and a route", day.Name, len(day.Placemarks))
+	}
+
+	falls := day.Placemarks[0]
+	if falls.Name != "1. Abbey Falls" || falls.Address != "Abbey Falls, Madikeri" || falls.StyleURL != "#day-1" {
+		t.Errorf("placemark %+v", falls)
+	}
+	if falls.Point == nil || falls.Point.Coordinates != "75.719100,12.455600,0" {
+		t.Errorf("coordinates %+v, want longitude first", falls.Point)
+	}
+	if falls.TimeSpan == nil || falls.TimeSpan.Begin != "2025-11-01T10:00:00" || falls.TimeSpan.End != "2025-11-01T11:30:00" {
+		t.Errorf("time span %+v", falls.TimeSpan)
+	}
+
+	seat := day.Placemarks[1]
+	if seat.Name != "3. Raja's Seat" || seat.TimeSpan != nil {
+		t.Errorf("untimed placemark %+v", seat)
+	}
+
+	route := day.Placemarks[2]
+	if route.LineString == nil || route.LineString.Coordinates != "75.719100,12.455600,0 75.737600,12.420700,0" {
+		t.Errorf("route %+v", route.LineString)
+	}
+
+	if empty := doc.Document.Folders[1]; empty.Name != "Day 2" || len(empty.Placemarks) != 0 {
+		t.Errorf("day 2 is %q with %d placemarks, want none", empty.Name, len(empty.Placemarks))
+	}
+}
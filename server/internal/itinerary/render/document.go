@@ -0,0 +1,223 @@
+package render
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary/export"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+// document is the layout-independent view of an itinerary shared by the HTML and PDF renderers
+type document struct {
+	Title     string
+	Dates     string
+	Currency  string
+	Version   int
+	Generated string
+	Warnings  []string
+	Days      []dayView
+	Budget    budget
+	Map       mapView
+}
+
+type dayView struct {
+	Day   int
+	Label string
+	Title string // "Day 1 – Arrival"
+	Date  string // "Saturday, 1 November 2025"
+	Color string
+	Items []itemView
+	Total float64
+}
+
+type itemView struct {
+	Index    int
+	Time     string // "09:00 – 11:30"
+	Title    string
+	Location string
+	Category string
+	Notes    string
+	Cost     string // formatted, empty when unknown
+}
+
+type budget struct {
+	Days       []budgetLine
+	Categories []budgetLine
+	Total      string
+}
+
+type budgetLine struct {
+	Label  string
+	Amount string
+}
+
+func (b budget) Empty() bool {
+	return b.Total == ""
+}
+
+func newDocument(v *models.ItineraryVersion) *document {
+	itin := &v.Data
+	doc := &document{
+		Title:     itin.Destination,
+		Currency:  itin.Currency,
+		Version:   v.Version,
+		Generated: v.CreatedAt.Format("2 Jan 2006 15:04 MST"),
+		Warnings:  itin.Warnings,
+	}
+
+	if doc.Title == "" {
+		doc.Title = "Your trip"
+	}
+
+	doc.Dates = formatDates(itin.StartDate, itin.EndDate)
+
+	stops := export.Stops(v)
+	categories := make(map[string]float64)
+	var total float64
+	var costed bool
+
+	for d, day := range itin.Days {
+		view := dayView{
+			Day:   day.Day,
+			Label: day.Label,
+			Title: fmt.Sprintf("Day %d", day.Day),
+			Color: export.DayColor(d),
+		}
+		if day.Label != "" {
+			view.Title += " – " + day.Label
+		}
+
+		for _, s := range stops {
+			if s.DayIndex != d {
+				continue
+			}
+
+			if view.Date == "" && !s.Date.IsZero() {
+				view.Date = s.Date.Format("Monday, 2 January 2006")
+			}
+
+			item := itemView{
+				Index:    s.Index,
+				Time:     timeRange(s.Item.StartTime, s.Item.EndTime),
+				Title:    s.Item.Title,
+				Location: s.Location(),
+				Category: s.Item.Category,
+				Notes:    s.Item.Notes,
+			}
+
+			if s.Item.Cost > 0 {
+				costed = true
+				item.Cost = formatAmount(itin.Currency, s.Item.Cost)
+				view.Total += s.Item.Cost
+				total += s.Item.Cost
+
+				category := s.Item.Category
+				if category == "" {
+					category = "other"
+				}
+				categories[category] += s.Item.Cost
+			}
+
+			view.Items = append(view.Items, item)
+		}
+
+		if view.Date == "" {
+			if start, err := time.Parse("2006-01-02", itin.StartDate); err == nil {
+				view.Date = start.AddDate(0, 0, d).Format("Monday, 2 January 2006")
+			}
+		}
+
+		doc.Days = append(doc.Days, view)
+	}
+
+	if costed {
+		for _, day := range doc.Days {
+			doc.Budget.Days = append(doc.Budget.Days, budgetLine{day.Title, formatAmount(itin.Currency, day.Total)})
+		}
+
+		names := make([]string, 0, len(categories))
+		for name := range categories {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return categories[names[i]] > categories[names[j]] })
+
+		for _, name := range names {
+			doc.Budget.Categories = append(doc.Budget.Categories, budgetLine{capitalise(name), formatAmount(itin.Currency, categories[name])})
+		}
+
+		doc.Budget.Total = formatAmount(itin.Currency, total)
+	}
+
+	doc.Map = newMap(stops, mapWidth, mapHeight)
+
+	return doc
+}
+
+func formatDates(start, end string) string {
+	s, errStart := time.Parse("2006-01-02", start)
+	e, errEnd := time.Parse("2006-01-02", end)
+
+	switch {
+	case errStart != nil:
+		return ""
+	case errEnd != nil || s.Equal(e):
+		return s.Format("2 January 2006")
+	case s.Year() != e.Year():
+		return s.Format("2 January 2006") + " – " + e.Format("2 January 2006")
+	case s.Month() != e.Month():
+		return s.Format("2 January") + " – " + e.Format("2 January 2006")
+	default:
+		return s.Format("2") + " – " + e.Format("2 January 2006")
+	}
+}
+
+func timeRange(start, end string) string {
+	switch {
+	case start != "" && end != "":
+		return start + " – " + end
+	case start != "":
+		return start
+	default:
+		return ""
+	}
+}
+
+// formatAmount renders an amount with thousands separators, e.g. "INR 12,500"
+func formatAmount(currency string, amount float64) string {
+	whole := math.Floor(amount)
+	cents := int(math.Round((amount - whole) * 100))
+	if cents == 100 {
+		whole, cents = whole+1, 0
+	}
+
+	digits := fmt.Sprintf("%.0f", whole)
+	var b strings.Builder
+	for i, r := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+
+	out := b.String()
+	if cents > 0 {
+		out += fmt.Sprintf(".%02d", cents)
+	}
+
+	if currency != "" {
+		out = currency + " " + out
+	}
+
+	return out
+}
+
+func capitalise(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,35 @@
+package render
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"regexp"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+//go:embed templates/print.html templates/itinerary.md
+var templates embed.FS
+
+var hexColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+var printTemplate = template.Must(template.New("print.html").Funcs(template.FuncMap{
+	// day colours come from a fixed palette, only allow plain hex values through
+	"safeCSS": func(s string) template.CSS {
+		if !hexColor.MatchString(s) {
+			return ""
+		}
+		return template.CSS(s)
+	},
+}).ParseFS(templates, "templates/print.html"))
+
+// HTML renders a self-contained, print-friendly HTML document of an itinerary version
+func HTML(v *models.ItineraryVersion) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := printTemplate.Execute(&buf, newDocument(v)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,122 @@
+package render
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary/export"
+)
+
+const (
+	mapWidth   = 495.0
+	mapHeight  = 260.0
+	mapPadding = 24.0
+)
+
+// mapView is a static overview map of the stops, projected into a box with the origin at
+// the top left (SVG convention). It has no base tiles, just the stops and day routes.
+type mapView struct {
+	Width, Height float64
+	Routes        []mapRoute
+	Points        []mapPoint
+}
+
+type mapRoute struct {
+	Color  string
+	Points []mapXY
+}
+
+type mapPoint struct {
+	mapXY
+	Color string
+	Label string // "1.2" = day 1, stop 2
+}
+
+type mapXY struct {
+	X, Y float64
+}
+
+func (m mapView) Empty() bool {
+	return len(m.Points) == 0
+}
+
+// SVGPoints returns the route as an SVG polyline points attribute
+func (r mapRoute) SVGPoints() string {
+	var out string
+	for i, p := range r.Points {
+		if i > 0 {
+			out += " "
+		}
+		out += fmt.Sprintf("%.1f,%.1f", p.X, p.Y)
+	}
+	return out
+}
+
+// newMap projects geocoded stops with an equirectangular projection scaled by the
+// cosine of the mean latitude, which is accurate enough at trip scale
+func newMap(stops []export.Stop, width, height float64) mapView {
+	m := mapView{Width: width, Height: height}
+
+	var geo []export.Stop
+	for _, s := range stops {
+		if s.Item.HasCoords() {
+			geo = append(geo, s)
+		}
+	}
+	if len(geo) == 0 {
+		return m
+	}
+
+	minLat, maxLat := geo[0].Item.Lat, geo[0].Item.Lat
+	minLon, maxLon := geo[0].Item.Lon, geo[0].Item.Lon
+	for _, s := range geo {
+		minLat, maxLat = math.Min(minLat, s.Item.Lat), math.Max(maxLat, s.Item.Lat)
+		minLon, maxLon = math.Min(minLon, s.Item.Lon), math.Max(maxLon, s.Item.Lon)
+	}
+
+	k := math.Cos((minLat + maxLat) / 2 * math.Pi / 180)
+	spanX := (maxLon - minLon) * k
+	spanY := maxLat - minLat
+
+	// fit the stops in the box, but don't zoom in further than ~2 km across
+	// so a single stop or a handful of nearby ones still render sensibly
+	usableW, usableH := width-2*mapPadding, height-2*mapPadding
+	scale := math.Min(usableW/math.Max(spanX, 1e-6), usableH/math.Max(spanY, 1e-6))
+	scale = math.Min(scale, usableW/0.02)
+
+	// centre the drawing in the box
+	offX := (width - spanX*scale) / 2
+	offY := (height - spanY*scale) / 2
+
+	project := func(lat, lon float64) mapXY {
+		return mapXY{
+			X: offX + (lon-minLon)*k*scale,
+			Y: offY + (maxLat-lat)*scale,
+		}
+	}
+
+	routes := make(map[int]*mapRoute)
+	var order []int
+	for _, s := range geo {
+		xy := project(s.Item.Lat, s.Item.Lon)
+		color := export.DayColor(s.DayIndex)
+
+		m.Points = append(m.Points, mapPoint{mapXY: xy, Color: color, Label: fmt.Sprintf("%d.%d", s.Day, s.Index)})
+
+		r, ok := routes[s.DayIndex]
+		if !ok {
+			r = &mapRoute{Color: color}
+			routes[s.DayIndex] = r
+			order = append(order, s.DayIndex)
+		}
+		r.Points = append(r.Points, xy)
+	}
+
+	for _, day := range order {
+		if len(routes[day].Points) > 1 {
+			m.Routes = append(m.Routes, *routes[day])
+		}
+	}
+
+	return m
+}
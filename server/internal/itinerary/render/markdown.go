@@ -0,0 +1,44 @@
+package render
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+// markdownEscaper escapes the characters that would otherwise turn titles and notes into markup
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`, `<`, `\<`, `>`, `\>`, `|`, `\|`, `#`, `\#`,
+)
+
+var markdownTemplate = template.Must(template.New("itinerary.md").Funcs(template.FuncMap{
+	// collapses line breaks too, so notes stay inside their list item
+	"md": func(s string) string {
+		return markdownEscaper.Replace(strings.Join(strings.Fields(s), " "))
+	},
+	"details": func(item itemView) string {
+		var parts []string
+		for _, p := range []string{item.Location, item.Category, item.Cost} {
+			if p != "" {
+				parts = append(parts, markdownEscaper.Replace(p))
+			}
+		}
+		return strings.Join(parts, " · ")
+	},
+	"amount": formatAmount,
+}).ParseFS(templates, "templates/itinerary.md"))
+
+// Markdown renders the canonical Markdown of an itinerary, the same plan users see in the chat
+func Markdown(itin *itinerary.Itinerary) (string, error) {
+	doc := newDocument(&models.ItineraryVersion{Data: *itin})
+
+	var buf bytes.Buffer
+	if err := markdownTemplate.Execute(&buf, doc); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,315 @@
+package render
+
+import (
+	"fmt"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+const (
+	margin       = 50.0
+	footerHeight = 30.0
+	contentWidth = pageWidth - 2*margin
+
+	colorText  = "#1f2933"
+	colorMuted = "#52606d"
+	colorRule  = "#cbd2d9"
+	colorPanel = "#f5f7fa"
+	colorWarn  = "#fffbea"
+
+	timeColumn = 78.0 // width of the time column in the day timeline
+	costColumn = 80.0 // width reserved for item costs
+	lineGap    = 1.35 // line height as a multiple of font size
+)
+
+// pdfLayout flows the document top to bottom, starting new pages as needed
+type pdfLayout struct {
+	*pdfWriter
+	y   float64 // current baseline position, PDF origin is bottom left
+	doc *document
+}
+
+// PDF renders a paginated A4 PDF of an itinerary version
+func PDF(v *models.ItineraryVersion) ([]byte, error) {
+	l := &pdfLayout{pdfWriter: &pdfWriter{}, doc: newDocument(v)}
+	l.newPage()
+
+	l.header()
+	l.warnings()
+	l.overviewMap()
+	for _, day := range l.doc.Days {
+		l.day(day)
+	}
+	l.budget()
+	l.footers()
+
+	return l.bytes(l.doc.Title + " itinerary")
+}
+
+func (l *pdfLayout) newPage() {
+	l.pdfWriter.newPage()
+	l.y = pageHeight - margin
+}
+
+// ensure starts a new page unless height points still fit above the footer
+func (l *pdfLayout) ensure(height float64) {
+	if l.y-height < margin+footerHeight {
+		l.newPage()
+	}
+}
+
+// paragraph writes wrapped text and moves the cursor below it
+func (l *pdfLayout) paragraph(x, width float64, font string, size float64, color string, s string) {
+	for _, line := range wrap(s, font, size, width) {
+		l.y -= size * lineGap
+		l.text(x, l.y, font, size, color, line)
+	}
+}
+
+func (l *pdfLayout) heading(s string) {
+	l.ensure(40)
+	l.y -= 22
+	l.text(margin, l.y, fontBold, 15, colorText, s)
+	l.y -= 8
+}
+
+func (l *pdfLayout) header() {
+	l.paragraph(margin, contentWidth, fontBold, 24, colorText, l.doc.Title)
+
+	meta := fmt.Sprintf("%d day", len(l.doc.Days))
+	if len(l.doc.Days) != 1 {
+		meta += "s"
+	}
+	if l.doc.Dates != "" {
+		meta = l.doc.Dates + " · " + meta
+	}
+	if l.doc.Currency != "" {
+		meta += " · Prices in " + l.doc.Currency
+	}
+
+	l.y -= 4
+	l.paragraph(margin, contentWidth, fontRegular, 11, colorMuted, meta)
+	l.y -= 8
+	l.line(margin, l.y, pageWidth-margin, l.y, colorText, 2)
+	l.y -= 6
+}
+
+func (l *pdfLayout) warnings() {
+	if len(l.doc.Warnings) == 0 {
+		return
+	}
+
+	var lines []string
+	for _, w := range l.doc.Warnings {
+		lines = append(lines, wrap("• "+w, fontRegular, 9, contentWidth-20)...)
+	}
+
+	height := 24 + float64(len(lines))*9*lineGap
+	l.ensure(height + 10)
+	l.y -= 10
+	l.rect(margin, l.y-height, contentWidth, height, colorWarn)
+
+	l.y -= 14
+	l.text(margin+10, l.y, fontBold, 10, colorText, "Check before you go")
+	l.y -= 2
+	for _, line := range lines {
+		l.y -= 9 * lineGap
+		l.text(margin+10, l.y, fontRegular, 9, colorText, line)
+	}
+	l.y -= 8
+}
+
+func (l *pdfLayout) overviewMap() {
+	m := l.doc.Map
+	if m.Empty() {
+		return
+	}
+
+	l.heading("Overview")
+	l.ensure(m.Height + 30)
+
+	top := l.y
+	l.rect(margin, top-m.Height, m.Width, m.Height, colorPanel)
+	l.strokeRect(margin, top-m.Height, m.Width, m.Height, colorRule, 0.5)
+
+	// map coordinates have a top-left origin
+	at := func(p mapXY) [2]float64 {
+		return [2]float64{margin + p.X, top - p.Y}
+	}
+
+	for _, r := range m.Routes {
+		var points [][2]float64
+		for _, p := range r.Points {
+			points = append(points, at(p))
+		}
+		l.polyline(points, r.Color, 1.5)
+	}
+
+	for _, p := range m.Points {
+		xy := at(p.mapXY)
+		l.circle(xy[0], xy[1], 4, p.Color)
+		l.text(xy[0]+6, xy[1]+4, fontRegular, 7, colorText, p.Label)
+	}
+
+	l.y = top - m.Height - 14
+
+	// legend
+	x := margin
+	for _, day := range l.doc.Days {
+		width := 12 + textWidth(day.Title, fontRegular, 8) + 14
+		if x+width > pageWidth-margin {
+			x = margin
+			l.y -= 12
+		}
+		l.circle(x+4, l.y+3, 3.5, day.Color)
+		l.text(x+11, l.y, fontRegular, 8, colorMuted, day.Title)
+		x += width
+	}
+	l.y -= 6
+}
+
+// itemLines wraps an item up front so its height is known before it is drawn
+func (l *pdfLayout) itemLines(item itemView, width float64) (title, detail, notes []string) {
+	title = wrap(item.Title, fontBold, 11, width)
+
+	var d string
+	switch {
+	case item.Location != "" && item.Category != "":
+		d = item.Location + " · " + item.Category
+	default:
+		d = item.Location + item.Category
+	}
+	if d != "" {
+		detail = wrap(d, fontRegular, 9, width)
+	}
+
+	if item.Notes != "" {
+		notes = wrap(item.Notes, fontRegular, 9, width)
+	}
+
+	return title, detail, notes
+}
+
+func (l *pdfLayout) day(day dayView) {
+	textX := margin + timeColumn + 26
+	width := pageWidth - margin - costColumn - textX
+	railX := margin + timeColumn + 12
+
+	// keep the header with at least the first item
+	first := 60.0
+	if len(day.Items) > 0 {
+		t, d, n := l.itemLines(day.Items[0], width)
+		first += float64(len(t))*11*lineGap + float64(len(d)+len(n))*9*lineGap + 12
+	}
+	l.ensure(first)
+
+	l.y -= 18
+	headerTop := l.y
+	headerHeight := 36.0
+	if day.Date == "" {
+		headerHeight = 24
+	}
+	l.rect(margin, headerTop-headerHeight, contentWidth, headerHeight, colorPanel)
+	l.rect(margin, headerTop-headerHeight, 5, headerHeight, day.Color)
+
+	l.y = headerTop - 17
+	l.text(margin+14, l.y, fontBold, 14, colorText, day.Title)
+	if day.Date != "" {
+		l.y -= 13
+		l.text(margin+14, l.y, fontRegular, 9, colorMuted, day.Date)
+	}
+	l.y = headerTop - headerHeight - 4
+
+	if len(day.Items) == 0 {
+		l.y -= 14
+		l.text(textX, l.y, fontRegular, 9, colorMuted, "Nothing planned yet.")
+		return
+	}
+
+	for _, item := range day.Items {
+		title, detail, notes := l.itemLines(item, width)
+		height := float64(len(title))*11*lineGap + float64(len(detail)+len(notes))*9*lineGap + 12
+		l.ensure(height)
+
+		top := l.y
+		l.line(railX, top, railX, top-height, colorRule, 1.5)
+
+		l.y -= 6
+		baseline := l.y - 11*lineGap + 2
+		l.circle(railX, baseline+4, 4.5, day.Color)
+		if item.Time != "" {
+			l.textRight(margin+timeColumn, baseline, fontBold, 9, colorText, item.Time)
+		}
+		if item.Cost != "" {
+			l.textRight(pageWidth-margin, baseline, fontRegular, 9, colorMuted, item.Cost)
+		}
+
+		for _, line := range title {
+			l.y -= 11 * lineGap
+			l.text(textX, l.y, fontBold, 11, colorText, line)
+		}
+		for _, line := range detail {
+			l.y -= 9 * lineGap
+			l.text(textX, l.y, fontRegular, 9, colorMuted, line)
+		}
+		for _, line := range notes {
+			l.y -= 9 * lineGap
+			l.text(textX, l.y, fontRegular, 9, colorText, line)
+		}
+
+		l.y = top - height
+	}
+
+	if day.Total > 0 {
+		l.y -= 12
+		l.textRight(pageWidth-margin, l.y, fontBold, 9, colorText,
+			"Day total: "+formatAmount(l.doc.Currency, day.Total))
+	}
+}
+
+func (l *pdfLayout) budget() {
+	b := l.doc.Budget
+	if b.Empty() {
+		return
+	}
+
+	rows := len(b.Days) + len(b.Categories) + 3
+	l.ensure(40 + float64(rows)*16)
+	l.heading("Budget summary")
+
+	table := func(title string, lines []budgetLine) {
+		l.y -= 16
+		l.text(margin, l.y, fontBold, 10, colorMuted, title)
+		l.textRight(pageWidth-margin, l.y, fontBold, 10, colorMuted, "Estimated")
+		for _, line := range lines {
+			l.y -= 4
+			l.line(margin, l.y, pageWidth-margin, l.y, colorRule, 0.5)
+			l.y -= 12
+			l.text(margin, l.y, fontRegular, 10, colorText, line.Label)
+			l.textRight(pageWidth-margin, l.y, fontRegular, 10, colorText, line.Amount)
+		}
+	}
+
+	table("Day", b.Days)
+
+	l.y -= 5
+	l.line(margin, l.y, pageWidth-margin, l.y, colorText, 1.5)
+	l.y -= 14
+	l.text(margin, l.y, fontBold, 11, colorText, "Total")
+	l.textRight(pageWidth-margin, l.y, fontBold, 11, colorText, b.Total)
+
+	l.y -= 10
+	table("Category", b.Categories)
+}
+
+// footers stamps every page once the page count is known
+func (l *pdfLayout) footers() {
+	left := fmt.Sprintf("Kaiyo AI · %s · version %d · generated %s", l.doc.Title, l.doc.Version, l.doc.Generated)
+
+	for i, page := range l.pages {
+		l.page = page
+		l.line(margin, margin, pageWidth-margin, margin, colorRule, 0.5)
+		l.text(margin, margin-12, fontRegular, 7, colorMuted, left)
+		l.textRight(pageWidth-margin, margin-12, fontRegular, 7, colorMuted, fmt.Sprintf("Page %d of %d", i+1, len(l.pages)))
+	}
+}
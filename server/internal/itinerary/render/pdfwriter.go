@@ -0,0 +1,261 @@
+package render
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A minimal PDF 1.4 writer: A4 pages, the standard Helvetica fonts with WinAnsi encoding,
+// text, lines, rectangles and circles. Enough for a printable itinerary without a
+// third-party dependency.
+
+const (
+	pageWidth  = 595.28 // A4 in points
+	pageHeight = 841.89
+
+	fontRegular = "F1"
+	fontBold    = "F2"
+)
+
+// Helvetica advance widths for ASCII 32..126, in 1/1000 em (from the Adobe AFM files)
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+// winAnsi maps the non-Latin-1 characters we're likely to meet onto WinAnsiEncoding
+var winAnsi = map[rune]byte{
+	'€': 0x80, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94,
+	'•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+type pdfWriter struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+}
+
+func (w *pdfWriter) newPage() {
+	w.page = &bytes.Buffer{}
+	w.pages = append(w.pages, w.page)
+}
+
+// encode converts text to WinAnsi bytes, characters outside it become '?'
+func encode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '\t':
+			out = append(out, ' ')
+		case r < 0x20:
+			continue
+		case r < 0x80 || (r >= 0xA0 && r <= 0xFF):
+			out = append(out, byte(r))
+		default:
+			if b, ok := winAnsi[r]; ok {
+				out = append(out, b)
+			} else {
+				out = append(out, '?')
+			}
+		}
+	}
+	return out
+}
+
+func textWidth(s string, font string, size float64) float64 {
+	widths := &helveticaWidths
+	if font == fontBold {
+		widths = &helveticaBoldWidths
+	}
+
+	total := 0
+	for _, b := range encode(s) {
+		if b >= 32 && b <= 126 {
+			total += widths[b-32]
+		} else {
+			total += 556
+		}
+	}
+
+	return float64(total) * size / 1000
+}
+
+// wrap breaks text into lines no wider than width, splitting overlong words
+func wrap(s string, font string, size, width float64) []string {
+	var lines []string
+
+	for _, paragraph := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+
+			if textWidth(candidate, font, size) <= width {
+				line = candidate
+				continue
+			}
+
+			if line != "" {
+				lines = append(lines, line)
+			}
+
+			// hard-break words that don't fit on a line of their own
+			for textWidth(word, font, size) > width {
+				cut := len([]rune(word))
+				for cut > 1 && textWidth(string([]rune(word)[:cut]), font, size) > width {
+					cut--
+				}
+				lines = append(lines, string([]rune(word)[:cut]))
+				word = string([]rune(word)[cut:])
+			}
+			line = word
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func pdfString(s string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, c := range encode(s) {
+		if c == '(' || c == ')' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// rgb converts "#rrggbb" into PDF colour operands
+func rgb(hex string) string {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) != 6 {
+		return "0 0 0"
+	}
+
+	var c [3]float64
+	for i := range c {
+		v, _ := strconv.ParseUint(hex[i*2:i*2+2], 16, 8)
+		c[i] = float64(v) / 255
+	}
+
+	return fmt.Sprintf("%.3f %.3f %.3f", c[0], c[1], c[2])
+}
+
+func (w *pdfWriter) text(x, y float64, font string, size float64, color string, s string) {
+	fmt.Fprintf(w.page, "BT %s rg /%s %.1f Tf %.2f %.2f Td %s Tj ET\n", rgb(color), font, size, x, y, pdfString(s))
+}
+
+// textRight draws text ending at x
+func (w *pdfWriter) textRight(x, y float64, font string, size float64, color string, s string) {
+	w.text(x-textWidth(s, font, size), y, font, size, color, s)
+}
+
+func (w *pdfWriter) rect(x, y, width, height float64, fill string) {
+	fmt.Fprintf(w.page, "%s rg %.2f %.2f %.2f %.2f re f\n", rgb(fill), x, y, width, height)
+}
+
+func (w *pdfWriter) strokeRect(x, y, width, height float64, color string, lineWidth float64) {
+	fmt.Fprintf(w.page, "%s RG %.2f w %.2f %.2f %.2f %.2f re S\n", rgb(color), lineWidth, x, y, width, height)
+}
+
+func (w *pdfWriter) line(x1, y1, x2, y2 float64, color string, lineWidth float64) {
+	fmt.Fprintf(w.page, "%s RG %.2f w %.2f %.2f m %.2f %.2f l S\n", rgb(color), lineWidth, x1, y1, x2, y2)
+}
+
+// polyline strokes a dashed path through points
+func (w *pdfWriter) polyline(points [][2]float64, color string, lineWidth float64) {
+	if len(points) < 2 {
+		return
+	}
+
+	fmt.Fprintf(w.page, "%s RG %.2f w 1 j [5 3] 0 d %.2f %.2f m", rgb(color), lineWidth, points[0][0], points[0][1])
+	for _, p := range points[1:] {
+		fmt.Fprintf(w.page, " %.2f %.2f l", p[0], p[1])
+	}
+	fmt.Fprint(w.page, " S [] 0 d\n")
+}
+
+// circle draws a filled circle with a white outline using four Bézier arcs
+func (w *pdfWriter) circle(cx, cy, r float64, fill string) {
+	const k = 0.5523 // control point distance for a quarter circle
+	o := r * k
+
+	fmt.Fprintf(w.page, "%s rg 1 1 1 RG 1 w %.2f %.2f m ", rgb(fill), cx+r, cy)
+	fmt.Fprintf(w.page, "%.2f %.2f %.2f %.2f %.2f %.2f c ", cx+r, cy+o, cx+o, cy+r, cx, cy+r)
+	fmt.Fprintf(w.page, "%.2f %.2f %.2f %.2f %.2f %.2f c ", cx-o, cy+r, cx-r, cy+o, cx-r, cy)
+	fmt.Fprintf(w.page, "%.2f %.2f %.2f %.2f %.2f %.2f c ", cx-r, cy-o, cx-o, cy-r, cx, cy-r)
+	fmt.Fprintf(w.page, "%.2f %.2f %.2f %.2f %.2f %.2f c B\n", cx+o, cy-r, cx+r, cy-o, cx+r, cy)
+}
+
+// bytes serialises the document with an object per font, page and compressed content stream
+func (w *pdfWriter) bytes(title string) ([]byte, error) {
+	var out bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1 catalog, 2 page tree, 3-4 fonts, 5 info, then a page and content stream per page
+	kids := make([]string, len(w.pages))
+	for i := range w.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+i*2)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(w.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object(fmt.Sprintf("<< /Title %s /Producer (Kaiyo AI) >>", pdfString(title)))
+
+	for i, page := range w.pages {
+		object(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, fontRegular, fontBold, 7+i*2))
+
+		var stream bytes.Buffer
+		zw := zlib.NewWriter(&stream)
+		if _, err := zw.Write(page.Bytes()); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+
+		object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", stream.Len(), stream.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f\r\n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n\r\n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,62 @@
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+// the validator only warns about day numbers that don't match their position, so renderers see them
+func misnumbered() itinerary.Itinerary {
+	return itinerary.Itinerary{
+		Destination: "Coorg",
+		StartDate:   "2025-11-01",
+		EndDate:     "2025-11-02",
+		Days: []itinerary.DayPlan{
+			{Day: 0, Label: "Arrival", Items: []itinerary.DayItem{
+				{Title: "Abbey Falls", StartTime: "10:00", Lat: 12.4556, Lon: 75.7191},
+			}},
+			{Day: 0, Label: "Plantations", Items: []itinerary.DayItem{
+				{Title: "Coffee estate", StartTime: "09:00", Lat: 12.3375, Lon: 75.8069},
+				{Title: "Dubare", StartTime: "14:00", Lat: 12.3685, Lon: 75.9075},
+			}},
+		},
+	}
+}
+
+func TestMarkdownMisnumberedDays(t *testing.T) {
+	itin := misnumbered()
+	out, err := Markdown(&itin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arrival, plantations := strings.Index(out, "Arrival"), strings.Index(out, "Plantations")
+	if arrival < 0 || plantations < 0 {
+		t.Fatalf("missing a day:\n%s", out)
+	}
+	// each stop is listed once, under its own day
+	if i := strings.Index(out, "Coffee estate"); i < plantations || strings.Count(out, "Coffee estate") != 1 {
+		t.Errorf("coffee estate listed out of place:\n%s", out)
+	}
+}
+
+func TestMapMisnumberedDays(t *testing.T) {
+	doc := newDocument(&models.ItineraryVersion{Data: misnumbered()})
+	if len(doc.Days[0].Items) != 1 || len(doc.Days[1].Items) != 2 {
+		t.Errorf("days have %d and %d items, want 1 and 2", len(doc.Days[0].Items), len(doc.Days[1].Items))
+	}
+	if len(doc.Map.Points) != 3 || len(doc.Map.Routes) != 1 || len(doc.Map.Routes[0].Points) != 2 {
+		t.Errorf("map has %d points and routes %+v, want 3 points and one 2 stop route", len(doc.Map.Points), doc.Map.Routes)
+	}
+	if doc.Map.Points[0].Color == doc.Map.Points[1].Color {
+		t.Error("days share a map colour")
+	}
+
+	v := &models.ItineraryVersion{Data: misnumbered()}
+	if _, err := PDF(v); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,64 @@
+package itinerary
+
+import "strings"
+
+type Itinerary struct {
+	Destination string    `json:"destination"`         // e.g., "Coorg"
+	StartDate   string    `json:"startDate,omitempty"` // ISO date string, e.g., "2025-11-01"
+	EndDate     string    `json:"endDate,omitempty"`   // ISO date string, e.g., "2025-11-03"
+	Currency    string    `json:"currency,omitempty"`  // e.g., "INR", "USD"
+	Days        []DayPlan `json:"days"`                // Day-wise plan
+	Warnings    []string  `json:"warnings,omitempty"`  // Unresolved validation issues shown to the user
+}
+
+type DayPlan struct {
+	Day   int       `json:"day"`             // 1-based day index
+	Label string    `json:"label,omitempty"` // Optional label, e.g., "Arrival", "Trek day"
+	Items []DayItem `json:"items"`           // Stops/activities for the day
+}
+
+type DayItem struct {
+	Title     string  `json:"title"`               // Activity/title, e.g., "Tadiandamol Trek"
+	City      string  `json:"city,omitempty"`      // City/town context, e.g., "Madikeri"
+	Place     string  `json:"place,omitempty"`     // POI name, e.g., "Abbey Falls"
+	Category  string  `json:"category,omitempty"`  // e.g., "sightseeing", "food", "trek"
+	StartTime string  `json:"startTime,omitempty"` // "09:00" (24h) or ISO time
+	EndTime   string  `json:"endTime,omitempty"`   // "11:30"
+	Notes     string  `json:"notes,omitempty"`     // Free-form notes
+	Cost      float64 `json:"cost,omitempty"`      // Estimated cost in the itinerary currency
+	Lat       float64 `json:"lat,omitempty"`       // Geocoded latitude
+	Lon       float64 `json:"lon,omitempty"`       // Geocoded longitude
+}
+
+// Key identifies an item across versions by its title and place
+func (i DayItem) Key() string {
+	return strings.ToLower(strings.TrimSpace(i.Title)) + "|" + strings.ToLower(strings.TrimSpace(i.Place))
+}
+
+// HasCoords reports whether the item has been geocoded
+func (i DayItem) HasCoords() bool {
+	return i.Lat != 0 || i.Lon != 0
+}
+
+// Violation describes a single consistency problem found in an itinerary
+type Violation struct {
+	Code    string `json:"code"`
+	Day     int    `json:"day,omitempty"`  // 1-based day index, 0 for itinerary-wide issues
+	Item    int    `json:"item,omitempty"` // 1-based item index within the day, 0 for day-wide issues
+	Message string `json:"message"`
+}
+
+// Violations is the result of validating an itinerary
+type Violations []Violation
+
+// Violation codes
+const (
+	CodeInvalidDate = "invalid_date"
+	CodeDayMismatch = "day_mismatch"
+	CodeDayGap      = "day_gap"
+	CodeInvalidTime = "invalid_time"
+	CodeOverlap     = "overlap"
+	CodeOutOfOrder  = "out_of_order"
+	CodeUnreachable = "unreachable"
+	CodeFarFromCity = "far_from_city"
+)
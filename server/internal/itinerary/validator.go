@@ -0,0 +1,278 @@
+package itinerary
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	DateLayout = "2006-01-02"
+
+	defaultTravelSpeedKmh = 40.0 // conservative door-to-door speed including traffic
+	defaultCityRadiusKm   = 50.0
+	earthRadiusKm         = 6371.0
+)
+
+var timeLayouts = []string{"15:04", "15:04:05", "3:04 PM", "3:04PM", time.RFC3339, "2006-01-02T15:04", "2006-01-02T15:04:05"}
+
+// CityLocator resolves a city name to coordinates, e.g. by geocoding
+type CityLocator func(ctx context.Context, city string) (lat float64, lon float64, err error)
+
+type Validator struct {
+	TravelSpeedKmh float64     // assumed speed between consecutive stops
+	CityRadiusKm   float64     // max distance of a stop from its stated city
+	LocateCity     CityLocator // optional, city proximity checks are skipped when nil
+}
+
+func NewValidator(locate CityLocator) *Validator {
+	return &Validator{
+		TravelSpeedKmh: defaultTravelSpeedKmh,
+		CityRadiusKm:   defaultCityRadiusKm,
+		LocateCity:     locate,
+	}
+}
+
+// Validate checks an itinerary for calendar, timing and geographic consistency
+func (v *Validator) Validate(ctx context.Context, itin *Itinerary) Violations {
+	var out Violations
+
+	out = append(out, v.checkDays(itin)...)
+
+	for _, day := range itin.Days {
+		out = append(out, v.checkDayItems(day)...)
+	}
+
+	out = append(out, v.checkCities(ctx, itin)...)
+
+	return out
+}
+
+// checkDays verifies day numbers are contiguous and match the date range
+func (v *Validator) checkDays(itin *Itinerary) Violations {
+	var out Violations
+
+	for i, day := range itin.Days {
+		if day.Day != i+1 {
+			out = append(out, Violation{
+				Code:    CodeDayGap,
+				Day:     day.Day,
+				Message: fmt.Sprintf("day at position %d is numbered %d, expected %d", i+1, day.Day, i+1),
+			})
+		}
+	}
+
+	if itin.StartDate == "" && itin.EndDate == "" {
+		return out
+	}
+
+	start, errStart := time.Parse(DateLayout, itin.StartDate)
+	if errStart != nil {
+		out = append(out, Violation{
+			Code:    CodeInvalidDate,
+			Message: fmt.Sprintf("startDate %q is not a YYYY-MM-DD date", itin.StartDate),
+		})
+	}
+
+	end, errEnd := time.Parse(DateLayout, itin.EndDate)
+	if errEnd != nil {
+		out = append(out, Violation{
+			Code:    CodeInvalidDate,
+			Message: fmt.Sprintf("endDate %q is not a YYYY-MM-DD date", itin.EndDate),
+		})
+	}
+
+	if errStart != nil || errEnd != nil {
+		return out
+	}
+
+	if end.Before(start) {
+		return append(out, Violation{
+			Code:    CodeInvalidDate,
+			Message: fmt.Sprintf("endDate %s is before startDate %s", itin.EndDate, itin.StartDate),
+		})
+	}
+
+	expected := int(end.Sub(start).Hours()/24) + 1
+	if expected != len(itin.Days) {
+		out = append(out, Violation{
+			Code:    CodeDayMismatch,
+			Message: fmt.Sprintf("%s to %s spans %d days but the plan has %d", itin.StartDate, itin.EndDate, expected, len(itin.Days)),
+		})
+	}
+
+	return out
+}
+
+// checkDayItems verifies times parse, items are in order, don't overlap and
+// consecutive stops are reachable in the gap between them
+func (v *Validator) checkDayItems(day DayPlan) Violations {
+	var out Violations
+
+	type slot struct {
+		idx        int
+		item       DayItem
+		start, end time.Time
+		hasStart   bool
+		hasEnd     bool
+	}
+
+	var prev *slot
+	for i, item := range day.Items {
+		cur := slot{idx: i + 1, item: item}
+
+		if item.StartTime != "" {
+			t, err := ParseClock(item.StartTime)
+			if err != nil {
+				out = append(out, Violation{
+					Code: CodeInvalidTime, Day: day.Day, Item: i + 1,
+					Message: fmt.Sprintf("%q has unparseable startTime %q", item.Title, item.StartTime),
+				})
+			} else {
+				cur.start, cur.hasStart = t, true
+			}
+		}
+
+		if item.EndTime != "" {
+			t, err := ParseClock(item.EndTime)
+			if err != nil {
+				out = append(out, Violation{
+					Code: CodeInvalidTime, Day: day.Day, Item: i + 1,
+					Message: fmt.Sprintf("%q has unparseable endTime %q", item.Title, item.EndTime),
+				})
+			} else {
+				cur.end, cur.hasEnd = t, true
+			}
+		}
+
+		if cur.hasStart && cur.hasEnd && cur.end.Before(cur.start) {
+			out = append(out, Violation{
+				Code: CodeInvalidTime, Day: day.Day, Item: i + 1,
+				Message: fmt.Sprintf("%q ends (%s) before it starts (%s)", item.Title, item.EndTime, item.StartTime),
+			})
+		}
+
+		if prev != nil && cur.hasStart {
+			if prev.hasStart && cur.start.Before(prev.start) {
+				out = append(out, Violation{
+					Code: CodeOutOfOrder, Day: day.Day, Item: cur.idx,
+					Message: fmt.Sprintf("%q starts at %s, before the previous item %q at %s", item.Title, item.StartTime, prev.item.Title, prev.item.StartTime),
+				})
+			} else if prev.hasEnd && cur.start.Before(prev.end) {
+				out = append(out, Violation{
+					Code: CodeOverlap, Day: day.Day, Item: cur.idx,
+					Message: fmt.Sprintf("%q starts at %s, before %q ends at %s", item.Title, item.StartTime, prev.item.Title, prev.item.EndTime),
+				})
+			} else if prev.hasEnd && prev.item.HasCoords() && item.HasCoords() {
+				gap := cur.start.Sub(prev.end)
+				dist := Distance(prev.item.Lat, prev.item.Lon, item.Lat, item.Lon)
+				need := time.Duration(dist / v.TravelSpeedKmh * float64(time.Hour))
+				if need > gap {
+					out = append(out, Violation{
+						Code: CodeUnreachable, Day: day.Day, Item: cur.idx,
+						Message: fmt.Sprintf("%q is %.0f km from %q, needing about %s of travel but only %s is planned",
+							item.Title, dist, prev.item.Title, need.Round(time.Minute), gap),
+					})
+				}
+			}
+		}
+
+		if cur.hasStart || cur.hasEnd {
+			p := cur
+			if !p.hasEnd && p.hasStart {
+				p.end, p.hasEnd = p.start, true
+			}
+			prev = &p
+		}
+	}
+
+	return out
+}
+
+// checkCities verifies geocoded stops fall near the city they claim to be in
+func (v *Validator) checkCities(ctx context.Context, itin *Itinerary) Violations {
+	if v.LocateCity == nil {
+		return nil
+	}
+
+	type point struct{ lat, lon float64 }
+	cities := make(map[string]*point)
+
+	var out Violations
+	for _, day := range itin.Days {
+		for i, item := range day.Items {
+			if item.City == "" || !item.HasCoords() {
+				continue
+			}
+
+			key := strings.ToLower(strings.TrimSpace(item.City))
+			center, seen := cities[key]
+			if !seen {
+				lat, lon, err := v.LocateCity(ctx, item.City)
+				if err == nil {
+					center = &point{lat, lon}
+				}
+				cities[key] = center // nil on failure, so we don't retry
+			}
+
+			if center == nil {
+				continue
+			}
+
+			if dist := Distance(center.lat, center.lon, item.Lat, item.Lon); dist > v.CityRadiusKm {
+				out = append(out, Violation{
+					Code: CodeFarFromCity, Day: day.Day, Item: i + 1,
+					Message: fmt.Sprintf("%q is %.0f km from %s, coordinates (%.5f, %.5f) look wrong",
+						item.Title, dist, item.City, item.Lat, item.Lon),
+				})
+			}
+		}
+	}
+
+	return out
+}
+
+// ParseClock parses an item time such as "09:00" or an ISO timestamp,
+// returning it as a time of day on the zero date
+func ParseClock(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return time.Date(0, 1, 1, t.Hour(), t.Minute(), t.Second(), 0, time.UTC), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognised time %q", s)
+}
+
+// Distance returns the great-circle distance between two points in km
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := func(d float64) float64 { return d * math.Pi / 180 }
+
+	dLat := rad(lat2 - lat1)
+	dLon := rad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// Strings renders the violations as human readable warnings
+func (vs Violations) Strings() []string {
+	out := make([]string, 0, len(vs))
+	for _, v := range vs {
+		switch {
+		case v.Day > 0 && v.Item > 0:
+			out = append(out, fmt.Sprintf("Day %d, item %d: %s", v.Day, v.Item, v.Message))
+		case v.Day > 0:
+			out = append(out, fmt.Sprintf("Day %d: %s", v.Day, v.Message))
+		default:
+			out = append(out, v.Message)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,192 @@
+package itinerary
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func codes(vs Violations) []string {
+	out := make([]string, 0, len(vs))
+	for _, v := range vs {
+		out = append(out, v.Code)
+	}
+	return out
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		itin Itinerary
+		want []string
+	}{
+		{
+			name: "consistent plan",
+			itin: Itinerary{
+				StartDate: "2025-11-01", EndDate: "2025-11-02",
+				Days: []DayPlan{
+					{Day: 1, Items: []DayItem{
+						{Title: "Breakfast", StartTime: "08:00", EndTime: "09:00"},
+						{Title: "Fort", StartTime: "09:30", EndTime: "11:00"},
+					}},
+					{Day: 2, Items: []DayItem{{Title: "Museum", StartTime: "10:00"}}},
+				},
+			},
+		},
+		{
+			name: "day zero is numbered out of position",
+			itin: Itinerary{Days: []DayPlan{{Day: 0}, {Day: 1}}},
+			want: []string{CodeDayGap, CodeDayGap},
+		},
+		{
+			name: "gap in day numbers",
+			itin: Itinerary{Days: []DayPlan{{Day: 1}, {Day: 3}}},
+			want: []string{CodeDayGap},
+		},
+		{
+			name: "repeated day number",
+			itin: Itinerary{Days: []DayPlan{{Day: 1}, {Day: 1}}},
+			want: []string{CodeDayGap},
+		},
+		{
+			name: "negative day number",
+			itin: Itinerary{Days: []DayPlan{{Day: -2}}},
+			want: []string{CodeDayGap},
+		},
+		{
+			name: "unparseable dates",
+			itin: Itinerary{StartDate: "1 Nov", EndDate: "2025-11-31", Days: []DayPlan{{Day: 1}}},
+			want: []string{CodeInvalidDate, CodeInvalidDate},
+		},
+		{
+			name: "end before start",
+			itin: Itinerary{StartDate: "2025-11-03", EndDate: "2025-11-01", Days: []DayPlan{{Day: 1}}},
+			want: []string{CodeInvalidDate},
+		},
+		{
+			name: "date range does not match the number of days",
+			itin: Itinerary{StartDate: "2025-11-01", EndDate: "2025-11-03", Days: []DayPlan{{Day: 1}, {Day: 2}}},
+			want: []string{CodeDayMismatch},
+		},
+		{
+			name: "bad and reversed times",
+			itin: Itinerary{Days: []DayPlan{{Day: 1, Items: []DayItem{
+				{Title: "A", StartTime: "morning"},
+				{Title: "B", StartTime: "14:00", EndTime: "13:00"},
+			}}}},
+			want: []string{CodeInvalidTime, CodeInvalidTime},
+		},
+		{
+			name: "out of order",
+			itin: Itinerary{Days: []DayPlan{{Day: 1, Items: []DayItem{
+				{Title: "A", StartTime: "12:00"},
+				{Title: "B", StartTime: "09:00"},
+			}}}},
+			want: []string{CodeOutOfOrder},
+		},
+		{
+			name: "overlap",
+			itin: Itinerary{Days: []DayPlan{{Day: 1, Items: []DayItem{
+				{Title: "A", StartTime: "09:00", EndTime: "11:00"},
+				{Title: "B", StartTime: "10:30"},
+			}}}},
+			want: []string{CodeOverlap},
+		},
+		{
+			name: "unreachable in the time between stops",
+			itin: Itinerary{Days: []DayPlan{{Day: 1, Items: []DayItem{
+				{Title: "Mumbai", StartTime: "09:00", EndTime: "10:00", Lat: 19.076, Lon: 72.8777},
+				{Title: "Pune", StartTime: "10:30", Lat: 18.5204, Lon: 73.8567},
+			}}}},
+			want: []string{CodeUnreachable},
+		},
+		{
+			name: "reachable with enough time",
+			itin: Itinerary{Days: []DayPlan{{Day: 1, Items: []DayItem{
+				{Title: "Mumbai", StartTime: "09:00", EndTime: "10:00", Lat: 19.076, Lon: 72.8777},
+				{Title: "Pune", StartTime: "15:00", Lat: 18.5204, Lon: 73.8567},
+			}}}},
+		},
+	}
+
+	v := NewValidator(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := codes(v.Validate(context.Background(), &tt.itin))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCities(t *testing.T) {
+	calls := 0
+	locate := func(ctx context.Context, city string) (float64, float64, error) {
+		calls++
+		if city == "Nowhere" {
+			return 0, 0, errors.New("not found")
+		}
+		return 12.4244, 75.7382, nil // Madikeri
+	}
+
+	itin := Itinerary{Days: []DayPlan{{Day: 1, Items: []DayItem{
+		{Title: "Abbey Falls", City: "Madikeri", Lat: 12.4556, Lon: 75.7191},
+		{Title: "Raja's Seat", City: "madikeri", Lat: 12.4207, Lon: 75.7376},
+		{Title: "Misplaced", City: "Madikeri", Lat: 28.6139, Lon: 77.2090},
+		{Title: "Unknown", City: "Nowhere", Lat: 1, Lon: 1},
+		{Title: "Unknown again", City: "Nowhere", Lat: 1, Lon: 1},
+	}}}}
+
+	got := NewValidator(locate).Validate(context.Background(), &itin)
+	if want := []string{CodeFarFromCity}; !slices.Equal(codes(got), want) {
+		t.Fatalf("got %v, want %v", codes(got), want)
+	}
+	if got[0].Day != 1 || got[0].Item != 3 {
+		t.Errorf("violation at day %d item %d, want day 1 item 3", got[0].Day, got[0].Item)
+	}
+	if calls != 2 {
+		t.Errorf("located cities %d times, want each city once", calls)
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		in      string
+		h, m    int
+		wantErr bool
+	}{
+		{in: "09:00", h: 9},
+		{in: " 17:45 ", h: 17, m: 45},
+		{in: "3:30 PM", h: 15, m: 30},
+		{in: "2025-11-01T07:15", h: 7, m: 15},
+		{in: "2025-11-01T07:15:00+05:30", h: 7, m: 15},
+		{in: "noon", wantErr: true},
+		{in: "25:00", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseClock(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseClock(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (got.Hour() != tt.h || got.Minute() != tt.m) {
+			t.Errorf("ParseClock(%q) = %s, want %02d:%02d", tt.in, got.Format("15:04"), tt.h, tt.m)
+		}
+	}
+}
+
+func TestViolationStrings(t *testing.T) {
+	vs := Violations{
+		{Day: 2, Item: 3, Message: "a"},
+		{Day: 2, Message: "b"},
+		{Message: "c"},
+	}
+
+	want := []string{"Day 2, item 3: a", "Day 2: b", "c"}
+	if got := vs.Strings(); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,146 @@
+// Package mail sends transactional email through SMTP, or logs or stores it during development
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// Mailer delivers messages. Implementations must be safe for concurrent use
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// sendTimeout bounds the delivery of a message sent with SendAsync
+const sendTimeout = 30 * time.Second
+
+// SendAsync delivers msg in the background, keeping mail delivery out of the request that
+// caused it. Failures are only logged
+func SendAsync(m Mailer, msg Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+
+		if err := m.Send(ctx, msg); err != nil {
+			slog.Error("Could not send email", slog.String("subject", msg.Subject), slog.String("error", err.Error()))
+		}
+	}()
+}
+
+// Mailer drivers
+const (
+	DriverSMTP = "smtp"
+	DriverLog  = "log"
+	DriverFile = "file"
+)
+
+// MustLoad builds the mailer chosen by MAIL_DRIVER, logging messages when none is configured
+func MustLoad() Mailer {
+	if err := godotenv.Load(); err != nil {
+		slog.Warn("No .env file found or error loading it", slog.String("error", err.Error()))
+	}
+
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Kaiyo AI <no-reply@kaiyo.local>"
+	}
+	if _, err := netmail.ParseAddress(from); err != nil {
+		slog.Error("could not parse MAIL_FROM", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case DriverSMTP:
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			slog.Error("could not load smtp host, SMTP_HOST is not set")
+			os.Exit(1)
+		}
+
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+
+		return NewSMTPMailer(SMTPConfig{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		})
+
+	case DriverFile:
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "./tmp/mail"
+		}
+		return NewFileMailer(dir, from)
+
+	case DriverLog, "":
+		return NewLogMailer(from)
+
+	default:
+		slog.Error("unknown mail driver", slog.String("driver", driver))
+		os.Exit(1)
+		return nil
+	}
+}
+
+// compose renders a message as RFC 5322 text, quoted-printable so any line length or
+// character set survives SMTP
+func compose(from string, msg Message) ([]byte, error) {
+	if _, err := netmail.ParseAddress(msg.To); err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return nil, fmt.Errorf("invalid header value")
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@%s>\r\n", uuid.NewString(), domainOf(from))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&b)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(msg.Text, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func domainOf(from string) string {
+	addr, err := netmail.ParseAddress(from)
+	if err != nil {
+		return "localhost"
+	}
+	_, domain, _ := strings.Cut(addr.Address, "@")
+	return domain
+}
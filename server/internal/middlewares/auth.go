@@ -3,15 +3,36 @@ package middlewares
 import (
 	"context"
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"strings"
 
+	"github.com/google/uuid"
 	"github.com/nakul-krishnakumar/kaiyo-ai/internal/http/auth"
 )
 
 type contextKey string
 
-func Auth(config *auth.Config) func(http.Handler) http.Handler {
+// UserIDFromContext returns the authenticated user's ID set by Auth
+func UserIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	userID, ok := ctx.Value(contextKey("userID")).(uuid.UUID)
+	return userID, ok
+}
+
+// SessionIDFromContext returns the session family the request's access token was issued for
+func SessionIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	sessionID, ok := ctx.Value(contextKey("sessionID")).(uuid.UUID)
+	return sessionID, ok
+}
+
+// EmailVerifiedFromContext reports whether the user had verified their email when the access token was issued
+func EmailVerifiedFromContext(ctx context.Context) bool {
+	verified, _ := ctx.Value(contextKey("emailVerified")).(bool)
+	return verified
+}
+
+// Auth accepts signed access tokens whose session has not been revoked since they were issued
+func Auth(config *auth.Config, sessions *auth.SessionCache) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
@@ -34,8 +55,39 @@ func Auth(config *auth.Config) func(http.Handler) http.Handler {
 				return
 			}
 
+			// tokens issued before sessions were tracked carry no session and cannot be revoked
+			if claims.SessionID == uuid.Nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]string{
+					"message": "invalid token",
+					"error":   "token has no session",
+				})
+				return
+			}
+
+			active, err := sessions.Active(r.Context(), claims.SessionID, claims.UserID)
+			if err != nil {
+				slog.Error("could not check session", slog.String("error", err.Error()))
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]string{
+					"error": "could not check session",
+				})
+				return
+			}
+
+			if !active {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]string{
+					"message": "invalid token",
+					"error":   "session has been revoked",
+				})
+				return
+			}
+
 			ctx := context.WithValue(r.Context(), contextKey("userID"), claims.UserID)
 			ctx = context.WithValue(ctx, contextKey("subject"), claims.Subject)
+			ctx = context.WithValue(ctx, contextKey("sessionID"), claims.SessionID)
+			ctx = context.WithValue(ctx, contextKey("emailVerified"), claims.EmailVerified)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
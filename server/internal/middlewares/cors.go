@@ -9,7 +9,8 @@ func CORS(next http.Handler) http.Handler {
 		// CORS Headers
 		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:5173") // Configure for your frontend
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
 		w.Header().Set("Access-Control-Allow-Credentials", "true") // For cookies
 
 		w.Header().Set("Content-Type", "application/json")
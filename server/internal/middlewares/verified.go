@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// unverifiedActions are the actions that can be kept from users who have not verified their
+// email, mostly ones that reach other people. Patterns are relative to /api/v1. Seeing and
+// accepting trip invitations is not among them, trips always requires a verified email for it
+var unverifiedActions = map[string][]string{
+	"invite":  {"POST /trips/{chatID}/invitations"},
+	"share":   {"POST /itineraries/{id}/shares"},
+	"publish": {"POST /templates/{$}"},
+	"chat":    {"POST /chats/{$}"},
+	"fork":    {"POST /itineraries/{id}/fork", "POST /itineraries/duplicate", "POST /templates/{id}/instantiate"},
+}
+
+// RequireVerified refuses the given actions to users whose access token says their email is
+// not verified. It goes inside Auth
+func RequireVerified(actions []string) func(http.Handler) http.Handler {
+	restricted := http.NewServeMux()
+	matched := func(http.ResponseWriter, *http.Request) {}
+
+	for _, action := range actions {
+		patterns, ok := unverifiedActions[action]
+		if !ok {
+			slog.Warn("Unknown unverified restriction, ignoring it", slog.String("action", action))
+			continue
+		}
+		for _, pattern := range patterns {
+			restricted.HandleFunc(pattern, matched)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !EmailVerifiedFromContext(r.Context()) {
+				if _, pattern := restricted.Handler(r); pattern != "" {
+					w.WriteHeader(http.StatusForbidden)
+					json.NewEncoder(w).Encode(map[string]string{
+						"message": "verify your email first",
+						"error":   "email not verified",
+					})
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
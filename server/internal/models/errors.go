@@ -0,0 +1,12 @@
+package models
+
+import "errors"
+
+// ErrNotFound is returned by repositories when a record does not exist
+var ErrNotFound = errors.New("record not found")
+
+// ErrVersionConflict is returned when a write was based on a stale version
+var ErrVersionConflict = errors.New("version conflict")
+
+// ErrSessionReused is returned when a refresh token that was already rotated is presented again
+var ErrSessionReused = errors.New("session reused")
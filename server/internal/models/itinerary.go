@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary"
+)
+
+const (
+	ItinerarySourceAssistant  = "assistant"
+	ItinerarySourceRestore    = "restore"
+	ItinerarySourceEdit       = "edit"
+	ItinerarySourceEnrichment = "enrichment"
+	ItinerarySourceDuplicate  = "duplicate"
+	ItinerarySourceFork       = "fork"
+	ItinerarySourceTemplate   = "template"
+)
+
+type Itinerary struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	ChatID         string     `json:"chatId" db:"chat_id"`
+	UserID         *uuid.UUID `json:"userId,omitempty" db:"user_id"`
+	CurrentVersion int        `json:"currentVersion" db:"current_version"`
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updatedAt" db:"updated_at"`
+}
+
+type ItineraryVersion struct {
+	ID          uuid.UUID           `json:"id" db:"id"`
+	ItineraryID uuid.UUID           `json:"itineraryId" db:"itinerary_id"`
+	Version     int                 `json:"version" db:"version"`
+	Data        itinerary.Itinerary `json:"itinerary" db:"data"`
+	Source      string              `json:"source" db:"source"`
+	Message     string              `json:"message,omitempty" db:"message"`
+	CreatedBy   *uuid.UUID          `json:"createdBy,omitempty" db:"created_by"`
+	CreatedAt   time.Time           `json:"createdAt" db:"created_at"`
+	/*
+		Version -- 1-based, increases with every save
+		Source -- what produced the version (assistant, restore, edit, enrichment, duplicate, fork, template)
+		Message -- the chat message that produced the version
+	*/
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+type Job struct {
+	ID          uuid.UUID       `json:"id" db:"id"`
+	Kind        string          `json:"kind" db:"kind"`
+	ChatID      string          `json:"chatId,omitempty" db:"chat_id"`
+	UserID      *uuid.UUID      `json:"userId,omitempty" db:"user_id"`
+	Payload     json.RawMessage `json:"-" db:"payload"`
+	Result      json.RawMessage `json:"result,omitempty" db:"result"`
+	Status      string          `json:"status" db:"status"`
+	Attempts    int             `json:"attempts" db:"attempts"`
+	MaxAttempts int             `json:"maxAttempts" db:"max_attempts"`
+	LastError   string          `json:"lastError,omitempty" db:"last_error"`
+	RunAt       time.Time       `json:"runAt" db:"run_at"`
+	FinishedAt  *time.Time      `json:"finishedAt,omitempty" db:"finished_at"`
+	CreatedAt   time.Time       `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time       `json:"updatedAt" db:"updated_at"`
+	/*
+		Kind -- which handler runs the job, e.g. itinerary.save
+		Attempts -- number of times a worker has picked the job up
+		RunAt -- when the job may next run, pushed back after a failed attempt
+	*/
+}
+
+// Done reports whether the job has reached a final status
+func (j *Job) Done() bool {
+	return j.Status == JobStatusSucceeded || j.Status == JobStatusFailed
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Login attempt outcomes recorded in the audit trail
+const (
+	LoginSucceeded    = "success"
+	LoginBadPassword  = "bad_password"
+	LoginUnknownEmail = "unknown_email"
+	LoginBadMFACode   = "bad_mfa_code"
+	LoginLocked       = "locked"
+)
+
+// LoginThrottle counts recent failed logins for an account or a client address
+type LoginThrottle struct {
+	Key           string     `json:"key" db:"key"`
+	Failures      int        `json:"failures" db:"failures"`
+	LockedUntil   *time.Time `json:"lockedUntil,omitempty" db:"locked_until"`
+	LastFailureAt time.Time  `json:"lastFailureAt" db:"last_failure_at"`
+}
+
+// LoginAttempt is one entry of the login audit trail. UserID is nil for unknown emails
+type LoginAttempt struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	UserID    *uuid.UUID `json:"userId,omitempty" db:"user_id"`
+	Email     string     `json:"email" db:"email"`
+	IPAddress string     `json:"ipAddress" db:"ip_address"`
+	UserAgent string     `json:"userAgent" db:"user_agent"`
+	Success   bool       `json:"success" db:"success"`
+	Reason    string     `json:"reason" db:"reason"`
+	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
+}
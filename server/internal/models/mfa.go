@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TOTP is a user's authenticator app secret. It only guards logins once confirmed
+type TOTP struct {
+	UserID      uuid.UUID  `json:"userId" db:"user_id"`
+	Secret      string     `json:"-" db:"secret"`
+	ConfirmedAt *time.Time `json:"confirmedAt,omitempty" db:"confirmed_at"`
+	LastStep    int64      `json:"-" db:"last_step"`
+	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
+}
+
+func (t *TOTP) Enabled() bool {
+	return t.ConfirmedAt != nil
+}
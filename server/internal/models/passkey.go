@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Passkey is a WebAuthn credential a user signs in with
+type Passkey struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	UserID         uuid.UUID  `json:"userId" db:"user_id"`
+	CredentialID   []byte     `json:"-" db:"credential_id"`
+	PublicKey      []byte     `json:"-" db:"public_key"`
+	SignCount      uint32     `json:"-" db:"sign_count"`
+	Transports     []string   `json:"transports" db:"transports"`
+	AAGUID         []byte     `json:"-" db:"aaguid"`
+	BackupEligible bool       `json:"backupEligible" db:"backup_eligible"`
+	BackedUp       bool       `json:"backedUp" db:"backed_up"`
+	Name           string     `json:"name" db:"name"`
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
+	LastUsedAt     *time.Time `json:"lastUsedAt,omitempty" db:"last_used_at"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Trip paces, matching the ones the assistant asks about
+const (
+	PaceRelaxed  = "relaxed"
+	PaceBalanced = "balanced"
+	PaceBusy     = "busy"
+)
+
+func ValidPace(pace string) bool {
+	return pace == PaceRelaxed || pace == PaceBalanced || pace == PaceBusy
+}
+
+// Preferences is a user's travel profile, the assistant uses it instead of asking again
+type Preferences struct {
+	UserID              uuid.UUID `json:"-" db:"user_id"`
+	HomeCity            string    `json:"homeCity,omitempty" db:"home_city"`
+	HomeCurrency        string    `json:"homeCurrency,omitempty" db:"home_currency"`
+	DietaryRestrictions []string  `json:"dietaryRestrictions" db:"dietary_restrictions"`
+	MobilityNeeds       string    `json:"mobilityNeeds,omitempty" db:"mobility_needs"`
+	Pace                string    `json:"pace,omitempty" db:"pace"`
+	Interests           []string  `json:"interests" db:"interests"`
+	AccommodationStyle  string    `json:"accommodationStyle,omitempty" db:"accommodation_style"`
+	Language            string    `json:"language,omitempty" db:"language"`
+	UpdatedAt           time.Time `json:"updatedAt" db:"updated_at"`
+	/*
+		HomeCurrency -- ISO 4217 code, e.g. "INR"
+		Language -- the language the assistant should reply in
+	*/
+}
+
+// Empty reports whether nothing has been filled in
+func (p *Preferences) Empty() bool {
+	return p.HomeCity == "" && p.HomeCurrency == "" && len(p.DietaryRestrictions) == 0 &&
+		p.MobilityNeeds == "" && p.Pace == "" && len(p.Interests) == 0 &&
+		p.AccommodationStyle == "" && p.Language == ""
+}
@@ -19,12 +19,22 @@ type DeviceInfo struct {
 	LastSeenAt time.Time `json:"last_seen_at" db:"last_seen_at"`
 }
 
+// Session is one refresh token. Refreshing rotates it into a new session of the same family
 type Session struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	FamilyID   uuid.UUID  `json:"family_id" db:"family_id"`
 	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
 	TokenHash  string     `json:"-" db:"token_hash"`
 	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
 	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
 	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
 	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	RotatedAt  *time.Time `json:"rotated_at,omitempty" db:"rotated_at"`
+	ReplacedBy *uuid.UUID `json:"replaced_by,omitempty" db:"replaced_by"`
 	DeviceInfo DeviceInfo `json:"device_info" db:"device_info"`
 }
+
+// Active reports whether the session can still be refreshed
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && s.RotatedAt == nil && now.Before(s.ExpiresAt)
+}
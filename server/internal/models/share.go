@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SharePermissionRead      = "read"      // view the itinerary
+	SharePermissionDuplicate = "duplicate" // view it and copy it into your own chat
+)
+
+type ItineraryShare struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	ItineraryID uuid.UUID  `json:"itineraryId" db:"itinerary_id"`
+	TokenHash   string     `json:"-" db:"token_hash"`
+	Permission  string     `json:"permission" db:"permission"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty" db:"expires_at"`
+	RevokedAt   *time.Time `json:"revokedAt,omitempty" db:"revoked_at"`
+	CreatedBy   *uuid.UUID `json:"createdBy,omitempty" db:"created_by"`
+	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// Active reports whether the share link can still be used
+func (s *ItineraryShare) Active(now time.Time) bool {
+	return s.RevokedAt == nil && (s.ExpiresAt == nil || now.Before(*s.ExpiresAt))
+}
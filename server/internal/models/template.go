@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/itinerary"
+)
+
+type ItineraryTemplate struct {
+	ID           uuid.UUID           `json:"id" db:"id"`
+	Title        string              `json:"title" db:"title"`
+	Destination  string              `json:"destination" db:"destination"`
+	DurationDays int                 `json:"durationDays" db:"duration_days"`
+	Pace         string              `json:"pace,omitempty" db:"pace"`
+	Interests    []string            `json:"interests" db:"interests"`
+	Data         itinerary.Itinerary `json:"itinerary" db:"data"`
+	Public       bool                `json:"public" db:"public"`
+	Uses         int                 `json:"uses" db:"uses"`
+	CreatedBy    *uuid.UUID          `json:"createdBy,omitempty" db:"created_by"`
+	CreatedAt    time.Time           `json:"createdAt" db:"created_at"`
+	/*
+		Data -- the plan without dates, see itinerary.StripDates
+		Public -- curated by an admin and visible to everyone
+	*/
+}
+
+// TemplateQuery filters templates, zero values match everything
+type TemplateQuery struct {
+	Destination string
+	Days        int
+	Pace        string
+	Interests   []string   // templates tagged with all of them
+	UserID      *uuid.UUID // also match this user's private templates
+	Limit       int
+}
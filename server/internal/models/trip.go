@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Trip roles, each role can do everything the roles below it can
+const (
+	TripRoleOwner  = "owner"  // manages members, invitations and share links
+	TripRoleEditor = "editor" // chats and edits the itinerary
+	TripRoleViewer = "viewer" // reads the chat and itinerary
+)
+
+var tripRoleRank = map[string]int{
+	TripRoleViewer: 1,
+	TripRoleEditor: 2,
+	TripRoleOwner:  3,
+}
+
+// RoleAllows reports whether role grants at least the access of required
+func RoleAllows(role string, required string) bool {
+	return tripRoleRank[role] > 0 && tripRoleRank[role] >= tripRoleRank[required]
+}
+
+type TripMember struct {
+	ChatID    string     `json:"chatId" db:"chat_id"`
+	UserID    uuid.UUID  `json:"userId" db:"user_id"`
+	Role      string     `json:"role" db:"role"`
+	InvitedBy *uuid.UUID `json:"invitedBy,omitempty" db:"invited_by"`
+	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
+
+	// joined from users
+	Email    string `json:"email,omitempty" db:"email"`
+	UserName string `json:"userName,omitempty" db:"username"`
+}
+
+type TripInvitation struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	ChatID     string     `json:"chatId" db:"chat_id"`
+	Email      string     `json:"email" db:"email"`
+	Role       string     `json:"role" db:"role"`
+	InvitedBy  *uuid.UUID `json:"invitedBy,omitempty" db:"invited_by"`
+	ExpiresAt  time.Time  `json:"expiresAt" db:"expires_at"`
+	AcceptedAt *time.Time `json:"acceptedAt,omitempty" db:"accepted_at"`
+	AcceptedBy *uuid.UUID `json:"acceptedBy,omitempty" db:"accepted_by"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty" db:"revoked_at"`
+	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// Pending reports whether the invitation can still be accepted
+func (i *TripInvitation) Pending(now time.Time) bool {
+	return i.AcceptedAt == nil && i.RevokedAt == nil && now.Before(i.ExpiresAt)
+}
@@ -23,8 +23,10 @@ type User struct {
 
 	EmailVerified bool `json:"email_verified,omitempty" mapstructure:"email_verified"`
 	IsActive      bool `json:"is_active,omitempty" mapstructure:"is_active"`
+	IsAdmin       bool `json:"is_admin,omitempty" mapstructure:"is_admin"`
 	/*
 		IsActive -- for soft deletion
+		IsAdmin -- curates public templates
 	*/
 
 	CreatedAt   time.Time `json:"created_at,omitempty" mapstructure:"created_at"`
@@ -0,0 +1,65 @@
+package oidc
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// validName keeps provider names usable in URLs and cookie paths
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,30}$`)
+
+// LoadProviders reads the providers of the YAML file at path. A missing file means no providers
+func LoadProviders(path string) ([]Config, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read oidc config: %w", err)
+	}
+
+	var file struct {
+		Providers []Config `mapstructure:"providers"`
+	}
+	if err := v.Unmarshal(&file); err != nil {
+		return nil, fmt.Errorf("failed to load oidc config: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range file.Providers {
+		p := &file.Providers[i]
+
+		switch {
+		case !validName.MatchString(p.Name):
+			return nil, fmt.Errorf("oidc provider %q: name must be lowercase letters, digits and dashes", p.Name)
+		case seen[p.Name]:
+			return nil, fmt.Errorf("oidc provider %q is defined twice", p.Name)
+		case p.Issuer == "" || p.ClientID == "" || p.RedirectURL == "":
+			return nil, fmt.Errorf("oidc provider %q: issuer, client_id and redirect_url are required", p.Name)
+		}
+		seen[p.Name] = true
+
+		if p.ClientSecretEnv != "" {
+			p.ClientSecret = os.Getenv(p.ClientSecretEnv)
+			if p.ClientSecret == "" {
+				return nil, fmt.Errorf("oidc provider %q: %s is not set", p.Name, p.ClientSecretEnv)
+			}
+		}
+
+		if p.DisplayName == "" {
+			p.DisplayName = p.Name
+		}
+		for j, domain := range p.AllowedDomains {
+			p.AllowedDomains[j] = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		}
+	}
+
+	return file.Providers, nil
+}
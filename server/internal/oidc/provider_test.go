@@ -0,0 +1,178 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/oidc"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/oidc/oidctest"
+)
+
+const redirectURL = "http://app.test/auth/oidc/test/callback"
+
+func startProvider(t *testing.T) (*oidctest.Provider, *oidc.Provider) {
+	t.Helper()
+
+	mock, srv, err := oidctest.Start("client", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+
+	provider := oidc.NewProvider(oidc.Config{
+		Name:         "test",
+		Issuer:       mock.Issuer,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  redirectURL,
+	})
+
+	return mock, provider
+}
+
+// authorize runs the browser's part of the flow and returns the code and state the provider sent back
+func authorize(t *testing.T, provider *oidc.Provider, state, nonce, verifier string) (string, string) {
+	t.Helper()
+
+	to, err := provider.AuthCodeURL(context.Background(), state, nonce, oidc.Challenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.Get(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	back, err := url.Parse(res.Header.Get("Location"))
+	if err != nil || res.StatusCode != http.StatusFound {
+		t.Fatalf("authorize answered %s, location %q", res.Status, res.Header.Get("Location"))
+	}
+
+	return back.Query().Get("code"), back.Query().Get("state")
+}
+
+func TestExchange(t *testing.T) {
+	mock, provider := startProvider(t)
+	mock.SetIdentity(oidctest.Identity{Subject: "42", Email: "ana@example.com", EmailVerified: true, GivenName: "Ana"})
+
+	code, state := authorize(t, provider, "state", "nonce", "verifier")
+	if state != "state" {
+		t.Errorf("state = %q, want it returned as sent", state)
+	}
+
+	claims, err := provider.Exchange(context.Background(), code, "verifier", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "42" || claims.Email != "ana@example.com" || !bool(claims.EmailVerified) || claims.GivenName != "Ana" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	// codes are single use
+	if _, err := provider.Exchange(context.Background(), code, "verifier", "nonce"); !errors.Is(err, oidc.ErrExchange) {
+		t.Errorf("reused code: got %v, want %v", err, oidc.ErrExchange)
+	}
+}
+
+func TestExchangeRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		verifier string
+		nonce    string
+		forge    bool
+		want     error
+	}{
+		{name: "PKCE verifier mismatch", verifier: "other-verifier", nonce: "nonce", want: oidc.ErrExchange},
+		{name: "nonce mismatch", verifier: "verifier", nonce: "other-nonce", want: oidc.ErrIDToken},
+		{name: "signature from an unpublished key", verifier: "verifier", nonce: "nonce", forge: true, want: oidc.ErrIDToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, provider := startProvider(t)
+			if tt.forge {
+				if err := mock.ForgeSignatures(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			code, _ := authorize(t, provider, "state", "nonce", "verifier")
+			if _, err := provider.Exchange(context.Background(), code, tt.verifier, tt.nonce); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeMapsClaims(t *testing.T) {
+	mock, _ := startProvider(t)
+	mock.SetIdentity(oidctest.Identity{
+		Subject: "42",
+		Email:   "personal@example.com",
+		Claims: map[string]any{
+			"upn":     "ana@acme.com",
+			"profile": map[string]any{"first": "Ana", "last": "Lima", "verified": "TRUE"},
+		},
+	})
+
+	provider := oidc.NewProvider(oidc.Config{
+		Name:         "test",
+		Issuer:       mock.Issuer,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  redirectURL,
+		Claims: oidc.ClaimMapping{
+			Email:         "upn",
+			EmailVerified: "profile.verified",
+			GivenName:     "profile.first",
+			FamilyName:    "profile.last",
+			Name:          "profile.missing",
+		},
+	})
+
+	code, _ := authorize(t, provider, "state", "nonce", "verifier")
+	claims, err := provider.Exchange(context.Background(), code, "verifier", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Email != "ana@acme.com" || !bool(claims.EmailVerified) || claims.GivenName != "Ana" || claims.FamilyName != "Lima" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+	// a mapped claim the token doesn't have is empty, not the standard claim
+	if claims.Name != "" {
+		t.Errorf("name = %q, want it empty", claims.Name)
+	}
+}
+
+func TestEmailDomains(t *testing.T) {
+	tests := []struct {
+		email   string
+		domains []string
+		allows  bool
+		manages bool
+	}{
+		{"ana@example.com", nil, true, false},
+		{"ana@acme.com", []string{"acme.com"}, true, true},
+		{"ana@ACME.com", []string{"acme.com"}, true, true},
+		{"ana@example.com", []string{"acme.com"}, false, false},
+		{"ana@sub.acme.com", []string{"acme.com"}, false, false},
+		{"acme.com", []string{"acme.com"}, false, false},
+	}
+
+	for _, tt := range tests {
+		c := oidc.Config{AllowedDomains: tt.domains}
+		if got := c.AllowsEmail(tt.email); got != tt.allows {
+			t.Errorf("%q with %v: AllowsEmail = %v, want %v", tt.email, tt.domains, got, tt.allows)
+		}
+		if got := c.ManagesEmail(tt.email); got != tt.manages {
+			t.Errorf("%q with %v: ManagesEmail = %v, want %v", tt.email, tt.domains, got, tt.manages)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const clockSkew = time.Minute
+
+// Claims are the identity claims of a verified ID token
+type Claims struct {
+	Email         string `json:"email"`
+	EmailVerified Bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Picture       string `json:"picture"`
+	Nonce         string `json:"nonce"`
+	AuthorizedBy  string `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// Bool accepts both true and "true", some providers send email_verified as a string
+type Bool bool
+
+func (b *Bool) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case bool:
+		*b = Bool(v)
+	case string:
+		*b = Bool(strings.EqualFold(v, "true"))
+	default:
+		*b = false
+	}
+
+	return nil
+}
+
+// Verify checks an ID token's signature against the provider's keys and that it was issued
+// by the provider, for this client, for the login that sent the nonce
+func (p *Provider) Verify(ctx context.Context, raw, nonce string) (*Claims, error) {
+	if _, err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(raw, claims,
+		func(t *jwt.Token) (any, error) {
+			kid, _ := t.Header["kid"].(string)
+			return p.keys.Key(ctx, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIDToken, err)
+	}
+
+	if !p.issuedBy(claims.Issuer) {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrIDToken, claims.Issuer)
+	}
+
+	// a token for several audiences must name us as the party it was issued to
+	if len(claims.Audience) > 1 && claims.AuthorizedBy != p.ClientID {
+		return nil, fmt.Errorf("%w: issued to %q", ErrIDToken, claims.AuthorizedBy)
+	}
+
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrIDToken)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrIDToken)
+	}
+
+	if p.Claims != (ClaimMapping{}) {
+		if err := p.mapClaims(raw, claims); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrIDToken, err)
+		}
+	}
+
+	return claims, nil
+}
+
+// mapClaims reads the claims the provider names differently from the verified token's payload
+func (p *Provider) mapClaims(raw string, claims *Claims) error {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("malformed payload: %w", err)
+	}
+
+	var all map[string]any
+	if err := json.Unmarshal(payload, &all); err != nil {
+		return fmt.Errorf("malformed payload: %w", err)
+	}
+
+	for _, m := range []struct {
+		path  string
+		field *string
+	}{
+		{p.Claims.Email, &claims.Email},
+		{p.Claims.Name, &claims.Name},
+		{p.Claims.GivenName, &claims.GivenName},
+		{p.Claims.FamilyName, &claims.FamilyName},
+	} {
+		if m.path != "" {
+			*m.field, _ = lookup(all, m.path).(string)
+		}
+	}
+
+	if p.Claims.EmailVerified != "" {
+		switch v := lookup(all, p.Claims.EmailVerified).(type) {
+		case bool:
+			claims.EmailVerified = Bool(v)
+		case string:
+			claims.EmailVerified = Bool(strings.EqualFold(v, "true"))
+		default:
+			claims.EmailVerified = false
+		}
+	}
+
+	return nil
+}
+
+// lookup follows a dotted path through nested claims, nil when any step is missing
+func lookup(claims map[string]any, path string) any {
+	var v any = claims
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = obj[key]
+	}
+	return v
+}
+
+// issuedBy compares issuers. Google documents that its ID tokens may name the issuer
+// without the scheme, so that form is accepted for any provider
+func (p *Provider) issuedBy(iss string) bool {
+	return slices.Contains([]string{p.Issuer, strings.TrimPrefix(p.Issuer, "https://")}, strings.TrimSuffix(iss, "/"))
+}
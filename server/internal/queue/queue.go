@@ -0,0 +1,317 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/repositories"
+)
+
+const (
+	defaultWorkers      = 4
+	defaultPollInterval = 2 * time.Second
+	defaultTimeout      = 5 * time.Minute
+	defaultMaxAttempts  = 5
+
+	baseBackoff = 10 * time.Second
+	maxBackoff  = 10 * time.Minute
+)
+
+// Handler runs a job, the result is stored as JSON on the job once it succeeds
+type Handler func(ctx context.Context, job *models.Job) (any, error)
+
+// Queue runs jobs stored in Postgres on a pool of workers. Jobs survive restarts: anything still
+// queued is picked up again, and jobs abandoned mid-run are requeued once their lease expires.
+type Queue struct {
+	Repo         repositories.JobRepository
+	Workers      int
+	PollInterval time.Duration
+	Timeout      time.Duration // per attempt, also the lease after which a running job counts as abandoned
+
+	handlers map[string]Handler
+	watchers map[uuid.UUID][]chan struct{}
+	mu       sync.Mutex
+
+	wake chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func New(repo repositories.JobRepository) *Queue {
+	return &Queue{
+		Repo:         repo,
+		Workers:      defaultWorkers,
+		PollInterval: defaultPollInterval,
+		Timeout:      defaultTimeout,
+		handlers:     make(map[string]Handler),
+		watchers:     make(map[uuid.UUID][]chan struct{}),
+		wake:         make(chan struct{}, 1),
+		stop:         make(chan struct{}),
+	}
+}
+
+// Register sets the handler for a kind of job, it must be called before Start
+func (q *Queue) Register(kind string, h Handler) {
+	q.handlers[kind] = h
+}
+
+// Enqueue stores a job for the workers, payload is marshalled to JSON
+func (q *Queue) Enqueue(ctx context.Context, kind string, chatID string, userID *uuid.UUID, payload any) (*models.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job payload: %w", err)
+	}
+
+	job := &models.Job{
+		Kind:        kind,
+		ChatID:      chatID,
+		UserID:      userID,
+		Payload:     data,
+		MaxAttempts: defaultMaxAttempts,
+	}
+	if err := q.Repo.Enqueue(ctx, job); err != nil {
+		return nil, err
+	}
+
+	// wake a worker instead of waiting for the next poll
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return job, nil
+}
+
+// Start launches the workers and the reaper for abandoned jobs
+func (q *Queue) Start() {
+	for i := 0; i < q.Workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+
+	q.wg.Add(1)
+	go q.reap()
+
+	slog.Info("Job workers started", slog.Int("workers", q.Workers))
+}
+
+// Stop stops claiming jobs and waits for running ones to finish, or for ctx to expire
+func (q *Queue) Stop(ctx context.Context) error {
+	close(q.stop)
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		// unfinished jobs are requeued by the next server once their lease expires
+		return ctx.Err()
+	}
+}
+
+// Wait blocks until the job has finished or ctx is done
+func (q *Queue) Wait(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	notify := make(chan struct{}, 1)
+
+	q.mu.Lock()
+	q.watchers[id] = append(q.watchers[id], notify)
+	q.mu.Unlock()
+
+	defer func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		watchers := q.watchers[id]
+		for i, w := range watchers {
+			if w == notify {
+				watchers = append(watchers[:i], watchers[i+1:]...)
+				break
+			}
+		}
+		if len(watchers) == 0 {
+			delete(q.watchers, id)
+		} else {
+			q.watchers[id] = watchers
+		}
+	}()
+
+	// polling as well covers jobs run by another server
+	ticker := time.NewTicker(q.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, err := q.Repo.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Done() {
+			return job, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+
+		job, err := q.Repo.Claim(context.Background())
+		switch {
+		case err == nil:
+			q.run(job)
+			continue
+		case !errors.Is(err, models.ErrNotFound):
+			slog.Error("Could not claim job", slog.String("error", err.Error()))
+		}
+
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// run executes a claimed job and records the outcome
+func (q *Queue) run(job *models.Job) {
+	defer q.notify(job.ID)
+
+	log := slog.With(slog.String("job_id", job.ID.String()), slog.String("kind", job.Kind), slog.Int("attempt", job.Attempts))
+
+	// the outcome is recorded even if the server is shutting down
+	ctx := context.Background()
+
+	result, err := q.execute(job)
+	if err == nil {
+		data, err := json.Marshal(result)
+		if err == nil {
+			err = q.Repo.Complete(ctx, job.ID, data)
+		}
+		if err != nil {
+			log.Error("Could not record job result", slog.String("error", err.Error()))
+			return
+		}
+
+		log.Info("Job succeeded")
+		return
+	}
+
+	var permanent *permanentError
+	if errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts {
+		log.Error("Job failed", slog.String("error", err.Error()))
+		if err := q.Repo.Fail(ctx, job.ID, err.Error()); err != nil {
+			log.Error("Could not record job failure", slog.String("error", err.Error()))
+		}
+		return
+	}
+
+	delay := backoff(job.Attempts)
+	log.Warn("Job attempt failed, retrying", slog.String("error", err.Error()), slog.Duration("retry_in", delay))
+	if err := q.Repo.Retry(ctx, job.ID, err.Error(), time.Now().Add(delay)); err != nil {
+		log.Error("Could not reschedule job", slog.String("error", err.Error()))
+	}
+}
+
+func (q *Queue) execute(job *models.Job) (result any, err error) {
+	handler, ok := q.handlers[job.Kind]
+	if !ok {
+		return nil, Permanent(fmt.Errorf("no handler for job kind %q", job.Kind))
+	}
+
+	// a panicking handler fails the attempt instead of the worker
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), q.Timeout)
+	defer cancel()
+
+	return handler(ctx, job)
+}
+
+func (q *Queue) notify(id uuid.UUID) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, w := range q.watchers[id] {
+		select {
+		case w <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// reap requeues jobs that have been running for longer than the timeout, their worker is gone
+func (q *Queue) reap() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.Timeout / 2)
+	defer ticker.Stop()
+
+	for {
+		// lease with some slack so a slow job isn't run twice
+		n, err := q.Repo.RequeueStale(context.Background(), time.Now().Add(-q.Timeout-time.Minute))
+		if err != nil {
+			slog.Error("Could not requeue stale jobs", slog.String("error", err.Error()))
+		} else if n > 0 {
+			slog.Warn("Requeued abandoned jobs", slog.Int64("count", n))
+		}
+
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// backoff grows exponentially with the attempt number, with jitter so retries don't line up
+func backoff(attempt int) time.Duration {
+	delay := baseBackoff << min(attempt-1, 10)
+	delay = min(delay, maxBackoff)
+
+	return delay/2 + rand.N(delay/2+1)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error as not worth retrying, e.g. a malformed payload
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
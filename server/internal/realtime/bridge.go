@@ -0,0 +1,258 @@
+package realtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	channel = "kaiyo_events"
+
+	// Postgres rejects NOTIFY payloads of 8000 bytes or more
+	maxPayload = 7900
+
+	// bytes of an envelope per fragment, base64 grows them to 7468 which leaves room for the rest
+	fragmentSize = 5600
+	// envelopes are at most ~700 KB, far beyond any message or itinerary
+	maxFragments = 128
+	// fragments are sent in one transaction and arrive together, this only clears out leftovers
+	fragmentTTL = time.Minute
+
+	notifyTimeout    = 5 * time.Second
+	minListenBackoff = time.Second
+	maxListenBackoff = 30 * time.Second
+)
+
+// envelope is what replicas send each other, either an event, a replica's viewers of a chat
+// or a fragment of a larger envelope
+type envelope struct {
+	Origin string `json:"origin"`
+
+	Event *Event `json:"event,omitempty"`
+
+	ChatID   string   `json:"chatId,omitempty"`
+	Viewers  []Viewer `json:"viewers,omitempty"`
+	Presence bool     `json:"presence,omitempty"`
+
+	Fragment *fragment `json:"fragment,omitempty"`
+}
+
+// fragment is a piece of an envelope too large for a single NOTIFY
+type fragment struct {
+	ID    string `json:"id"`
+	Index int    `json:"index"`
+	Total int    `json:"total"`
+	Data  []byte `json:"data"`
+}
+
+// split breaks an encoded envelope into NOTIFY payloads, in order
+func split(origin string, payload []byte) ([]string, error) {
+	if len(payload) <= maxPayload {
+		return []string{string(payload)}, nil
+	}
+
+	total := (len(payload) + fragmentSize - 1) / fragmentSize
+	if total > maxFragments {
+		return nil, fmt.Errorf("event of %d bytes is too large", len(payload))
+	}
+
+	id := uuid.NewString()
+	out := make([]string, 0, total)
+	for i := 0; i < total; i++ {
+		end := min((i+1)*fragmentSize, len(payload))
+		part, err := json.Marshal(envelope{
+			Origin:   origin,
+			Fragment: &fragment{ID: id, Index: i, Total: total, Data: payload[i*fragmentSize : end]},
+		})
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, string(part))
+	}
+
+	return out, nil
+}
+
+// assembler puts fragmented envelopes back together, it belongs to a single listening connection
+type assembler struct {
+	partial map[string]*assembly // origin/fragment ID -> fragments received so far
+}
+
+type assembly struct {
+	parts    [][]byte
+	received int
+	started  time.Time
+}
+
+func newAssembler() *assembler {
+	return &assembler{partial: make(map[string]*assembly)}
+}
+
+// add records a fragment and returns the whole envelope once every fragment has arrived
+func (a *assembler) add(origin string, f *fragment, now time.Time) ([]byte, bool) {
+	for key, p := range a.partial {
+		if now.Sub(p.started) > fragmentTTL {
+			delete(a.partial, key)
+		}
+	}
+
+	if f.Total < 1 || f.Total > maxFragments || f.Index < 0 || f.Index >= f.Total {
+		return nil, false
+	}
+
+	key := origin + "/" + f.ID
+	p, ok := a.partial[key]
+	if !ok {
+		p = &assembly{parts: make([][]byte, f.Total), started: now}
+		a.partial[key] = p
+	}
+	if len(p.parts) != f.Total || p.parts[f.Index] != nil {
+		return nil, false
+	}
+
+	p.parts[f.Index] = f.Data
+	p.received++
+	if p.received < f.Total {
+		return nil, false
+	}
+
+	delete(a.partial, key)
+	return bytes.Join(p.parts, nil), true
+}
+
+// notify sends an envelope to the other replicas. Envelopes too large for one NOTIFY are split
+// into fragments sent in a single transaction, so they are delivered together and in order.
+func (h *Hub) notify(env envelope) {
+	if h.pool == nil {
+		return
+	}
+	env.Origin = h.ID
+
+	payload, err := json.Marshal(env)
+	if err != nil {
+		slog.Error("Could not send event to other replicas", slog.String("error", err.Error()))
+		return
+	}
+
+	payloads, err := split(h.ID, payload)
+	if err != nil {
+		slog.Error("Could not send event to other replicas", slog.String("error", err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	if len(payloads) == 1 {
+		if _, err := h.pool.Exec(ctx, `SELECT pg_notify($1, $2)`, channel, payloads[0]); err != nil {
+			slog.Error("Could not send event to other replicas", slog.String("error", err.Error()))
+		}
+		return
+	}
+
+	err = pgx.BeginFunc(ctx, h.pool, func(tx pgx.Tx) error {
+		for _, p := range payloads {
+			if _, err := tx.Exec(ctx, `SELECT pg_notify($1, $2)`, channel, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("Could not send event to other replicas", slog.String("error", err.Error()))
+	}
+}
+
+// listen receives envelopes from the other replicas, reconnecting until the hub stops
+func (h *Hub) listen() {
+	defer h.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-h.stop
+		cancel()
+	}()
+
+	backoff := minListenBackoff
+	for {
+		started := time.Now()
+		err := h.receive(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Error("Lost connection to the event channel", slog.String("error", err.Error()))
+
+		// a connection that held up for a while starts the backoff over
+		if time.Since(started) > maxListenBackoff {
+			backoff = minListenBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxListenBackoff)
+	}
+}
+
+// receive holds a connection listening on the channel until it fails
+func (h *Hub) receive(ctx context.Context) error {
+	conn, err := h.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+channel); err != nil {
+		return err
+	}
+	// the connection goes back to the pool, stop it receiving notifications
+	defer conn.Exec(context.Background(), "UNLISTEN "+channel)
+
+	slog.Info("Listening for events from other replicas")
+
+	fragments := newAssembler()
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var env envelope
+		if err := json.Unmarshal([]byte(n.Payload), &env); err != nil {
+			slog.Error("Could not decode event", slog.String("error", err.Error()))
+			continue
+		}
+		if env.Origin == h.ID {
+			continue
+		}
+
+		if env.Fragment != nil {
+			payload, ok := fragments.add(env.Origin, env.Fragment, time.Now())
+			if !ok {
+				continue
+			}
+			env = envelope{}
+			if err := json.Unmarshal(payload, &env); err != nil {
+				slog.Error("Could not decode event", slog.String("error", err.Error()))
+				continue
+			}
+		}
+
+		switch {
+		case env.Event != nil:
+			h.deliver(*env.Event)
+		case env.Presence:
+			h.remotePresence(env.Origin, env.ChatID, env.Viewers)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package realtime
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitSmallEnvelope(t *testing.T) {
+	payloads, err := split("origin", []byte(`{"origin":"origin"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payloads) != 1 || payloads[0] != `{"origin":"origin"}` {
+		t.Errorf("got %q, want the envelope as it was", payloads)
+	}
+}
+
+func TestSplitAndAssemble(t *testing.T) {
+	data, _ := json.Marshal(map[string]string{"content": strings.Repeat("Day 1 – \"Abbey Falls\"\n", 2000)})
+	env := envelope{Origin: "replica-a", Event: &Event{Type: EventMessage, ChatID: "chat", Data: data}}
+	payload, _ := json.Marshal(env)
+
+	payloads, err := split("replica-a", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payloads) < 2 {
+		t.Fatalf("got %d payloads, want the envelope split", len(payloads))
+	}
+
+	var fragments []*fragment
+	for _, p := range payloads {
+		if len(p) > maxPayload {
+			t.Errorf("payload of %d bytes is too large for NOTIFY", len(p))
+		}
+		var e envelope
+		if err := json.Unmarshal([]byte(p), &e); err != nil {
+			t.Fatal(err)
+		}
+		fragments = append(fragments, e.Fragment)
+	}
+
+	// out of order and with a duplicate, the envelope is only returned once it is complete
+	a := newAssembler()
+	now := time.Now()
+	last := len(fragments) - 1
+	for i := last; i > 0; i-- {
+		if _, ok := a.add("replica-a", fragments[i], now); ok {
+			t.Fatalf("assembled after fragment %d of %d", i, len(fragments))
+		}
+	}
+	if _, ok := a.add("replica-a", fragments[last], now); ok {
+		t.Fatal("assembled from a duplicate fragment")
+	}
+
+	// the same fragment ID from another replica is kept apart
+	if _, ok := a.add("replica-b", fragments[0], now); ok {
+		t.Fatal("assembled fragments of different replicas")
+	}
+
+	got, ok := a.add("replica-a", fragments[0], now)
+	if !ok {
+		t.Fatal("envelope not assembled")
+	}
+	var out envelope
+	if err := json.Unmarshal(got, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Event == nil || string(out.Event.Data) != string(data) {
+		t.Error("assembled event differs from the one sent")
+	}
+	if len(a.partial) != 1 {
+		t.Errorf("%d partial envelopes left, want only replica-b's", len(a.partial))
+	}
+}
+
+func TestAssemblerForgetsStaleFragments(t *testing.T) {
+	a := newAssembler()
+	now := time.Now()
+
+	a.add("replica-a", &fragment{ID: "1", Index: 0, Total: 2, Data: []byte("{")}, now)
+	a.add("replica-a", &fragment{ID: "2", Index: 0, Total: 2, Data: []byte("{")}, now.Add(fragmentTTL+time.Second))
+
+	if _, ok := a.partial["replica-a/1"]; ok {
+		t.Error("stale fragments were kept")
+	}
+	if _, ok := a.add("replica-a", &fragment{ID: "3", Index: 2, Total: 2}, now); ok {
+		t.Error("accepted a fragment outside its range")
+	}
+}
+
+func TestSplitTooLarge(t *testing.T) {
+	if _, err := split("origin", make([]byte, fragmentSize*maxFragments+1)); err == nil {
+		t.Error("split an envelope over the fragment limit")
+	}
+}
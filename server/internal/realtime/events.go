@@ -0,0 +1,19 @@
+package realtime
+
+import "github.com/google/uuid"
+
+// ChatMessage is the data of an EventMessage
+type ChatMessage struct {
+	Role    string     `json:"role"` // user or assistant
+	UserID  *uuid.UUID `json:"userId,omitempty"`
+	Author  string     `json:"author,omitempty"`
+	Content string     `json:"content"`
+}
+
+// ItineraryUpdate is the data of an EventItinerary, subscribers fetch the version itself
+type ItineraryUpdate struct {
+	ItineraryID uuid.UUID `json:"itineraryId"`
+	Version     int       `json:"version"`
+	Source      string    `json:"source"`
+	Message     string    `json:"message,omitempty"`
+}
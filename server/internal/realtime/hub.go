@@ -0,0 +1,309 @@
+package realtime
+
+import (
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Event types
+const (
+	EventMessage   = "message"   // a message was added to the chat
+	EventItinerary = "itinerary" // a new itinerary version was saved
+	EventPresence  = "presence"  // the set of members viewing the trip changed
+)
+
+const (
+	subscriptionBuffer = 32
+
+	presenceInterval = 30 * time.Second // how often replicas repeat who is viewing through them
+	presenceTTL      = 3 * presenceInterval
+)
+
+// Event is delivered to everyone subscribed to a chat
+type Event struct {
+	Type   string          `json:"type"`
+	ChatID string          `json:"chatId"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// Viewer is a member with the trip open
+type Viewer struct {
+	UserID   uuid.UUID `json:"userId"`
+	UserName string    `json:"userName"`
+}
+
+// Subscription receives a chat's events until it is closed. C is closed when the subscriber
+// falls too far behind or the hub stops, clients are expected to reconnect and refetch.
+type Subscription struct {
+	ChatID string
+	Viewer Viewer
+	C      <-chan Event
+
+	c   chan Event
+	hub *Hub
+}
+
+// Close unsubscribes, it is safe to call more than once
+func (s *Subscription) Close() {
+	s.hub.unsubscribe(s)
+}
+
+// replicaPresence is who is viewing a chat through another replica
+type replicaPresence struct {
+	viewers []Viewer
+	seen    time.Time
+}
+
+// Hub fans out chat events to subscribers in this process, and through Postgres LISTEN/NOTIFY
+// to subscribers of every other replica. Without a pool it only works in-process.
+type Hub struct {
+	ID string // identifies this replica on the shared channel
+
+	pool *pgxpool.Pool
+
+	subs   map[string]map[*Subscription]struct{} // chatID -> local subscribers
+	remote map[string]map[string]replicaPresence // chatID -> replica ID -> viewers
+	mu     sync.Mutex
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func New(pool *pgxpool.Pool) *Hub {
+	return &Hub{
+		ID:     uuid.NewString(),
+		pool:   pool,
+		subs:   make(map[string]map[*Subscription]struct{}),
+		remote: make(map[string]map[string]replicaPresence),
+		stop:   make(chan struct{}),
+	}
+}
+
+// Subscribe starts receiving a chat's events, the viewer is announced to the other subscribers
+func (h *Hub) Subscribe(chatID string, viewer Viewer) *Subscription {
+	c := make(chan Event, subscriptionBuffer)
+	sub := &Subscription{ChatID: chatID, Viewer: viewer, C: c, c: c, hub: h}
+
+	h.mu.Lock()
+	if h.subs[chatID] == nil {
+		h.subs[chatID] = make(map[*Subscription]struct{})
+	}
+	h.subs[chatID][sub] = struct{}{}
+	h.mu.Unlock()
+
+	h.presenceChanged(chatID)
+	return sub
+}
+
+func (h *Hub) unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	_, ok := h.subs[sub.ChatID][sub]
+	if ok {
+		h.drop(sub)
+	}
+	h.mu.Unlock()
+
+	if ok {
+		h.presenceChanged(sub.ChatID)
+	}
+}
+
+// drop removes a subscriber and closes its channel, h.mu must be held
+func (h *Hub) drop(sub *Subscription) {
+	delete(h.subs[sub.ChatID], sub)
+	if len(h.subs[sub.ChatID]) == 0 {
+		delete(h.subs, sub.ChatID)
+	}
+	close(sub.c)
+}
+
+// Publish sends an event to every subscriber of the chat on every replica, data is marshalled to JSON
+func (h *Hub) Publish(chatID string, eventType string, data any) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("Could not encode event", slog.String("type", eventType), slog.String("error", err.Error()))
+		return
+	}
+
+	ev := Event{Type: eventType, ChatID: chatID, Data: raw}
+	h.deliver(ev)
+	h.notify(envelope{Event: &ev})
+}
+
+// deliver sends an event to this replica's subscribers, slow subscribers are dropped instead of
+// holding up everyone else
+func (h *Hub) deliver(ev Event) {
+	var dropped bool
+
+	h.mu.Lock()
+	for sub := range h.subs[ev.ChatID] {
+		select {
+		case sub.c <- ev:
+		default:
+			slog.Warn("Dropping slow subscriber", slog.String("chat_id", ev.ChatID))
+			h.drop(sub)
+			dropped = true
+		}
+	}
+	h.mu.Unlock()
+
+	if dropped {
+		h.presenceChanged(ev.ChatID)
+	}
+}
+
+// localViewers returns who is viewing a chat through this replica, h.mu must be held
+func (h *Hub) localViewers(chatID string) []Viewer {
+	var viewers []Viewer
+	for sub := range h.subs[chatID] {
+		viewers = append(viewers, sub.Viewer)
+	}
+	return viewers
+}
+
+// Viewers returns everyone viewing a chat across all replicas, each member once
+func (h *Hub) Viewers(chatID string) []Viewer {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.viewers(chatID)
+}
+
+func (h *Hub) viewers(chatID string) []Viewer {
+	all := h.localViewers(chatID)
+	for _, p := range h.remote[chatID] {
+		all = append(all, p.viewers...)
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	viewers := []Viewer{}
+	for _, v := range all {
+		if !seen[v.UserID] {
+			seen[v.UserID] = true
+			viewers = append(viewers, v)
+		}
+	}
+
+	slices.SortFunc(viewers, func(a, b Viewer) int {
+		return strings.Compare(strings.ToLower(a.UserName), strings.ToLower(b.UserName))
+	})
+	return viewers
+}
+
+// presenceChanged tells local subscribers who is viewing now and the other replicas who is viewing through this one
+func (h *Hub) presenceChanged(chatID string) {
+	h.mu.Lock()
+	local := h.localViewers(chatID)
+	viewers := h.viewers(chatID)
+	h.mu.Unlock()
+
+	h.deliverPresence(chatID, viewers)
+	h.notify(envelope{ChatID: chatID, Viewers: local, Presence: true})
+}
+
+func (h *Hub) deliverPresence(chatID string, viewers []Viewer) {
+	raw, err := json.Marshal(map[string]any{"viewers": viewers})
+	if err != nil {
+		return
+	}
+	h.deliver(Event{Type: EventPresence, ChatID: chatID, Data: raw})
+}
+
+// remotePresence records who is viewing through another replica
+func (h *Hub) remotePresence(origin string, chatID string, viewers []Viewer) {
+	h.mu.Lock()
+	if len(viewers) == 0 {
+		delete(h.remote[chatID], origin)
+		if len(h.remote[chatID]) == 0 {
+			delete(h.remote, chatID)
+		}
+	} else {
+		if h.remote[chatID] == nil {
+			h.remote[chatID] = make(map[string]replicaPresence)
+		}
+		h.remote[chatID][origin] = replicaPresence{viewers: viewers, seen: time.Now()}
+	}
+	_, watched := h.subs[chatID]
+	merged := h.viewers(chatID)
+	h.mu.Unlock()
+
+	if watched {
+		h.deliverPresence(chatID, merged)
+	}
+}
+
+// heartbeat repeats this replica's presence and forgets replicas that stopped repeating theirs
+func (h *Hub) heartbeat() {
+	defer h.wg.Done()
+
+	ticker := time.NewTicker(presenceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+		}
+
+		h.mu.Lock()
+		local := make(map[string][]Viewer)
+		for chatID := range h.subs {
+			local[chatID] = h.localViewers(chatID)
+		}
+
+		var expired []string
+		for chatID, replicas := range h.remote {
+			for origin, p := range replicas {
+				if time.Since(p.seen) > presenceTTL {
+					delete(replicas, origin)
+					expired = append(expired, chatID)
+				}
+			}
+			if len(replicas) == 0 {
+				delete(h.remote, chatID)
+			}
+		}
+		h.mu.Unlock()
+
+		for chatID, viewers := range local {
+			h.notify(envelope{ChatID: chatID, Viewers: viewers, Presence: true})
+		}
+		for _, chatID := range expired {
+			h.deliverPresence(chatID, h.Viewers(chatID))
+		}
+	}
+}
+
+// Start runs the presence heartbeat and, with a pool, the bridge to the other replicas
+func (h *Hub) Start() {
+	h.wg.Add(1)
+	go h.heartbeat()
+
+	if h.pool != nil {
+		h.wg.Add(1)
+		go h.listen()
+	}
+}
+
+// Stop closes every subscription, open streams end and their clients reconnect to another replica
+func (h *Hub) Stop() {
+	close(h.stop)
+
+	h.mu.Lock()
+	for _, subs := range h.subs {
+		for sub := range subs {
+			h.drop(sub)
+		}
+	}
+	h.mu.Unlock()
+
+	h.wg.Wait()
+}
@@ -8,7 +8,18 @@ import (
 // NewRepositories creates all repository implementations
 func NewRepositories(pool *pgxpool.Pool) *Repositories {
 	return &Repositories{
-		User:    postgres.NewUserRepo(pool),
-		Session: postgres.NewSessionRepo(pool),
+		User:        postgres.NewUserRepo(pool),
+		Identity:    postgres.NewIdentityRepo(pool),
+		UserToken:   postgres.NewUserTokenRepo(pool),
+		MFA:         postgres.NewMFARepo(pool),
+		Passkey:     postgres.NewPasskeyRepo(pool),
+		Login:       postgres.NewLoginRepo(pool),
+		Session:     postgres.NewSessionRepo(pool),
+		Preferences: postgres.NewPreferencesRepo(pool),
+		Itinerary:   postgres.NewItineraryRepo(pool),
+		Trip:        postgres.NewTripRepo(pool),
+		Share:       postgres.NewShareRepo(pool),
+		Template:    postgres.NewTemplateRepo(pool),
+		Job:         postgres.NewJobRepo(pool),
 	}
 }
@@ -2,6 +2,8 @@ package repositories
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
@@ -11,20 +13,151 @@ import (
 type UserRepository interface {
 	Create(ctx context.Context, user *models.User) error
 	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	GetByGoogleID(ctx context.Context, googleID string) (*models.User, error)
+	LinkGoogle(ctx context.Context, userID uuid.UUID, googleID string, unusablePassword string) error
 	Exists(ctx context.Context, email string) (bool, error)
+	MarkEmailVerified(ctx context.Context, userID uuid.UUID, email string) error
+	GetPasswordHash(ctx context.Context, userID uuid.UUID) (string, error)
+	UpdatePassword(ctx context.Context, userID uuid.UUID, passwordHash string) error
 	UpdateLastLogin(ctx context.Context, userID uuid.UUID) error
 	UpdateLastLoginAsync(userID uuid.UUID, email string)
 }
 
+// IdentityRepository stores users' accounts at OpenID Connect providers
+type IdentityRepository interface {
+	Get(ctx context.Context, provider, subject string) (*models.UserIdentity, error)
+	Link(ctx context.Context, identity *models.UserIdentity, unusablePassword string) error
+	Touch(ctx context.Context, provider, subject, email string) error
+}
+
+// UserTokenRepository stores single use tokens mailed to users
+type UserTokenRepository interface {
+	Create(ctx context.Context, token *models.UserToken) error
+	Consume(ctx context.Context, purpose, tokenHash string) (*models.UserToken, error)
+	CountSince(ctx context.Context, userID uuid.UUID, purpose string, since time.Time) (int, error)
+}
+
+// MFARepository stores second factors, authenticator app secrets and recovery codes
+type MFARepository interface {
+	GetTOTP(ctx context.Context, userID uuid.UUID) (*models.TOTP, error)
+	SetPendingTOTP(ctx context.Context, userID uuid.UUID, secret string) error
+	EnableTOTP(ctx context.Context, userID uuid.UUID, step int64, codeHashes []string) error
+	UseStep(ctx context.Context, userID uuid.UUID, step int64) error
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) error
+	CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error)
+	DisableTOTP(ctx context.Context, userID uuid.UUID) error
+}
+
+// PasskeyRepository stores WebAuthn credentials and the challenges of finished ceremonies
+type PasskeyRepository interface {
+	Create(ctx context.Context, passkey *models.Passkey) error
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]models.Passkey, error)
+	GetByCredentialID(ctx context.Context, credentialID []byte) (*models.Passkey, error)
+	RecordUse(ctx context.Context, id uuid.UUID, signCount uint32, backedUp bool) error
+	Delete(ctx context.Context, userID, id uuid.UUID) error
+	DeleteForUser(ctx context.Context, userID uuid.UUID) error
+	SpendChallenge(ctx context.Context, challengeHash string, expiresAt time.Time) error
+}
+
+// LoginRepository throttles failed logins and keeps the login audit trail
+type LoginRepository interface {
+	LockedUntil(ctx context.Context, keys []string) (time.Time, error)
+	RecordFailure(ctx context.Context, key string, since time.Time) (int, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Clear(ctx context.Context, key string) error
+	RecordAttempt(ctx context.Context, attempt *models.LoginAttempt) error
+}
+
+// PreferencesRepository stores users' travel profiles
+type PreferencesRepository interface {
+	Get(ctx context.Context, userID uuid.UUID) (*models.Preferences, error)
+	Upsert(ctx context.Context, prefs *models.Preferences) error
+}
+
+// SessionRepository stores refresh sessions, looked up by the hash of their refresh token
 type SessionRepository interface {
 	Create(ctx context.Context, session *models.Session) error
-	GetByToken(ctx context.Context, refreshToken string) (*models.Session, error)
-	RevokeSessionByToken(ctx context.Context, refreshToken string) error
+	GetByToken(ctx context.Context, tokenHash string) (*models.Session, error)
+	Rotate(ctx context.Context, current *models.Session, next *models.Session) error
+	RevokeSessionByToken(ctx context.Context, tokenHash string) error
+	RevokeFamily(ctx context.Context, familyID uuid.UUID) error
+	FamilyActive(ctx context.Context, familyID uuid.UUID, userID uuid.UUID) (bool, error)
+	ListActive(ctx context.Context, userID uuid.UUID) ([]models.Session, error)
+	RevokeForUser(ctx context.Context, userID uuid.UUID, familyID uuid.UUID) error
 	RevokeSessionByUserID(ctx context.Context, userID uuid.UUID) error
 }
 
+// ItineraryRepository stores itineraries as immutable versions per chat
+type ItineraryRepository interface {
+	SaveVersion(ctx context.Context, chatID string, userID *uuid.UUID, version *models.ItineraryVersion) (*models.Itinerary, error)
+	AppendVersion(ctx context.Context, itineraryID uuid.UUID, expectedVersion int, version *models.ItineraryVersion) (*models.Itinerary, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Itinerary, error)
+	GetByChatID(ctx context.Context, chatID string) (*models.Itinerary, error)
+	ListVersions(ctx context.Context, itineraryID uuid.UUID) ([]models.ItineraryVersion, error)
+	GetVersion(ctx context.Context, itineraryID uuid.UUID, version int) (*models.ItineraryVersion, error)
+}
+
+// TripRepository stores who can access a chat and its itinerary
+type TripRepository interface {
+	Claim(ctx context.Context, chatID string, userID uuid.UUID) (bool, error)
+	GetRole(ctx context.Context, chatID string, userID uuid.UUID) (string, error)
+	ListMembers(ctx context.Context, chatID string) ([]models.TripMember, error)
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]models.TripMember, error)
+	UpdateRole(ctx context.Context, chatID string, userID uuid.UUID, role string) error
+	RemoveMember(ctx context.Context, chatID string, userID uuid.UUID) error
+
+	CreateInvitation(ctx context.Context, invitation *models.TripInvitation) error
+	GetInvitation(ctx context.Context, id uuid.UUID) (*models.TripInvitation, error)
+	ListInvitations(ctx context.Context, chatID string) ([]models.TripInvitation, error)
+	ListPendingInvitations(ctx context.Context, email string) ([]models.TripInvitation, error)
+	RevokeInvitation(ctx context.Context, chatID string, id uuid.UUID) error
+	AcceptInvitation(ctx context.Context, id uuid.UUID, userID uuid.UUID) error
+}
+
+// TemplateRepository stores reusable itineraries
+type TemplateRepository interface {
+	Create(ctx context.Context, template *models.ItineraryTemplate) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.ItineraryTemplate, error)
+	Search(ctx context.Context, query models.TemplateQuery) ([]models.ItineraryTemplate, error)
+	MatchDestination(ctx context.Context, text string, limit int) ([]models.ItineraryTemplate, error)
+	IncrementUses(ctx context.Context, id uuid.UUID) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+// ShareRepository stores public links to itineraries
+type ShareRepository interface {
+	Create(ctx context.Context, share *models.ItineraryShare) error
+	GetByTokenHash(ctx context.Context, tokenHash string) (*models.ItineraryShare, error)
+	ListByItinerary(ctx context.Context, itineraryID uuid.UUID) ([]models.ItineraryShare, error)
+	Revoke(ctx context.Context, itineraryID uuid.UUID, shareID uuid.UUID) error
+}
+
+// JobRepository is a durable queue of background jobs
+type JobRepository interface {
+	Enqueue(ctx context.Context, job *models.Job) error
+	Claim(ctx context.Context) (*models.Job, error)
+	Complete(ctx context.Context, id uuid.UUID, result json.RawMessage) error
+	Retry(ctx context.Context, id uuid.UUID, lastError string, runAt time.Time) error
+	Fail(ctx context.Context, id uuid.UUID, lastError string) error
+	RequeueStale(ctx context.Context, lockedBefore time.Time) (int64, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Job, error)
+	ListByChatID(ctx context.Context, chatID string) ([]models.Job, error)
+}
+
 // Repositories aggregates all repositories
 type Repositories struct {
-	User    UserRepository
-	Session SessionRepository
+	User        UserRepository
+	Identity    IdentityRepository
+	UserToken   UserTokenRepository
+	MFA         MFARepository
+	Passkey     PasskeyRepository
+	Login       LoginRepository
+	Session     SessionRepository
+	Preferences PreferencesRepository
+	Itinerary   ItineraryRepository
+	Trip        TripRepository
+	Share       ShareRepository
+	Template    TemplateRepository
+	Job         JobRepository
 }
@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+type IdentityRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewIdentityRepo(pool *pgxpool.Pool) *IdentityRepo {
+	return &IdentityRepo{pool: pool}
+}
+
+func (r *IdentityRepo) Get(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	query := `
+	SELECT provider, subject, user_id, COALESCE(email, ''), created_at, last_login_at
+	FROM user_identities WHERE provider = $1 AND subject = $2`
+
+	id := &models.UserIdentity{}
+	err := r.pool.QueryRow(ctx, query, provider, subject).Scan(
+		&id.Provider, &id.Subject, &id.UserID, &id.Email, &id.CreatedAt, &id.LastLoginAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+
+	return id, nil
+}
+
+// Link attaches an identity whose email the provider vouches for to a user. As with Google
+// accounts, a user who had not verified the email may not be its owner, so their password
+// is replaced by the given unusable hash
+func (r *IdentityRepo) Link(ctx context.Context, identity *models.UserIdentity, unusablePassword string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	INSERT INTO user_identities (provider, subject, user_id, email, last_login_at)
+	VALUES ($1, $2, $3, NULLIF($4, ''), NOW())
+	RETURNING created_at, last_login_at`
+
+	err = tx.QueryRow(ctx, query, identity.Provider, identity.Subject, identity.UserID, identity.Email).
+		Scan(&identity.CreatedAt, &identity.LastLoginAt)
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	query = `
+	UPDATE users
+	SET password = CASE WHEN email_verified THEN password ELSE $2 END,
+		email_verified = true,
+		updated_at = NOW()
+	WHERE id = $1`
+
+	if _, err := tx.Exec(ctx, query, identity.UserID, unusablePassword); err != nil {
+		return fmt.Errorf("failed to verify user email: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit identity link: %w", err)
+	}
+
+	return nil
+}
+
+// Touch records a sign in and the email the provider currently reports
+func (r *IdentityRepo) Touch(ctx context.Context, provider, subject, email string) error {
+	query := `
+	UPDATE user_identities SET last_login_at = NOW(), email = NULLIF($3, '')
+	WHERE provider = $1 AND subject = $2`
+
+	if _, err := r.pool.Exec(ctx, query, provider, subject, email); err != nil {
+		return fmt.Errorf("failed to update identity: %w", err)
+	}
+
+	return nil
+}
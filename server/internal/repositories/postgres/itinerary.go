@@ -0,0 +1,190 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+type ItineraryRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewItineraryRepo(pool *pgxpool.Pool) *ItineraryRepo {
+	return &ItineraryRepo{pool: pool}
+}
+
+const itineraryColumns = `id, chat_id, user_id, current_version, created_at, updated_at`
+
+const itineraryVersionColumns = `id, itinerary_id, version, data, source, COALESCE(message, ''), created_by, created_at`
+
+func scanItinerary(row pgx.Row) (*models.Itinerary, error) {
+	itin := &models.Itinerary{}
+	err := row.Scan(&itin.ID, &itin.ChatID, &itin.UserID, &itin.CurrentVersion, &itin.CreatedAt, &itin.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get itinerary: %w", err)
+	}
+
+	return itin, nil
+}
+
+func scanItineraryVersion(row pgx.Row) (*models.ItineraryVersion, error) {
+	v := &models.ItineraryVersion{}
+	err := row.Scan(&v.ID, &v.ItineraryID, &v.Version, &v.Data, &v.Source, &v.Message, &v.CreatedBy, &v.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get itinerary version: %w", err)
+	}
+
+	return v, nil
+}
+
+// SaveVersion appends a new version to the chat's itinerary, creating the itinerary on first save
+func (r *ItineraryRepo) SaveVersion(ctx context.Context, chatID string, userID *uuid.UUID, version *models.ItineraryVersion) (*models.Itinerary, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// the upsert locks the itinerary row, serialising concurrent saves
+	upsert := `
+	INSERT INTO itineraries (chat_id, user_id)
+	VALUES ($1, $2)
+	ON CONFLICT (chat_id) DO UPDATE SET updated_at = NOW()
+	RETURNING ` + itineraryColumns
+
+	itin, err := scanItinerary(tx.QueryRow(ctx, upsert, chatID, userID))
+	if err != nil {
+		return nil, err
+	}
+
+	version.ItineraryID = itin.ID
+	version.Version = itin.CurrentVersion + 1
+
+	insert := `
+	INSERT INTO itinerary_versions (itinerary_id, version, data, source, message, created_by)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at`
+
+	err = tx.QueryRow(ctx, insert,
+		version.ItineraryID, version.Version, version.Data, version.Source, version.Message, version.CreatedBy,
+	).Scan(&version.ID, &version.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert itinerary version: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE itineraries SET current_version = $2 WHERE id = $1`, itin.ID, version.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update current version: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	itin.CurrentVersion = version.Version
+	return itin, nil
+}
+
+// AppendVersion adds a version only if the itinerary is still at expectedVersion
+func (r *ItineraryRepo) AppendVersion(ctx context.Context, itineraryID uuid.UUID, expectedVersion int, version *models.ItineraryVersion) (*models.Itinerary, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	bump := `
+	UPDATE itineraries
+	SET current_version = current_version + 1, updated_at = NOW()
+	WHERE id = $1 AND current_version = $2
+	RETURNING ` + itineraryColumns
+
+	itin, err := scanItinerary(tx.QueryRow(ctx, bump, itineraryID, expectedVersion))
+	if errors.Is(err, models.ErrNotFound) {
+		if _, err := r.GetByID(ctx, itineraryID); err != nil {
+			return nil, err
+		}
+		return nil, models.ErrVersionConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	version.ItineraryID = itin.ID
+	version.Version = itin.CurrentVersion
+
+	insert := `
+	INSERT INTO itinerary_versions (itinerary_id, version, data, source, message, created_by)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at`
+
+	err = tx.QueryRow(ctx, insert,
+		version.ItineraryID, version.Version, version.Data, version.Source, version.Message, version.CreatedBy,
+	).Scan(&version.ID, &version.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert itinerary version: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return itin, nil
+}
+
+func (r *ItineraryRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Itinerary, error) {
+	query := `SELECT ` + itineraryColumns + ` FROM itineraries WHERE id = $1`
+	return scanItinerary(r.pool.QueryRow(ctx, query, id))
+}
+
+func (r *ItineraryRepo) GetByChatID(ctx context.Context, chatID string) (*models.Itinerary, error) {
+	query := `SELECT ` + itineraryColumns + ` FROM itineraries WHERE chat_id = $1`
+	return scanItinerary(r.pool.QueryRow(ctx, query, chatID))
+}
+
+// ListVersions returns every version of an itinerary, newest first
+func (r *ItineraryRepo) ListVersions(ctx context.Context, itineraryID uuid.UUID) ([]models.ItineraryVersion, error) {
+	query := `
+	SELECT ` + itineraryVersionColumns + `
+	FROM itinerary_versions
+	WHERE itinerary_id = $1
+	ORDER BY version DESC`
+
+	rows, err := r.pool.Query(ctx, query, itineraryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list itinerary versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []models.ItineraryVersion{}
+	for rows.Next() {
+		v, err := scanItineraryVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *v)
+	}
+
+	return versions, rows.Err()
+}
+
+func (r *ItineraryRepo) GetVersion(ctx context.Context, itineraryID uuid.UUID, version int) (*models.ItineraryVersion, error) {
+	query := `
+	SELECT ` + itineraryVersionColumns + `
+	FROM itinerary_versions
+	WHERE itinerary_id = $1 AND version = $2`
+
+	return scanItineraryVersion(r.pool.QueryRow(ctx, query, itineraryID, version))
+}
@@ -0,0 +1,155 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+type JobRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewJobRepo(pool *pgxpool.Pool) *JobRepo {
+	return &JobRepo{pool: pool}
+}
+
+const jobColumns = `id, kind, COALESCE(chat_id, ''), user_id, payload, result, status, attempts, max_attempts,
+	COALESCE(last_error, ''), run_at, finished_at, created_at, updated_at`
+
+func scanJob(row pgx.Row) (*models.Job, error) {
+	job := &models.Job{}
+	err := row.Scan(&job.ID, &job.Kind, &job.ChatID, &job.UserID, &job.Payload, &job.Result, &job.Status, &job.Attempts,
+		&job.MaxAttempts, &job.LastError, &job.RunAt, &job.FinishedAt, &job.CreatedAt, &job.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+
+	return job, nil
+}
+
+func (r *JobRepo) Enqueue(ctx context.Context, job *models.Job) error {
+	query := `
+	INSERT INTO jobs (kind, chat_id, user_id, payload, max_attempts)
+	VALUES ($1, NULLIF($2, ''), $3, $4, $5)
+	RETURNING ` + jobColumns
+
+	created, err := scanJob(r.pool.QueryRow(ctx, query, job.Kind, job.ChatID, job.UserID, job.Payload, job.MaxAttempts))
+	if err != nil {
+		return fmt.Errorf("failed to enqueue job: %w", err)
+	}
+
+	*job = *created
+	return nil
+}
+
+// Claim marks the next due job as running and returns it, ErrNotFound means the queue is empty
+func (r *JobRepo) Claim(ctx context.Context) (*models.Job, error) {
+	// SKIP LOCKED lets any number of workers, on any number of servers, claim jobs concurrently
+	query := `
+	UPDATE jobs
+	SET status = 'running', attempts = attempts + 1, locked_at = NOW(), updated_at = NOW()
+	WHERE id = (
+		SELECT id FROM jobs
+		WHERE status = 'queued' AND run_at <= NOW()
+		ORDER BY run_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + jobColumns
+
+	return scanJob(r.pool.QueryRow(ctx, query))
+}
+
+func (r *JobRepo) Complete(ctx context.Context, id uuid.UUID, result json.RawMessage) error {
+	query := `
+	UPDATE jobs
+	SET status = 'succeeded', result = $2, last_error = NULL, locked_at = NULL, finished_at = NOW(), updated_at = NOW()
+	WHERE id = $1`
+
+	if _, err := r.pool.Exec(ctx, query, id, result); err != nil {
+		return fmt.Errorf("failed to complete job: %w", err)
+	}
+
+	return nil
+}
+
+// Retry puts a failed attempt back in the queue to run again at runAt
+func (r *JobRepo) Retry(ctx context.Context, id uuid.UUID, lastError string, runAt time.Time) error {
+	query := `
+	UPDATE jobs
+	SET status = 'queued', last_error = $2, run_at = $3, locked_at = NULL, updated_at = NOW()
+	WHERE id = $1`
+
+	if _, err := r.pool.Exec(ctx, query, id, lastError, runAt); err != nil {
+		return fmt.Errorf("failed to reschedule job: %w", err)
+	}
+
+	return nil
+}
+
+func (r *JobRepo) Fail(ctx context.Context, id uuid.UUID, lastError string) error {
+	query := `
+	UPDATE jobs
+	SET status = 'failed', last_error = $2, locked_at = NULL, finished_at = NOW(), updated_at = NOW()
+	WHERE id = $1`
+
+	if _, err := r.pool.Exec(ctx, query, id, lastError); err != nil {
+		return fmt.Errorf("failed to mark job as failed: %w", err)
+	}
+
+	return nil
+}
+
+// RequeueStale returns jobs whose worker went away (e.g. the server restarted mid-job) to the queue
+func (r *JobRepo) RequeueStale(ctx context.Context, lockedBefore time.Time) (int64, error) {
+	query := `
+	UPDATE jobs
+	SET status = 'queued', run_at = NOW(), locked_at = NULL, updated_at = NOW(),
+		last_error = COALESCE(last_error, 'worker stopped before the job finished')
+	WHERE status = 'running' AND locked_at < $1`
+
+	tag, err := r.pool.Exec(ctx, query, lockedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue stale jobs: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func (r *JobRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = $1`
+	return scanJob(r.pool.QueryRow(ctx, query, id))
+}
+
+// ListByChatID returns a chat's jobs, newest first
+func (r *JobRepo) ListByChatID(ctx context.Context, chatID string) ([]models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE chat_id = $1 ORDER BY created_at DESC LIMIT 50`
+
+	rows, err := r.pool.Query(ctx, query, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []models.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+
+	return jobs, rows.Err()
+}
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+type LoginRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewLoginRepo(pool *pgxpool.Pool) *LoginRepo {
+	return &LoginRepo{pool: pool}
+}
+
+// LockedUntil returns the latest lockout among keys that has not run out yet, the zero time if none
+func (r *LoginRepo) LockedUntil(ctx context.Context, keys []string) (time.Time, error) {
+	query := `SELECT COALESCE(MAX(locked_until), 'epoch') FROM login_throttles WHERE key = ANY($1) AND locked_until > NOW()`
+
+	var until time.Time
+	if err := r.pool.QueryRow(ctx, query, keys).Scan(&until); err != nil {
+		return time.Time{}, fmt.Errorf("failed to check login throttles: %w", err)
+	}
+	if until.Unix() == 0 {
+		return time.Time{}, nil
+	}
+
+	return until, nil
+}
+
+// RecordFailure counts a failed login for key and returns the count. Failures from before
+// since are forgotten first
+func (r *LoginRepo) RecordFailure(ctx context.Context, key string, since time.Time) (int, error) {
+	query := `
+	INSERT INTO login_throttles (key, failures, last_failure_at) VALUES ($1, 1, NOW())
+	ON CONFLICT (key) DO UPDATE SET
+		failures = CASE WHEN login_throttles.last_failure_at < $2 THEN 1 ELSE login_throttles.failures + 1 END,
+		last_failure_at = NOW()
+	RETURNING failures`
+
+	var failures int
+	if err := r.pool.QueryRow(ctx, query, key, since).Scan(&failures); err != nil {
+		return 0, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	return failures, nil
+}
+
+func (r *LoginRepo) Lock(ctx context.Context, key string, until time.Time) error {
+	query := `UPDATE login_throttles SET locked_until = GREATEST(COALESCE(locked_until, $2), $2) WHERE key = $1`
+
+	if _, err := r.pool.Exec(ctx, query, key, until); err != nil {
+		return fmt.Errorf("failed to lock login: %w", err)
+	}
+
+	return nil
+}
+
+// Clear forgets the failures of key, after a successful login or password reset
+func (r *LoginRepo) Clear(ctx context.Context, key string) error {
+	if _, err := r.pool.Exec(ctx, `DELETE FROM login_throttles WHERE key = $1`, key); err != nil {
+		return fmt.Errorf("failed to clear login throttle: %w", err)
+	}
+
+	return nil
+}
+
+func (r *LoginRepo) RecordAttempt(ctx context.Context, attempt *models.LoginAttempt) error {
+	query := `
+	INSERT INTO login_attempts (user_id, email, ip_address, user_agent, success, reason)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at`
+
+	err := r.pool.QueryRow(ctx, query, attempt.UserID, attempt.Email, attempt.IPAddress, attempt.UserAgent,
+		attempt.Success, attempt.Reason).Scan(&attempt.ID, &attempt.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record login attempt: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// loginRepo connects to TEST_DATABASE_URL with a single connection, so the temporary table
+// standing in for login_throttles is the one every query sees and nothing real is touched
+func loginRepo(t *testing.T) *LoginRepo {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	cfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.MaxConns = 1
+
+	ctx := context.Background()
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	_, err = pool.Exec(ctx, `
+	CREATE TEMPORARY TABLE login_throttles (
+		key VARCHAR(320) PRIMARY KEY,
+		failures INTEGER NOT NULL DEFAULT 0,
+		locked_until TIMESTAMP WITH TIME ZONE,
+		last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewLoginRepo(pool)
+}
+
+func TestRecordFailure(t *testing.T) {
+	repo := loginRepo(t)
+	ctx := context.Background()
+	window := time.Now().Add(-time.Hour)
+
+	for want := 1; want <= 3; want++ {
+		got, err := repo.RecordFailure(ctx, "account:ana@example.com", window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("failure %d counted as %d", want, got)
+		}
+	}
+
+	// keys are counted apart
+	if got, _ := repo.RecordFailure(ctx, "ip:203.0.113.7", window); got != 1 {
+		t.Errorf("other key counted %d, want 1", got)
+	}
+
+	// once the last failure is older than the window the count starts over
+	if got, _ := repo.RecordFailure(ctx, "account:ana@example.com", time.Now().Add(time.Minute)); got != 1 {
+		t.Errorf("after the window counted %d, want 1", got)
+	}
+
+	// a lockout is kept until it runs out and the later of two wins
+	until := time.Now().Add(time.Minute)
+	if err := repo.Lock(ctx, "account:ana@example.com", until); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Lock(ctx, "account:ana@example.com", time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.LockedUntil(ctx, []string{"account:ana@example.com", "ip:203.0.113.7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Sub(until).Abs() > time.Millisecond {
+		t.Errorf("locked until %v, want %v", got, until)
+	}
+
+	if err := repo.Clear(ctx, "account:ana@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := repo.LockedUntil(ctx, []string{"account:ana@example.com"}); !got.IsZero() {
+		t.Errorf("cleared key is locked until %v", got)
+	}
+}
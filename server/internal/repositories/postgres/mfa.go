@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+type MFARepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewMFARepo(pool *pgxpool.Pool) *MFARepo {
+	return &MFARepo{pool: pool}
+}
+
+func (r *MFARepo) GetTOTP(ctx context.Context, userID uuid.UUID) (*models.TOTP, error) {
+	query := `SELECT user_id, secret, confirmed_at, last_step, created_at FROM user_totp WHERE user_id = $1`
+
+	t := &models.TOTP{}
+	err := r.pool.QueryRow(ctx, query, userID).Scan(&t.UserID, &t.Secret, &t.ConfirmedAt, &t.LastStep, &t.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get totp: %w", err)
+	}
+
+	return t, nil
+}
+
+// SetPendingTOTP stores a new unconfirmed secret, replacing an earlier unconfirmed one.
+// It returns models.ErrVersionConflict when TOTP is already enabled
+func (r *MFARepo) SetPendingTOTP(ctx context.Context, userID uuid.UUID, secret string) error {
+	query := `
+	INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_step = 0, created_at = NOW()
+	WHERE user_totp.confirmed_at IS NULL`
+
+	tag, err := r.pool.Exec(ctx, query, userID, secret)
+	if err != nil {
+		return fmt.Errorf("failed to store totp secret: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrVersionConflict
+	}
+
+	return nil
+}
+
+// EnableTOTP confirms the pending secret with the step of the code that proved it and
+// replaces the user's recovery codes
+func (r *MFARepo) EnableTOTP(ctx context.Context, userID uuid.UUID, step int64, codeHashes []string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+	UPDATE user_totp SET confirmed_at = NOW(), last_step = $2
+	WHERE user_id = $1 AND confirmed_at IS NULL`
+
+	tag, err := tx.Exec(ctx, query, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to enable totp: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit totp: %w", err)
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID uuid.UUID, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	query := `INSERT INTO user_recovery_codes (user_id, code_hash) SELECT $1, unnest($2::text[])`
+	if _, err := tx.Exec(ctx, query, userID, codeHashes); err != nil {
+		return fmt.Errorf("failed to store recovery codes: %w", err)
+	}
+
+	return nil
+}
+
+// UseStep records that a code for step was accepted. It returns models.ErrNotFound when
+// TOTP is not enabled or a code for this or a later step was already used
+func (r *MFARepo) UseStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	query := `
+	UPDATE user_totp SET last_step = $2
+	WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_step < $2`
+
+	tag, err := r.pool.Exec(ctx, query, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to record totp step: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+// UseRecoveryCode spends an unused recovery code, returning models.ErrNotFound otherwise
+func (r *MFARepo) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) error {
+	query := `
+	UPDATE user_recovery_codes SET used_at = NOW()
+	WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	tag, err := r.pool.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *MFARepo) CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error) {
+	query := `SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+
+	var n int
+	if err := r.pool.QueryRow(ctx, query, userID).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+
+	return n, nil
+}
+
+// DisableTOTP removes the secret and the recovery codes that came with it
+func (r *MFARepo) DisableTOTP(ctx context.Context, userID uuid.UUID) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete totp: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit totp removal: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+const passkeyColumns = `id, user_id, credential_id, public_key, sign_count, transports, aaguid,
+	backup_eligible, backed_up, name, created_at, last_used_at`
+
+type PasskeyRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewPasskeyRepo(pool *pgxpool.Pool) *PasskeyRepo {
+	return &PasskeyRepo{pool: pool}
+}
+
+func scanPasskey(row pgx.Row) (*models.Passkey, error) {
+	p := &models.Passkey{}
+	var signCount int64
+	err := row.Scan(&p.ID, &p.UserID, &p.CredentialID, &p.PublicKey, &signCount, &p.Transports, &p.AAGUID,
+		&p.BackupEligible, &p.BackedUp, &p.Name, &p.CreatedAt, &p.LastUsedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.SignCount = uint32(signCount)
+	return p, nil
+}
+
+func (r *PasskeyRepo) Create(ctx context.Context, p *models.Passkey) error {
+	if p.Transports == nil {
+		p.Transports = []string{}
+	}
+
+	query := `
+	INSERT INTO user_passkeys (user_id, credential_id, public_key, sign_count, transports, aaguid,
+		backup_eligible, backed_up, name)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id, created_at`
+
+	err := r.pool.QueryRow(ctx, query, p.UserID, p.CredentialID, p.PublicKey, int64(p.SignCount), p.Transports,
+		p.AAGUID, p.BackupEligible, p.BackedUp, p.Name).Scan(&p.ID, &p.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create passkey: %w", err)
+	}
+
+	return nil
+}
+
+func (r *PasskeyRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.Passkey, error) {
+	query := `SELECT ` + passkeyColumns + ` FROM user_passkeys WHERE user_id = $1 ORDER BY created_at`
+
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list passkeys: %w", err)
+	}
+	defer rows.Close()
+
+	passkeys := []models.Passkey{}
+	for rows.Next() {
+		p, err := scanPasskey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan passkey: %w", err)
+		}
+		passkeys = append(passkeys, *p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list passkeys: %w", err)
+	}
+
+	return passkeys, nil
+}
+
+func (r *PasskeyRepo) GetByCredentialID(ctx context.Context, credentialID []byte) (*models.Passkey, error) {
+	query := `SELECT ` + passkeyColumns + ` FROM user_passkeys WHERE credential_id = $1`
+
+	p, err := scanPasskey(r.pool.QueryRow(ctx, query, credentialID))
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		return nil, fmt.Errorf("failed to get passkey: %w", err)
+	}
+
+	return p, err
+}
+
+// RecordUse stores the counter and backup state of a successful assertion
+func (r *PasskeyRepo) RecordUse(ctx context.Context, id uuid.UUID, signCount uint32, backedUp bool) error {
+	query := `UPDATE user_passkeys SET sign_count = $2, backed_up = $3, last_used_at = NOW() WHERE id = $1`
+
+	if _, err := r.pool.Exec(ctx, query, id, int64(signCount), backedUp); err != nil {
+		return fmt.Errorf("failed to record passkey use: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes one of the user's passkeys, returning models.ErrNotFound for anyone else's
+func (r *PasskeyRepo) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM user_passkeys WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete passkey: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteForUser removes every passkey of the user
+func (r *PasskeyRepo) DeleteForUser(ctx context.Context, userID uuid.UUID) error {
+	if _, err := r.pool.Exec(ctx, `DELETE FROM user_passkeys WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete passkeys: %w", err)
+	}
+
+	return nil
+}
+
+// SpendChallenge records a ceremony's challenge as used. It returns models.ErrNotFound when
+// it already was, the response is a replay
+func (r *PasskeyRepo) SpendChallenge(ctx context.Context, challengeHash string, expiresAt time.Time) error {
+	if _, err := r.pool.Exec(ctx, `DELETE FROM webauthn_challenges WHERE expires_at < NOW()`); err != nil {
+		return fmt.Errorf("failed to clean up challenges: %w", err)
+	}
+
+	query := `INSERT INTO webauthn_challenges (challenge_hash, expires_at) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+
+	tag, err := r.pool.Exec(ctx, query, challengeHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to spend challenge: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
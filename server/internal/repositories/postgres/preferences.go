@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+type PreferencesRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewPreferencesRepo(pool *pgxpool.Pool) *PreferencesRepo {
+	return &PreferencesRepo{pool: pool}
+}
+
+func (r *PreferencesRepo) Get(ctx context.Context, userID uuid.UUID) (*models.Preferences, error) {
+	query := `
+	SELECT user_id, COALESCE(home_city, ''), COALESCE(home_currency, ''), dietary_restrictions,
+	       COALESCE(mobility_needs, ''), COALESCE(pace, ''), interests,
+	       COALESCE(accommodation_style, ''), COALESCE(language, ''), updated_at
+	FROM user_preferences WHERE user_id = $1`
+
+	p := &models.Preferences{}
+	err := r.pool.QueryRow(ctx, query, userID).Scan(
+		&p.UserID, &p.HomeCity, &p.HomeCurrency, &p.DietaryRestrictions,
+		&p.MobilityNeeds, &p.Pace, &p.Interests,
+		&p.AccommodationStyle, &p.Language, &p.UpdatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get preferences: %w", err)
+	}
+
+	return p, nil
+}
+
+// Upsert replaces the user's preferences
+func (r *PreferencesRepo) Upsert(ctx context.Context, p *models.Preferences) error {
+	query := `
+	INSERT INTO user_preferences
+		(user_id, home_city, home_currency, dietary_restrictions, mobility_needs, pace, interests, accommodation_style, language, updated_at)
+	VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, NULLIF($5, ''), NULLIF($6, ''), $7, NULLIF($8, ''), NULLIF($9, ''), NOW())
+	ON CONFLICT (user_id) DO UPDATE SET
+		home_city = EXCLUDED.home_city,
+		home_currency = EXCLUDED.home_currency,
+		dietary_restrictions = EXCLUDED.dietary_restrictions,
+		mobility_needs = EXCLUDED.mobility_needs,
+		pace = EXCLUDED.pace,
+		interests = EXCLUDED.interests,
+		accommodation_style = EXCLUDED.accommodation_style,
+		language = EXCLUDED.language,
+		updated_at = EXCLUDED.updated_at
+	RETURNING updated_at`
+
+	err := r.pool.QueryRow(ctx, query,
+		p.UserID, p.HomeCity, p.HomeCurrency, p.DietaryRestrictions, p.MobilityNeeds,
+		p.Pace, p.Interests, p.AccommodationStyle, p.Language,
+	).Scan(&p.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save preferences: %w", err)
+	}
+
+	return nil
+}
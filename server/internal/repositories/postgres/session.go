@@ -2,9 +2,12 @@ package postgres
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
 )
@@ -17,33 +20,193 @@ func NewSessionRepo(pool *pgxpool.Pool) *SessionRepo {
 	return &SessionRepo{pool: pool}
 }
 
-// Create a new Session with the details
-func (r *SessionRepo) Create(ctx context.Context, session *models.Session) error {
-	query := `
-	INSERT INTO sessions 
-	(user_id, token_hash, expires_at, created_at, last_used_at, device_info)
-    VALUES ($1, $2, $3, $4, $5, $6)`
+const sessionColumns = `id, family_id, user_id, token_hash, expires_at, created_at, last_used_at,
+	revoked_at, rotated_at, replaced_by, COALESCE(device_info, '{}'::jsonb)`
+
+func scanSession(row pgx.Row) (*models.Session, error) {
+	s := &models.Session{}
+	err := row.Scan(&s.ID, &s.FamilyID, &s.UserID, &s.TokenHash, &s.ExpiresAt, &s.CreatedAt, &s.LastUsedAt,
+		&s.RevokedAt, &s.RotatedAt, &s.ReplacedBy, &s.DeviceInfo)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	return s, nil
+}
+
+const insertSession = `
+	INSERT INTO sessions
+	(id, family_id, user_id, token_hash, expires_at, created_at, last_used_at, device_info)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
 
+// Create a new Session with the details, a session without a family starts its own
+func (r *SessionRepo) Create(ctx context.Context, session *models.Session) error {
 	now := time.Now()
+	session.ID = uuid.New()
+	if session.FamilyID == uuid.Nil {
+		session.FamilyID = session.ID
+	}
 	session.CreatedAt = now
 	session.LastUsedAt = &now
 
-	_, err := r.pool.Exec(ctx, query, session.UserID, session.TokenHash, session.ExpiresAt, session.CreatedAt, session.LastUsedAt, session.DeviceInfo)
+	_, err := r.pool.Exec(ctx, insertSession,
+		session.ID, session.FamilyID, session.UserID, session.TokenHash, session.ExpiresAt,
+		session.CreatedAt, session.LastUsedAt, session.DeviceInfo,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return nil
+}
 
+// GetByToken looks a session up by the hash of its refresh token, whatever its state
+func (r *SessionRepo) GetByToken(ctx context.Context, tokenHash string) (*models.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE token_hash = $1`
+	return scanSession(r.pool.QueryRow(ctx, query, tokenHash))
+}
+
+// Rotate marks the current session as rotated and stores next in the same family.
+// It returns models.ErrSessionReused when current was rotated or revoked in the meantime,
+// which is how two concurrent refreshes with the same token are told apart
+func (r *SessionRepo) Rotate(ctx context.Context, current *models.Session, next *models.Session) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	next.ID = uuid.New()
+	next.FamilyID = current.FamilyID
+	next.UserID = current.UserID
+	next.CreatedAt = now
+	next.LastUsedAt = &now
+
+	_, err = tx.Exec(ctx, insertSession,
+		next.ID, next.FamilyID, next.UserID, next.TokenHash, next.ExpiresAt,
+		next.CreatedAt, next.LastUsedAt, next.DeviceInfo,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	query := `
+	UPDATE sessions SET rotated_at = $2, replaced_by = $3, last_used_at = $2
+	WHERE id = $1 AND rotated_at IS NULL AND revoked_at IS NULL`
+
+	tag, err := tx.Exec(ctx, query, current.ID, now, next.ID)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to rotate session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrSessionReused
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit session rotation: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeSessionByToken revokes the session a refresh token belongs to, together with the
+// rest of its family since the earlier, rotated tokens of a login are no use on their own
+func (r *SessionRepo) RevokeSessionByToken(ctx context.Context, tokenHash string) error {
+	query := `
+	UPDATE sessions SET revoked_at = NOW()
+	WHERE family_id = (SELECT family_id FROM sessions WHERE token_hash = $1) AND revoked_at IS NULL`
+
+	if _, err := r.pool.Exec(ctx, query, tokenHash); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
 	}
 
 	return nil
 }
 
-func (r *SessionRepo) GetByToken(ctx context.Context, refreshToken string) (*models.Session, error) {
-	return nil, nil
+// RevokeFamily revokes every session descending from the same login
+func (r *SessionRepo) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+
+	if _, err := r.pool.Exec(ctx, query, familyID); err != nil {
+		return fmt.Errorf("failed to revoke session family: %w", err)
+	}
+
+	return nil
 }
-func (r *SessionRepo) RevokeSessionByToken(ctx context.Context, refreshToken string) error {
+
+// FamilyActive reports whether a login of the user still has a session that can be refreshed
+func (r *SessionRepo) FamilyActive(ctx context.Context, familyID uuid.UUID, userID uuid.UUID) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM sessions
+		WHERE family_id = $1 AND user_id = $2
+		AND revoked_at IS NULL AND rotated_at IS NULL AND expires_at > NOW()
+	)`
+
+	var active bool
+	if err := r.pool.QueryRow(ctx, query, familyID, userID).Scan(&active); err != nil {
+		return false, fmt.Errorf("failed to check session: %w", err)
+	}
+
+	return active, nil
+}
+
+// ListActive returns the user's logins that can still be refreshed, one per family, most
+// recently used first. CreatedAt is when the login started rather than its latest rotation
+func (r *SessionRepo) ListActive(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	query := `
+	SELECT s.id, s.family_id, s.user_id, s.token_hash, s.expires_at,
+		(SELECT MIN(f.created_at) FROM sessions f WHERE f.family_id = s.family_id),
+		s.last_used_at, s.revoked_at, s.rotated_at, s.replaced_by, COALESCE(s.device_info, '{}'::jsonb)
+	FROM sessions s
+	WHERE s.user_id = $1 AND s.revoked_at IS NULL AND s.rotated_at IS NULL AND s.expires_at > NOW()
+	ORDER BY s.last_used_at DESC NULLS LAST`
+
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *s)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeForUser revokes one of the user's logins, it returns models.ErrNotFound when the
+// family is not theirs or has nothing left to revoke
+func (r *SessionRepo) RevokeForUser(ctx context.Context, userID uuid.UUID, familyID uuid.UUID) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL`
+
+	tag, err := r.pool.Exec(ctx, query, familyID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+
 	return nil
 }
 
+// RevokeSessionByUserID revokes all of a user's sessions
 func (r *SessionRepo) RevokeSessionByUserID(ctx context.Context, userID uuid.UUID) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+
+	if _, err := r.pool.Exec(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to revoke user sessions: %w", err)
+	}
+
 	return nil
 }
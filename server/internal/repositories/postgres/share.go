@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+type ShareRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewShareRepo(pool *pgxpool.Pool) *ShareRepo {
+	return &ShareRepo{pool: pool}
+}
+
+const shareColumns = `id, itinerary_id, token_hash, permission, expires_at, revoked_at, created_by, created_at`
+
+func scanShare(row pgx.Row) (*models.ItineraryShare, error) {
+	s := &models.ItineraryShare{}
+	err := row.Scan(&s.ID, &s.ItineraryID, &s.TokenHash, &s.Permission, &s.ExpiresAt, &s.RevokedAt, &s.CreatedBy, &s.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get itinerary share: %w", err)
+	}
+
+	return s, nil
+}
+
+func (r *ShareRepo) Create(ctx context.Context, share *models.ItineraryShare) error {
+	query := `
+	INSERT INTO itinerary_shares (itinerary_id, token_hash, permission, expires_at, created_by)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+
+	err := r.pool.QueryRow(ctx, query,
+		share.ItineraryID, share.TokenHash, share.Permission, share.ExpiresAt, share.CreatedBy,
+	).Scan(&share.ID, &share.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create itinerary share: %w", err)
+	}
+
+	return nil
+}
+
+func (r *ShareRepo) GetByTokenHash(ctx context.Context, tokenHash string) (*models.ItineraryShare, error) {
+	query := `SELECT ` + shareColumns + ` FROM itinerary_shares WHERE token_hash = $1`
+	return scanShare(r.pool.QueryRow(ctx, query, tokenHash))
+}
+
+// ListByItinerary returns every share of an itinerary, including revoked and expired ones, newest first
+func (r *ShareRepo) ListByItinerary(ctx context.Context, itineraryID uuid.UUID) ([]models.ItineraryShare, error) {
+	query := `SELECT ` + shareColumns + ` FROM itinerary_shares WHERE itinerary_id = $1 ORDER BY created_at DESC`
+
+	rows, err := r.pool.Query(ctx, query, itineraryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list itinerary shares: %w", err)
+	}
+	defer rows.Close()
+
+	shares := []models.ItineraryShare{}
+	for rows.Next() {
+		s, err := scanShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, *s)
+	}
+
+	return shares, rows.Err()
+}
+
+func (r *ShareRepo) Revoke(ctx context.Context, itineraryID uuid.UUID, shareID uuid.UUID) error {
+	query := `
+	UPDATE itinerary_shares
+	SET revoked_at = COALESCE(revoked_at, NOW())
+	WHERE id = $1 AND itinerary_id = $2`
+
+	tag, err := r.pool.Exec(ctx, query, shareID, itineraryID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke itinerary share: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+const defaultTemplateLimit = 20
+
+type TemplateRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewTemplateRepo(pool *pgxpool.Pool) *TemplateRepo {
+	return &TemplateRepo{pool: pool}
+}
+
+const templateColumns = `id, title, destination, duration_days, COALESCE(pace, ''), interests, data, public, uses, created_by, created_at`
+
+func scanTemplate(row pgx.Row) (*models.ItineraryTemplate, error) {
+	t := &models.ItineraryTemplate{}
+	err := row.Scan(&t.ID, &t.Title, &t.Destination, &t.DurationDays, &t.Pace, &t.Interests, &t.Data, &t.Public, &t.Uses, &t.CreatedBy, &t.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get itinerary template: %w", err)
+	}
+
+	return t, nil
+}
+
+func (r *TemplateRepo) Create(ctx context.Context, template *models.ItineraryTemplate) error {
+	query := `
+	INSERT INTO itinerary_templates (title, destination, duration_days, pace, interests, data, public, created_by)
+	VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8)
+	RETURNING id, created_at`
+
+	err := r.pool.QueryRow(ctx, query,
+		template.Title, template.Destination, template.DurationDays, template.Pace, template.Interests,
+		template.Data, template.Public, template.CreatedBy,
+	).Scan(&template.ID, &template.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create itinerary template: %w", err)
+	}
+
+	return nil
+}
+
+func (r *TemplateRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.ItineraryTemplate, error) {
+	query := `SELECT ` + templateColumns + ` FROM itinerary_templates WHERE id = $1`
+	return scanTemplate(r.pool.QueryRow(ctx, query, id))
+}
+
+func (r *TemplateRepo) list(ctx context.Context, query string, args ...any) ([]models.ItineraryTemplate, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list itinerary templates: %w", err)
+	}
+	defer rows.Close()
+
+	templates := []models.ItineraryTemplate{}
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, *t)
+	}
+
+	return templates, rows.Err()
+}
+
+// Search returns public templates and the user's own that match the query, most used first
+func (r *TemplateRepo) Search(ctx context.Context, q models.TemplateQuery) ([]models.ItineraryTemplate, error) {
+	var where []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.UserID != nil {
+		where = append(where, "(public OR created_by = "+arg(*q.UserID)+")")
+	} else {
+		where = append(where, "public")
+	}
+	if q.Destination != "" {
+		where = append(where, "LOWER(destination) LIKE '%' || LOWER("+arg(q.Destination)+") || '%'")
+	}
+	if q.Days > 0 {
+		where = append(where, "duration_days = "+arg(q.Days))
+	}
+	if q.Pace != "" {
+		where = append(where, "pace = "+arg(q.Pace))
+	}
+	if len(q.Interests) > 0 {
+		where = append(where, "interests @> "+arg(q.Interests))
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultTemplateLimit
+	}
+
+	query := `
+	SELECT ` + templateColumns + `
+	FROM itinerary_templates
+	WHERE ` + strings.Join(where, " AND ") + `
+	ORDER BY public DESC, uses DESC, created_at DESC
+	LIMIT ` + arg(limit)
+
+	return r.list(ctx, query, args...)
+}
+
+// MatchDestination returns the most used public templates whose destination is mentioned in text
+func (r *TemplateRepo) MatchDestination(ctx context.Context, text string, limit int) ([]models.ItineraryTemplate, error) {
+	query := `
+	SELECT ` + templateColumns + `
+	FROM itinerary_templates
+	WHERE public AND POSITION(LOWER(destination) IN LOWER($1)) > 0
+	ORDER BY uses DESC, created_at DESC
+	LIMIT $2`
+
+	return r.list(ctx, query, text, limit)
+}
+
+func (r *TemplateRepo) IncrementUses(ctx context.Context, id uuid.UUID) error {
+	_, err := r.pool.Exec(ctx, `UPDATE itinerary_templates SET uses = uses + 1 WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to count template use: %w", err)
+	}
+
+	return nil
+}
+
+func (r *TemplateRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM itinerary_templates WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete itinerary template: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,260 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+type TripRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewTripRepo(pool *pgxpool.Pool) *TripRepo {
+	return &TripRepo{pool: pool}
+}
+
+const tripMemberColumns = `m.chat_id, m.user_id, m.role, m.invited_by, m.created_at, u.email, u.username`
+
+const tripInvitationColumns = `id, chat_id, email, role, invited_by, expires_at, accepted_at, accepted_by, revoked_at, created_at`
+
+func scanTripMember(row pgx.Row) (*models.TripMember, error) {
+	m := &models.TripMember{}
+	err := row.Scan(&m.ChatID, &m.UserID, &m.Role, &m.InvitedBy, &m.CreatedAt, &m.Email, &m.UserName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trip member: %w", err)
+	}
+
+	return m, nil
+}
+
+func scanTripInvitation(row pgx.Row) (*models.TripInvitation, error) {
+	i := &models.TripInvitation{}
+	err := row.Scan(&i.ID, &i.ChatID, &i.Email, &i.Role, &i.InvitedBy, &i.ExpiresAt, &i.AcceptedAt, &i.AcceptedBy, &i.RevokedAt, &i.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trip invitation: %w", err)
+	}
+
+	return i, nil
+}
+
+// Claim makes userID the owner of a chat nobody owns yet, it reports whether the chat was claimed
+func (r *TripRepo) Claim(ctx context.Context, chatID string, userID uuid.UUID) (bool, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// the primary key decides between concurrent claims
+	tag, err := tx.Exec(ctx, `INSERT INTO trips (chat_id, created_by) VALUES ($1, $2) ON CONFLICT (chat_id) DO NOTHING`, chatID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to create trip: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO trip_members (chat_id, user_id, role) VALUES ($1, $2, $3)`, chatID, userID, models.TripRoleOwner)
+	if err != nil {
+		return false, fmt.Errorf("failed to add trip owner: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *TripRepo) GetRole(ctx context.Context, chatID string, userID uuid.UUID) (string, error) {
+	var role string
+	err := r.pool.QueryRow(ctx, `SELECT role FROM trip_members WHERE chat_id = $1 AND user_id = $2`, chatID, userID).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", models.ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get trip role: %w", err)
+	}
+
+	return role, nil
+}
+
+func (r *TripRepo) listMembers(ctx context.Context, where string, arg any) ([]models.TripMember, error) {
+	query := `
+	SELECT ` + tripMemberColumns + `
+	FROM trip_members m JOIN users u ON u.id = m.user_id
+	WHERE ` + where + `
+	ORDER BY m.created_at`
+
+	rows, err := r.pool.Query(ctx, query, arg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trip members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []models.TripMember{}
+	for rows.Next() {
+		m, err := scanTripMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, *m)
+	}
+
+	return members, rows.Err()
+}
+
+func (r *TripRepo) ListMembers(ctx context.Context, chatID string) ([]models.TripMember, error) {
+	return r.listMembers(ctx, "m.chat_id = $1", chatID)
+}
+
+// ListByUser returns the user's memberships, one per trip
+func (r *TripRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.TripMember, error) {
+	return r.listMembers(ctx, "m.user_id = $1", userID)
+}
+
+func (r *TripRepo) UpdateRole(ctx context.Context, chatID string, userID uuid.UUID, role string) error {
+	tag, err := r.pool.Exec(ctx, `UPDATE trip_members SET role = $3 WHERE chat_id = $1 AND user_id = $2`, chatID, userID, role)
+	if err != nil {
+		return fmt.Errorf("failed to update trip role: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *TripRepo) RemoveMember(ctx context.Context, chatID string, userID uuid.UUID) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM trip_members WHERE chat_id = $1 AND user_id = $2`, chatID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove trip member: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *TripRepo) CreateInvitation(ctx context.Context, invitation *models.TripInvitation) error {
+	query := `
+	INSERT INTO trip_invitations (chat_id, email, role, invited_by, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+
+	err := r.pool.QueryRow(ctx, query,
+		invitation.ChatID, invitation.Email, invitation.Role, invitation.InvitedBy, invitation.ExpiresAt,
+	).Scan(&invitation.ID, &invitation.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create trip invitation: %w", err)
+	}
+
+	return nil
+}
+
+func (r *TripRepo) GetInvitation(ctx context.Context, id uuid.UUID) (*models.TripInvitation, error) {
+	query := `SELECT ` + tripInvitationColumns + ` FROM trip_invitations WHERE id = $1`
+	return scanTripInvitation(r.pool.QueryRow(ctx, query, id))
+}
+
+func (r *TripRepo) listInvitations(ctx context.Context, query string, arg any) ([]models.TripInvitation, error) {
+	rows, err := r.pool.Query(ctx, query, arg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trip invitations: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := []models.TripInvitation{}
+	for rows.Next() {
+		i, err := scanTripInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *i)
+	}
+
+	return invitations, rows.Err()
+}
+
+// ListInvitations returns every invitation to a trip, newest first
+func (r *TripRepo) ListInvitations(ctx context.Context, chatID string) ([]models.TripInvitation, error) {
+	query := `SELECT ` + tripInvitationColumns + ` FROM trip_invitations WHERE chat_id = $1 ORDER BY created_at DESC`
+	return r.listInvitations(ctx, query, chatID)
+}
+
+// ListPendingInvitations returns the invitations an email address can still accept
+func (r *TripRepo) ListPendingInvitations(ctx context.Context, email string) ([]models.TripInvitation, error) {
+	query := `
+	SELECT ` + tripInvitationColumns + `
+	FROM trip_invitations
+	WHERE LOWER(email) = LOWER($1) AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+	ORDER BY created_at DESC`
+	return r.listInvitations(ctx, query, email)
+}
+
+func (r *TripRepo) RevokeInvitation(ctx context.Context, chatID string, id uuid.UUID) error {
+	query := `
+	UPDATE trip_invitations
+	SET revoked_at = COALESCE(revoked_at, NOW())
+	WHERE id = $1 AND chat_id = $2 AND accepted_at IS NULL`
+
+	tag, err := r.pool.Exec(ctx, query, id, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke trip invitation: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+// AcceptInvitation marks a pending invitation accepted and adds the user to the trip,
+// existing members keep their role
+func (r *TripRepo) AcceptInvitation(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	accept := `
+	UPDATE trip_invitations
+	SET accepted_at = NOW(), accepted_by = $2
+	WHERE id = $1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+	RETURNING ` + tripInvitationColumns
+
+	invitation, err := scanTripInvitation(tx.QueryRow(ctx, accept, id, userID))
+	if err != nil {
+		return err
+	}
+
+	join := `
+	INSERT INTO trip_members (chat_id, user_id, role, invited_by)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (chat_id, user_id) DO NOTHING`
+
+	_, err = tx.Exec(ctx, join, invitation.ChatID, userID, invitation.Role, invitation.InvitedBy)
+	if err != nil {
+		return fmt.Errorf("failed to add trip member: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
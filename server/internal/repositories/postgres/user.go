@@ -72,7 +72,7 @@ func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*models.User,
 	)
 
 	if err == pgx.ErrNoRows {
-		return nil, fmt.Errorf("user not found")
+		return nil, models.ErrNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
@@ -81,6 +81,119 @@ func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*models.User,
 	return user, nil
 }
 
+// GetByID implements repositories.UserRepository
+func (r *UserRepo) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	query := `
+        SELECT id, email, COALESCE(first_name, ''), COALESCE(last_name, ''), username, google_id, twitter_id,
+               email_verified, is_active, is_admin, created_at, updated_at, last_login_at
+        FROM users WHERE id = $1 AND is_active = true`
+
+	user := &models.User{}
+	err := r.pool.QueryRow(ctx, query, id).Scan(
+		&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.UserName, &user.GoogleID, &user.TwitterID, &user.EmailVerified, &user.IsActive, &user.IsAdmin,
+		&user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
+	)
+
+	if err == pgx.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+// GetByGoogleID returns the user who signed in with the Google account before
+func (r *UserRepo) GetByGoogleID(ctx context.Context, googleID string) (*models.User, error) {
+	query := `
+        SELECT id, email, COALESCE(first_name, ''), COALESCE(last_name, ''), username, google_id, twitter_id,
+               email_verified, is_active, is_admin, created_at, updated_at, last_login_at
+        FROM users WHERE google_id = $1 AND is_active = true`
+
+	user := &models.User{}
+	err := r.pool.QueryRow(ctx, query, googleID).Scan(
+		&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.UserName, &user.GoogleID, &user.TwitterID, &user.EmailVerified, &user.IsActive, &user.IsAdmin,
+		&user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt,
+	)
+
+	if err == pgx.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+// LinkGoogle attaches a Google account to a user whose email Google has verified. If the user
+// had not verified the email themselves the account may have been registered by someone else,
+// so its password is replaced by the given unusable hash
+func (r *UserRepo) LinkGoogle(ctx context.Context, userID uuid.UUID, googleID string, unusablePassword string) error {
+	query := `
+	UPDATE users
+	SET google_id = $2,
+		password = CASE WHEN email_verified THEN password ELSE $3 END,
+		email_verified = true,
+		updated_at = NOW()
+	WHERE id = $1`
+
+	_, err := r.pool.Exec(ctx, query, userID, googleID, unusablePassword)
+	if err != nil {
+		return fmt.Errorf("failed to link google account: %w", err)
+	}
+
+	return nil
+}
+
+// MarkEmailVerified verifies the user's email, unless it changed since the link was sent.
+// It returns models.ErrNotFound in that case
+func (r *UserRepo) MarkEmailVerified(ctx context.Context, userID uuid.UUID, email string) error {
+	query := `
+	UPDATE users SET email_verified = true, updated_at = NOW()
+	WHERE id = $1 AND email = $2 AND is_active = true`
+
+	tag, err := r.pool.Exec(ctx, query, userID, email)
+	if err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *UserRepo) GetPasswordHash(ctx context.Context, userID uuid.UUID) (string, error) {
+	query := `SELECT password FROM users WHERE id = $1 AND is_active = true`
+
+	var hash string
+	err := r.pool.QueryRow(ctx, query, userID).Scan(&hash)
+	if err == pgx.ErrNoRows {
+		return "", models.ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get password: %w", err)
+	}
+
+	return hash, nil
+}
+
+func (r *UserRepo) UpdatePassword(ctx context.Context, userID uuid.UUID, passwordHash string) error {
+	query := `UPDATE users SET password = $2, updated_at = NOW() WHERE id = $1 AND is_active = true`
+
+	tag, err := r.pool.Exec(ctx, query, userID, passwordHash)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
 func (r *UserRepo) UpdateLastLogin(ctx context.Context, userID uuid.UUID) error {
 	query := `
 	UPDATE users 
@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/models"
+)
+
+type UserTokenRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewUserTokenRepo(pool *pgxpool.Pool) *UserTokenRepo {
+	return &UserTokenRepo{pool: pool}
+}
+
+// Create stores a new token and retires the user's earlier ones for the same purpose,
+// only the latest link mailed works
+func (r *UserTokenRepo) Create(ctx context.Context, token *models.UserToken) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE user_tokens SET used_at = NOW() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`
+	if _, err := tx.Exec(ctx, query, token.UserID, token.Purpose); err != nil {
+		return fmt.Errorf("failed to retire user tokens: %w", err)
+	}
+
+	query = `
+	INSERT INTO user_tokens (user_id, purpose, token_hash, email, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+
+	err = tx.QueryRow(ctx, query, token.UserID, token.Purpose, token.TokenHash, token.Email, token.ExpiresAt).
+		Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create user token: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit user token: %w", err)
+	}
+
+	return nil
+}
+
+// Consume marks an unused, unexpired token as used and returns it. It returns
+// models.ErrNotFound for unknown, used and expired tokens alike
+func (r *UserTokenRepo) Consume(ctx context.Context, purpose, tokenHash string) (*models.UserToken, error) {
+	query := `
+	UPDATE user_tokens SET used_at = NOW()
+	WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+	RETURNING id, user_id, purpose, token_hash, email, expires_at, used_at, created_at`
+
+	t := &models.UserToken{}
+	err := r.pool.QueryRow(ctx, query, tokenHash, purpose).Scan(
+		&t.ID, &t.UserID, &t.Purpose, &t.TokenHash, &t.Email, &t.ExpiresAt, &t.UsedAt, &t.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume user token: %w", err)
+	}
+
+	return t, nil
+}
+
+// CountSince counts the tokens sent to a user for a purpose since a time, to limit resends
+func (r *UserTokenRepo) CountSince(ctx context.Context, userID uuid.UUID, purpose string, since time.Time) (int, error) {
+	query := `SELECT COUNT(*) FROM user_tokens WHERE user_id = $1 AND purpose = $2 AND created_at > $3`
+
+	var n int
+	if err := r.pool.QueryRow(ctx, query, userID, purpose, since).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count user tokens: %w", err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,475 @@
+// Package webauthn implements the relying party side of WebAuthn registration and
+// authentication ceremonies (passkeys). Attestation is not requested, any authenticator
+// the browser offers is accepted
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Timeout is how long the browser gives the user to complete a ceremony
+const Timeout = 5 * time.Minute
+
+// User verification requirements
+const (
+	VerificationRequired    = "required"
+	VerificationPreferred   = "preferred"
+	VerificationDiscouraged = "discouraged"
+)
+
+// authenticator data flags
+const (
+	flagUserPresent    = 0x01
+	flagUserVerified   = 0x04
+	flagBackupEligible = 0x08
+	flagBackedUp       = 0x10
+	flagAttestedData   = 0x40
+)
+
+var (
+	// ErrInvalidResponse is returned for responses that cannot be parsed
+	ErrInvalidResponse = errors.New("invalid webauthn response")
+	// ErrVerification is returned for responses that parse but do not check out
+	ErrVerification = errors.New("webauthn verification failed")
+)
+
+// Config describes the relying party. RPID is the domain credentials are scoped to, the
+// origins are those pages using the API may be served from
+type Config struct {
+	RPID    string
+	RPName  string
+	Origins []string
+}
+
+type RelyingParty struct {
+	cfg    Config
+	rpHash [32]byte
+}
+
+func New(cfg Config) *RelyingParty {
+	return &RelyingParty{cfg: cfg, rpHash: sha256.Sum256([]byte(cfg.RPID))}
+}
+
+// User is the account a credential is registered for. ID is the opaque user handle
+// authenticators store with discoverable credentials
+type User struct {
+	ID          []byte
+	Name        string
+	DisplayName string
+}
+
+// Credential is a registered public key credential
+type Credential struct {
+	ID             []byte
+	PublicKey      []byte // COSE_Key
+	SignCount      uint32
+	Transports     []string
+	AAGUID         []byte
+	BackupEligible bool
+	BackedUp       bool
+}
+
+// Session is what has to be kept between starting a ceremony and finishing it
+type Session struct {
+	Challenge          string   `json:"challenge"`
+	UserVerification   string   `json:"userVerification"`
+	AllowedCredentials [][]byte `json:"allowedCredentials,omitempty"`
+}
+
+// CredentialDescriptor identifies a credential to the browser
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// CreationOptions are PublicKeyCredentialCreationOptions in their JSON form, which browsers
+// read with PublicKeyCredential.parseCreationOptionsFromJSON
+type CreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// RequestOptions are PublicKeyCredentialRequestOptions in their JSON form, which browsers
+// read with PublicKeyCredential.parseRequestOptionsFromJSON
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationResponse is what PublicKeyCredential.toJSON returns after navigator.credentials.create
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports"`
+	} `json:"response"`
+}
+
+// AssertionResponse is what PublicKeyCredential.toJSON returns after navigator.credentials.get
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+type authenticatorData struct {
+	rpHash     []byte
+	flags      byte
+	signCount  uint32
+	aaguid     []byte
+	credential []byte
+	publicKey  []byte // COSE_Key, as the authenticator encoded it
+}
+
+// BeginRegistration starts creating a passkey for the user. Credentials the user already has
+// are excluded so the same authenticator is not registered twice
+func (rp *RelyingParty) BeginRegistration(user User, existing []Credential) (*CreationOptions, *Session, error) {
+	challenge, err := newChallenge()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := &CreationOptions{
+		Challenge:          challenge,
+		Timeout:            Timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(existing),
+		// passkeys are discoverable credentials, so login works without typing a username
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   VerificationPreferred,
+		},
+		Attestation: "none",
+	}
+	opts.RP.ID = rp.cfg.RPID
+	opts.RP.Name = rp.cfg.RPName
+	opts.User.ID = encode(user.ID)
+	opts.User.Name = user.Name
+	opts.User.DisplayName = user.DisplayName
+	for _, alg := range algorithms {
+		opts.PubKeyCredParams = append(opts.PubKeyCredParams, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+
+	return opts, &Session{Challenge: challenge, UserVerification: VerificationPreferred}, nil
+}
+
+// FinishRegistration verifies the browser's response and returns the new credential
+func (rp *RelyingParty) FinishRegistration(session *Session, resp *RegistrationResponse) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type", ErrInvalidResponse)
+	}
+
+	rawClientData, err := decode(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%w: client data: %v", ErrInvalidResponse, err)
+	}
+	if err := rp.checkClientData(rawClientData, "webauthn.create", session); err != nil {
+		return nil, err
+	}
+
+	rawObject, err := decode(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: attestation object: %v", ErrInvalidResponse, err)
+	}
+	item, _, err := decodeCBOR(rawObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: attestation object: %v", ErrInvalidResponse, err)
+	}
+	object, ok := item.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation object is not a map", ErrInvalidResponse)
+	}
+	rawAuthData, ok := object["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing authenticator data", ErrInvalidResponse)
+	}
+	// attestation is not requested, so the statement of authenticators that send one anyway
+	// is not checked. Nothing here depends on the make of the authenticator
+
+	data, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthenticatorData(data, session.UserVerification); err != nil {
+		return nil, err
+	}
+	if data.credential == nil {
+		return nil, fmt.Errorf("%w: no credential in authenticator data", ErrInvalidResponse)
+	}
+
+	if rawID, err := decode(resp.RawID); err != nil || !bytes.Equal(rawID, data.credential) {
+		return nil, fmt.Errorf("%w: credential id does not match", ErrVerification)
+	}
+
+	if _, err := parsePublicKey(data.publicKey); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+
+	return &Credential{
+		ID:             data.credential,
+		PublicKey:      data.publicKey,
+		SignCount:      data.signCount,
+		Transports:     resp.Response.Transports,
+		AAGUID:         data.aaguid,
+		BackupEligible: data.flags&flagBackupEligible != 0,
+		BackedUp:       data.flags&flagBackedUp != 0,
+	}, nil
+}
+
+// BeginLogin starts an assertion. Without allowed credentials the browser offers the user's
+// passkeys for the site, and the response says whose it is
+func (rp *RelyingParty) BeginLogin(allowed []Credential, userVerification string) (*RequestOptions, *Session, error) {
+	challenge, err := newChallenge()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	session := &Session{Challenge: challenge, UserVerification: userVerification}
+	for _, c := range allowed {
+		session.AllowedCredentials = append(session.AllowedCredentials, c.ID)
+	}
+
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          Timeout.Milliseconds(),
+		RPID:             rp.cfg.RPID,
+		AllowCredentials: descriptors(allowed),
+		UserVerification: userVerification,
+	}, session, nil
+}
+
+// CredentialLookup finds the stored credential an assertion is for. userHandle is empty
+// unless the credential is discoverable
+type CredentialLookup func(credentialID, userHandle []byte) (*Credential, error)
+
+// FinishLogin verifies an assertion against the stored credential and returns the credential
+// with its updated counter and backup state
+func (rp *RelyingParty) FinishLogin(session *Session, resp *AssertionResponse, lookup CredentialLookup) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type", ErrInvalidResponse)
+	}
+
+	credentialID, err := decode(resp.RawID)
+	if err != nil || len(credentialID) == 0 {
+		return nil, fmt.Errorf("%w: credential id", ErrInvalidResponse)
+	}
+	if len(session.AllowedCredentials) > 0 && !slices.ContainsFunc(session.AllowedCredentials, func(id []byte) bool {
+		return bytes.Equal(id, credentialID)
+	}) {
+		return nil, fmt.Errorf("%w: credential was not allowed", ErrVerification)
+	}
+
+	userHandle, err := decode(resp.Response.UserHandle)
+	if err != nil {
+		return nil, fmt.Errorf("%w: user handle", ErrInvalidResponse)
+	}
+
+	rawClientData, err := decode(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%w: client data: %v", ErrInvalidResponse, err)
+	}
+	rawAuthData, err := decode(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: authenticator data: %v", ErrInvalidResponse, err)
+	}
+	sig, err := decode(resp.Response.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidResponse, err)
+	}
+
+	if err := rp.checkClientData(rawClientData, "webauthn.get", session); err != nil {
+		return nil, err
+	}
+	data, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthenticatorData(data, session.UserVerification); err != nil {
+		return nil, err
+	}
+
+	stored, err := lookup(credentialID, userHandle)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := parsePublicKey(stored.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: stored key: %v", ErrVerification, err)
+	}
+
+	clientHash := sha256.Sum256(rawClientData)
+	if !key.verify(append(rawAuthData[:len(rawAuthData):len(rawAuthData)], clientHash[:]...), sig) {
+		return nil, fmt.Errorf("%w: bad signature", ErrVerification)
+	}
+
+	// a counter that does not go up means the key was copied, unless the authenticator keeps
+	// none, which synced passkeys do not
+	if (data.signCount != 0 || stored.SignCount != 0) && data.signCount <= stored.SignCount {
+		return nil, fmt.Errorf("%w: signature counter went backwards", ErrVerification)
+	}
+
+	updated := *stored
+	updated.SignCount = data.signCount
+	updated.BackedUp = data.flags&flagBackedUp != 0
+
+	return &updated, nil
+}
+
+func (rp *RelyingParty) checkClientData(raw []byte, ceremony string, session *Session) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return fmt.Errorf("%w: client data: %v", ErrInvalidResponse, err)
+	}
+
+	if cd.Type != ceremony {
+		return fmt.Errorf("%w: unexpected ceremony %q", ErrVerification, cd.Type)
+	}
+	if subtle.ConstantTimeCompare([]byte(cd.Challenge), []byte(session.Challenge)) != 1 {
+		return fmt.Errorf("%w: challenge does not match", ErrVerification)
+	}
+	if !slices.Contains(rp.cfg.Origins, cd.Origin) {
+		return fmt.Errorf("%w: unexpected origin %q", ErrVerification, cd.Origin)
+	}
+	if cd.CrossOrigin {
+		return fmt.Errorf("%w: cross origin requests are not allowed", ErrVerification)
+	}
+
+	return nil
+}
+
+func (rp *RelyingParty) checkAuthenticatorData(data *authenticatorData, userVerification string) error {
+	if subtle.ConstantTimeCompare(data.rpHash, rp.rpHash[:]) != 1 {
+		return fmt.Errorf("%w: credential is for another site", ErrVerification)
+	}
+	if data.flags&flagUserPresent == 0 {
+		return fmt.Errorf("%w: user was not present", ErrVerification)
+	}
+	if userVerification == VerificationRequired && data.flags&flagUserVerified == 0 {
+		return fmt.Errorf("%w: user was not verified", ErrVerification)
+	}
+	if data.flags&flagBackedUp != 0 && data.flags&flagBackupEligible == 0 {
+		return fmt.Errorf("%w: invalid backup flags", ErrVerification)
+	}
+
+	return nil
+}
+
+// parseAuthenticatorData reads the layout in section 6.1 of the WebAuthn spec
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrInvalidResponse)
+	}
+
+	data := &authenticatorData{
+		rpHash:    raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+
+	if data.flags&flagAttestedData == 0 {
+		return data, nil
+	}
+
+	rest := raw[37:]
+	if len(rest) < 18 {
+		return nil, fmt.Errorf("%w: attested credential data too short", ErrInvalidResponse)
+	}
+	data.aaguid = append([]byte(nil), rest[:16]...)
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+		return nil, fmt.Errorf("%w: invalid credential id", ErrInvalidResponse)
+	}
+	data.credential = append([]byte(nil), rest[:idLen]...)
+	rest = rest[idLen:]
+
+	// extensions may follow the key, its length is only known by decoding it
+	_, after, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: public key: %v", ErrInvalidResponse, err)
+	}
+	data.publicKey = append([]byte(nil), rest[:len(rest)-len(after)]...)
+
+	return data, nil
+}
+
+func descriptors(creds []Credential) []CredentialDescriptor {
+	out := make([]CredentialDescriptor, 0, len(creds))
+	for _, c := range creds {
+		out = append(out, CredentialDescriptor{Type: "public-key", ID: encode(c.ID), Transports: c.Transports})
+	}
+	return out
+}
+
+func newChallenge() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	return encode(b), nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decode reads base64url, with or without padding as browsers and libraries differ
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
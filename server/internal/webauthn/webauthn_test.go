@@ -0,0 +1,254 @@
+package webauthn_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/webauthn"
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/webauthn/webauthntest"
+)
+
+const origin = "https://app.example.com"
+
+var rp = webauthn.New(webauthn.Config{RPID: "app.example.com", RPName: "Kaiyo AI", Origins: []string{origin}})
+
+var user = webauthn.User{ID: []byte("user-handle"), Name: "ana@example.com", DisplayName: "Ana"}
+
+// register creates a passkey on the authenticator and returns it as the relying party stores it
+func register(t *testing.T, a *webauthntest.Authenticator) *webauthn.Credential {
+	t.Helper()
+
+	opts, session, err := rp.BeginRegistration(user, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := a.Create(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := rp.FinishRegistration(session, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cred
+}
+
+// lookupOf finds only the given credential, for the user it was registered for
+func lookupOf(cred *webauthn.Credential) webauthn.CredentialLookup {
+	return func(credentialID, userHandle []byte) (*webauthn.Credential, error) {
+		if !bytes.Equal(credentialID, cred.ID) || !bytes.Equal(userHandle, user.ID) {
+			return nil, errors.New("unknown credential")
+		}
+		return cred, nil
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	a := webauthntest.New(origin)
+	cred := register(t, a)
+
+	if ids := a.CredentialIDs(); len(ids) != 1 || !bytes.Equal(ids[0], cred.ID) {
+		t.Errorf("registered credential %x, the authenticator holds %x", cred.ID, ids)
+	}
+	if len(cred.PublicKey) == 0 || !cred.BackupEligible || cred.SignCount != 0 {
+		t.Errorf("unexpected credential %+v", cred)
+	}
+
+	// the same authenticator is not registered twice
+	opts, _, err := rp.BeginRegistration(user, []webauthn.Credential{*cred})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Create(opts); err == nil {
+		t.Error("existing credential was not excluded")
+	}
+}
+
+func TestRegistrationRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		origin string
+		tamper func(*webauthn.CreationOptions, *webauthn.Session)
+	}{
+		{name: "other origin", origin: "https://evil.example.com"},
+		{name: "other RP ID", tamper: func(o *webauthn.CreationOptions, _ *webauthn.Session) { o.RP.ID = "evil.example.com" }},
+		{name: "other challenge", tamper: func(_ *webauthn.CreationOptions, s *webauthn.Session) { s.Challenge = "other" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := webauthntest.New(origin)
+			if tt.origin != "" {
+				a.Origin = tt.origin
+			}
+
+			opts, session, err := rp.BeginRegistration(user, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.tamper != nil {
+				tt.tamper(opts, session)
+			}
+
+			resp, err := a.Create(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := rp.FinishRegistration(session, resp); !errors.Is(err, webauthn.ErrVerification) {
+				t.Errorf("got %v, want %v", err, webauthn.ErrVerification)
+			}
+		})
+	}
+}
+
+func TestLogin(t *testing.T) {
+	a := webauthntest.New(origin)
+	cred := register(t, a)
+
+	// discoverable, the browser offers any passkey for the site
+	opts, session, err := rp.BeginLogin(nil, webauthn.VerificationRequired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := a.Get(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := rp.FinishLogin(session, resp, lookupOf(cred))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(updated.ID, cred.ID) || updated.SignCount != 0 {
+		t.Errorf("unexpected credential %+v", updated)
+	}
+
+	// a ceremony's response is tied to its challenge
+	_, other, err := rp.BeginLogin(nil, webauthn.VerificationRequired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rp.FinishLogin(other, resp, lookupOf(cred)); !errors.Is(err, webauthn.ErrVerification) {
+		t.Errorf("response for another challenge: got %v, want %v", err, webauthn.ErrVerification)
+	}
+}
+
+func TestLoginRejects(t *testing.T) {
+	// a relying party on another domain that takes the same origin, as a phishing site would
+	other := webauthn.New(webauthn.Config{RPID: "evil.example.com", Origins: []string{origin}})
+
+	tests := []struct {
+		name    string
+		origin  string
+		rp      *webauthn.RelyingParty // registers the passkey and starts the login
+		require bool                   // requires user verification
+		skipUV  bool
+		tamper  func(*webauthn.AssertionResponse)
+	}{
+		{name: "other origin", origin: "https://evil.example.com"},
+		{name: "other RP ID", rp: other},
+		{name: "user not verified", require: true, skipUV: true},
+		{
+			name: "bad signature",
+			tamper: func(r *webauthn.AssertionResponse) {
+				sig, _ := base64.RawURLEncoding.DecodeString(r.Response.Signature)
+				sig[len(sig)-1] ^= 0xff
+				r.Response.Signature = base64.RawURLEncoding.EncodeToString(sig)
+			},
+		},
+		{
+			name: "wrong ceremony",
+			tamper: func(r *webauthn.AssertionResponse) {
+				raw, _ := base64.RawURLEncoding.DecodeString(r.Response.ClientDataJSON)
+				raw = bytes.Replace(raw, []byte("webauthn.get"), []byte("webauthn.create"), 1)
+				r.Response.ClientDataJSON = base64.RawURLEncoding.EncodeToString(raw)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := rp
+			if tt.rp != nil {
+				start = tt.rp
+			}
+
+			a := webauthntest.New(origin)
+			opts, session, err := start.BeginRegistration(user, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			created, err := a.Create(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cred, err := start.FinishRegistration(session, created)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.origin != "" {
+				a.Origin = tt.origin
+			}
+			a.SkipVerification = tt.skipUV
+
+			uv := webauthn.VerificationPreferred
+			if tt.require {
+				uv = webauthn.VerificationRequired
+			}
+			login, session, err := start.BeginLogin([]webauthn.Credential{*cred}, uv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := a.Get(login)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.tamper != nil {
+				tt.tamper(resp)
+			}
+
+			if _, err := rp.FinishLogin(session, resp, lookupOf(cred)); !errors.Is(err, webauthn.ErrVerification) {
+				t.Errorf("got %v, want %v", err, webauthn.ErrVerification)
+			}
+		})
+	}
+}
+
+func TestLoginSignCount(t *testing.T) {
+	a := webauthntest.New(origin)
+	a.Counter = true
+	cred := register(t, a)
+
+	// two logins started, the second one finished first
+	first, firstSession, _ := rp.BeginLogin([]webauthn.Credential{*cred}, webauthn.VerificationPreferred)
+	second, secondSession, _ := rp.BeginLogin([]webauthn.Credential{*cred}, webauthn.VerificationPreferred)
+	firstResp, err := a.Get(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondResp, err := a.Get(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := rp.FinishLogin(secondSession, secondResp, lookupOf(cred))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.SignCount != 2 {
+		t.Fatalf("sign count = %d, want 2", updated.SignCount)
+	}
+
+	// the older response's counter is behind the stored one, as a cloned key's would be
+	if _, err := rp.FinishLogin(firstSession, firstResp, lookupOf(updated)); !errors.Is(err, webauthn.ErrVerification) {
+		t.Errorf("got %v, want %v", err, webauthn.ErrVerification)
+	}
+
+	// and the same counter again is no better
+	if _, err := rp.FinishLogin(secondSession, secondResp, lookupOf(updated)); !errors.Is(err, webauthn.ErrVerification) {
+		t.Errorf("repeated counter: got %v, want %v", err, webauthn.ErrVerification)
+	}
+}
@@ -0,0 +1,249 @@
+// Package webauthntest is a software authenticator for tests. It creates P-256 passkeys and
+// answers registration and login options the way a browser and platform authenticator would
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/nakul-krishnakumar/kaiyo-ai/internal/webauthn"
+)
+
+// credential is a passkey the authenticator holds
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+// Authenticator acts for a browser on Origin. Counters start at zero and only increase when
+// Counter is set, like a hardware key; synced passkeys keep them at zero
+type Authenticator struct {
+	Origin string
+	// Counter makes the authenticator keep a signature counter
+	Counter bool
+	// SkipVerification answers without user verification, as a security key without a PIN would
+	SkipVerification bool
+
+	mu          sync.Mutex
+	credentials []*credential
+}
+
+func New(origin string) *Authenticator {
+	return &Authenticator{Origin: origin}
+}
+
+// Create answers navigator.credentials.create
+func (a *Authenticator) Create(opts *webauthn.CreationOptions) (*webauthn.RegistrationResponse, error) {
+	if !slices.ContainsFunc(opts.PubKeyCredParams, func(p webauthn.CredentialParameter) bool { return p.Alg == webauthn.AlgES256 }) {
+		return nil, errors.New("es256 not offered")
+	}
+
+	userHandle, err := decode(opts.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, excluded := range opts.ExcludeCredentials {
+		for _, c := range a.credentials {
+			if c.rpID == opts.RP.ID && encode(c.id) == excluded.ID {
+				return nil, errors.New("credential already registered")
+			}
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	c := &credential{id: id, rpID: opts.RP.ID, userHandle: userHandle, key: key}
+	a.credentials = append(a.credentials, c)
+
+	x, y := make([]byte, 32), make([]byte, 32)
+	key.PublicKey.X.FillBytes(x)
+	key.PublicKey.Y.FillBytes(y)
+
+	var cose encoder
+	cose.head(5, 5)
+	cose.int(1).int(2)    // kty EC2
+	cose.int(3).int(-7)   // alg ES256
+	cose.int(-1).int(1)   // crv P-256
+	cose.int(-2).bytes(x) // x
+	cose.int(-3).bytes(y) // y
+
+	authData := a.authData(c, flagAttestedData)
+	authData = append(authData, make([]byte, 16)...) // aaguid, zero for none attestation
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(id)))
+	authData = append(authData, id...)
+	authData = append(authData, cose...)
+
+	var object encoder
+	object.head(5, 3)
+	object.text("fmt").text("none")
+	object.text("attStmt").head(5, 0)
+	object.text("authData").bytes(authData)
+
+	resp := &webauthn.RegistrationResponse{ID: encode(id), RawID: encode(id), Type: "public-key"}
+	resp.Response.ClientDataJSON = encode(a.clientData("webauthn.create", opts.Challenge))
+	resp.Response.AttestationObject = encode(object)
+	resp.Response.Transports = []string{"internal", "hybrid"}
+
+	return resp, nil
+}
+
+// Get answers navigator.credentials.get, using the first credential for the site that is allowed
+func (a *Authenticator) Get(opts *webauthn.RequestOptions) (*webauthn.AssertionResponse, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var c *credential
+	for _, cand := range a.credentials {
+		if cand.rpID != opts.RPID {
+			continue
+		}
+		if len(opts.AllowCredentials) == 0 || slices.ContainsFunc(opts.AllowCredentials, func(d webauthn.CredentialDescriptor) bool {
+			return d.ID == encode(cand.id)
+		}) {
+			c = cand
+			break
+		}
+	}
+	if c == nil {
+		return nil, errors.New("no credential for this site")
+	}
+
+	if a.Counter {
+		c.signCount++
+	}
+
+	authData := a.authData(c, 0)
+	clientData := a.clientData("webauthn.get", opts.Challenge)
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData[:len(authData):len(authData)], clientHash[:]...))
+
+	sig, err := ecdsa.SignASN1(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &webauthn.AssertionResponse{ID: encode(c.id), RawID: encode(c.id), Type: "public-key"}
+	resp.Response.ClientDataJSON = encode(clientData)
+	resp.Response.AuthenticatorData = encode(authData)
+	resp.Response.Signature = encode(sig)
+	resp.Response.UserHandle = encode(c.userHandle)
+
+	return resp, nil
+}
+
+// CredentialIDs returns the ids of the passkeys the authenticator holds
+func (a *Authenticator) CredentialIDs() [][]byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ids := make([][]byte, 0, len(a.credentials))
+	for _, c := range a.credentials {
+		ids = append(ids, c.id)
+	}
+	return ids
+}
+
+const (
+	flagUserPresent    = 0x01
+	flagUserVerified   = 0x04
+	flagBackupEligible = 0x08
+	flagAttestedData   = 0x40
+)
+
+func (a *Authenticator) authData(c *credential, extra byte) []byte {
+	rpHash := sha256.Sum256([]byte(c.rpID))
+
+	flags := flagUserPresent | extra
+	if !a.SkipVerification {
+		flags |= flagUserVerified
+	}
+	if !a.Counter {
+		// a counter of zero is what synced passkeys report
+		flags |= flagBackupEligible
+	}
+
+	data := append([]byte(nil), rpHash[:]...)
+	data = append(data, flags)
+	return binary.BigEndian.AppendUint32(data, c.signCount)
+}
+
+func (a *Authenticator) clientData(ceremony, challenge string) []byte {
+	b, _ := json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return b
+}
+
+// encoder writes the little CBOR an authenticator needs
+type encoder []byte
+
+func (e *encoder) head(major byte, n uint64) *encoder {
+	switch {
+	case n < 24:
+		*e = append(*e, major<<5|byte(n))
+	case n <= 0xff:
+		*e = append(*e, major<<5|24, byte(n))
+	case n <= 0xffff:
+		*e = binary.BigEndian.AppendUint16(append(*e, major<<5|25), uint16(n))
+	default:
+		*e = binary.BigEndian.AppendUint32(append(*e, major<<5|26), uint32(n))
+	}
+	return e
+}
+
+func (e *encoder) int(n int64) *encoder {
+	if n < 0 {
+		return e.head(1, uint64(-1-n))
+	}
+	return e.head(0, uint64(n))
+}
+
+func (e *encoder) bytes(b []byte) *encoder {
+	e.head(2, uint64(len(b)))
+	*e = append(*e, b...)
+	return e
+}
+
+func (e *encoder) text(s string) *encoder {
+	e.head(3, uint64(len(s)))
+	*e = append(*e, s...)
+	return e
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64url: %w", err)
+	}
+	return b, nil
+}